@@ -0,0 +1,84 @@
+// Command bench-check gates a go test -bench run of pkg/bench against a saved
+// baseline, exiting 2 if ns/op or allocs/op grew more than --max-regression
+// percent, or calls/op grew at all. It is a development tool and is not
+// released.
+//
+//	go test -run '^$' -bench . -count 6 ./pkg/bench/ > new.txt
+//	go run ./cmd/bench-check --baseline old.txt new.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"secrets-lister/pkg/bench"
+	"secrets-lister/pkg/render"
+)
+
+func main() {
+	baseline := flag.String("baseline", "", "Saved go test -bench output to compare against (required)")
+	maxRegression := flag.Float64("max-regression", 10, "The percent ns/op and allocs/op may grow before failing (calls/op may not grow)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bench-check --baseline old.txt [--max-regression 10] new.txt")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *baseline == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	baselineResults, err := readResults(*baseline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading baseline: %v\n", err)
+		os.Exit(1)
+	}
+	results, err := readResults(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading results: %v\n", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no benchmark results in %s\n", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	deltas := bench.Compare(baselineResults, results, *maxRegression/100)
+	headers := []string{"Benchmark", "Metric", "Baseline", "Current", "Change", "Regressed"}
+	var rows [][]string
+	regressions := 0
+	for _, delta := range deltas {
+		regressed := "-"
+		if delta.Regressed {
+			regressed = "YES"
+			regressions++
+		}
+		rows = append(rows, []string{
+			delta.Name,
+			delta.Unit,
+			strconv.FormatFloat(delta.Old, 'f', -1, 64),
+			strconv.FormatFloat(delta.New, 'f', -1, 64),
+			fmt.Sprintf("%+.1f%%", delta.Change*100),
+			regressed,
+		})
+	}
+	render.Table(os.Stdout, headers, rows)
+	if len(deltas) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: no benchmarks in common with the baseline")
+	}
+	if regressions > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d metric(s) regressed more than %.0f%% against %s\n", regressions, *maxRegression, *baseline)
+		os.Exit(2)
+	}
+}
+
+func readResults(path string) ([]bench.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return bench.Parse(f)
+}
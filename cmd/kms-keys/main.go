@@ -0,0 +1,4718 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"secrets-lister/pkg/accessdenied"
+	"secrets-lister/pkg/awsconfig"
+	"secrets-lister/pkg/awserr"
+	"secrets-lister/pkg/browse"
+	"secrets-lister/pkg/config"
+	"secrets-lister/pkg/console"
+	"secrets-lister/pkg/degrade"
+	"secrets-lister/pkg/enccontext"
+	"secrets-lister/pkg/identity"
+	"secrets-lister/pkg/keypolicy"
+	"secrets-lister/pkg/kmsinv"
+	"secrets-lister/pkg/manifest"
+	"secrets-lister/pkg/metrics"
+	"secrets-lister/pkg/pricing"
+	"secrets-lister/pkg/progress"
+	"secrets-lister/pkg/regions"
+	"secrets-lister/pkg/render"
+	"secrets-lister/pkg/scanner"
+	"secrets-lister/pkg/secretsinv"
+	"secrets-lister/pkg/selfupdate"
+	"secrets-lister/pkg/snapshot"
+	"secrets-lister/pkg/sqlitestore"
+	"secrets-lister/pkg/tagindex"
+	"secrets-lister/pkg/tagpolicy"
+	"secrets-lister/pkg/telemetry"
+	"secrets-lister/pkg/throttle"
+	"secrets-lister/pkg/version"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	secretsmanagertypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Date format for display
+const dateFormat = "2006-01-02 15:04:05"
+
+type KeyInfo struct {
+	KeyID          string    `json:"key_id"`
+	Region         string    `json:"region"`
+	Aliases        []string  `json:"aliases"`
+	Status         string    `json:"status"`
+	CreationDate   time.Time `json:"creation_date"`
+	KeyType        string    `json:"key_type"`
+	KeyManager     string    `json:"key_manager,omitempty"`
+	AWSService     string    `json:"aws_service,omitempty"`
+	Origin         string    `json:"origin,omitempty"`
+	MultiRegion    string    `json:"multi_region,omitempty"`
+	PrimaryRegion  string    `json:"primary_region,omitempty"`
+	ReplicaRegions []string  `json:"replica_regions,omitempty"`
+	// Unknown lists the degrade features that could not be read for the key
+	Unknown            []string          `json:"unknown,omitempty"`
+	RotationStatus     string            `json:"rotation_status,omitempty"`
+	RotationPeriodDays int32             `json:"rotation_period_days,omitempty"`
+	DeletionDate       *time.Time        `json:"deletion_date,omitempty"`
+	DaysUntilDeletion  *int              `json:"days_until_deletion,omitempty"`
+	ImminentDeletion   bool              `json:"imminent_deletion,omitempty"`
+	Tags               map[string]string `json:"tags"`
+	MissingTags        []string          `json:"missing_tags,omitempty"`
+	Policy             json.RawMessage   `json:"policy,omitempty"`
+	LockoutBypass      *LockoutBypass    `json:"lockout_bypass,omitempty"`
+	MonthlyCost        *float64          `json:"estimated_monthly_cost_usd,omitempty"`
+	CostBasis          string            `json:"cost_basis,omitempty"`
+	ErrorReason        string            `json:"error_reason,omitempty"`
+	Error              string            `json:"error,omitempty"`
+}
+
+// LockoutBypass is the most recent CreateKey or PutKeyPolicy call for a key
+// that set BypassPolicyLockoutSafetyCheck.
+type LockoutBypass struct {
+	EventName string    `json:"event_name"`
+	EventTime time.Time `json:"event_time"`
+	Principal string    `json:"principal"`
+}
+
+type GrantInfo struct {
+	KeyID                   string            `json:"key_id"`
+	GrantID                 string            `json:"grant_id"`
+	GrantName               string            `json:"grant_name,omitempty"`
+	GranteePrincipal        string            `json:"grantee_principal"`
+	RetiringPrincipal       string            `json:"retiring_principal,omitempty"`
+	IssuingAccount          string            `json:"issuing_account"`
+	Operations              []string          `json:"operations"`
+	EncryptionContextSubset map[string]string `json:"encryption_context_subset,omitempty"`
+	EncryptionContextEquals map[string]string `json:"encryption_context_equals,omitempty"`
+	CreationDate            time.Time         `json:"creation_date"`
+}
+
+type GrantRecord struct {
+	KeyID                   string            `parquet:"name=key_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	GrantID                 string            `parquet:"name=grant_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	GrantName               *string           `parquet:"name=grant_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	GranteePrincipal        string            `parquet:"name=grantee_principal, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	RetiringPrincipal       *string           `parquet:"name=retiring_principal, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IssuingAccount          string            `parquet:"name=issuing_account, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Operations              []string          `parquet:"name=operations, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	EncryptionContextSubset map[string]string `parquet:"name=encryption_context_subset, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	EncryptionContextEquals map[string]string `parquet:"name=encryption_context_equals, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	CreationDate            *int64            `parquet:"name=creation_date, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+// KeyRecord is one key in --format parquet.
+type KeyRecord struct {
+	KeyID              string            `parquet:"name=key_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Region             string            `parquet:"name=region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Aliases            []string          `parquet:"name=aliases, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Status             string            `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CreationDate       *int64            `parquet:"name=creation_date, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	KeyType            string            `parquet:"name=key_type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	KeyManager         *string           `parquet:"name=key_manager, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	AWSService         *string           `parquet:"name=aws_service, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Origin             *string           `parquet:"name=origin, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	MultiRegion        *string           `parquet:"name=multi_region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PrimaryRegion      *string           `parquet:"name=primary_region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ReplicaRegions     []string          `parquet:"name=replica_regions, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	RotationStatus     *string           `parquet:"name=rotation_status, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	RotationPeriodDays *int32            `parquet:"name=rotation_period_days, type=INT32"`
+	DeletionDate       *int64            `parquet:"name=deletion_date, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Tags               map[string]string `parquet:"name=tags, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	MissingTags        []string          `parquet:"name=missing_tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	// Policy is the key policy as compact JSON, with --include-policies
+	Policy      *string  `parquet:"name=policy, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MonthlyCost *float64 `parquet:"name=estimated_monthly_cost_usd, type=DOUBLE"`
+	ErrorReason *string  `parquet:"name=error_reason, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Unknown     []string `parquet:"name=unknown, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+type GrantReport struct {
+	Grants            []GrantInfo `json:"grants"`
+	NotAuthorizedKeys []string    `json:"not_authorized_keys"`
+}
+
+type MigrationState struct {
+	SourceKeyID        string              `json:"source_key_id"`
+	SourceKeyArn       string              `json:"source_key_arn"`
+	CustomKeyStoreID   string              `json:"custom_key_store_id"`
+	CustomKeyStoreType string              `json:"custom_key_store_type"`
+	XksKeyID           string              `json:"xks_key_id,omitempty"`
+	TargetKeyID        string              `json:"target_key_id,omitempty"`
+	TargetKeyArn       string              `json:"target_key_arn,omitempty"`
+	StartedAt          *time.Time          `json:"started_at,omitempty"`
+	TagsMirrored       int                 `json:"tags_mirrored"`
+	PolicyMirrored     bool                `json:"policy_mirrored"`
+	GrantsMirrored     int                 `json:"grants_mirrored"`
+	GrantsFailed       []string            `json:"grants_failed,omitempty"`
+	Aliases            []string            `json:"aliases"`
+	Resources          []MigrationResource `json:"resources"`
+	// ToolVersion is the build that last wrote the state file
+	ToolVersion string `json:"tool_version,omitempty"`
+}
+
+type MigrationResource struct {
+	Service    string `json:"service"`
+	ResourceID string `json:"resource_id"`
+	Name       string `json:"name"`
+	Action     string `json:"action"`
+}
+
+// awsOptions is how every command connects: profile, region, endpoint, role,
+// and the tuning of the HTTP client and retries shared by all its AWS clients
+var awsOptions = awsconfig.Defaults()
+
+// usage records the run for users who opt in to telemetry; exit sends it
+var (
+	telemetryOptions = telemetry.Defaults()
+	usage            *telemetry.Recorder
+)
+
+// finishRun, when a command sets it, completes the run's manifest on exit and
+// returns the code to exit with instead
+var finishRun func(code int) int
+
+func exit(code int) {
+	if finishRun != nil {
+		code = finishRun(code)
+	}
+	usage.Finish(code)
+	os.Exit(code)
+}
+
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type KeyUsage struct {
+	KeyID         string     `json:"key_id"`
+	Aliases       []string   `json:"aliases"`
+	Status        string     `json:"status"`
+	LastUsed      *time.Time `json:"last_used,omitempty"`
+	LastOperation string     `json:"last_operation,omitempty"`
+	LastPrincipal string     `json:"last_principal,omitempty"`
+	Unused        bool       `json:"unused"`
+	// New is set for a key created inside the lookback window with no use
+	// yet; it isn't counted as unused
+	New     bool     `json:"new,omitempty"`
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// DeletionCandidate is one key in a schedule-deletion run: what still
+// depends on it, and what was done.
+type DeletionCandidate struct {
+	KeyID         string     `json:"key_id"`
+	KeyArn        string     `json:"key_arn,omitempty"`
+	Aliases       []string   `json:"aliases,omitempty"`
+	Status        string     `json:"status"`
+	LastUsed      *time.Time `json:"last_used,omitempty"`
+	LastOperation string     `json:"last_operation,omitempty"`
+	LastPrincipal string     `json:"last_principal,omitempty"`
+	Secrets       []string   `json:"secrets,omitempty"`
+	Grants        int        `json:"grants"`
+	// Replicas are the regions a multi-Region primary key is replicated to
+	Replicas []string `json:"replicas,omitempty"`
+	// Blockers are the reasons not to delete the key; checks that could not
+	// run are blockers too
+	Blockers     []string   `json:"blockers,omitempty"`
+	Action       string     `json:"action"`
+	DeletionDate *time.Time `json:"deletion_date,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// schedule-deletion actions.
+const (
+	actionWouldSchedule  = "would_schedule"
+	actionScheduled      = "scheduled"
+	actionBlocked        = "blocked"
+	actionAlreadyPending = "already_pending"
+	actionNotDeletable   = "not_deletable"
+	actionFailed         = "failed"
+)
+
+type KeyReport struct {
+	EnabledKeys          []KeyInfo         `json:"enabled_keys"`
+	PendingDeletionKeys  []KeyInfo         `json:"pending_deletion_keys"`
+	NotAuthorizedKeys    []KeyInfo         `json:"not_authorized_keys"`
+	FailedKeys           []KeyInfo         `json:"failed_keys,omitempty"`
+	RotationNonCompliant []KeyInfo         `json:"rotation_non_compliant,omitempty"`
+	MissingRequiredTags  []KeyInfo         `json:"missing_required_tags,omitempty"`
+	LockoutBypassed      []KeyInfo         `json:"lockout_bypassed,omitempty"`
+	Drift                []snapshot.Change `json:"drift,omitempty"`
+	// Degraded lists optional calls that failed, and what is unknown as a result
+	Degraded []degrade.Degradation `json:"degraded,omitempty"`
+}
+
+// commands are the kms-keys subcommands; with none of them it lists keys
+var commands = map[string]func(args []string){
+	"grants":             runGrants,
+	"migrate":            runMigrate,
+	"policy":             runPolicy,
+	"policy-audit":       runPolicyAudit,
+	"explain-denied":     runExplainDenied,
+	"usage":              runUsage,
+	"encryption-context": runEncryptionContext,
+	"schedule-deletion":  runScheduleDeletion,
+	"create-key":         runCreateKey,
+	"protect":            runProtect,
+	"version":            runVersion,
+	"self-update":        runSelfUpdate,
+	"scan":               runScan,
+}
+
+func main() {
+	name, command, args := "list", runList, os.Args[1:]
+	if len(args) > 0 {
+		if subcommand, ok := commands[args[0]]; ok {
+			name, command, args = args[0], subcommand, args[1:]
+		}
+	}
+
+	usage = telemetry.Start(&telemetryOptions, "kms-keys", name)
+	command(args)
+	exit(0)
+}
+
+// listOptions are the flags of the list command, and what validate parses
+// out of them.
+type listOptions struct {
+	regionList         string
+	excludeRegions     string
+	format             string
+	outputPath         string
+	filterAlias        string
+	requireRotation    bool
+	warnWithinDays     int
+	includePolicies    bool
+	policyDir          string
+	filterTags         stringSliceFlag
+	withCost           bool
+	costByTag          string
+	limit              int
+	sample             int
+	manifestPath       string
+	snapshotOut        string
+	diffAgainst        string
+	checkLockoutBypass bool
+	scopes             stringSliceFlag
+	taggingAPI         bool
+	requiredTagsList   string
+	keyManager         string
+	offline            string
+	interactive        bool
+	progressMode       *string
+
+	tagFilters   []tagpolicy.Filter
+	requiredTags []string
+	scope        kmsinv.Scope
+	// maxKeys is where --limit or --sample stops the scan
+	maxKeys int
+}
+
+func (o *listOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.regionList, "regions", "", "Comma-separated regions to scan, or 'all' for every enabled region (default: --region)")
+	fs.StringVar(&o.excludeRegions, "exclude-regions", "", "Comma-separated regions to skip (e.g. regions blocked by SCPs)")
+	fs.StringVar(&o.format, "format", "table", "Output format: table, json, csv (one row per key), html (a self-contained report with sortable tables), sqlite, or parquet")
+	fs.StringVar(&o.outputPath, "output", "", "SQLite database to append the scan to (default inventory.db), or parquet file to write (default keys.parquet)")
+	fs.StringVar(&o.filterAlias, "filter-alias", "", "Only include keys with an alias matching this glob (e.g. 'alias/prod-*')")
+	fs.BoolVar(&o.requireRotation, "require-rotation", false, "Exit non-zero if any enabled symmetric key lacks automatic rotation")
+	fs.IntVar(&o.warnWithinDays, "warn-within-days", 0, "Highlight keys scheduled for deletion within N days and exit non-zero if any")
+	fs.BoolVar(&o.includePolicies, "include-policies", false, "Fetch each key's policy document and include it in JSON output")
+	fs.StringVar(&o.policyDir, "policy-dir", "", "Write one <region>/<key-id>.json policy file per key under this directory (implies --include-policies)")
+	fs.Var(&o.filterTags, "filter-tag", "Only include keys with this tag, as Key=Value or Key (repeatable)")
+	fs.BoolVar(&o.withCost, "with-cost", false, "Estimate the monthly cost of each key from the built-in price table")
+	fs.StringVar(&o.costByTag, "cost-by-tag", "", "With --with-cost, subtotal the estimate by this tag key (e.g. Team)")
+	fs.IntVar(&o.limit, "limit", 0, "Stop after scanning N keys (quick smoke tests)")
+	fs.IntVar(&o.sample, "sample", 0, "Scan a random sample of N keys instead of all of them, taken from the first regions until N are found (not spread evenly across regions)")
+	fs.StringVar(&o.manifestPath, "manifest", "", "Write a JSON run manifest (caller, regions, counts, errors, artifact hashes) to this file")
+	fs.StringVar(&o.snapshotOut, "snapshot", "", "Write the inventory to this snapshot file for a later --diff-against")
+	fs.StringVar(&o.diffAgainst, "diff-against", "", "Compare the inventory with a previous snapshot and exit non-zero on drift")
+	fs.BoolVar(&o.checkLockoutBypass, "check-lockout-bypass", false, "Flag keys whose policy lockout safety check was bypassed (CloudTrail CreateKey/PutKeyPolicy, last 90 days)")
+	fs.Var(&o.scopes, "scope", "Restrict the scan before keys are described: alias-prefix:<prefix> or tag:Key=Value (repeatable, all must match)")
+	fs.BoolVar(&o.taggingAPI, "tagging-api", false, "Find keys for tag: scopes and --filter-tag with the Resource Groups Tagging API instead of reading every key's tags")
+	fs.StringVar(&o.requiredTagsList, "required-tags", "", "Comma-separated tag keys every enabled key must have; exit non-zero if any are missing")
+	fs.StringVar(&o.keyManager, "key-manager", kmsinv.ManagerCustomer, "Which keys to list: customer, aws (AWS managed), or all")
+	fs.StringVar(&o.offline, "offline", "", "Build the report from this --snapshot file instead of calling AWS (no credentials needed)")
+	fs.BoolVar(&o.interactive, "interactive", false, "Browse the keys, with their policies, in a searchable terminal view instead of printing the report")
+	o.progressMode = progress.RegisterFlag(fs)
+}
+
+// validate checks the flags against each other and parses the ones with a
+// syntax of their own.
+func (o *listOptions) validate() error {
+	var err error
+	if o.tagFilters, err = tagpolicy.ParseFilters(o.filterTags); err != nil {
+		return err
+	}
+	o.requiredTags = tagpolicy.ParseRequired(o.requiredTagsList)
+
+	if o.scope, err = kmsinv.ParseScope(o.scopes); err != nil {
+		return err
+	}
+	if o.scope.KeyManager, err = kmsinv.ParseKeyManager(o.keyManager); err != nil {
+		return err
+	}
+
+	if err := progress.Validate(*o.progressMode); err != nil {
+		return err
+	}
+
+	if o.limit > 0 && o.sample > 0 {
+		return errors.New("--limit and --sample are mutually exclusive")
+	}
+	// A partial scan would be drift against every key it didn't reach
+	if (o.limit > 0 || o.sample > 0) && (o.snapshotOut != "" || o.diffAgainst != "") {
+		return errors.New("--limit and --sample can't be used with --snapshot or --diff-against")
+	}
+	o.maxKeys = o.limit
+	if o.sample > 0 {
+		o.maxKeys = o.sample
+		o.scope.Shuffle = true
+	}
+
+	if o.interactive {
+		if err := browse.Available(); err != nil {
+			return err
+		}
+		// The detail pane shows each key's policy
+		o.includePolicies = true
+	}
+	if o.policyDir != "" {
+		o.includePolicies = true
+	}
+
+	if o.format != "table" && o.format != "json" && o.format != "csv" && o.format != "html" && o.format != "sqlite" && o.format != "parquet" {
+		return fmt.Errorf("unsupported format %q (use table, json, csv, html, sqlite, or parquet)", o.format)
+	}
+	if o.outputPath == "" {
+		o.outputPath = "inventory.db"
+		if o.format == "parquet" {
+			o.outputPath = "keys.parquet"
+		}
+	}
+
+	if o.filterAlias != "" {
+		if _, err := path.Match(o.filterAlias, ""); err != nil {
+			return fmt.Errorf("invalid --filter-alias pattern %q: %v", o.filterAlias, err)
+		}
+	}
+
+	// These change what is read from AWS, which a snapshot can't redo
+	if o.offline != "" && (len(o.scopes) > 0 || o.taggingAPI || o.limit > 0 || o.sample > 0 || o.policyDir != "") {
+		return errors.New("--scope, --tagging-api, --limit, --sample, and --policy-dir can't be used with --offline")
+	}
+
+	// Drift compares whole inventories; a filtered one would report every
+	// key it left out as removed
+	if o.diffAgainst != "" && (len(o.scopes) > 0 || len(o.filterTags) > 0 || o.filterAlias != "") {
+		return errors.New("--scope, --filter-tag, and --filter-alias can't be used with --diff-against")
+	}
+	return nil
+}
+
+// showManager is whether to show the Key Manager column, which only matters
+// when AWS managed keys can be listed
+func (o *listOptions) showManager() bool {
+	return o.scope.KeyManager != kmsinv.ManagerCustomer
+}
+
+// runList lists the keys in every region scanned, which is what kms-keys
+// does without a subcommand.
+func runList(args []string) {
+	fs := flag.NewFlagSet("kms-keys", flag.ExitOnError)
+	opts := &listOptions{}
+	opts.register(fs)
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	run := manifest.New("kms-keys")
+	// Optional calls that fail are summarised once at the end instead of per key
+	degraded := degrade.NewTracker()
+	// Every exit from here on, including early errors, finishes the manifest
+	// with the real exit code once the outputs it hashes are written
+	finishRun = func(code int) int {
+		for _, warning := range degraded.Warnings() {
+			run.Warnf("%s", warning)
+		}
+		if opts.manifestPath != "" {
+			if err := run.Write(opts.manifestPath, code); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+				return 1
+			}
+		}
+		return code
+	}
+
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if opts.policyDir != "" {
+		if err := os.MkdirAll(opts.policyDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating policy directory: %v\n", err)
+			exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	listing := &keyListing{tagKeys: make(map[string]bool)}
+
+	var cfg aws.Config
+	var skippedRegions []regions.Skipped
+	var offlineKeys []KeyInfo
+	var err error
+	if opts.offline != "" {
+		listing.offline, offlineKeys, err = readKeySnapshot(opts.offline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading snapshot: %v\n", err)
+			exit(1)
+		}
+		listing.scanRegions = regions.Select(snapshotRegions(listing.offline), regions.Parse(opts.regionList), regions.Parse(opts.excludeRegions))
+	} else {
+		// Load AWS configuration with SSO support
+		cfg, err = awsOptions.Load(ctx)
+		if err != nil {
+			usage.Error(err)
+			fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+			exit(1)
+		}
+
+		listing.scanRegions, skippedRegions, err = regions.Resolve(ctx, cfg, regions.Parse(opts.regionList), regions.Parse(opts.excludeRegions))
+		if errors.Is(err, regions.ErrOptInUnknown) {
+			degraded.Record(degrade.Regions, err)
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving regions: %v\n", err)
+			exit(1)
+		}
+	}
+	listing.scanning = make(map[string]bool)
+	for _, scanRegion := range listing.scanRegions {
+		listing.scanning[scanRegion] = true
+	}
+
+	run.Regions = listing.scanRegions
+	for _, skipped := range skippedRegions {
+		run.Errors = append(run.Errors, fmt.Sprintf("skipped region %s: %s", skipped.Region, skipped.Reason))
+	}
+
+	listing.account = degrade.Unknown
+	if opts.offline == "" {
+		listing.caller, err = identity.Lookup(ctx, cfg)
+		degraded.Record(degrade.Caller, err)
+		run.Caller = listing.caller
+		if listing.caller != nil {
+			listing.account = listing.caller.Account
+		}
+	} else if listing.offline.Account != "" {
+		listing.account = listing.offline.Account
+	}
+
+	// Display configuration being used (stderr for JSON and HTML so stdout stays parseable)
+	banner := os.Stdout
+	if opts.format != "table" {
+		banner = os.Stderr
+	}
+	if opts.offline != "" {
+		fmt.Fprintf(banner, "Offline: %s (taken %s, account %s)\n", opts.offline, listing.offline.TakenAt.Format(time.RFC3339), render.ValueOrDash(listing.offline.Account))
+		fmt.Fprintf(banner, "Using Region:  %s\n", strings.Join(listing.scanRegions, ", "))
+	} else {
+		identity.Banner(banner, awsOptions.Profile, listing.caller, listing.scanRegions)
+	}
+	for _, skipped := range skippedRegions {
+		fmt.Fprintf(banner, "Skipping Region: %s (%s)\n", skipped.Region, skipped.Reason)
+	}
+	fmt.Fprintln(banner)
+
+	if opts.offline != "" {
+		listing.fileOffline(opts, offlineKeys)
+	} else {
+		listing.scan(ctx, cfg, opts, run, degraded)
+	}
+	listing.finish(opts)
+	listing.compareSnapshots(opts, run)
+
+	run.Counts["keys"] = listing.matched
+	run.Counts["enabled"] = len(listing.enabled)
+	run.Counts["pending_deletion"] = len(listing.pendingDeletion)
+	run.Counts["not_authorized"] = len(listing.notAuthorized)
+	run.Counts["failed"] = len(listing.failed)
+	run.Counts["rotation_non_compliant"] = len(listing.rotationNonCompliant)
+	run.Counts["missing_tags"] = len(listing.missingTags)
+	run.Counts["drift"] = len(listing.drift)
+	run.Counts["merged_replicas"] = listing.mergedReplicas
+
+	switch {
+	case opts.interactive:
+		items := make([]browse.Item, 0, len(listing.scanned))
+		for _, key := range listing.scanned {
+			items = append(items, keyBrowseItem(key))
+		}
+		if err := browse.Run(fmt.Sprintf("%s in %s", keyManagerLabel(opts.scope.KeyManager), strings.Join(listing.scanRegions, ", ")), items); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+	case opts.format == "json":
+		if err := render.JSON(os.Stdout, listing.report(degraded)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+
+	case opts.format == "csv":
+		headers, rows := keyCSVRows(listing.scanned, listing.sortedTagKeys, opts.showManager(), opts.withCost, opts.includePolicies)
+		if err := writeCSV(os.Stdout, headers, rows); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+			exit(1)
+		}
+
+	case opts.format == "parquet":
+		if err := writeKeysParquet(opts.outputPath, listing.scanned); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing parquet: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d keys to %s\n", len(listing.scanned), opts.outputPath)
+		if err := run.AddFile(opts.outputPath); err != nil {
+			run.Warnf("Could not hash %s: %v", opts.outputPath, err)
+		}
+
+	case opts.format == "sqlite":
+		scan := sqlitestore.Scan{Tool: "kms-keys", Account: listing.account, Regions: listing.scanRegions, Grants: listing.grants}
+		for _, key := range listing.scanned {
+			scan.Keys = append(scan.Keys, sqliteKey(key))
+		}
+		scanID, err := sqlitestore.Append(ctx, opts.outputPath, scan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing SQLite: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Appended %d keys and %d grants to %s (scan %d)\n", len(scan.Keys), len(listing.grants), opts.outputPath, scanID)
+		if err := run.AddFile(opts.outputPath); err != nil {
+			run.Warnf("Could not hash %s: %v", opts.outputPath, err)
+		}
+
+	case opts.format == "html":
+		if err := render.HTML(os.Stdout, listing.htmlReport(opts, degraded)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing HTML: %v\n", err)
+			exit(1)
+		}
+
+	default:
+		listing.print(opts)
+	}
+
+	if listing.checksFailed() {
+		exit(2)
+	}
+	exit(0)
+}
+
+// keyListing is what the list command found: the keys filed by state, and
+// the regions and account they came from.
+type keyListing struct {
+	scanRegions []string
+	// scanning is scanRegions as a set
+	scanning map[string]bool
+	// listedRegions are the regions whose keys were all listed, which the
+	// snapshot records so a failed region isn't reported as drift
+	listedRegions []string
+	account       string
+	caller        *identity.Caller
+	// offline is the snapshot an --offline report is built from
+	offline snapshot.Snapshot
+
+	enabled              []KeyInfo
+	pendingDeletion      []KeyInfo
+	notAuthorized        []KeyInfo
+	failed               []KeyInfo
+	missingTags          []KeyInfo
+	lockoutBypassed      []KeyInfo
+	rotationNonCompliant []KeyInfo
+	scanned              []KeyInfo
+	grants               []sqlitestore.Grant
+	tagKeys              map[string]bool
+	sortedTagKeys        []string
+	drift                []snapshot.Change
+
+	imminentDeletions int
+	matched           int
+	mergedReplicas    int
+}
+
+func (l *keyListing) multiRegion() bool {
+	return len(l.scanRegions) > 1
+}
+
+// record files a key that is in the report under the lists it belongs to
+func (l *keyListing) record(keyInfo KeyInfo, opts *listOptions) {
+	awsManaged := keyInfo.KeyManager == string(types.KeyManagerTypeAws)
+	if keyInfo.LockoutBypass != nil {
+		l.lockoutBypassed = append(l.lockoutBypassed, keyInfo)
+	}
+	l.scanned = append(l.scanned, keyInfo)
+
+	if keyInfo.Status == "Not Authorized" {
+		usage.Class(awserr.NotAuthorized)
+		l.notAuthorized = append(l.notAuthorized, keyInfo)
+	} else if keyInfo.Status == kmsinv.Failed {
+		usage.Class(awserr.Class(keyInfo.ErrorReason))
+		l.failed = append(l.failed, keyInfo)
+	} else if keyInfo.Status == "Enabled" {
+		// AWS managed keys can't be tagged, so they are exempt
+		if len(opts.requiredTags) > 0 && !awsManaged && !keyInfo.isUnknown(degrade.Tags) {
+			keyInfo.MissingTags = tagpolicy.Missing(keyInfo.Tags, opts.requiredTags)
+			if len(keyInfo.MissingTags) > 0 {
+				l.missingTags = append(l.missingTags, keyInfo)
+			}
+		}
+		l.enabled = append(l.enabled, keyInfo)
+		for tagKey := range keyInfo.Tags {
+			l.tagKeys[tagKey] = true
+		}
+	} else if keyInfo.Status == string(types.KeyStatePendingDeletion) {
+		if opts.warnWithinDays > 0 && keyInfo.DaysUntilDeletion != nil && *keyInfo.DaysUntilDeletion <= opts.warnWithinDays {
+			keyInfo.ImminentDeletion = true
+			l.imminentDeletions++
+		}
+		l.pendingDeletion = append(l.pendingDeletion, keyInfo)
+	}
+}
+
+// scan lists and describes the keys in every region. --sample shuffles
+// within a region and takes what it still needs from each region in turn,
+// so the first regions fill most of the sample.
+func (l *keyListing) scan(ctx context.Context, cfg aws.Config, opts *listOptions, run *manifest.Manifest, degraded *degrade.Tracker) {
+	bar := progress.New(*opts.progressMode, awsOptions.Log.Enabled())
+	scope := opts.scope
+	scanned := 0
+	for i, scanRegion := range l.scanRegions {
+		if opts.maxKeys > 0 {
+			if scanned >= opts.maxKeys {
+				break
+			}
+			scope.Limit = opts.maxKeys - scanned
+		}
+
+		label := fmt.Sprintf("Scanning %s (account %s)", scanRegion, l.account)
+		if l.multiRegion() {
+			label = fmt.Sprintf("[%d/%d] %s", i+1, len(l.scanRegions), label)
+		}
+
+		// With several regions one failing region shouldn't stop the scan
+		listed, err := l.scanRegion(ctx, cfg, opts, scope, scanRegion, label, bar, run, degraded)
+		if err != nil {
+			if l.multiRegion() {
+				run.Warnf("Could not list keys in %s: %v", scanRegion, err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Error listing keys: %v\n", err)
+			exit(1)
+		}
+		scanned += listed
+		l.listedRegions = append(l.listedRegions, scanRegion)
+	}
+	bar.Clear()
+}
+
+// scanRegion lists the keys in scope in one region and files the ones that
+// match. It returns how many keys were listed, or why they couldn't be.
+func (l *keyListing) scanRegion(ctx context.Context, cfg aws.Config, opts *listOptions, scope kmsinv.Scope, scanRegion, label string, bar *progress.Bar, run *manifest.Manifest, degraded *degrade.Tracker) (int, error) {
+	client := kms.NewFromConfig(cfg, func(o *kms.Options) {
+		o.Region = scanRegion
+	})
+	// Keys are described once while filtering and reused for their details
+	inventory := kmsinv.NewCache(client)
+
+	// Build keyID -> aliases index with a single ListAliases pass
+	aliasIndex, err := kmsinv.AliasesByKey(ctx, client)
+	aliasesUnknown := err != nil
+	if err != nil {
+		if opts.filterAlias != "" || len(scope.AliasPrefixes) > 0 {
+			fmt.Fprintf(os.Stderr, "Error listing aliases: %v\n", err)
+			exit(1)
+		}
+		degraded.Record(degrade.Aliases, err)
+	}
+
+	// The tagging API returns only the matching keys, with their tags, a
+	// hundred per call
+	if opts.taggingAPI && len(scope.TagFilters)+len(opts.tagFilters) > 0 {
+		tagging := resourcegroupstaggingapi.NewFromConfig(cfg, func(o *resourcegroupstaggingapi.Options) {
+			o.Region = scanRegion
+		})
+		resources, err := tagindex.Find(ctx, tagging, tagindex.KMSKey, append(slices.Clone(scope.TagFilters), opts.tagFilters...))
+		if err != nil {
+			run.Warnf("Could not use the tagging API in %s, reading each key's tags instead: %v", scanRegion, err)
+		} else {
+			scope.Tagged = tagindex.KeyTags(resources)
+			inventory.SeedTags(scope.Tagged)
+		}
+	}
+
+	keys, err := kmsinv.ListScoped(ctx, inventory, scope, aliasIndex, degraded)
+	if err != nil {
+		return 0, err
+	}
+	listed := len(keys)
+
+	// Apply alias filter before fetching per-key details
+	if opts.filterAlias != "" {
+		var filtered []types.KeyListEntry
+		for _, key := range keys {
+			if matchesAlias(aliasIndex[*key.KeyId], opts.filterAlias) {
+				filtered = append(filtered, key)
+			}
+		}
+		keys = filtered
+	}
+	slog.Info("listed keys", "region", scanRegion, "keys", len(keys))
+
+	bar.Start(label, len(keys), "keys")
+
+	var bypasses map[string]LockoutBypass
+	if opts.checkLockoutBypass {
+		bypasses, err = findLockoutBypasses(ctx, cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) {
+			o.Region = scanRegion
+		}))
+		degraded.Record(degrade.LockoutBypass, err)
+	}
+
+	for _, key := range keys {
+		keyInfo := getKeyInfo(ctx, inventory, *key.KeyId, degraded)
+		bar.Add(1)
+		keyInfo.Region = scanRegion
+		keyInfo.Aliases = aliasIndex[*key.KeyId]
+		if aliasesUnknown {
+			keyInfo.Unknown = append(keyInfo.Unknown, degrade.Aliases)
+		}
+		if keyInfo.KeyManager == string(types.KeyManagerTypeAws) {
+			keyInfo.AWSService = kmsinv.ManagedService(keyInfo.Aliases)
+		}
+
+		// A multi-Region key is listed once, from its primary, when both are scanned
+		if keyInfo.PrimaryRegion != "" && keyInfo.PrimaryRegion != scanRegion && l.scanning[keyInfo.PrimaryRegion] {
+			l.mergedReplicas++
+			continue
+		}
+
+		// Tags can't be checked for keys we can't describe or tag-list, so they never match a tag filter
+		if len(opts.tagFilters) > 0 && (keyInfo.Status == "Not Authorized" || keyInfo.isUnknown(degrade.Tags) || !tagpolicy.Match(keyInfo.Tags, opts.tagFilters)) {
+			continue
+		}
+		l.matched++
+
+		l.addDetails(ctx, client, opts, &keyInfo, run, degraded)
+		if bypass, ok := bypasses[keyInfo.KeyID]; ok {
+			keyInfo.LockoutBypass = &bypass
+		}
+		l.record(keyInfo, opts)
+	}
+	return listed, nil
+}
+
+// addDetails fetches what the flags ask for beyond DescribeKey: the policy,
+// the cost estimate, and the grants the database keeps.
+func (l *keyListing) addDetails(ctx context.Context, client *kms.Client, opts *listOptions, keyInfo *KeyInfo, run *manifest.Manifest, degraded *degrade.Tracker) {
+	if keyInfo.Status == "Not Authorized" {
+		return
+	}
+
+	if opts.includePolicies {
+		policy, err := getKeyPolicy(ctx, client, keyInfo.KeyID)
+		if err != nil {
+			degraded.Record(degrade.Policy, err)
+			keyInfo.Unknown = append(keyInfo.Unknown, degrade.Policy)
+		} else {
+			keyInfo.Policy = policy
+			if opts.policyDir != "" {
+				// Key IDs are only unique within a region, and a multi-Region
+				// key's replicas share its ID
+				if path, err := writePolicyFile(opts.policyDir, keyInfo.Region, keyInfo.KeyID, policy); err != nil {
+					run.Warnf("Could not write policy for %s: %v", keyInfo.KeyID, err)
+				} else if err := run.AddFile(path); err != nil {
+					run.Warnf("Could not hash policy file for %s: %v", keyInfo.KeyID, err)
+				}
+			}
+		}
+	}
+
+	// AWS managed keys carry no monthly fee
+	if opts.withCost && keyInfo.KeyManager != string(types.KeyManagerTypeAws) {
+		estimateKeyCost(ctx, client, keyInfo, degraded)
+		// Each merged replica is billed as a key of its own
+		if replicas := len(mergedReplicaRegions(*keyInfo, l.scanning)); replicas > 0 && keyInfo.MonthlyCost != nil {
+			*keyInfo.MonthlyCost *= float64(1 + replicas)
+			keyInfo.CostBasis += fmt.Sprintf(", %d replica(s)", replicas)
+		}
+	}
+
+	// The database keeps grants alongside keys, at one ListGrants call per key
+	if opts.format == "sqlite" {
+		grants, err := listKeyGrants(ctx, client, keyInfo.KeyID)
+		if err != nil {
+			degraded.Record(degrade.Grants, err)
+			keyInfo.Unknown = append(keyInfo.Unknown, degrade.Grants)
+		}
+		for _, grant := range grants {
+			l.grants = append(l.grants, sqliteGrant(keyInfo.Region, grant))
+		}
+	}
+}
+
+// fileOffline files the snapshot's keys in the regions asked for, with only
+// the details asked for.
+func (l *keyListing) fileOffline(opts *listOptions, keys []KeyInfo) {
+	for _, scanRegion := range l.scanRegions {
+		if l.offline.Covers(snapshot.Scope("", scanRegion)) {
+			l.listedRegions = append(l.listedRegions, scanRegion)
+		}
+	}
+
+	for _, keyInfo := range keys {
+		if !l.scanning[keyInfo.Region] || !kmsinv.ManagedBy(keyInfo.KeyManager, opts.scope.KeyManager) {
+			continue
+		}
+		if opts.filterAlias != "" && !matchesAlias(keyInfo.Aliases, opts.filterAlias) {
+			continue
+		}
+		if len(opts.tagFilters) > 0 && (keyInfo.Status == "Not Authorized" || keyInfo.isUnknown(degrade.Tags) || !tagpolicy.Match(keyInfo.Tags, opts.tagFilters)) {
+			continue
+		}
+		l.matched++
+
+		// Only report what was asked for, and count down from today rather
+		// than from when the snapshot was taken
+		if !opts.includePolicies {
+			keyInfo.Policy = nil
+		}
+		if !opts.withCost {
+			keyInfo.MonthlyCost, keyInfo.CostBasis = nil, ""
+		}
+		if !opts.checkLockoutBypass {
+			keyInfo.LockoutBypass = nil
+		}
+		keyInfo.MissingTags, keyInfo.ImminentDeletion = nil, false
+		if keyInfo.DeletionDate != nil {
+			daysLeft := int(time.Until(*keyInfo.DeletionDate).Hours() / 24)
+			keyInfo.DaysUntilDeletion = &daysLeft
+		}
+		l.record(keyInfo, opts)
+	}
+}
+
+// finish orders the lists for the report and runs the rotation check
+func (l *keyListing) finish(opts *listOptions) {
+	// Soonest deletions first
+	sort.SliceStable(l.pendingDeletion, func(i, j int) bool {
+		a, b := l.pendingDeletion[i].DeletionDate, l.pendingDeletion[j].DeletionDate
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+
+	// Sort tag keys for consistent column order
+	for tagKey := range l.tagKeys {
+		l.sortedTagKeys = append(l.sortedTagKeys, tagKey)
+	}
+	sort.Strings(l.sortedTagKeys)
+
+	if opts.requireRotation {
+		l.rotationNonCompliant = findRotationNonCompliant(l.enabled)
+	}
+}
+
+// compareSnapshots writes --snapshot and records the drift since
+// --diff-against
+func (l *keyListing) compareSnapshots(opts *listOptions, run *manifest.Manifest) {
+	if opts.snapshotOut == "" && opts.diffAgainst == "" {
+		return
+	}
+	current, err := keySnapshot(l.scanned, l.account, l.listedRegions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building snapshot: %v\n", err)
+		exit(1)
+	}
+	if opts.diffAgainst != "" {
+		previous, err := snapshot.Read(opts.diffAgainst)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading snapshot: %v\n", err)
+			exit(1)
+		}
+		l.drift, err = snapshot.Diff(previous, current)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error comparing snapshots: %v\n", err)
+			exit(1)
+		}
+	}
+	if opts.snapshotOut != "" {
+		if err := snapshot.Write(opts.snapshotOut, current); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing snapshot: %v\n", err)
+			exit(1)
+		}
+		if err := run.AddFile(opts.snapshotOut); err != nil {
+			run.Warnf("Could not hash snapshot: %v", err)
+		}
+	}
+}
+
+// checksFailed is whether a check the flags turned on found something,
+// which exits 2
+func (l *keyListing) checksFailed() bool {
+	return len(l.rotationNonCompliant) > 0 || l.imminentDeletions > 0 || len(l.missingTags) > 0 || len(l.drift) > 0
+}
+
+func (l *keyListing) report(degraded *degrade.Tracker) KeyReport {
+	return KeyReport{
+		EnabledKeys:          l.enabled,
+		PendingDeletionKeys:  l.pendingDeletion,
+		NotAuthorizedKeys:    l.notAuthorized,
+		FailedKeys:           l.failed,
+		RotationNonCompliant: l.rotationNonCompliant,
+		MissingRequiredTags:  l.missingTags,
+		LockoutBypassed:      l.lockoutBypassed,
+		Drift:                l.drift,
+		Degraded:             degraded.Degraded(),
+	}
+}
+
+func (l *keyListing) htmlReport(opts *listOptions, degraded *degrade.Tracker) render.HTMLReport {
+	multiRegion := l.multiRegion()
+	report := render.HTMLReport{
+		Title:       "KMS Key Inventory",
+		GeneratedAt: time.Now(),
+		Context:     []string{"Regions: " + strings.Join(l.scanRegions, ", ")},
+		Summary: []render.HTMLCount{
+			{Label: keyManagerLabel(opts.scope.KeyManager), Value: l.matched},
+			{Label: "Enabled", Value: len(l.enabled)},
+			{Label: "Pending deletion", Value: len(l.pendingDeletion)},
+			{Label: "Not authorized", Value: len(l.notAuthorized), Alert: true},
+		},
+	}
+	if l.caller != nil {
+		report.Context = append([]string{"Account: " + l.caller.Account, "Caller: " + l.caller.ARN}, report.Context...)
+	}
+	if opts.offline != "" {
+		report.Context = append([]string{"Account: " + l.account, "Offline from " + opts.offline + ", taken " + l.offline.TakenAt.Format(time.RFC3339)}, report.Context...)
+	}
+	if len(l.failed) > 0 {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: "Failed", Value: len(l.failed), Alert: true})
+	}
+	if opts.warnWithinDays > 0 {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: fmt.Sprintf("Deleted within %d days", opts.warnWithinDays), Value: l.imminentDeletions, Alert: true})
+	}
+	if opts.requireRotation {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: "Rotation non-compliant", Value: len(l.rotationNonCompliant), Alert: true})
+	}
+	if len(opts.requiredTags) > 0 {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: "Missing required tags", Value: len(l.missingTags), Alert: true})
+	}
+	if opts.diffAgainst != "" {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: "Changes since snapshot", Value: len(l.drift), Alert: true})
+	}
+
+	report.AddSection("Enabled Keys").SetTable(enabledKeysRows(l.enabled, l.sortedTagKeys, multiRegion, opts.showManager(), opts.withCost)).LinkColumn("Key ID", keyConsoleLinks(l.enabled))
+	report.AddSection("Pending Deletion Keys").SetTable(pendingDeletionKeysRows(l.pendingDeletion, opts.warnWithinDays > 0, multiRegion)).LinkColumn("Key ID", keyConsoleLinks(l.pendingDeletion))
+	report.AddSection("Not Authorized Keys").SetTable(notAuthorizedKeysRows(l.notAuthorized, multiRegion)).LinkColumn("Key ID", keyConsoleLinks(l.notAuthorized))
+	if len(l.failed) > 0 {
+		report.AddSection("Failed Keys").SetTable(failedKeysRows(l.failed, multiRegion)).LinkColumn("Key ID", keyConsoleLinks(l.failed))
+	}
+	if opts.requireRotation {
+		report.AddSection("Rotation Non-Compliant Keys").SetTable(rotationComplianceRows(l.rotationNonCompliant, multiRegion)).LinkColumn("Key ID", keyConsoleLinks(l.rotationNonCompliant))
+	}
+	if len(opts.requiredTags) > 0 {
+		report.AddSection("Keys Missing Required Tags").SetTable(missingTagsRows(l.missingTags, multiRegion)).LinkColumn("Key ID", keyConsoleLinks(l.missingTags))
+	}
+	if opts.checkLockoutBypass {
+		report.AddSection("Policy Lockout Safety Check Bypassed").SetTable(lockoutBypassRows(l.lockoutBypassed, multiRegion)).LinkColumn("Key ID", keyConsoleLinks(l.lockoutBypassed))
+	}
+	if opts.diffAgainst != "" {
+		report.AddSection("Drift Since " + opts.diffAgainst).SetTable(keyDriftRows(l.drift))
+	}
+	if degradations := degraded.Degraded(); len(degradations) > 0 {
+		report.AddSection("Missing Permissions").SetTable(degradedRows(degradations))
+	}
+	return report
+}
+
+// print writes the table report, its summary, and the result of each check
+// the flags turned on
+func (l *keyListing) print(opts *listOptions) {
+	multiRegion := l.multiRegion()
+
+	// Print Enabled Keys
+	if len(l.enabled) > 0 {
+		fmt.Println("=== ENABLED KEYS ===")
+		fmt.Println()
+		printTable(enabledKeysRows(l.enabled, l.sortedTagKeys, multiRegion, opts.showManager(), opts.withCost))
+	}
+
+	// Print Pending Deletion Keys
+	if len(l.pendingDeletion) > 0 {
+		fmt.Println()
+		fmt.Println("=== PENDING DELETION KEYS ===")
+		fmt.Println()
+		printTable(pendingDeletionKeysRows(l.pendingDeletion, opts.warnWithinDays > 0, multiRegion))
+	}
+
+	// Print Not Authorized Keys
+	if len(l.notAuthorized) > 0 {
+		fmt.Println()
+		fmt.Println("=== NOT AUTHORIZED KEYS ===")
+		fmt.Println()
+		printTable(notAuthorizedKeysRows(l.notAuthorized, multiRegion))
+	}
+
+	// Print keys that could not be described for other reasons
+	if len(l.failed) > 0 {
+		fmt.Println()
+		fmt.Println("=== FAILED KEYS ===")
+		fmt.Println()
+		printTable(failedKeysRows(l.failed, multiRegion))
+	}
+
+	if opts.includePolicies {
+		printKeyPolicies(l.scanned, multiRegion)
+	}
+
+	// Summary
+	fmt.Println()
+	fmt.Printf("Total %s: %d\n", keyManagerLabel(opts.scope.KeyManager), l.matched)
+	fmt.Printf("  Enabled: %d\n", len(l.enabled))
+	fmt.Printf("  Pending Deletion: %d\n", len(l.pendingDeletion))
+	fmt.Printf("  Not Authorized: %d\n", len(l.notAuthorized))
+	if len(l.failed) > 0 {
+		fmt.Printf("  Failed: %d\n", len(l.failed))
+	}
+	if l.mergedReplicas > 0 {
+		fmt.Printf("  Multi-Region replicas merged into their primary: %d\n", l.mergedReplicas)
+	}
+
+	if opts.withCost {
+		l.printCost(opts.costByTag)
+	}
+
+	if opts.warnWithinDays > 0 {
+		fmt.Println()
+		if l.imminentDeletions > 0 {
+			fmt.Printf("WARNING: %d key(s) will be deleted within %d days\n", l.imminentDeletions, opts.warnWithinDays)
+		} else {
+			fmt.Printf("No keys scheduled for deletion within %d days\n", opts.warnWithinDays)
+		}
+	}
+
+	if opts.requireRotation {
+		if len(l.rotationNonCompliant) > 0 {
+			fmt.Println()
+			fmt.Println("=== ROTATION NON-COMPLIANT KEYS ===")
+			fmt.Println()
+			printTable(rotationComplianceRows(l.rotationNonCompliant, multiRegion))
+			fmt.Println()
+			fmt.Printf("Rotation non-compliant keys: %d\n", len(l.rotationNonCompliant))
+		} else {
+			fmt.Println("All enabled symmetric keys have automatic rotation enabled")
+		}
+	}
+
+	if len(opts.requiredTags) > 0 {
+		fmt.Println()
+		if len(l.missingTags) > 0 {
+			fmt.Println("=== MISSING REQUIRED TAGS ===")
+			fmt.Println()
+			printTable(missingTagsRows(l.missingTags, multiRegion))
+			fmt.Println()
+			fmt.Printf("Keys missing required tags: %d\n", len(l.missingTags))
+		} else {
+			fmt.Printf("All enabled keys have required tags: %s\n", strings.Join(opts.requiredTags, ", "))
+		}
+	}
+
+	if opts.checkLockoutBypass {
+		fmt.Println()
+		if len(l.lockoutBypassed) > 0 {
+			fmt.Println("=== POLICY LOCKOUT SAFETY CHECK BYPASSED ===")
+			fmt.Println()
+			printTable(lockoutBypassRows(l.lockoutBypassed, multiRegion))
+			fmt.Println()
+			fmt.Printf("Keys with bypassed lockout safety check: %d\n", len(l.lockoutBypassed))
+		} else {
+			fmt.Println("No CreateKey or PutKeyPolicy calls bypassed the lockout safety check in the last 90 days")
+		}
+	}
+
+	if opts.diffAgainst != "" {
+		fmt.Println()
+		if len(l.drift) > 0 {
+			fmt.Printf("=== DRIFT SINCE %s ===\n", opts.diffAgainst)
+			fmt.Println()
+			printTable(keyDriftRows(l.drift))
+			fmt.Println()
+			fmt.Printf("Changes since last snapshot: %d\n", len(l.drift))
+		} else {
+			fmt.Printf("No drift since %s\n", opts.diffAgainst)
+		}
+	}
+}
+
+// printCost writes the estimated monthly cost, subtotalled by costByTag when
+// it is set
+func (l *keyListing) printCost(costByTag string) {
+	var tags []map[string]string
+	var costs []float64
+	total := 0.0
+	for _, key := range l.scanned {
+		if key.MonthlyCost == nil {
+			continue
+		}
+		tags = append(tags, key.Tags)
+		costs = append(costs, *key.MonthlyCost)
+		total += *key.MonthlyCost
+	}
+
+	if costByTag != "" {
+		fmt.Println()
+		fmt.Printf("=== ESTIMATED MONTHLY COST BY %s ===\n", costByTag)
+		fmt.Println()
+		var rows [][]string
+		for _, subtotal := range pricing.ByTag(tags, costs, costByTag) {
+			rows = append(rows, []string{subtotal.Value, fmt.Sprintf("%d", subtotal.Keys), fmt.Sprintf("$%.2f", subtotal.Cost)})
+		}
+		render.Table(os.Stdout, []string{costByTag, "Keys", "Est. $/month"}, rows)
+	}
+
+	fmt.Println()
+	fmt.Printf("Estimated monthly cost: $%.2f (key storage and rotations only; excludes API requests and CloudHSM clusters)\n", total)
+	if len(l.notAuthorized) > 0 {
+		fmt.Printf("  Not included: %d key(s) that could not be described\n", len(l.notAuthorized))
+	}
+}
+
+// keySnapshot keys items by key ID, which is unique across regions.
+func keySnapshot(keys []KeyInfo, account string, listedRegions []string) (snapshot.Snapshot, error) {
+	snap := snapshot.Snapshot{Kind: "kms-keys", TakenAt: time.Now().UTC(), Scanned: listedRegions}
+	if account != degrade.Unknown {
+		snap.Account = account
+	}
+	for _, key := range keys {
+		item := snapshot.Item{ID: key.KeyID, Region: key.Region, State: key.Status, Tags: key.Tags, TagsUnknown: key.isUnknown(degrade.Tags)}
+		if len(key.Aliases) > 0 {
+			item.Name = key.Aliases[0]
+		}
+		data, err := json.Marshal(key)
+		if err != nil {
+			return snap, fmt.Errorf("encoding key %s: %w", key.KeyID, err)
+		}
+		item.Data = data
+		snap.Items = append(snap.Items, item)
+	}
+	return snap, nil
+}
+
+// readKeySnapshot reads a kms-keys snapshot for --offline.
+func readKeySnapshot(path string) (snapshot.Snapshot, []KeyInfo, error) {
+	snap, err := snapshot.ReadOffline(path, "kms-keys")
+	if err != nil {
+		return snap, nil, err
+	}
+	keys := make([]KeyInfo, 0, len(snap.Items))
+	for _, item := range snap.Items {
+		var key KeyInfo
+		if err := json.Unmarshal(item.Data, &key); err != nil {
+			return snap, nil, fmt.Errorf("parsing key %s in %s: %w", item.ID, path, err)
+		}
+		keys = append(keys, key)
+	}
+	return snap, keys, nil
+}
+
+// selectSnapshotKeys picks the keys refs name, by key ID, key ARN, alias, or
+// alias ARN, as the live commands accept them; with no refs it picks every
+// customer managed key, like kmsinv.ListCustomerManaged.
+func selectSnapshotKeys(keys []KeyInfo, refs []string) ([]KeyInfo, error) {
+	if len(refs) == 0 {
+		var selected []KeyInfo
+		for _, key := range keys {
+			if kmsinv.ManagedBy(key.KeyManager, kmsinv.ManagerCustomer) {
+				selected = append(selected, key)
+			}
+		}
+		return selected, nil
+	}
+
+	var selected []KeyInfo
+	for _, ref := range refs {
+		found := false
+		for _, key := range keys {
+			if ref == key.KeyID || strings.HasSuffix(ref, ":key/"+key.KeyID) || slices.ContainsFunc(key.Aliases, func(alias string) bool {
+				return ref == alias || strings.HasSuffix(ref, ":"+alias)
+			}) {
+				selected = append(selected, key)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("key %s is not in the snapshot", ref)
+		}
+	}
+	return selected, nil
+}
+
+// snapshotRegions lists the regions of a snapshot's items, sorted.
+func snapshotRegions(snap snapshot.Snapshot) []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, item := range snap.Items {
+		if item.Region != "" && !seen[item.Region] {
+			seen[item.Region] = true
+			list = append(list, item.Region)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func degradedRows(degradations []degrade.Degradation) ([]string, [][]string) {
+	headers := []string{"Permission", "Failed", "Effect"}
+
+	var rows [][]string
+	for _, d := range degradations {
+		rows = append(rows, []string{d.Permission, fmt.Sprintf("%d %s(s)", d.Count, d.Unit), d.Effect})
+	}
+	return headers, rows
+}
+
+func keyDriftRows(changes []snapshot.Change) ([]string, [][]string) {
+	headers := []string{"Change", "Resource", "Name", "Details"}
+
+	var rows [][]string
+	for _, c := range changes {
+		rows = append(rows, []string{c.Type, c.ID, render.ValueOrDash(c.Name), render.ValueOrDash(c.Details)})
+	}
+
+	return headers, rows
+}
+
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+
+	switch *format {
+	case "text":
+		version.Print(os.Stdout, "kms-keys")
+	case "json":
+		if err := render.JSON(os.Stdout, version.Get()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use text or json)\n", *format)
+		exit(1)
+	}
+}
+
+func runSelfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	var updateFlags selfupdate.Flags
+	updateFlags.Register(fs)
+	fs.Parse(args)
+
+	ctx := context.Background()
+
+	verifier, err := updateFlags.Verifier(func() (*kms.Client, error) {
+		cfg, err := awsOptions.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		return kms.NewFromConfig(cfg), nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	if err := selfupdate.Run(ctx, client, os.Stdout, updateFlags.Options("kms-keys", version.Version, verifier)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating: %v\n", err)
+		exit(1)
+	}
+}
+
+// runScan runs registered inventory scanners across regions. A scanner that
+// fails in one region is reported and the rest of the scan carries on.
+func runScan(args []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	scannerList := fs.String("scanners", "all", "Comma-separated scanners to run, or 'all' (available: "+strings.Join(scanner.Names(), ", ")+")")
+	regionList := fs.String("regions", "", "Comma-separated regions to scan, or 'all' for every enabled region (default: --region)")
+	excludeRegions := fs.String("exclude-regions", "", "Comma-separated regions to skip (e.g. regions blocked by SCPs)")
+	format := fs.String("format", "table", "Output format: table or json")
+	serve := fs.String("serve", "", "Instead of printing, rescan every --interval and serve Prometheus metrics on this address (e.g. :9090)")
+	interval := fs.Duration("interval", 15*time.Minute, "Time between scans with --serve")
+	requiredTagsList := fs.String("required-tags", "", "Comma-separated tag keys; with --serve, count resources missing any of them")
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table or json)\n", *format)
+		exit(1)
+	}
+	if *serve != "" && *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --interval must be positive")
+		exit(1)
+	}
+
+	scanners, err := scanner.Select(*scannerList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+
+	scanRegions, skippedRegions, err := regions.Resolve(ctx, cfg, regions.Parse(*regionList), regions.Parse(*excludeRegions))
+	if errors.Is(err, regions.ErrOptInUnknown) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving regions: %v\n", err)
+		exit(1)
+	}
+
+	caller, err := identity.Lookup(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	identity.Banner(os.Stderr, awsOptions.Profile, caller, scanRegions)
+	for _, skipped := range skippedRegions {
+		fmt.Fprintf(os.Stderr, "Skipping Region: %s (%s)\n", skipped.Region, skipped.Reason)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if *serve != "" {
+		serveScanMetrics(ctx, cfg, scanners, scanRegions, tagpolicy.ParseRequired(*requiredTagsList), *serve, *interval)
+		return
+	}
+
+	records, failures := scanAll(ctx, cfg, scanners, scanRegions)
+
+	if *format == "json" {
+		if records == nil {
+			records = []scanner.Record{}
+		}
+		if err := render.JSON(os.Stdout, records); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+	} else {
+		var rows [][]string
+		for _, record := range records {
+			created := "-"
+			if record.CreatedAt != nil {
+				created = record.CreatedAt.Format(dateFormat)
+			}
+			rows = append(rows, []string{record.Scanner, record.Region, record.ID, render.ValueOrDash(record.Name), render.ValueOrDash(record.State), created})
+		}
+		render.Table(os.Stdout, []string{"Scanner", "Region", "ID", "Name", "State", "Created"}, rows)
+		fmt.Println()
+		fmt.Printf("Total resources: %d\n", len(records))
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "%d scan(s) failed\n", len(failures))
+		exit(1)
+	}
+}
+
+type scanFailure struct {
+	Scanner string
+	Region  string
+	Class   awserr.Class
+}
+
+// scanAll runs every scanner in every region, warning about each that fails.
+func scanAll(ctx context.Context, cfg aws.Config, scanners []scanner.Scanner, scanRegions []string) ([]scanner.Record, []scanFailure) {
+	var records []scanner.Record
+	var failures []scanFailure
+	for _, s := range scanners {
+		for _, scanRegion := range scanRegions {
+			regionCfg := cfg.Copy()
+			regionCfg.Region = scanRegion
+			found, err := s.Scan(ctx, regionCfg)
+			if err != nil {
+				usage.Error(err)
+				failures = append(failures, scanFailure{Scanner: s.Name(), Region: scanRegion, Class: awserr.Classify(err)})
+				fmt.Fprintf(os.Stderr, "Warning: %s scan failed in %s (%s): %v\n", s.Name(), scanRegion, awserr.Describe(err), err)
+				continue
+			}
+			records = append(records, found...)
+		}
+	}
+	return records, failures
+}
+
+// serveScanMetrics scans every interval and serves the latest results on
+// addr. It only returns by exiting, when the listener fails.
+func serveScanMetrics(ctx context.Context, cfg aws.Config, scanners []scanner.Scanner, scanRegions []string, requiredTags []string, addr string, interval time.Duration) {
+	server := &metrics.Server{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", server)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	go func() {
+		// Failures accumulate across scans, as Prometheus counters must
+		scanErrors := make(map[scanFailure]int)
+		scans := 0
+		for {
+			started := time.Now()
+			records, failures := scanAll(ctx, cfg, scanners, scanRegions)
+			scans++
+			for _, failure := range failures {
+				scanErrors[failure]++
+			}
+			server.Set(scanMetrics(records, requiredTags, scanErrors, scans, time.Since(started), started))
+			fmt.Fprintf(os.Stderr, "Scanned %d resources in %s (%d failed scans)\n", len(records), time.Since(started).Round(time.Millisecond), len(failures))
+			time.Sleep(time.Until(started.Add(interval)))
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics, rescanning every %s\n", addr, interval)
+	httpServer := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := httpServer.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving metrics: %v\n", err)
+		exit(1)
+	}
+}
+
+// scanMetrics turns one scan into the metric families served until the next.
+func scanMetrics(records []scanner.Record, requiredTags []string, scanErrors map[scanFailure]int, scans int, duration time.Duration, started time.Time) []*metrics.Family {
+	type regionState struct{ scanner, region, state string }
+	type scannerRegion struct{ scanner, region string }
+	type resourceError struct{ scanner, region, class string }
+
+	byState := make(map[regionState]int)
+	pendingDeletion := make(map[string]int)
+	rotationDisabled := make(map[string]int)
+	missingTags := make(map[scannerRegion]int)
+	resourceErrors := make(map[resourceError]int)
+	for _, record := range records {
+		byState[regionState{record.Scanner, record.Region, record.State}]++
+		if class := record.Attributes["error_class"]; class != "" {
+			resourceErrors[resourceError{record.Scanner, record.Region, class}]++
+			continue
+		}
+		switch record.Scanner {
+		case "kms":
+			if record.State == string(types.KeyStatePendingDeletion) {
+				pendingDeletion[record.Region]++
+			}
+		case "secretsmanager":
+			if record.State == "Active" && record.Attributes["rotation_enabled"] != "true" {
+				rotationDisabled[record.Region]++
+			}
+		}
+		if len(requiredTags) > 0 && len(tagpolicy.Missing(record.Tags, requiredTags)) > 0 {
+			missingTags[scannerRegion{record.Scanner, record.Region}]++
+		}
+	}
+
+	resources := &metrics.Family{Name: "awskms_resources", Help: "Resources found by the last scan, by scanner, region, and state.", Type: metrics.Gauge}
+	for key, count := range byState {
+		resources.Add(float64(count), "scanner", key.scanner, "region", key.region, "state", key.state)
+	}
+	pending := &metrics.Family{Name: "awskms_kms_keys_pending_deletion", Help: "KMS keys scheduled for deletion.", Type: metrics.Gauge}
+	for region, count := range pendingDeletion {
+		pending.Add(float64(count), "region", region)
+	}
+	rotation := &metrics.Family{Name: "awskms_secrets_rotation_disabled", Help: "Active secrets without automatic rotation.", Type: metrics.Gauge}
+	for region, count := range rotationDisabled {
+		rotation.Add(float64(count), "region", region)
+	}
+	errored := &metrics.Family{Name: "awskms_resource_errors", Help: "Resources listed but not described by the last scan, by error class.", Type: metrics.Gauge}
+	for key, count := range resourceErrors {
+		errored.Add(float64(count), "scanner", key.scanner, "region", key.region, "class", key.class)
+	}
+	scanFailures := &metrics.Family{Name: "awskms_scan_errors_total", Help: "Scanner runs that failed in a region, by error class.", Type: metrics.Counter}
+	for failure, count := range scanErrors {
+		scanFailures.Add(float64(count), "scanner", failure.Scanner, "region", failure.Region, "class", string(failure.Class))
+	}
+
+	families := []*metrics.Family{resources, pending, rotation, errored, scanFailures}
+	if len(requiredTags) > 0 {
+		missing := &metrics.Family{Name: "awskms_resources_missing_required_tags", Help: "Resources missing any of the --required-tags.", Type: metrics.Gauge}
+		for key, count := range missingTags {
+			missing.Add(float64(count), "scanner", key.scanner, "region", key.region)
+		}
+		families = append(families, missing)
+	}
+
+	families = append(families,
+		(&metrics.Family{Name: "awskms_scan_duration_seconds", Help: "How long the last scan took.", Type: metrics.Gauge}).Add(duration.Seconds()),
+		(&metrics.Family{Name: "awskms_scan_timestamp_seconds", Help: "When the last scan started, as a Unix time.", Type: metrics.Gauge}).Add(float64(started.Unix())),
+		(&metrics.Family{Name: "awskms_scans_total", Help: "Scans completed since the process started.", Type: metrics.Counter}).Add(float64(scans)),
+	)
+	return families
+}
+
+func runGrants(args []string) {
+	fs := flag.NewFlagSet("grants", flag.ExitOnError)
+	format := fs.String("format", "table", "Output format: table, json, or parquet")
+	output := fs.String("output", "grants.parquet", "Output parquet file path (parquet format only)")
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *format != "table" && *format != "json" && *format != "parquet" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table, json, or parquet)\n", *format)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+
+	client := kms.NewFromConfig(cfg)
+
+	printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+
+	keys, err := kmsinv.ListCustomerManaged(ctx, client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing keys: %v\n", err)
+		exit(1)
+	}
+
+	var grants []GrantInfo
+	var notAuthorizedKeys []string
+	degraded := degrade.NewTracker()
+
+	for _, key := range keys {
+		keyGrants, err := listKeyGrants(ctx, client, *key.KeyId)
+		if err != nil {
+			degraded.Record(degrade.Grants, err)
+			if awserr.IsNotAuthorized(err) {
+				notAuthorizedKeys = append(notAuthorizedKeys, *key.KeyId)
+			}
+			continue
+		}
+		grants = append(grants, keyGrants...)
+	}
+	for _, warning := range degraded.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	switch *format {
+	case "json":
+		report := GrantReport{
+			Grants:            grants,
+			NotAuthorizedKeys: notAuthorizedKeys,
+		}
+		if err := render.JSON(os.Stdout, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+		return
+	case "parquet":
+		if err := writeGrantsParquet(*output, grants); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing parquet: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d grants to %s\n", len(grants), *output)
+		if len(notAuthorizedKeys) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: Not authorized to list grants for %d key(s)\n", len(notAuthorizedKeys))
+		}
+		return
+	}
+
+	if len(grants) > 0 {
+		fmt.Println("=== GRANTS ===")
+		fmt.Println()
+		printGrantsTable(grants)
+	}
+
+	if len(notAuthorizedKeys) > 0 {
+		fmt.Println()
+		fmt.Println("=== NOT AUTHORIZED KEYS ===")
+		fmt.Println()
+		var notAuthorized []KeyInfo
+		for _, keyID := range notAuthorizedKeys {
+			notAuthorized = append(notAuthorized, KeyInfo{KeyID: keyID, Status: "Not Authorized"})
+		}
+		printTable(notAuthorizedKeysRows(notAuthorized, false))
+	}
+
+	// Summary
+	fmt.Println()
+	fmt.Printf("Total Customer Managed Keys: %d\n", len(keys))
+	fmt.Printf("  Grants: %d\n", len(grants))
+	fmt.Printf("  Not Authorized: %d\n", len(notAuthorizedKeys))
+}
+
+func listKeyGrants(ctx context.Context, client *kms.Client, keyID string) ([]GrantInfo, error) {
+	var grants []GrantInfo
+	var marker *string
+
+	for {
+		output, err := client.ListGrants(ctx, &kms.ListGrantsInput{
+			KeyId:  &keyID,
+			Marker: marker,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, grant := range output.Grants {
+			info := GrantInfo{
+				KeyID:             keyID,
+				GrantID:           aws.ToString(grant.GrantId),
+				GrantName:         aws.ToString(grant.Name),
+				GranteePrincipal:  aws.ToString(grant.GranteePrincipal),
+				RetiringPrincipal: aws.ToString(grant.RetiringPrincipal),
+				IssuingAccount:    aws.ToString(grant.IssuingAccount),
+			}
+
+			for _, op := range grant.Operations {
+				info.Operations = append(info.Operations, string(op))
+			}
+
+			if grant.Constraints != nil {
+				info.EncryptionContextSubset = grant.Constraints.EncryptionContextSubset
+				info.EncryptionContextEquals = grant.Constraints.EncryptionContextEquals
+			}
+
+			if grant.CreationDate != nil {
+				info.CreationDate = *grant.CreationDate
+			}
+
+			grants = append(grants, info)
+		}
+
+		if !output.Truncated {
+			break
+		}
+		marker = output.NextMarker
+	}
+
+	return grants, nil
+}
+
+func sqliteKey(key KeyInfo) sqlitestore.Key {
+	return sqlitestore.Key{
+		Region:             key.Region,
+		KeyID:              key.KeyID,
+		Status:             key.Status,
+		KeyType:            key.KeyType,
+		KeyManager:         key.KeyManager,
+		AWSService:         key.AWSService,
+		Origin:             key.Origin,
+		MultiRegion:        key.MultiRegion,
+		PrimaryRegion:      key.PrimaryRegion,
+		CreationDate:       key.CreationDate,
+		RotationStatus:     key.RotationStatus,
+		RotationPeriodDays: key.RotationPeriodDays,
+		DeletionDate:       key.DeletionDate,
+		MonthlyCost:        key.MonthlyCost,
+		ErrorReason:        key.ErrorReason,
+		Aliases:            key.Aliases,
+		Tags:               key.Tags,
+	}
+}
+
+func sqliteGrant(region string, grant GrantInfo) sqlitestore.Grant {
+	return sqlitestore.Grant{
+		Region:            region,
+		KeyID:             grant.KeyID,
+		GrantID:           grant.GrantID,
+		GrantName:         grant.GrantName,
+		GranteePrincipal:  grant.GranteePrincipal,
+		RetiringPrincipal: grant.RetiringPrincipal,
+		IssuingAccount:    grant.IssuingAccount,
+		Operations:        grant.Operations,
+		CreationDate:      grant.CreationDate,
+	}
+}
+
+// parquetKey is key as a --format parquet row; optional fields left empty are
+// written as nulls.
+func parquetKey(key KeyInfo) KeyRecord {
+	optional := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return aws.String(value)
+	}
+	record := KeyRecord{
+		KeyID:          key.KeyID,
+		Region:         key.Region,
+		Aliases:        key.Aliases,
+		Status:         key.Status,
+		KeyType:        key.KeyType,
+		KeyManager:     optional(key.KeyManager),
+		AWSService:     optional(key.AWSService),
+		Origin:         optional(key.Origin),
+		MultiRegion:    optional(key.MultiRegion),
+		PrimaryRegion:  optional(key.PrimaryRegion),
+		ReplicaRegions: key.ReplicaRegions,
+		RotationStatus: optional(key.RotationStatus),
+		Tags:           key.Tags,
+		MissingTags:    key.MissingTags,
+		MonthlyCost:    key.MonthlyCost,
+		ErrorReason:    optional(key.ErrorReason),
+		Unknown:        key.Unknown,
+	}
+	if !key.CreationDate.IsZero() {
+		record.CreationDate = aws.Int64(key.CreationDate.UnixMilli())
+	}
+	if key.RotationPeriodDays > 0 {
+		record.RotationPeriodDays = aws.Int32(key.RotationPeriodDays)
+	}
+	if key.DeletionDate != nil {
+		record.DeletionDate = aws.Int64(key.DeletionDate.UnixMilli())
+	}
+	if key.Policy != nil {
+		var compact bytes.Buffer
+		if json.Compact(&compact, key.Policy) != nil {
+			compact.Reset()
+			compact.Write(key.Policy)
+		}
+		record.Policy = aws.String(compact.String())
+	}
+	return record
+}
+
+func writeKeysParquet(filename string, keys []KeyInfo) (err error) {
+	fw, err := local.NewLocalFileWriter(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	// A failed flush or close leaves a truncated file behind
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close file: %w", closeErr)
+		}
+	}()
+
+	pw, err := writer.NewParquetWriter(fw, new(KeyRecord), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+
+	pw.RowGroupSize = 128 * 1024 * 1024 // 128MB
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, key := range keys {
+		if err := pw.Write(parquetKey(key)); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		return fmt.Errorf("failed to finalize parquet: %w", err)
+	}
+
+	return nil
+}
+
+func writeGrantsParquet(filename string, grants []GrantInfo) (err error) {
+	fw, err := local.NewLocalFileWriter(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close file: %w", closeErr)
+		}
+	}()
+
+	pw, err := writer.NewParquetWriter(fw, new(GrantRecord), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+
+	pw.RowGroupSize = 128 * 1024 * 1024 // 128MB
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, grant := range grants {
+		record := GrantRecord{
+			KeyID:                   grant.KeyID,
+			GrantID:                 grant.GrantID,
+			GranteePrincipal:        grant.GranteePrincipal,
+			IssuingAccount:          grant.IssuingAccount,
+			Operations:              grant.Operations,
+			EncryptionContextSubset: grant.EncryptionContextSubset,
+			EncryptionContextEquals: grant.EncryptionContextEquals,
+		}
+		if grant.GrantName != "" {
+			record.GrantName = aws.String(grant.GrantName)
+		}
+		if grant.RetiringPrincipal != "" {
+			record.RetiringPrincipal = aws.String(grant.RetiringPrincipal)
+		}
+		if !grant.CreationDate.IsZero() {
+			record.CreationDate = aws.Int64(grant.CreationDate.UnixMilli())
+		}
+
+		if err := pw.Write(record); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		return fmt.Errorf("failed to finalize parquet: %w", err)
+	}
+
+	return nil
+}
+
+// cryptoOperations are the KMS calls that count as using a key.
+var cryptoOperations = map[string]bool{
+	"Encrypt": true, "Decrypt": true, "ReEncrypt": true,
+	"GenerateDataKey": true, "GenerateDataKeyWithoutPlaintext": true,
+	"GenerateDataKeyPair": true, "GenerateDataKeyPairWithoutPlaintext": true,
+	"Sign": true, "Verify": true, "GenerateMac": true, "VerifyMac": true,
+	"DeriveSharedSecret": true,
+}
+
+func runUsage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	format := fs.String("format", "table", "Output format: table or json")
+	lookbackDays := fs.Int("lookback-days", 90, "How far back to look for cryptographic use (CloudTrail event history keeps 90 days)")
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table or json)\n", *format)
+		exit(1)
+	}
+	if *lookbackDays < 1 || *lookbackDays > 90 {
+		fmt.Fprintln(os.Stderr, "Error: --lookback-days must be between 1 and 90")
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+
+	inventory := kmsinv.NewCache(kms.NewFromConfig(cfg))
+	trail := cloudtrail.NewFromConfig(cfg)
+
+	printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+
+	keys, err := kmsinv.ListCustomerManaged(ctx, inventory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing keys: %v\n", err)
+		exit(1)
+	}
+
+	aliasIndex, err := kmsinv.AliasesByKey(ctx, inventory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not list aliases: %v\n", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -*lookbackDays)
+	var usage []KeyUsage
+	unused, newKeys, unknown := 0, 0, 0
+	degraded := degrade.NewTracker()
+
+	for _, key := range keys {
+		keyInfo := getKeyInfo(ctx, inventory, *key.KeyId, nil)
+		entry := KeyUsage{
+			KeyID:   *key.KeyId,
+			Aliases: aliasIndex[*key.KeyId],
+			Status:  keyInfo.Status,
+		}
+
+		record, err := lastKeyUse(ctx, trail, aws.ToString(key.KeyArn), since)
+		switch {
+		case err != nil:
+			degraded.Record(degrade.Usage, err)
+			entry.Unknown = []string{degrade.Usage}
+			unknown++
+		case record != nil:
+			eventTime := record.EventTime
+			entry.LastUsed = &eventTime
+			entry.LastOperation = record.EventName
+			entry.LastPrincipal = record.UserIdentity.ARN
+		case keyInfo.CreationDate.After(since):
+			entry.New = true
+			newKeys++
+		default:
+			entry.Unused = true
+			unused++
+		}
+		usage = append(usage, entry)
+	}
+	for _, warning := range degraded.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	// Idle keys first, then those that couldn't be looked up, new keys, and
+	// the rest least recently used first
+	rank := func(u KeyUsage) int {
+		switch {
+		case u.Unused:
+			return 0
+		case len(u.Unknown) > 0:
+			return 1
+		case u.New:
+			return 2
+		}
+		return 3
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		if ri, rj := rank(usage[i]), rank(usage[j]); ri != rj || ri < 3 {
+			return ri < rj
+		}
+		return usage[i].LastUsed.Before(*usage[j].LastUsed)
+	})
+
+	if *format == "json" {
+		if err := render.JSON(os.Stdout, usage); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	if len(usage) > 0 {
+		fmt.Println("=== KEY USAGE ===")
+		fmt.Println()
+		printKeyUsageTable(usage, *lookbackDays)
+	}
+
+	fmt.Println()
+	fmt.Printf("Total Customer Managed Keys: %d\n", len(usage))
+	fmt.Printf("  Unused in the last %d days: %d\n", *lookbackDays, unused)
+	if newKeys > 0 {
+		fmt.Printf("  Created in the last %d days, not used yet: %d\n", *lookbackDays, newKeys)
+	}
+	if unknown > 0 {
+		fmt.Printf("  Unknown (CloudTrail lookup failed): %d\n", unknown)
+	}
+	if unused > 0 {
+		fmt.Println()
+		fmt.Println("Unused keys are candidates for disabling and scheduling deletion (each enabled key costs about $1/month).")
+	}
+}
+
+// LookupEvents allows two calls a second per account and region, far below
+// what the SDK retryer waits out when every key is looked up in turn, so each
+// page gets its own, slower retries.
+const (
+	cloudTrailAttempts   = 5
+	cloudTrailRetryDelay = time.Second
+)
+
+// lastKeyUse returns the most recent cryptographic operation on the key since
+// the given time, or nil if there was none. Events are returned newest first,
+// so paging stops at the first match.
+func lastKeyUse(ctx context.Context, client *cloudtrail.Client, keyArn string, since time.Time) (*cloudTrailRecord, error) {
+	paginator := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{
+			{AttributeKey: cloudtrailtypes.LookupAttributeKeyResourceName, AttributeValue: aws.String(keyArn)},
+		},
+		StartTime: aws.Time(since),
+	})
+
+	for paginator.HasMorePages() {
+		var page *cloudtrail.LookupEventsOutput
+		err := throttle.Retry(ctx, cloudTrailAttempts, cloudTrailRetryDelay, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range page.Events {
+			if !cryptoOperations[aws.ToString(event.EventName)] {
+				continue
+			}
+			var record cloudTrailRecord
+			if err := json.Unmarshal([]byte(aws.ToString(event.CloudTrailEvent)), &record); err != nil {
+				return nil, fmt.Errorf("parsing event: %w", err)
+			}
+			return &record, nil
+		}
+	}
+	return nil, nil
+}
+
+func printKeyUsageTable(usage []KeyUsage, lookbackDays int) {
+	headers := []string{"Key ID", "Aliases", "Status", "Last Used", "Operation", "Principal", "Days Idle"}
+
+	var rows [][]string
+	for _, u := range usage {
+		lastUsed, daysIdle := "-", fmt.Sprintf(">%d", lookbackDays)
+		switch {
+		case u.LastUsed != nil:
+			lastUsed = u.LastUsed.Format(dateFormat)
+			daysIdle = fmt.Sprintf("%d", int(time.Since(*u.LastUsed).Hours()/24))
+		case len(u.Unknown) > 0:
+			lastUsed, daysIdle = degrade.Unknown, degrade.Unknown
+		case u.New:
+			daysIdle = "new"
+		}
+		rows = append(rows, []string{
+			u.KeyID,
+			formatAliases(u.Aliases),
+			u.Status,
+			lastUsed,
+			render.ValueOrDash(u.LastOperation),
+			render.ValueOrDash(u.LastPrincipal),
+			daysIdle,
+		})
+	}
+
+	render.Table(os.Stdout, headers, rows)
+}
+
+type KeyContextStats struct {
+	KeyID   string   `json:"key_id"`
+	Aliases []string `json:"aliases"`
+	enccontext.Stats
+	// Sampled is set when --max-events stopped the lookup early
+	Sampled bool     `json:"sampled,omitempty"`
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// runEncryptionContext summarizes, per key, the encryption context key names
+// seen in CloudTrail, to show how each key is used and which context keys a
+// policy condition could require.
+func runEncryptionContext(args []string) {
+	var keyFlags stringSliceFlag
+	fs := flag.NewFlagSet("encryption-context", flag.ExitOnError)
+	fs.Var(&keyFlags, "key", "Key ID, ARN, or alias to report on (repeatable; default: every customer managed key)")
+	format := fs.String("format", "table", "Output format: table or json")
+	lookbackDays := fs.Int("lookback-days", 90, "How far back to read CloudTrail (event history keeps 90 days)")
+	maxEvents := fs.Int("max-events", 1000, "Stop after this many events per key, newest first (0 for no limit)")
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table or json)\n", *format)
+		exit(1)
+	}
+	if *lookbackDays < 1 || *lookbackDays > 90 {
+		fmt.Fprintln(os.Stderr, "Error: --lookback-days must be between 1 and 90")
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+
+	inventory := kmsinv.NewCache(kms.NewFromConfig(cfg))
+	trail := cloudtrail.NewFromConfig(cfg)
+
+	printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+
+	// CloudTrail is looked up by key ARN
+	resolver := kmsinv.NewResolver(inventory)
+	var keyArns []string
+	if len(keyFlags) > 0 {
+		for _, ref := range keyFlags {
+			keyID, err := resolver.Resolve(ctx, ref)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			output, err := inventory.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error describing key %s: %v\n", ref, err)
+				exit(1)
+			}
+			keyArns = append(keyArns, aws.ToString(output.KeyMetadata.Arn))
+		}
+	} else {
+		keys, err := kmsinv.ListCustomerManaged(ctx, inventory)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing keys: %v\n", err)
+			exit(1)
+		}
+		for _, key := range keys {
+			keyArns = append(keyArns, aws.ToString(key.KeyArn))
+		}
+	}
+
+	aliasIndex, err := resolver.AliasesByKey(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not list aliases: %v\n", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -*lookbackDays)
+	var stats []KeyContextStats
+	degraded := degrade.NewTracker()
+	for _, keyArn := range keyArns {
+		keyID := keyArn[strings.LastIndex(keyArn, "/")+1:]
+		entry := KeyContextStats{KeyID: keyID, Aliases: aliasIndex[keyID]}
+		aggregator, sampled, err := keyContexts(ctx, trail, keyArn, since, *maxEvents)
+		if err != nil {
+			degraded.Record(degrade.EncryptionContext, err)
+			entry.Unknown = []string{degrade.EncryptionContext}
+		} else {
+			entry.Stats, entry.Sampled = aggregator.Stats(), sampled
+		}
+		stats = append(stats, entry)
+	}
+	for _, warning := range degraded.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	if *format == "json" {
+		if err := render.JSON(os.Stdout, stats); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	if len(stats) > 0 {
+		fmt.Println("=== ENCRYPTION CONTEXT BY KEY ===")
+		fmt.Println()
+		headers, rows := encryptionContextSummaryRows(stats, *maxEvents)
+		render.Table(os.Stdout, headers, rows)
+		fmt.Println()
+		fmt.Println("=== DISTINCT CONTEXTS ===")
+		fmt.Println()
+		headers, rows = encryptionContextSetRows(stats)
+		render.Table(os.Stdout, headers, rows)
+	}
+
+	fmt.Println()
+	fmt.Printf("Total Keys: %d\n", len(stats))
+	if degradations := degraded.Degraded(); len(degradations) > 0 {
+		fmt.Printf("  Unknown (CloudTrail lookup failed): %d\n", degradations[0].Count)
+	}
+	fmt.Println("Always Present keys can be required in the key policy (kms:EncryptionContextKeys or kms:EncryptionContext:<key>) without breaking current callers.")
+}
+
+// keyContexts aggregates the encryption contexts of the key's calls since
+// the given time. ReEncrypt events appear under both keys; each key counts
+// the context on its own side.
+func keyContexts(ctx context.Context, client *cloudtrail.Client, keyArn string, since time.Time, maxEvents int) (*enccontext.Aggregator, bool, error) {
+	aggregator := &enccontext.Aggregator{}
+	paginator := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{
+			{AttributeKey: cloudtrailtypes.LookupAttributeKeyResourceName, AttributeValue: aws.String(keyArn)},
+		},
+		StartTime: aws.Time(since),
+	})
+
+	events := 0
+	for paginator.HasMorePages() {
+		var page *cloudtrail.LookupEventsOutput
+		err := throttle.Retry(ctx, cloudTrailAttempts, cloudTrailRetryDelay, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, event := range page.Events {
+			if !enccontext.Operations[aws.ToString(event.EventName)] {
+				continue
+			}
+			if maxEvents > 0 && events >= maxEvents {
+				return aggregator, true, nil
+			}
+			var record cloudTrailRecord
+			if err := json.Unmarshal([]byte(aws.ToString(event.CloudTrailEvent)), &record); err != nil {
+				return nil, false, fmt.Errorf("parsing event: %w", err)
+			}
+			if record.ErrorCode != "" {
+				continue
+			}
+			events++
+
+			params := record.RequestParameters
+			encryptionContext := params.EncryptionContext
+			if record.EventName == "ReEncrypt" {
+				encryptionContext = params.SourceEncryptionContext
+				if params.DestinationKeyID != "" && (params.DestinationKeyID == keyArn || strings.HasSuffix(keyArn, "/"+params.DestinationKeyID)) {
+					encryptionContext = params.DestinationEncryptionContext
+				}
+			}
+			aggregator.Add(record.EventName, record.EventTime, encryptionContext)
+		}
+	}
+	return aggregator, false, nil
+}
+
+func encryptionContextSummaryRows(stats []KeyContextStats, maxEvents int) ([]string, [][]string) {
+	headers := []string{"Key ID", "Aliases", "Events", "Without Context", "Distinct Contexts", "Always Present"}
+
+	var rows [][]string
+	for _, s := range stats {
+		if len(s.Unknown) > 0 {
+			rows = append(rows, []string{s.KeyID, formatAliases(s.Aliases), degrade.Unknown, degrade.Unknown, degrade.Unknown, degrade.Unknown})
+			continue
+		}
+		events := strconv.Itoa(s.Events)
+		if s.Sampled {
+			events = fmt.Sprintf("%d (first %d)", s.Events, maxEvents)
+		}
+		rows = append(rows, []string{
+			s.KeyID,
+			formatAliases(s.Aliases),
+			events,
+			strconv.Itoa(s.WithoutContext),
+			strconv.Itoa(len(s.Sets)),
+			render.ValueOrDash(strings.Join(s.AlwaysPresent, ", ")),
+		})
+	}
+	return headers, rows
+}
+
+func encryptionContextSetRows(stats []KeyContextStats) ([]string, [][]string) {
+	headers := []string{"Key ID", "Context Keys", "Events", "Operations", "Last Seen"}
+
+	var rows [][]string
+	for _, s := range stats {
+		for _, set := range s.Sets {
+			keys := "(none)"
+			if len(set.Keys) > 0 {
+				keys = strings.Join(set.Keys, ", ")
+			}
+			rows = append(rows, []string{
+				s.KeyID,
+				keys,
+				strconv.Itoa(set.Events),
+				strings.Join(set.Operations, ", "),
+				set.LastSeen.Format(dateFormat),
+			})
+		}
+	}
+	return headers, rows
+}
+
+func runMigrate(args []string) {
+	if len(args) == 0 || (args[0] != "plan" && args[0] != "start" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, "Usage: migrate <plan|start|status> [flags]")
+		fmt.Fprintln(os.Stderr, "  plan    Show what a migration to a custom key store would do and write the state file")
+		fmt.Fprintln(os.Stderr, "  start   Create the target key and mirror tags, policy, and grants")
+		fmt.Fprintln(os.Stderr, "  status  Report re-encryption and cutover progress from the state file")
+		exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	sourceKey := fs.String("source-key", "", "Source KMS key ID, ARN, or alias (plan/start)")
+	keyStoreID := fs.String("custom-key-store-id", "", "Target CloudHSM or external key store ID (plan/start)")
+	xksKeyID := fs.String("xks-key-id", "", "External key ID in the XKS proxy (external key stores only)")
+	statePath := fs.String("state", "migration-state.json", "Migration state/manifest file")
+	yes := fs.Bool("yes", false, "Skip the interactive confirmation (start)")
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args[1:])
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+
+	caller := printBanner(ctx, cfg, os.Stdout, awsOptions.Profile)
+
+	client := kms.NewFromConfig(cfg)
+	smClient := secretsmanager.NewFromConfig(cfg)
+
+	if action == "status" {
+		state, err := readMigrationState(*statePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading state file: %v\n", err)
+			exit(1)
+		}
+		if err := printMigrationStatus(ctx, client, smClient, state); err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking migration status: %v\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *sourceKey == "" || *keyStoreID == "" {
+		fmt.Fprintln(os.Stderr, "Error: --source-key and --custom-key-store-id are required")
+		exit(1)
+	}
+
+	state, grants, tags, policy, err := planMigration(ctx, client, smClient, *sourceKey, *keyStoreID, *xksKeyID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning migration: %v\n", err)
+		exit(1)
+	}
+
+	// Plan
+	fmt.Println("=== MIGRATION PLAN ===")
+	fmt.Println()
+	fmt.Printf("Source Key:        %s\n", state.SourceKeyArn)
+	fmt.Printf("Custom Key Store:  %s (%s)\n", state.CustomKeyStoreID, state.CustomKeyStoreType)
+	fmt.Printf("Tags to mirror:    %d\n", len(tags))
+	fmt.Printf("Grants to mirror:  %d\n", len(grants))
+	fmt.Printf("Aliases to move:   %s\n", formatAliases(state.Aliases))
+	fmt.Printf("Dependent secrets: %d\n", len(state.Resources))
+	if len(state.Resources) > 0 {
+		fmt.Println()
+		printMigrationResourcesTable(state.Resources, nil)
+	}
+	fmt.Println()
+	fmt.Println("Only Secrets Manager secrets are discovered as dependents. Data encrypted under the key elsewhere")
+	fmt.Println("(S3, EBS, RDS, DynamoDB, application data keys) is not listed and must be re-encrypted separately.")
+	fmt.Println()
+
+	if action == "plan" {
+		if err := writeMigrationState(*statePath, state); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing state file: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("Wrote migration plan to %s\n", *statePath)
+		fmt.Println("Run 'migrate start' with the same flags to create the target key.")
+		return
+	}
+
+	// Refuse to create a second target key for an in-flight migration
+	if existing, err := readMigrationState(*statePath); err == nil && existing.TargetKeyID != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s already records target key %s; use 'migrate status'\n", *statePath, existing.TargetKeyID)
+		exit(1)
+	}
+
+	if !*yes {
+		// Never ask someone to confirm an account we couldn't show them
+		if caller == nil {
+			fmt.Fprintln(os.Stderr, "Error: could not resolve the caller identity; pass --yes to proceed anyway")
+			exit(1)
+		}
+		if !identity.Confirm(caller, []string{cfg.Region}, "This will create a new KMS key in the custom key store and copy tags, policy, and grants.") {
+			fmt.Println("Operation cancelled")
+			return
+		}
+	}
+
+	if err := startMigration(ctx, client, state, grants, tags, policy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting migration: %v\n", err)
+		// Persist partial progress so status can report it, and say so if
+		// even that failed, since a created target key would then be untracked
+		if stateErr := writeMigrationState(*statePath, state); stateErr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing state file: %v\n", stateErr)
+			if state.TargetKeyID != "" {
+				fmt.Fprintf(os.Stderr, "Target key %s was created but is not recorded anywhere; record or schedule it for deletion by hand\n", state.TargetKeyArn)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Partial progress written to %s\n", *statePath)
+		}
+		exit(1)
+	}
+
+	if err := writeMigrationState(*statePath, state); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing state file: %v\n", err)
+		exit(1)
+	}
+
+	fmt.Printf("Created target key: %s\n", state.TargetKeyArn)
+	fmt.Printf("  Tags mirrored:   %d\n", state.TagsMirrored)
+	fmt.Printf("  Policy mirrored: %t\n", state.PolicyMirrored)
+	fmt.Printf("  Grants mirrored: %d (failed: %d)\n", state.GrantsMirrored, len(state.GrantsFailed))
+	fmt.Println()
+	fmt.Printf("Re-encryption manifest written to %s\n", *statePath)
+	fmt.Println("Re-encrypt dependent resources, then repoint aliases with 'aws kms update-alias'.")
+	fmt.Println("Track progress with 'migrate status'.")
+}
+
+func runScheduleDeletion(args []string) {
+	var keyRefs, filterTags stringSliceFlag
+	fs := flag.NewFlagSet("schedule-deletion", flag.ExitOnError)
+	fs.Var(&keyRefs, "key", "Key ID, ARN, or alias to delete (repeatable)")
+	keyFile := fs.String("key-file", "", "File of keys to delete, one ID, ARN, or alias per line (# comments and blank lines are ignored)")
+	fs.Var(&filterTags, "filter-tag", "Delete the customer managed keys with this tag, as Key=Value or Key (repeatable, all must match)")
+	pendingDays := fs.Int("pending-days", 30, "Waiting period before the keys are deleted, 7 to 30 days, during which deletion can be cancelled")
+	lookbackDays := fs.Int("lookback-days", 30, "Treat a key used in CloudTrail within N days as in use (at most 90)")
+	force := fs.Bool("force", false, "Also schedule keys that have blockers")
+	yes := fs.Bool("yes", false, "Schedule the deletions; without it only the impact report is printed")
+	format := fs.String("format", "table", "Output format: table or json")
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table or json)\n", *format)
+		exit(1)
+	}
+	if *pendingDays < 7 || *pendingDays > 30 {
+		fmt.Fprintln(os.Stderr, "Error: --pending-days must be between 7 and 30")
+		exit(1)
+	}
+	if *lookbackDays < 1 || *lookbackDays > 90 {
+		fmt.Fprintln(os.Stderr, "Error: --lookback-days must be between 1 and 90")
+		exit(1)
+	}
+	tagFilters, err := tagpolicy.ParseFilters(filterTags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if *keyFile != "" {
+		refs, err := readKeyFile(*keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading key file: %v\n", err)
+			exit(1)
+		}
+		keyRefs = append(keyRefs, refs...)
+	}
+	if len(keyRefs) == 0 && len(tagFilters) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: pass --key, --key-file, or --filter-tag")
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+
+	banner := os.Stdout
+	if *format == "json" {
+		banner = os.Stderr
+	}
+	printBanner(ctx, cfg, banner, awsOptions.Profile)
+
+	client := kms.NewFromConfig(cfg)
+	inventory := kmsinv.NewCache(client)
+	resolver := kmsinv.NewResolver(inventory)
+	trail := cloudtrail.NewFromConfig(cfg)
+
+	// Aliases are a blocker, so not knowing them must block too
+	aliasIndex, aliasErr := resolver.AliasesByKey(ctx)
+
+	keyIDs, err := resolver.ResolveAll(ctx, keyRefs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if len(tagFilters) > 0 {
+		// A key whose tags can't be read isn't selected, and is reported
+		degraded := degrade.NewTracker()
+		tagged, err := kmsinv.ListScoped(ctx, inventory, kmsinv.Scope{TagFilters: tagFilters}, aliasIndex, degraded)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing keys: %v\n", err)
+			exit(1)
+		}
+		for _, warning := range degraded.Warnings() {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		for _, key := range tagged {
+			keyIDs = append(keyIDs, aws.ToString(key.KeyId))
+		}
+	}
+
+	// Secrets are listed once for every key, including those scheduled for
+	// deletion, which can't be restored once their key is gone
+	secrets, secretsErr := secretsinv.List(ctx, secretsmanager.NewFromConfig(cfg), secretsinv.ListOptions{IncludeDeleted: true})
+
+	since := time.Now().AddDate(0, 0, -*lookbackDays)
+	var candidates []DeletionCandidate
+	seen := make(map[string]bool)
+	for _, keyID := range keyIDs {
+		output, err := inventory.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+		if err != nil {
+			candidates = append(candidates, DeletionCandidate{KeyID: keyID, Status: kmsinv.Failed, Action: actionFailed, Error: err.Error()})
+			continue
+		}
+		metadata := output.KeyMetadata
+		id := aws.ToString(metadata.KeyId)
+		// The same key can be named by ID, ARN, alias, and tag
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		candidate := DeletionCandidate{
+			KeyID:   id,
+			KeyArn:  aws.ToString(metadata.Arn),
+			Aliases: aliasIndex[id],
+			Status:  string(metadata.KeyState),
+		}
+		// A primary key's replicas outlive it and can't be re-replicated once
+		// it's gone; deleting a replica leaves the others alone
+		if multiRegion := metadata.MultiRegionConfiguration; multiRegion != nil && multiRegion.MultiRegionKeyType == types.MultiRegionKeyTypePrimary {
+			for _, replica := range multiRegion.ReplicaKeys {
+				candidate.Replicas = append(candidate.Replicas, aws.ToString(replica.Region))
+			}
+		}
+		switch {
+		case metadata.KeyManager == types.KeyManagerTypeAws:
+			candidate.Action = actionNotDeletable
+			candidate.Error = "AWS managed keys can't be deleted"
+		case metadata.KeyState == types.KeyStatePendingDeletion || metadata.KeyState == types.KeyStatePendingReplicaDeletion:
+			candidate.Action = actionAlreadyPending
+			candidate.DeletionDate = metadata.DeletionDate
+		default:
+			candidate.Blockers = deletionBlockers(ctx, client, trail, &candidate, since, *lookbackDays, aliasErr, secrets, secretsErr)
+			candidate.Action = actionWouldSchedule
+			if len(candidate.Blockers) > 0 && !*force {
+				candidate.Action = actionBlocked
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 {
+		fmt.Fprintln(os.Stderr, "No keys matched")
+		return
+	}
+
+	toSchedule := 0
+	for _, candidate := range candidates {
+		if candidate.Action == actionWouldSchedule {
+			toSchedule++
+		}
+	}
+
+	if *yes && toSchedule > 0 {
+		for i := range candidates {
+			candidate := &candidates[i]
+			if candidate.Action != actionWouldSchedule {
+				continue
+			}
+			output, err := client.ScheduleKeyDeletion(ctx, &kms.ScheduleKeyDeletionInput{
+				KeyId:               aws.String(candidate.KeyID),
+				PendingWindowInDays: aws.Int32(int32(*pendingDays)),
+			})
+			if err != nil {
+				usage.Class(awserr.Classify(err))
+				candidate.Action = actionFailed
+				candidate.Error = err.Error()
+				continue
+			}
+			candidate.Action = actionScheduled
+			candidate.Status = string(output.KeyState)
+			candidate.DeletionDate = output.DeletionDate
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, candidate := range candidates {
+		counts[candidate.Action]++
+	}
+
+	if *format == "json" {
+		if err := render.JSON(os.Stdout, candidates); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+	} else {
+		fmt.Println("=== DELETION IMPACT ===")
+		fmt.Println()
+		printTable(deletionCandidateRows(candidates, *lookbackDays))
+		fmt.Println()
+		fmt.Printf("Keys: %d\n", len(candidates))
+		if *yes {
+			fmt.Printf("  Scheduled for deletion in %d days: %d\n", *pendingDays, counts[actionScheduled])
+		} else {
+			fmt.Printf("  Would be scheduled for deletion in %d days: %d\n", *pendingDays, counts[actionWouldSchedule])
+		}
+		fmt.Printf("  Blocked: %d\n", counts[actionBlocked])
+		fmt.Printf("  Already pending deletion: %d\n", counts[actionAlreadyPending])
+		if counts[actionNotDeletable]+counts[actionFailed] > 0 {
+			fmt.Printf("  Not deletable or failed: %d\n", counts[actionNotDeletable]+counts[actionFailed])
+		}
+		if counts[actionScheduled] > 0 {
+			fmt.Println()
+			fmt.Println("Deletion can be cancelled until the deletion date with 'aws kms cancel-key-deletion --key-id <key>'.")
+		}
+		if !*yes && counts[actionWouldSchedule] > 0 {
+			fmt.Println()
+			fmt.Println("Dry run: nothing was changed. Re-run with --yes to schedule the deletions.")
+		}
+		if counts[actionBlocked] > 0 {
+			fmt.Println("Blocked keys are left alone; check what still uses them, or pass --force to schedule them anyway.")
+		}
+	}
+
+	if counts[actionFailed] > 0 {
+		exit(1)
+	}
+	if counts[actionBlocked] > 0 {
+		exit(2)
+	}
+}
+
+// deletionBlockers fills in what still depends on candidate and returns why
+// it shouldn't be deleted. A check that fails is a blocker of its own, since
+// the key can't be shown to be unused.
+func deletionBlockers(ctx context.Context, client *kms.Client, trail *cloudtrail.Client, candidate *DeletionCandidate, since time.Time, lookbackDays int, aliasErr error, secrets []secretsmanagertypes.SecretListEntry, secretsErr error) []string {
+	var blockers []string
+
+	record, err := lastKeyUse(ctx, trail, candidate.KeyArn, since)
+	switch {
+	case err != nil:
+		blockers = append(blockers, "usage unknown: "+awserr.Describe(err))
+	case record != nil:
+		eventTime := record.EventTime
+		candidate.LastUsed = &eventTime
+		candidate.LastOperation = record.EventName
+		candidate.LastPrincipal = record.UserIdentity.ARN
+		blockers = append(blockers, fmt.Sprintf("used in the last %d days", lookbackDays))
+	}
+
+	if secretsErr != nil {
+		blockers = append(blockers, "secrets unknown: "+awserr.Describe(secretsErr))
+	} else {
+		references := keyReferences(candidate.KeyID, candidate.KeyArn, candidate.Aliases)
+		for _, secret := range secrets {
+			if references[aws.ToString(secret.KmsKeyId)] {
+				candidate.Secrets = append(candidate.Secrets, aws.ToString(secret.Name))
+			}
+		}
+		if len(candidate.Secrets) > 0 {
+			blockers = append(blockers, fmt.Sprintf("%d secret(s)", len(candidate.Secrets)))
+		}
+	}
+
+	if aliasErr != nil {
+		blockers = append(blockers, "aliases unknown: "+awserr.Describe(aliasErr))
+	} else if len(candidate.Aliases) > 0 {
+		blockers = append(blockers, fmt.Sprintf("%d alias(es)", len(candidate.Aliases)))
+	}
+
+	if len(candidate.Replicas) > 0 {
+		blockers = append(blockers, fmt.Sprintf("%d replica(s) in %s", len(candidate.Replicas), strings.Join(candidate.Replicas, ", ")))
+	}
+
+	grants, err := listKeyGrants(ctx, client, candidate.KeyID)
+	if err != nil {
+		blockers = append(blockers, "grants unknown: "+awserr.Describe(err))
+	} else if candidate.Grants = len(grants); candidate.Grants > 0 {
+		blockers = append(blockers, fmt.Sprintf("%d grant(s)", candidate.Grants))
+	}
+
+	return blockers
+}
+
+// readKeyFile reads one key reference per line, skipping blank lines and
+// # comments.
+func readKeyFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs, nil
+}
+
+func planMigration(ctx context.Context, client *kms.Client, smClient *secretsmanager.Client, sourceKey, keyStoreID, xksKeyID string) (*MigrationState, []types.GrantListEntry, []types.Tag, *string, error) {
+	describeOutput, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: &sourceKey})
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to describe source key: %w", err)
+	}
+	metadata := describeOutput.KeyMetadata
+
+	// Custom key stores only hold symmetric encryption keys
+	if metadata.KeySpec != types.KeySpecSymmetricDefault || metadata.KeyUsage != types.KeyUsageTypeEncryptDecrypt {
+		return nil, nil, nil, nil, fmt.Errorf("source key is %s/%s; custom key stores only support SYMMETRIC_DEFAULT encryption keys", metadata.KeySpec, metadata.KeyUsage)
+	}
+
+	storesOutput, err := client.DescribeCustomKeyStores(ctx, &kms.DescribeCustomKeyStoresInput{
+		CustomKeyStoreId: &keyStoreID,
+	})
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to describe custom key store: %w", err)
+	}
+	if len(storesOutput.CustomKeyStores) == 0 {
+		return nil, nil, nil, nil, fmt.Errorf("custom key store %s not found", keyStoreID)
+	}
+	store := storesOutput.CustomKeyStores[0]
+
+	if store.ConnectionState != types.ConnectionStateTypeConnected {
+		return nil, nil, nil, nil, fmt.Errorf("custom key store %s is %s, it must be CONNECTED", keyStoreID, store.ConnectionState)
+	}
+	if store.CustomKeyStoreType == types.CustomKeyStoreTypeExternalKeyStore && xksKeyID == "" {
+		return nil, nil, nil, nil, fmt.Errorf("--xks-key-id is required for external key stores")
+	}
+
+	state := &MigrationState{
+		SourceKeyID:        aws.ToString(metadata.KeyId),
+		SourceKeyArn:       aws.ToString(metadata.Arn),
+		CustomKeyStoreID:   keyStoreID,
+		CustomKeyStoreType: string(store.CustomKeyStoreType),
+		XksKeyID:           xksKeyID,
+	}
+
+	tagsOutput, err := client.ListResourceTags(ctx, &kms.ListResourceTagsInput{KeyId: metadata.KeyId})
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to list source key tags: %w", err)
+	}
+
+	policy, err := getKeyPolicy(ctx, client, state.SourceKeyID)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to get source key policy: %w", err)
+	}
+	policyStr := string(policy)
+
+	var grants []types.GrantListEntry
+	var marker *string
+	for {
+		grantsOutput, err := client.ListGrants(ctx, &kms.ListGrantsInput{KeyId: metadata.KeyId, Marker: marker})
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to list source key grants: %w", err)
+		}
+		grants = append(grants, grantsOutput.Grants...)
+		if !grantsOutput.Truncated {
+			break
+		}
+		marker = grantsOutput.NextMarker
+	}
+
+	aliasIndex, err := kmsinv.AliasesByKey(ctx, client)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to list aliases: %w", err)
+	}
+	state.Aliases = aliasIndex[state.SourceKeyID]
+
+	state.Resources, err = findDependentSecrets(ctx, smClient, state.SourceKeyID, state.SourceKeyArn, state.Aliases)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to find dependent secrets: %w", err)
+	}
+
+	return state, grants, tagsOutput.Tags, &policyStr, nil
+}
+
+// keyReferences is every way a secret can name the key: its ID, ARN, alias
+// names, and alias ARNs.
+func keyReferences(keyID, keyArn string, aliases []string) map[string]bool {
+	references := map[string]bool{keyID: true, keyArn: true}
+	arnPrefix := strings.TrimSuffix(keyArn, "key/"+keyID)
+	for _, alias := range aliases {
+		references[alias] = true
+		references[arnPrefix+alias] = true
+	}
+	return references
+}
+
+func findDependentSecrets(ctx context.Context, smClient *secretsmanager.Client, keyID, keyArn string, aliases []string) ([]MigrationResource, error) {
+	references := keyReferences(keyID, keyArn, aliases)
+
+	var resources []MigrationResource
+	paginator := secretsmanager.NewListSecretsPaginator(smClient, &secretsmanager.ListSecretsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range page.SecretList {
+			if !references[aws.ToString(secret.KmsKeyId)] {
+				continue
+			}
+			resources = append(resources, MigrationResource{
+				Service:    "secretsmanager",
+				ResourceID: aws.ToString(secret.ARN),
+				Name:       aws.ToString(secret.Name),
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+func startMigration(ctx context.Context, client *kms.Client, state *MigrationState, grants []types.GrantListEntry, tags []types.Tag, policy *string) error {
+	origin := types.OriginTypeAwsCloudhsm
+	if state.CustomKeyStoreType == string(types.CustomKeyStoreTypeExternalKeyStore) {
+		origin = types.OriginTypeExternalKeyStore
+	}
+
+	input := &kms.CreateKeyInput{
+		CustomKeyStoreId: aws.String(state.CustomKeyStoreID),
+		Origin:           origin,
+		KeySpec:          types.KeySpecSymmetricDefault,
+		KeyUsage:         types.KeyUsageTypeEncryptDecrypt,
+		Description:      aws.String("Migrated from " + state.SourceKeyID),
+		Policy:           policy,
+		Tags:             tags,
+	}
+	if state.XksKeyID != "" {
+		input.XksKeyId = aws.String(state.XksKeyID)
+	}
+
+	output, err := client.CreateKey(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to create target key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	state.StartedAt = &now
+	state.TargetKeyID = aws.ToString(output.KeyMetadata.KeyId)
+	state.TargetKeyArn = aws.ToString(output.KeyMetadata.Arn)
+	state.TagsMirrored = len(tags)
+	state.PolicyMirrored = policy != nil
+
+	for _, grant := range grants {
+		_, err := client.CreateGrant(ctx, &kms.CreateGrantInput{
+			KeyId:             output.KeyMetadata.KeyId,
+			GranteePrincipal:  grant.GranteePrincipal,
+			RetiringPrincipal: grant.RetiringPrincipal,
+			Operations:        grant.Operations,
+			Constraints:       grant.Constraints,
+			Name:              grant.Name,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not mirror grant %s: %v\n", aws.ToString(grant.GrantId), err)
+			state.GrantsFailed = append(state.GrantsFailed, aws.ToString(grant.GrantId))
+			continue
+		}
+		state.GrantsMirrored++
+	}
+
+	for i := range state.Resources {
+		state.Resources[i].Action = fmt.Sprintf("aws secretsmanager update-secret --secret-id %s --kms-key-id %s",
+			state.Resources[i].ResourceID, state.TargetKeyArn)
+	}
+
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, client *kms.Client, smClient *secretsmanager.Client, state *MigrationState) error {
+	fmt.Println("=== MIGRATION STATUS ===")
+	fmt.Println()
+	fmt.Printf("Source Key: %s\n", state.SourceKeyArn)
+
+	if state.TargetKeyID == "" {
+		fmt.Println("Target Key: not created yet (run 'migrate start')")
+		return nil
+	}
+
+	describeOutput, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: &state.TargetKeyID})
+	if err != nil {
+		return fmt.Errorf("failed to describe target key: %w", err)
+	}
+	fmt.Printf("Target Key: %s (%s)\n", state.TargetKeyArn, describeOutput.KeyMetadata.KeyState)
+	fmt.Printf("  Tags mirrored:   %d\n", state.TagsMirrored)
+	fmt.Printf("  Policy mirrored: %t\n", state.PolicyMirrored)
+	fmt.Printf("  Grants mirrored: %d (failed: %d)\n", state.GrantsMirrored, len(state.GrantsFailed))
+	fmt.Println()
+
+	// Re-encryption progress
+	aliasIndex, err := kmsinv.AliasesByKey(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to list aliases: %w", err)
+	}
+	targetAliases := aliasIndex[state.TargetKeyID]
+
+	targetRefs := map[string]bool{state.TargetKeyID: true, state.TargetKeyArn: true}
+	arnPrefix := strings.TrimSuffix(state.TargetKeyArn, "key/"+state.TargetKeyID)
+	for _, alias := range targetAliases {
+		targetRefs[alias] = true
+		targetRefs[arnPrefix+alias] = true
+	}
+
+	done := make(map[string]bool)
+	for _, resource := range state.Resources {
+		output, err := smClient.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+			SecretId: aws.String(resource.ResourceID),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not describe secret %s: %v\n", resource.Name, err)
+			continue
+		}
+		done[resource.ResourceID] = targetRefs[aws.ToString(output.KmsKeyId)]
+	}
+
+	reencrypted := 0
+	for _, ok := range done {
+		if ok {
+			reencrypted++
+		}
+	}
+
+	if len(state.Resources) > 0 {
+		printMigrationResourcesTable(state.Resources, done)
+		fmt.Println()
+	}
+	fmt.Printf("Re-encrypted: %d/%d\n", reencrypted, len(state.Resources))
+
+	// Alias cutover progress
+	moved := 0
+	for _, alias := range state.Aliases {
+		for _, targetAlias := range targetAliases {
+			if alias == targetAlias {
+				moved++
+			}
+		}
+	}
+	fmt.Printf("Aliases repointed: %d/%d\n", moved, len(state.Aliases))
+
+	if reencrypted == len(state.Resources) && moved == len(state.Aliases) {
+		fmt.Println()
+		fmt.Println("Migration complete. The source key can be disabled and scheduled for deletion.")
+	}
+
+	return nil
+}
+
+func printMigrationResourcesTable(resources []MigrationResource, done map[string]bool) {
+	headers := []string{"Service", "Name", "Resource ID"}
+	if done != nil {
+		headers = append(headers, "Re-encrypted")
+	}
+
+	var rows [][]string
+	for _, resource := range resources {
+		row := []string{resource.Service, resource.Name, resource.ResourceID}
+		if done != nil {
+			status := "no"
+			if done[resource.ResourceID] {
+				status = "yes"
+			}
+			row = append(row, status)
+		}
+		rows = append(rows, row)
+	}
+
+	render.Table(os.Stdout, headers, rows)
+}
+
+func readMigrationState(filename string) (*MigrationState, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var state MigrationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return &state, nil
+}
+
+func writeMigrationState(filename string, state *MigrationState) error {
+	state.ToolVersion = version.Get().String()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+func runPolicy(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "generate":
+			runPolicyGenerate(args[1:])
+			return
+		case "minimize":
+			runPolicyMinimize(args[1:])
+			return
+		case "simulate":
+			runPolicySimulate(args[1:])
+			return
+		case "audit":
+			runPolicyAudit(args[1:])
+			return
+		case "put":
+			runPolicyPut(args[1:])
+			return
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "Usage: policy <generate|put|minimize|simulate|audit> [flags]")
+	fmt.Fprintln(os.Stderr, "  generate  Compose a key policy from the named building blocks")
+	fmt.Fprintln(os.Stderr, "  put       Replace a key's policy with one composed from the building blocks")
+	fmt.Fprintln(os.Stderr, "  minimize  Find redundant or shadowed statements and suggest a minimized policy")
+	fmt.Fprintln(os.Stderr, "  simulate  Explain whether a principal may perform an action on a key")
+	fmt.Fprintln(os.Stderr, "  audit     Flag wildcard principals, external accounts, and broad full access in key policies")
+	exit(1)
+}
+
+// policyBlocks are the flags of policy generate, policy put, and create-key
+// that pick the building blocks a key policy is composed from.
+type policyBlocks struct {
+	adminRoles, usageRoles, crossAccounts stringSliceFlag
+	viaService, breakGlassRole            string
+}
+
+func (b *policyBlocks) register(fs *flag.FlagSet) {
+	fs.Var(&b.adminRoles, "admin-role", "Key administrator role ARN (repeatable)")
+	fs.Var(&b.usageRoles, "usage-role", "Role ARN allowed to use the key (repeatable)")
+	fs.Var(&b.crossAccounts, "cross-account", "External account ID allowed to use the key (repeatable)")
+	fs.StringVar(&b.viaService, "via-service", "", "Restrict cross-account use to this kms:ViaService (e.g. secretsmanager.us-east-1.amazonaws.com)")
+	fs.StringVar(&b.breakGlassRole, "break-glass-role", "", "Only this role may schedule deletion of or disable the key")
+}
+
+// document composes the policy of a key owned by account in partition.
+func (b *policyBlocks) document(partition, account string) keypolicy.Document {
+	policy := keypolicy.Document{
+		Version:   "2012-10-17",
+		Statement: []keypolicy.Statement{keypolicy.RootAccessBlock(partition, account)},
+	}
+
+	if len(b.adminRoles) > 0 {
+		policy.Statement = append(policy.Statement, keypolicy.AdminBlock(b.adminRoles...))
+	}
+
+	for _, role := range b.usageRoles {
+		policy.Statement = append(policy.Statement, keypolicy.UsageBlock(role))
+	}
+
+	for _, crossAccount := range b.crossAccounts {
+		var conditions map[string]map[string]keypolicy.StringList
+		if b.viaService != "" {
+			conditions = map[string]map[string]keypolicy.StringList{
+				"StringEquals": {"kms:ViaService": {b.viaService}},
+			}
+		}
+		policy.Statement = append(policy.Statement, keypolicy.CrossAccountUse(partition, crossAccount, conditions))
+	}
+
+	if b.breakGlassRole != "" {
+		policy.Statement = append(policy.Statement, keypolicy.DenyDeletion(b.breakGlassRole))
+	}
+	return policy
+}
+
+func runPolicyGenerate(args []string) {
+	var blocks policyBlocks
+	fs := flag.NewFlagSet("policy generate", flag.ExitOnError)
+	account := fs.String("account", "", "Account ID that owns the key (root access block)")
+	partition := fs.String("partition", "aws", "Partition of the account: aws, aws-cn, or aws-us-gov")
+	blocks.register(fs)
+	fs.Parse(args)
+
+	if *account == "" {
+		fmt.Fprintln(os.Stderr, "Error: --account is required")
+		exit(1)
+	}
+
+	if err := render.JSON(os.Stdout, blocks.document(*partition, *account)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing policy: %v\n", err)
+		exit(1)
+	}
+}
+
+// runPolicyPut replaces a key's policy with one composed from the building
+// blocks, for the key's own account and partition.
+func runPolicyPut(args []string) {
+	var blocks policyBlocks
+	fs := flag.NewFlagSet("policy put", flag.ExitOnError)
+	keyRef := fs.String("key", "", "Key ID, ARN, or alias whose policy to replace")
+	yes := fs.Bool("yes", false, "Replace the policy; without it the composed policy is only printed")
+	blocks.register(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *keyRef == "" {
+		fmt.Fprintln(os.Stderr, "Error: --key is required")
+		exit(1)
+	}
+
+	ctx := context.Background()
+	client, keyArn := keyForPolicyChange(ctx, *keyRef)
+	putPolicy(ctx, client, keyArn, blocks.document(keyArn.Partition, keyArn.AccountID), *yes)
+}
+
+// runProtect adds the DenyDeletion block to a key's existing policy, or
+// replaces the one already there, leaving every other statement as it is.
+func runProtect(args []string) {
+	fs := flag.NewFlagSet("protect", flag.ExitOnError)
+	keyRef := fs.String("key", "", "Key ID, ARN, or alias to protect")
+	breakGlassRole := fs.String("break-glass-role", "", "The only role that may schedule deletion of or disable the key")
+	yes := fs.Bool("yes", false, "Update the policy; without it the new policy is only printed")
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *keyRef == "" || *breakGlassRole == "" {
+		fmt.Fprintln(os.Stderr, "Error: --key and --break-glass-role are required")
+		exit(1)
+	}
+
+	ctx := context.Background()
+	client, keyArn := keyForPolicyChange(ctx, *keyRef)
+
+	raw, err := getKeyPolicy(ctx, client, keyArn.String())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting key policy: %v\n", err)
+		exit(1)
+	}
+	var policy keypolicy.Document
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing policy: %v\n", err)
+		exit(1)
+	}
+	policy.SetStatement(keypolicy.DenyDeletion(*breakGlassRole))
+	putPolicy(ctx, client, keyArn, policy, *yes)
+}
+
+// keyForPolicyChange loads the AWS config, prints the banner, and resolves
+// the key to its ARN, whose account and partition the policy is written for.
+func keyForPolicyChange(ctx context.Context, ref string) (*kms.Client, arn.ARN) {
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+	printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+
+	client := kms.NewFromConfig(cfg)
+	keyID, err := kmsinv.NewResolver(client).Resolve(ctx, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	output, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error describing key %s: %v\n", ref, err)
+		exit(1)
+	}
+	keyArn, err := arn.Parse(aws.ToString(output.KeyMetadata.Arn))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: key %s has no usable ARN: %v\n", ref, err)
+		exit(1)
+	}
+	return client, keyArn
+}
+
+// putPolicy prints the policy and, with yes, sets it as the key's policy. The
+// lockout safety check stays on, so KMS rejects a policy that would lock the
+// caller out.
+func putPolicy(ctx context.Context, client *kms.Client, keyArn arn.ARN, policy keypolicy.Document, yes bool) {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing policy: %v\n", err)
+		exit(1)
+	}
+	fmt.Println(string(data))
+
+	if !yes {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Dry run: nothing was changed. Re-run with --yes to set this as the key policy.")
+		return
+	}
+	if _, err := client.PutKeyPolicy(ctx, &kms.PutKeyPolicyInput{
+		KeyId:      aws.String(keyArn.String()),
+		PolicyName: aws.String("default"),
+		Policy:     aws.String(string(data)),
+	}); err != nil {
+		usage.Class(awserr.Classify(err))
+		fmt.Fprintf(os.Stderr, "Error putting key policy: %v\n", err)
+		exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Updated the policy of %s\n", keyArn)
+}
+
+// runCreateKey creates a symmetric key whose policy is composed from the
+// building blocks, for the caller's account and partition.
+func runCreateKey(args []string) {
+	var blocks policyBlocks
+	var tagFlags stringSliceFlag
+	fs := flag.NewFlagSet("create-key", flag.ExitOnError)
+	description := fs.String("description", "", "Key description")
+	alias := fs.String("alias", "", "Alias to create for the key (e.g. alias/app-data)")
+	fs.Var(&tagFlags, "tag", "Tag the key, as Key=Value (repeatable)")
+	yes := fs.Bool("yes", false, "Create the key; without it the policy is only printed")
+	blocks.register(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *alias != "" && !strings.HasPrefix(*alias, "alias/") {
+		fmt.Fprintln(os.Stderr, "Error: --alias must start with alias/")
+		exit(1)
+	}
+	var tags []types.Tag
+	for _, flagValue := range tagFlags {
+		key, value, ok := strings.Cut(flagValue, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid --tag %q (use Key=Value)\n", flagValue)
+			exit(1)
+		}
+		tags = append(tags, types.Tag{TagKey: aws.String(key), TagValue: aws.String(value)})
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+		exit(1)
+	}
+	// The root access block names the caller's account, in its partition
+	caller := printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+	if caller == nil {
+		fmt.Fprintln(os.Stderr, "Error: could not resolve the caller identity, which the key policy is written for")
+		exit(1)
+	}
+	callerArn, err := arn.Parse(caller.ARN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: caller %s has no usable ARN: %v\n", caller.ARN, err)
+		exit(1)
+	}
+
+	policy := blocks.document(callerArn.Partition, caller.Account)
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing policy: %v\n", err)
+		exit(1)
+	}
+	fmt.Println(string(data))
+
+	if !*yes {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Dry run: nothing was changed. Re-run with --yes to create the key.")
+		return
+	}
+
+	client := kms.NewFromConfig(cfg)
+	output, err := client.CreateKey(ctx, &kms.CreateKeyInput{
+		Description: aws.String(*description),
+		Policy:      aws.String(string(data)),
+		Tags:        tags,
+	})
+	if err != nil {
+		usage.Class(awserr.Classify(err))
+		fmt.Fprintf(os.Stderr, "Error creating key: %v\n", err)
+		exit(1)
+	}
+	keyID := aws.ToString(output.KeyMetadata.KeyId)
+	fmt.Fprintf(os.Stderr, "Created key %s\n", aws.ToString(output.KeyMetadata.Arn))
+
+	if *alias != "" {
+		if _, err := client.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: alias, TargetKeyId: aws.String(keyID)}); err != nil {
+			usage.Class(awserr.Classify(err))
+			fmt.Fprintf(os.Stderr, "Error creating alias %s for key %s: %v\n", *alias, keyID, err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Created alias %s\n", *alias)
+	}
+}
+
+func runPolicyMinimize(args []string) {
+	fs := flag.NewFlagSet("policy minimize", flag.ExitOnError)
+	keyID := fs.String("key", "", "Key ID, ARN, or alias whose policy to analyze")
+	file := fs.String("file", "", "Analyze a policy JSON file instead of fetching one")
+	output := fs.String("output", "", "Write the minimized policy to this file")
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if (*keyID == "") == (*file == "") {
+		fmt.Fprintln(os.Stderr, "Error: exactly one of --key or --file is required")
+		exit(1)
+	}
+
+	var raw []byte
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading policy: %v\n", err)
+			exit(1)
+		}
+		raw = data
+	} else {
+		ctx := context.Background()
+		cfg, err := awsOptions.Load(ctx)
+		if err != nil {
+			usage.Error(err)
+			fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+			exit(1)
+		}
+		printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+		client := kms.NewFromConfig(cfg)
+		resolved, err := kmsinv.NewResolver(client).Resolve(ctx, *keyID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		policy, err := getKeyPolicy(ctx, client, resolved)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting key policy: %v\n", err)
+			exit(1)
+		}
+		raw = policy
+	}
+
+	var policy keypolicy.Document
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing policy: %v\n", err)
+		exit(1)
+	}
+
+	minimized, findings := keypolicy.Minimize(policy)
+
+	if len(findings) == 0 {
+		fmt.Println("No redundant, shadowed, or mergeable statements found")
+		return
+	}
+
+	fmt.Println("=== FINDINGS ===")
+	fmt.Println()
+	printPolicyFindingsTable(findings)
+
+	before, _ := json.MarshalIndent(policy, "", "  ")
+	after, _ := json.MarshalIndent(minimized, "", "  ")
+
+	fmt.Println()
+	fmt.Println("=== SUGGESTED POLICY DIFF ===")
+	fmt.Println()
+	for _, line := range render.Diff(strings.Split(string(before), "\n"), strings.Split(string(after), "\n")) {
+		fmt.Println(line)
+	}
+
+	if *output != "" {
+		if err := os.WriteFile(*output, append(after, '\n'), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing minimized policy: %v\n", err)
+			exit(1)
+		}
+		fmt.Println()
+		fmt.Printf("Wrote minimized policy to %s\n", *output)
+	}
+}
+
+// KeyPolicyAudit is the audit result for one key.
+type KeyPolicyAudit struct {
+	KeyID    string                   `json:"key_id"`
+	Findings []keypolicy.AuditFinding `json:"findings"`
+}
+
+// runPolicyAudit checks key policies for statements that open a key to more
+// principals than intended, exiting 2 when any finding reaches --fail-on.
+func runPolicyAudit(args []string) {
+	var keyIDs stringSliceFlag
+	fs := flag.NewFlagSet("policy audit", flag.ExitOnError)
+	fs.Var(&keyIDs, "key", "Key ID, ARN, or alias to audit (repeatable; default: every customer managed key in the region)")
+	file := fs.String("file", "", "Audit a policy JSON file instead of fetching key policies")
+	account := fs.String("account", "", "With --file, the account that owns the key (default: the caller's account)")
+	trustedAccounts := fs.String("trusted-accounts", "", "Comma-separated account IDs that may be granted access without a finding")
+	broadPrincipals := fs.String("broad-principals", strings.Join(keypolicy.DefaultBroadPrincipals, ","), "Comma-separated principal ARN patterns that many people can assume")
+	failOn := fs.String("fail-on", "high", "Exit non-zero when a finding is at least this severe: high, medium, or low")
+	format := fs.String("format", "table", "Output format: table or json")
+	offline := fs.String("offline", "", "Audit the key policies in this kms-keys snapshot (taken with --include-policies) instead of fetching them")
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table or json)\n", *format)
+		exit(1)
+	}
+	if *file != "" && len(keyIDs) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --file and --key are mutually exclusive")
+		exit(1)
+	}
+	if *file != "" && *offline != "" {
+		fmt.Fprintln(os.Stderr, "Error: --file and --offline are mutually exclusive")
+		exit(1)
+	}
+	threshold, err := keypolicy.ParseSeverity(*failOn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	opts := keypolicy.AuditOptions{
+		Account:         *account,
+		TrustedAccounts: tagpolicy.ParseRequired(*trustedAccounts),
+		BroadPrincipals: tagpolicy.ParseRequired(*broadPrincipals),
+	}
+
+	// Each entry is a key (or the file) and its raw policy
+	type policySource struct {
+		keyID  string
+		policy []byte
+	}
+	var sources []policySource
+	degraded := degrade.NewTracker()
+
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading policy: %v\n", err)
+			exit(1)
+		}
+		sources = append(sources, policySource{keyID: *file, policy: data})
+	}
+
+	if *offline != "" {
+		snap, keys, err := readKeySnapshot(*offline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading snapshot: %v\n", err)
+			exit(1)
+		}
+		if opts.Account == "" {
+			opts.Account = snap.Account
+		}
+		if opts.Account == "" {
+			fmt.Fprintf(os.Stderr, "Error: %s doesn't record its account; pass --account\n", *offline)
+			exit(1)
+		}
+		selected, err := selectSnapshotKeys(keys, keyIDs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		withoutPolicy := 0
+		for _, key := range selected {
+			if key.Policy == nil {
+				withoutPolicy++
+				continue
+			}
+			sources = append(sources, policySource{keyID: key.KeyID, policy: key.Policy})
+		}
+		if len(sources) == 0 && withoutPolicy > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %s has no key policies; take the snapshot with --include-policies\n", *offline)
+			exit(1)
+		}
+		if withoutPolicy > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d key(s) in the snapshot have no policy and were not audited\n", withoutPolicy)
+		}
+	}
+
+	ctx := context.Background()
+	if *offline == "" && (*file == "" || opts.Account == "") {
+		cfg, err := awsOptions.Load(ctx)
+		if err != nil {
+			usage.Error(err)
+			fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+			exit(1)
+		}
+		caller := printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+		if opts.Account == "" && caller != nil {
+			opts.Account = caller.Account
+		}
+
+		if *file == "" {
+			client := kms.NewFromConfig(cfg)
+			if len(keyIDs) == 0 {
+				keys, err := kmsinv.ListCustomerManaged(ctx, client)
+				if err != nil {
+					usage.Error(err)
+					fmt.Fprintf(os.Stderr, "Error listing keys: %v\n", err)
+					exit(1)
+				}
+				for _, key := range keys {
+					keyIDs = append(keyIDs, aws.ToString(key.KeyArn))
+				}
+			} else {
+				resolved, err := kmsinv.NewResolver(client).ResolveAll(ctx, keyIDs)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					exit(1)
+				}
+				keyIDs = resolved
+			}
+			for _, keyID := range keyIDs {
+				policy, err := getKeyPolicy(ctx, client, keyID)
+				if err != nil {
+					degraded.Record(degrade.Policy, err)
+					continue
+				}
+				sources = append(sources, policySource{keyID: keyID, policy: policy})
+			}
+		}
+	}
+
+	var audits []KeyPolicyAudit
+	failed := false
+	for _, source := range sources {
+		var policy keypolicy.Document
+		if err := json.Unmarshal(source.policy, &policy); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not parse policy of %s: %v\n", source.keyID, err)
+			continue
+		}
+		// The key's own account is the one that isn't cross-account
+		keyOpts := opts
+		if parsed, err := arn.Parse(source.keyID); err == nil {
+			keyOpts.Account = parsed.AccountID
+		}
+		findings := keypolicy.Audit(policy, keyOpts)
+		if keypolicy.HasSeverity(findings, threshold) {
+			failed = true
+		}
+		audits = append(audits, KeyPolicyAudit{KeyID: source.keyID, Findings: findings})
+	}
+	for _, warning := range degraded.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	if *format == "json" {
+		if err := render.JSON(os.Stdout, audits); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+	} else {
+		printPolicyAuditTable(audits)
+	}
+
+	if failed {
+		exit(2)
+	}
+}
+
+func printPolicyAuditTable(audits []KeyPolicyAudit) {
+	headers := []string{"Key ID", "Severity", "Rule", "Statement", "Details"}
+
+	var rows [][]string
+	var offending []string
+	total := 0
+	for _, audit := range audits {
+		seen := make(map[string]bool)
+		for _, f := range audit.Findings {
+			rows = append(rows, []string{audit.KeyID, string(f.Severity), f.Rule, f.Label, f.Message})
+			total++
+			if !seen[f.Label] {
+				seen[f.Label] = true
+				statement, _ := json.Marshal(f.Statement)
+				offending = append(offending, fmt.Sprintf("%s %s: %s", audit.KeyID, f.Label, statement))
+			}
+		}
+	}
+
+	if total == 0 {
+		fmt.Printf("No risky statements found in %d key policies\n", len(audits))
+		return
+	}
+
+	fmt.Println("=== POLICY FINDINGS ===")
+	fmt.Println()
+	render.Table(os.Stdout, headers, rows)
+
+	fmt.Println()
+	fmt.Println("=== OFFENDING STATEMENTS ===")
+	fmt.Println()
+	for _, line := range offending {
+		fmt.Println(line)
+	}
+
+	fmt.Println()
+	fmt.Printf("Total: %d finding(s) in %d key policies\n", total, len(audits))
+}
+
+func printPolicyFindingsTable(findings []keypolicy.Finding) {
+	headers := []string{"Finding", "Statements", "Details"}
+
+	var rows [][]string
+	for _, f := range findings {
+		rows = append(rows, []string{f.Kind, strings.Join(f.Statements, ", "), f.Message})
+	}
+
+	render.Table(os.Stdout, headers, rows)
+}
+
+func runPolicySimulate(args []string) {
+	var contextFlags stringSliceFlag
+
+	fs := flag.NewFlagSet("policy simulate", flag.ExitOnError)
+	keyID := fs.String("key", "", "Key ID, ARN, or alias whose policy to evaluate")
+	file := fs.String("file", "", "Evaluate a policy JSON file instead of fetching one")
+	principal := fs.String("principal", "", "Caller ARN (IAM role, user, or assumed-role session)")
+	action := fs.String("action", "", "KMS action to evaluate (e.g. kms:Decrypt)")
+	fs.Var(&contextFlags, "context", "Request context key=value (repeatable, e.g. kms:ViaService=s3.us-east-1.amazonaws.com)")
+	withIAM := fs.Bool("iam", false, "When the key policy delegates to IAM, also run iam:SimulatePrincipalPolicy")
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if (*keyID == "") == (*file == "") {
+		fmt.Fprintln(os.Stderr, "Error: exactly one of --key or --file is required")
+		exit(1)
+	}
+	if *principal == "" || *action == "" {
+		fmt.Fprintln(os.Stderr, "Error: --principal and --action are required")
+		exit(1)
+	}
+
+	requestContext := map[string][]string{}
+	for _, entry := range contextFlags {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid --context %q, expected key=value\n", entry)
+			exit(1)
+		}
+		requestContext[key] = append(requestContext[key], value)
+	}
+
+	ctx := context.Background()
+	var cfg aws.Config
+	if *keyID != "" || *withIAM {
+		var err error
+		cfg, err = awsOptions.Load(ctx)
+		if err != nil {
+			usage.Error(err)
+			fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+			exit(1)
+		}
+		printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+	}
+
+	var raw []byte
+	resourceArn := "*"
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading policy: %v\n", err)
+			exit(1)
+		}
+		raw = data
+	} else {
+		client := kms.NewFromConfig(cfg)
+		desc, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: keyID})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error describing key: %v\n", err)
+			exit(1)
+		}
+		resourceArn = aws.ToString(desc.KeyMetadata.Arn)
+
+		// GetKeyPolicy doesn't take aliases, so the policy is read by ARN
+		policy, err := getKeyPolicy(ctx, client, resourceArn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting key policy: %v\n", err)
+			exit(1)
+		}
+		raw = policy
+	}
+
+	var policy keypolicy.Document
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing policy: %v\n", err)
+		exit(1)
+	}
+
+	result := keypolicy.Simulate(policy, keypolicy.Request{
+		Principal: *principal,
+		Action:    *action,
+		Context:   requestContext,
+	})
+
+	fmt.Println("=== KEY POLICY EVALUATION ===")
+	fmt.Println()
+	printSimulationTable(result)
+	fmt.Println()
+	fmt.Printf("Key policy decision: %s\n", result.Decision)
+
+	switch result.Decision {
+	case keypolicy.DecisionExplicitDeny:
+		fmt.Println("An explicit Deny statement applies; no other policy can allow this request.")
+	case keypolicy.DecisionIndeterminate:
+		fmt.Println("A Deny statement may apply, but its condition uses an operator the simulator cannot evaluate; check it with the IAM policy simulator.")
+	case keypolicy.DecisionAllow:
+		fmt.Println("A statement naming the principal allows this request.")
+	case keypolicy.DecisionImplicitDeny:
+		fmt.Println("No statement allows this request, and the key policy does not delegate to IAM.")
+	case keypolicy.DecisionDelegated:
+		fmt.Println("The key policy delegates to IAM; the principal's identity policies must also allow this request.")
+		if !*withIAM {
+			fmt.Println("Re-run with --iam to evaluate the principal's IAM policies.")
+			return
+		}
+
+		decision, err := simulateIAM(ctx, iam.NewFromConfig(cfg), keypolicy.NormalizePrincipal(*principal), *action, resourceArn, requestContext)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error simulating IAM policy: %v\n", err)
+			exit(1)
+		}
+		fmt.Println()
+		fmt.Printf("IAM decision: %s\n", decision)
+	}
+}
+
+func simulateIAM(ctx context.Context, client *iam.Client, principalArn, action, resourceArn string, requestContext map[string][]string) (string, error) {
+	var entries []iamtypes.ContextEntry
+	for key, values := range requestContext {
+		keyType := iamtypes.ContextKeyTypeEnumString
+		if len(values) > 1 {
+			keyType = iamtypes.ContextKeyTypeEnumStringList
+		}
+		entries = append(entries, iamtypes.ContextEntry{
+			ContextKeyName:   aws.String(key),
+			ContextKeyType:   keyType,
+			ContextKeyValues: values,
+		})
+	}
+
+	output, err := client.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalArn),
+		ActionNames:     []string{action},
+		ResourceArns:    []string{resourceArn},
+		ContextEntries:  entries,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(output.EvaluationResults) == 0 {
+		return "", fmt.Errorf("no evaluation results returned")
+	}
+
+	evaluation := output.EvaluationResults[0]
+	decision := string(evaluation.EvalDecision)
+	for _, statement := range evaluation.MatchedStatements {
+		decision += fmt.Sprintf(" (matched %s)", aws.ToString(statement.SourcePolicyId))
+	}
+	return decision, nil
+}
+
+func printSimulationTable(result keypolicy.Result) {
+	headers := []string{"Statement", "Effect", "Principal", "Action", "Condition", "Outcome"}
+
+	var rows [][]string
+	for _, s := range result.Statements {
+		rows = append(rows, []string{
+			s.Label,
+			s.Effect,
+			formatMatch(s.PrincipalMatch),
+			formatMatch(s.ActionMatch),
+			formatCondition(s),
+			s.Reason,
+		})
+	}
+
+	render.Table(os.Stdout, headers, rows)
+}
+
+func formatCondition(s keypolicy.StatementResult) string {
+	if s.Indeterminate {
+		return "unknown"
+	}
+	return formatMatch(s.ConditionMatch)
+}
+
+func formatMatch(matched bool) string {
+	if matched {
+		return "match"
+	}
+	return "no match"
+}
+
+// cloudTrailRecord holds the fields of a KMS CloudTrail event that the
+// explain-denied and lockout bypass checks use.
+type cloudTrailRecord struct {
+	EventName    string    `json:"eventName"`
+	EventSource  string    `json:"eventSource"`
+	EventTime    time.Time `json:"eventTime"`
+	ErrorCode    string    `json:"errorCode"`
+	ErrorMessage string    `json:"errorMessage"`
+	UserIdentity struct {
+		ARN string `json:"arn"`
+	} `json:"userIdentity"`
+	RequestParameters struct {
+		KeyID                          string            `json:"keyId"`
+		BypassPolicyLockoutSafetyCheck bool              `json:"bypassPolicyLockoutSafetyCheck"`
+		EncryptionContext              map[string]string `json:"encryptionContext"`
+		// ReEncrypt has a context on each side
+		DestinationKeyID             string            `json:"destinationKeyId"`
+		SourceEncryptionContext      map[string]string `json:"sourceEncryptionContext"`
+		DestinationEncryptionContext map[string]string `json:"destinationEncryptionContext"`
+	} `json:"requestParameters"`
+	ResponseElements struct {
+		KeyMetadata struct {
+			KeyID string `json:"keyId"`
+		} `json:"keyMetadata"`
+	} `json:"responseElements"`
+	Resources []struct {
+		ARN string `json:"ARN"`
+	} `json:"resources"`
+}
+
+func runExplainDenied(args []string) {
+	fs := flag.NewFlagSet("explain-denied", flag.ExitOnError)
+	eventID := fs.String("event-id", "", "CloudTrail event ID of the denied call")
+	message := fs.String("message", "", "AccessDenied error message (may contain an encoded authorization failure message)")
+	format := fs.String("format", "table", "Output format: table or json")
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if (*eventID == "") == (*message == "") {
+		fmt.Fprintln(os.Stderr, "Error: exactly one of --event-id or --message is required")
+		exit(1)
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --format %q (expected table or json)\n", *format)
+		exit(1)
+	}
+
+	ctx := context.Background()
+	var cfg aws.Config
+	if *eventID != "" || strings.Contains(*message, "Encoded authorization failure message") {
+		var err error
+		cfg, err = awsOptions.Load(ctx)
+		if err != nil {
+			usage.Error(err)
+			fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Hint: Run 'aws sso login --profile %s' first\n", awsOptions.Profile)
+			exit(1)
+		}
+		printBanner(ctx, cfg, os.Stderr, awsOptions.Profile)
+	}
+
+	var record cloudTrailRecord
+	errorMessage := *message
+	if *eventID != "" {
+		var err error
+		record, err = lookupCloudTrailEvent(ctx, cloudtrail.NewFromConfig(cfg), *eventID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error looking up CloudTrail event: %v\n", err)
+			exit(1)
+		}
+		if record.ErrorCode == "" {
+			fmt.Fprintf(os.Stderr, "Error: event %s (%s) did not fail\n", *eventID, record.EventName)
+			exit(1)
+		}
+		errorMessage = record.ErrorMessage
+	}
+
+	explanation := accessdenied.Parse(errorMessage)
+	if explanation.Principal == "" {
+		explanation.Principal = record.UserIdentity.ARN
+	}
+	if explanation.Action == "" && record.EventName != "" {
+		explanation.Action = strings.TrimSuffix(record.EventSource, ".amazonaws.com") + ":" + record.EventName
+	}
+	if explanation.Resource == "" {
+		if len(record.Resources) > 0 {
+			explanation.Resource = record.Resources[0].ARN
+		} else {
+			explanation.Resource = record.RequestParameters.KeyID
+		}
+	}
+
+	var decoded *accessdenied.Decoded
+	if explanation.Encoded != "" {
+		output, err := sts.NewFromConfig(cfg).DecodeAuthorizationMessage(ctx, &sts.DecodeAuthorizationMessageInput{
+			EncodedMessage: aws.String(explanation.Encoded),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding authorization message: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Hint: decoding requires sts:DecodeAuthorizationMessage")
+			exit(1)
+		}
+		d, err := accessdenied.ParseDecoded(aws.ToString(output.DecodedMessage))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing decoded message: %v\n", err)
+			exit(1)
+		}
+		decoded = &d
+		if d.ExplicitDeny {
+			explanation.ExplicitDeny = true
+		}
+	}
+
+	if *format == "json" {
+		out := struct {
+			accessdenied.Explanation
+			Advice  string                `json:"advice"`
+			Decoded *accessdenied.Decoded `json:"decoded,omitempty"`
+		}{explanation, explanation.Advice(), decoded}
+		if err := render.JSON(os.Stdout, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	denial := "implicit (nothing allowed it)"
+	if explanation.ExplicitDeny {
+		denial = "explicit Deny"
+	}
+	render.Table(os.Stdout, []string{"Field", "Value"}, [][]string{
+		{"Principal", getValueOrDefault(explanation.Principal, "-")},
+		{"Action", getValueOrDefault(explanation.Action, "-")},
+		{"Resource", getValueOrDefault(explanation.Resource, "-")},
+		{"Denied by", string(explanation.Layer)},
+		{"Denial", denial},
+	})
+
+	if decoded != nil {
+		fmt.Println()
+		fmt.Println("=== DECODED AUTHORIZATION MESSAGE ===")
+		fmt.Println()
+		var rows [][]string
+		for _, statement := range decoded.MatchedStatements.Items {
+			rows = append(rows, []string{statement.StatementID, statement.Effect, getValueOrDefault(statement.Source, "-")})
+		}
+		if len(rows) == 0 {
+			fmt.Println("No statements matched the request")
+		} else {
+			render.Table(os.Stdout, []string{"Statement", "Effect", "Source"}, rows)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(explanation.Advice())
+
+	if explanation.Layer == accessdenied.LayerKeyPolicy || explanation.Layer == accessdenied.LayerIdentity {
+		if strings.HasPrefix(explanation.Action, "kms:") && explanation.Principal != "" && explanation.Resource != "" {
+			fmt.Println()
+			fmt.Println("To see which key policy statements apply, run:")
+			fmt.Printf("  policy simulate --key %s --principal %s --action %s --iam\n", explanation.Resource, explanation.Principal, explanation.Action)
+		}
+	}
+}
+
+// findLockoutBypasses returns, per key ID, the latest CreateKey or PutKeyPolicy
+// event that set BypassPolicyLockoutSafetyCheck. LookupEvents only covers the
+// last 90 days of management events in the client's region.
+func findLockoutBypasses(ctx context.Context, client *cloudtrail.Client) (map[string]LockoutBypass, error) {
+	bypasses := make(map[string]LockoutBypass)
+
+	for _, eventName := range []string{"CreateKey", "PutKeyPolicy"} {
+		paginator := cloudtrail.NewLookupEventsPaginator(client, &cloudtrail.LookupEventsInput{
+			LookupAttributes: []cloudtrailtypes.LookupAttribute{
+				{AttributeKey: cloudtrailtypes.LookupAttributeKeyEventName, AttributeValue: aws.String(eventName)},
+			},
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return bypasses, err
+			}
+
+			for _, event := range page.Events {
+				var record cloudTrailRecord
+				if err := json.Unmarshal([]byte(aws.ToString(event.CloudTrailEvent)), &record); err != nil {
+					continue
+				}
+				if record.EventSource != "kms.amazonaws.com" || record.ErrorCode != "" || !record.RequestParameters.BypassPolicyLockoutSafetyCheck {
+					continue
+				}
+
+				keyID := record.RequestParameters.KeyID
+				if record.EventName == "CreateKey" {
+					keyID = record.ResponseElements.KeyMetadata.KeyID
+				}
+				// PutKeyPolicy accepts a key ARN as well as a key ID
+				keyID = keyID[strings.LastIndex(keyID, "/")+1:]
+				if keyID == "" {
+					continue
+				}
+
+				if existing, ok := bypasses[keyID]; ok && existing.EventTime.After(record.EventTime) {
+					continue
+				}
+				bypasses[keyID] = LockoutBypass{
+					EventName: record.EventName,
+					EventTime: record.EventTime,
+					Principal: record.UserIdentity.ARN,
+				}
+			}
+		}
+	}
+
+	return bypasses, nil
+}
+
+func lookupCloudTrailEvent(ctx context.Context, client *cloudtrail.Client, eventID string) (cloudTrailRecord, error) {
+	var record cloudTrailRecord
+
+	output, err := client.LookupEvents(ctx, &cloudtrail.LookupEventsInput{
+		LookupAttributes: []cloudtrailtypes.LookupAttribute{
+			{AttributeKey: cloudtrailtypes.LookupAttributeKeyEventId, AttributeValue: aws.String(eventID)},
+		},
+	})
+	if err != nil {
+		return record, err
+	}
+	if len(output.Events) == 0 {
+		return record, fmt.Errorf("event %s not found (LookupEvents only covers the last 90 days in this region)", eventID)
+	}
+
+	if err := json.Unmarshal([]byte(aws.ToString(output.Events[0].CloudTrailEvent)), &record); err != nil {
+		return record, fmt.Errorf("parsing event: %w", err)
+	}
+	return record, nil
+}
+
+// printBanner resolves and prints the caller identity at the start of a run.
+// A failed lookup only warns; mutating commands refuse to prompt without it.
+func printBanner(ctx context.Context, cfg aws.Config, w io.Writer, profile string) *identity.Caller {
+	caller, err := identity.Lookup(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	identity.Banner(w, profile, caller, []string{getValueOrDefault(cfg.Region, "default")})
+	fmt.Fprintln(w)
+	return caller
+}
+
+func matchesAlias(aliases []string, pattern string) bool {
+	for _, alias := range aliases {
+		if ok, _ := path.Match(pattern, alias); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getKeyInfo describes a key, recording tags and rotation status it could not
+// read in degraded and marking them unknown on the key.
+func getKeyInfo(ctx context.Context, client kmsinv.API, keyID string, degraded *degrade.Tracker) KeyInfo {
+	key := kmsinv.Describe(ctx, client, keyID)
+	info := KeyInfo{
+		KeyID:              key.KeyID,
+		Status:             key.Status,
+		CreationDate:       key.CreationDate,
+		KeyType:            key.KeyType,
+		KeyManager:         key.KeyManager,
+		Origin:             key.Origin,
+		MultiRegion:        key.MultiRegion,
+		PrimaryRegion:      key.PrimaryRegion,
+		ReplicaRegions:     key.ReplicaRegions,
+		RotationStatus:     key.RotationStatus,
+		RotationPeriodDays: key.RotationPeriodDays,
+		DeletionDate:       key.DeletionDate,
+		DaysUntilDeletion:  key.DaysUntilDeletion,
+		Tags:               key.Tags,
+		ErrorReason:        string(key.ErrorClass),
+		Error:              key.Error,
+	}
+	if key.TagsErr != nil {
+		degraded.Record(degrade.Tags, key.TagsErr)
+		info.Unknown = append(info.Unknown, degrade.Tags)
+	}
+	if key.RotationErr != nil {
+		degraded.Record(degrade.Rotation, key.RotationErr)
+		info.Unknown = append(info.Unknown, degrade.Rotation)
+	}
+	return info
+}
+
+func (k KeyInfo) isUnknown(feature string) bool {
+	return slices.Contains(k.Unknown, feature)
+}
+
+// estimateKeyCost fills in the monthly cost estimate. Rotations are only listed
+// for keys that can be rotated, since only the first two are billed.
+func estimateKeyCost(ctx context.Context, client *kms.Client, keyInfo *KeyInfo, degraded *degrade.Tracker) {
+	rotations := 0
+	if keyInfo.KeyType == string(types.KeySpecSymmetricDefault) && keyInfo.Origin == string(types.OriginTypeAwsKms) {
+		output, err := client.ListKeyRotations(ctx, &kms.ListKeyRotationsInput{
+			KeyId: aws.String(keyInfo.KeyID),
+			Limit: aws.Int32(3),
+		})
+		if err != nil {
+			degraded.Record(degrade.CostRotations, err)
+			keyInfo.Unknown = append(keyInfo.Unknown, degrade.CostRotations)
+		} else {
+			rotations = len(output.Rotations)
+		}
+	}
+
+	cost, basis := pricing.MonthlyCost(pricing.Key{
+		State:       keyInfo.Status,
+		Origin:      keyInfo.Origin,
+		MultiRegion: keyInfo.MultiRegion,
+		Rotations:   rotations,
+	})
+	keyInfo.MonthlyCost = &cost
+	keyInfo.CostBasis = basis
+}
+
+func getKeyPolicy(ctx context.Context, client *kms.Client, keyID string) (json.RawMessage, error) {
+	policyName := "default"
+	output, err := client.GetKeyPolicy(ctx, &kms.GetKeyPolicyInput{
+		KeyId:      &keyID,
+		PolicyName: &policyName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if output.Policy == nil {
+		return nil, fmt.Errorf("empty policy document")
+	}
+
+	policy := json.RawMessage(*output.Policy)
+	if !json.Valid(policy) {
+		return nil, fmt.Errorf("policy document is not valid JSON")
+	}
+	return policy, nil
+}
+
+// writePolicyFile writes the policy to dir/region/keyID.json and returns the
+// path.
+func writePolicyFile(dir, region, keyID string, policy json.RawMessage) (string, error) {
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, policy, "", "  "); err != nil {
+		return "", err
+	}
+	pretty.WriteString("\n")
+
+	path := filepath.Join(dir, region, keyID+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, pretty.Bytes(), 0o644)
+}
+
+// printKeyPolicies prints each key's policy, indented under its key ID, after
+// the key tables of the table format.
+func printKeyPolicies(keys []KeyInfo, showRegion bool) {
+	printed := false
+	for _, key := range keys {
+		if key.Policy == nil {
+			continue
+		}
+		if !printed {
+			fmt.Println()
+			fmt.Println("=== KEY POLICIES ===")
+			printed = true
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, key.Policy, "  ", "  "); err != nil {
+			pretty.Reset()
+			pretty.Write(key.Policy)
+		}
+		fmt.Println()
+		if showRegion {
+			fmt.Printf("%s (%s):\n", key.KeyID, key.Region)
+		} else {
+			fmt.Printf("%s:\n", key.KeyID)
+		}
+		fmt.Printf("  %s\n", pretty.String())
+	}
+}
+
+// keyCSVRows is every listed key in one table, with the enabled keys'
+// columns, the region, the deletion date, and with --include-policies the
+// policy as compact JSON.
+func keyCSVRows(keys []KeyInfo, tagKeys []string, showManager, showCost, includePolicies bool) ([]string, [][]string) {
+	headers, rows := enabledKeysRows(keys, tagKeys, true, showManager, showCost)
+	headers = append(headers, "Deletion Date")
+	if includePolicies {
+		headers = append(headers, "Policy")
+	}
+	for i, key := range keys {
+		deletion := ""
+		if key.DeletionDate != nil {
+			deletion = key.DeletionDate.Format(dateFormat)
+		}
+		rows[i] = append(rows[i], deletion)
+		if includePolicies {
+			var compact bytes.Buffer
+			if key.Policy != nil && json.Compact(&compact, key.Policy) != nil {
+				compact.Reset()
+				compact.Write(key.Policy)
+			}
+			rows[i] = append(rows[i], compact.String())
+		}
+	}
+	return headers, rows
+}
+
+func writeCSV(w io.Writer, headers []string, rows [][]string) error {
+	out := csv.NewWriter(w)
+	out.Write(headers)
+	out.WriteAll(rows)
+	return out.Error()
+}
+
+func findRotationNonCompliant(keys []KeyInfo) []KeyInfo {
+	var nonCompliant []KeyInfo
+	for _, key := range keys {
+		if key.KeyType != string(types.KeySpecSymmetricDefault) || key.RotationStatus == "Unsupported" {
+			continue
+		}
+		// Unknown (e.g. missing kms:GetKeyRotationStatus) counts as non-compliant
+		if key.RotationStatus != "Enabled" {
+			nonCompliant = append(nonCompliant, key)
+		}
+	}
+	return nonCompliant
+}
+
+// keyManagerLabel names the keys a --key-manager selection lists.
+func keyManagerLabel(manager string) string {
+	switch manager {
+	case kmsinv.ManagerAWS:
+		return "AWS Managed Keys"
+	case kmsinv.ManagerAll:
+		return "Keys"
+	}
+	return "Customer Managed Keys"
+}
+
+// keyBrowseItem is the --interactive view of a key.
+func keyBrowseItem(key KeyInfo) browse.Item {
+	item := browse.Item{
+		ID:     key.KeyID,
+		Name:   strings.Join(key.Aliases, ", "),
+		Region: key.Region,
+		State:  key.Status,
+		Tags:   key.Tags,
+	}
+	add := func(label, value string) {
+		if value != "" {
+			item.Details = append(item.Details, browse.Field{Label: label, Value: value})
+		}
+	}
+	add("Key Manager", key.KeyManager)
+	add("Service", key.AWSService)
+	add("Key Type", key.KeyType)
+	add("Origin", key.Origin)
+	if !key.CreationDate.IsZero() {
+		add("Created", key.CreationDate.Format(dateFormat))
+	}
+	add("Rotation", formatRotation(key))
+	add("Multi-Region", key.MultiRegion)
+	add("Primary Region", key.PrimaryRegion)
+	add("Replica Regions", strings.Join(key.ReplicaRegions, ", "))
+	if key.DeletionDate != nil {
+		add("Deletion Date", key.DeletionDate.Format(dateFormat))
+	}
+	add("Missing Tags", strings.Join(key.MissingTags, ", "))
+	if key.LockoutBypass != nil {
+		add("Lockout Bypass", fmt.Sprintf("%s on %s by %s", key.LockoutBypass.EventName, key.LockoutBypass.EventTime.Format(dateFormat), key.LockoutBypass.Principal))
+	}
+	if key.MonthlyCost != nil {
+		add("Monthly Cost", fmt.Sprintf("$%.2f (%s)", *key.MonthlyCost, key.CostBasis))
+	}
+	add("Unknown", strings.Join(key.Unknown, ", "))
+	add("Error", key.Error)
+	if len(key.Policy) > 0 {
+		var policy bytes.Buffer
+		if err := json.Indent(&policy, key.Policy, "", "  "); err != nil {
+			policy.Reset()
+			policy.Write(key.Policy)
+		}
+		add("Policy", policy.String())
+	}
+	return item
+}
+
+// keyConsoleLinks is each key's console URL, for linking the Key ID column of
+// the HTML report.
+func keyConsoleLinks(keys []KeyInfo) []string {
+	links := make([]string, len(keys))
+	for i, key := range keys {
+		links[i] = console.KMSKey(key.Region, key.KeyID, key.KeyManager == string(types.KeyManagerTypeAws))
+	}
+	return links
+}
+
+func enabledKeysRows(keys []KeyInfo, tagKeys []string, showRegion, showManager, showCost bool) ([]string, [][]string) {
+	// Build header
+	headers := []string{"Key ID", "Aliases", "Status", "Creation Date", "Key Type", "Rotation"}
+	if showManager {
+		headers = append(headers, "Key Manager", "Service")
+	}
+	// Multi-Region columns only when there is something to put in them
+	showMultiRegion := false
+	for _, key := range keys {
+		if key.MultiRegion != "" {
+			showMultiRegion = true
+			break
+		}
+	}
+	if showMultiRegion {
+		headers = append(headers, "Multi-Region", "Primary Region", "Replicas")
+	}
+	if showCost {
+		headers = append(headers, "Est. $/month", "Cost Basis")
+	}
+	headers = append(headers, tagKeys...)
+
+	// Build data rows
+	var rows [][]string
+	for _, key := range keys {
+		row := []string{
+			key.KeyID,
+			formatKeyAliases(key),
+			key.Status,
+			key.CreationDate.Format(dateFormat),
+			key.KeyType,
+			formatRotation(key),
+		}
+		if showManager {
+			row = append(row, render.ValueOrDash(key.KeyManager), render.ValueOrDash(key.AWSService))
+		}
+		if showMultiRegion {
+			row = append(row, render.ValueOrDash(key.MultiRegion), render.ValueOrDash(key.PrimaryRegion), render.ValueOrDash(strings.Join(key.ReplicaRegions, ", ")))
+		}
+		if showCost {
+			cost := "-"
+			if key.MonthlyCost != nil {
+				cost = fmt.Sprintf("$%.2f", *key.MonthlyCost)
+			}
+			row = append(row, cost, render.ValueOrDash(key.CostBasis))
+		}
+		for _, tagKey := range tagKeys {
+			if key.isUnknown(degrade.Tags) {
+				row = append(row, degrade.Unknown)
+			} else {
+				row = append(row, render.ValueOrDash(key.Tags[tagKey]))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func notAuthorizedKeysRows(keys []KeyInfo, showRegion bool) ([]string, [][]string) {
+	headers := []string{"Key ID", "Status"}
+
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{key.KeyID, key.Status})
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func failedKeysRows(keys []KeyInfo, showRegion bool) ([]string, [][]string) {
+	headers := []string{"Key ID", "Reason", "Error"}
+
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{key.KeyID, key.ErrorReason, key.Error})
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func pendingDeletionKeysRows(keys []KeyInfo, showWarning, showRegion bool) ([]string, [][]string) {
+	headers := []string{"Key ID", "Aliases", "Deletion Date", "Days Remaining"}
+	if showWarning {
+		headers = append(headers, "Warning")
+	}
+
+	var rows [][]string
+	for _, key := range keys {
+		deletionDate, daysLeft := "-", "-"
+		if key.DeletionDate != nil {
+			deletionDate = key.DeletionDate.Format(dateFormat)
+		}
+		if key.DaysUntilDeletion != nil {
+			daysLeft = fmt.Sprintf("%d", *key.DaysUntilDeletion)
+		}
+		row := []string{key.KeyID, formatKeyAliases(key), deletionDate, daysLeft}
+		if showWarning {
+			warning := "-"
+			if key.ImminentDeletion {
+				warning = "IMMINENT"
+			}
+			row = append(row, warning)
+		}
+		rows = append(rows, row)
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func deletionCandidateRows(candidates []DeletionCandidate, lookbackDays int) ([]string, [][]string) {
+	headers := []string{"Key ID", "Aliases", "Status", "Last Used", "Secrets", "Grants", "Blockers", "Action"}
+
+	var rows [][]string
+	for _, candidate := range candidates {
+		lastUsed := fmt.Sprintf("not in %d days", lookbackDays)
+		if candidate.LastUsed != nil {
+			lastUsed = fmt.Sprintf("%s (%s)", candidate.LastUsed.Format("2006-01-02"), candidate.LastOperation)
+		} else if candidate.Action == actionAlreadyPending || candidate.Action == actionNotDeletable || slices.ContainsFunc(candidate.Blockers, func(blocker string) bool {
+			return strings.HasPrefix(blocker, "usage unknown")
+		}) {
+			lastUsed = "-"
+		}
+		action := candidate.Action
+		if candidate.DeletionDate != nil {
+			action += " (" + candidate.DeletionDate.Format("2006-01-02") + ")"
+		}
+		if candidate.Error != "" {
+			action += ": " + candidate.Error
+		}
+		rows = append(rows, []string{
+			candidate.KeyID,
+			formatAliases(candidate.Aliases),
+			candidate.Status,
+			lastUsed,
+			render.ValueOrDash(strings.Join(candidate.Secrets, ", ")),
+			strconv.Itoa(candidate.Grants),
+			render.ValueOrDash(strings.Join(candidate.Blockers, "; ")),
+			action,
+		})
+	}
+	return headers, rows
+}
+
+func printGrantsTable(grants []GrantInfo) {
+	headers := []string{"Key ID", "Grant Name", "Grantee Principal", "Operations", "Constraints", "Creation Date"}
+
+	var rows [][]string
+	for _, grant := range grants {
+		rows = append(rows, []string{
+			grant.KeyID,
+			render.ValueOrDash(grant.GrantName),
+			grant.GranteePrincipal,
+			strings.Join(grant.Operations, ","),
+			formatGrantConstraints(grant),
+			grant.CreationDate.Format(dateFormat),
+		})
+	}
+
+	render.Table(os.Stdout, headers, rows)
+}
+
+func formatGrantConstraints(grant GrantInfo) string {
+	var parts []string
+	for _, c := range []struct {
+		label   string
+		context map[string]string
+	}{
+		{"subset", grant.EncryptionContextSubset},
+		{"equals", grant.EncryptionContextEquals},
+	} {
+		if len(c.context) == 0 {
+			continue
+		}
+		var pairs []string
+		for k, v := range c.context {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		parts = append(parts, c.label+"{"+strings.Join(pairs, ",")+"}")
+	}
+
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " ")
+}
+
+func missingTagsRows(keys []KeyInfo, showRegion bool) ([]string, [][]string) {
+	headers := []string{"Key ID", "Aliases", "Missing Tags"}
+
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{key.KeyID, formatKeyAliases(key), strings.Join(key.MissingTags, ", ")})
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func rotationComplianceRows(keys []KeyInfo, showRegion bool) ([]string, [][]string) {
+	headers := []string{"Key ID", "Aliases", "Rotation"}
+
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{key.KeyID, formatKeyAliases(key), key.RotationStatus})
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func lockoutBypassRows(keys []KeyInfo, showRegion bool) ([]string, [][]string) {
+	headers := []string{"Key ID", "Aliases", "Status", "Event", "Event Time", "Principal"}
+
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{
+			key.KeyID,
+			formatKeyAliases(key),
+			key.Status,
+			key.LockoutBypass.EventName,
+			key.LockoutBypass.EventTime.Format(dateFormat),
+			render.ValueOrDash(key.LockoutBypass.Principal),
+		})
+	}
+
+	if showRegion {
+		headers, rows = withRegionColumn(headers, rows, keys)
+	}
+	return headers, rows
+}
+
+func printTable(headers []string, rows [][]string) {
+	render.Table(os.Stdout, headers, rows)
+}
+
+// withRegionColumn prepends a Region column; rows must be in the same order as keys.
+// mergedReplicaRegions lists the replica regions of a primary key that are
+// also being scanned, whose listings are folded into the primary's.
+func mergedReplicaRegions(key KeyInfo, scanning map[string]bool) []string {
+	if key.MultiRegion != string(types.MultiRegionKeyTypePrimary) {
+		return nil
+	}
+	var merged []string
+	for _, region := range key.ReplicaRegions {
+		if scanning[region] {
+			merged = append(merged, region)
+		}
+	}
+	return merged
+}
+
+func withRegionColumn(headers []string, rows [][]string, keys []KeyInfo) ([]string, [][]string) {
+	headers = append([]string{"Region"}, headers...)
+	for i := range rows {
+		rows[i] = append([]string{keys[i].Region}, rows[i]...)
+	}
+	return headers, rows
+}
+
+func formatRotation(key KeyInfo) string {
+	switch key.RotationStatus {
+	case "":
+		return "-"
+	case "Enabled":
+		if key.RotationPeriodDays > 0 {
+			return fmt.Sprintf("Enabled (%dd)", key.RotationPeriodDays)
+		}
+	}
+	return key.RotationStatus
+}
+
+func formatKeyAliases(key KeyInfo) string {
+	if key.isUnknown(degrade.Aliases) {
+		return degrade.Unknown
+	}
+	return formatAliases(key.Aliases)
+}
+
+func formatAliases(aliases []string) string {
+	if len(aliases) == 0 {
+		return "-"
+	}
+	return strings.Join(aliases, ", ")
+}
+
+func getValueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,1901 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"secrets-lister/pkg/awsconfig"
+	"secrets-lister/pkg/awserr"
+	"secrets-lister/pkg/backup"
+	"secrets-lister/pkg/browse"
+	"secrets-lister/pkg/catalog"
+	"secrets-lister/pkg/config"
+	"secrets-lister/pkg/console"
+	"secrets-lister/pkg/degrade"
+	"secrets-lister/pkg/identity"
+	"secrets-lister/pkg/kmsinv"
+	"secrets-lister/pkg/manifest"
+	"secrets-lister/pkg/output"
+	"secrets-lister/pkg/progress"
+	"secrets-lister/pkg/regions"
+	"secrets-lister/pkg/render"
+	"secrets-lister/pkg/secretkeys"
+	"secrets-lister/pkg/secretsinv"
+	"secrets-lister/pkg/selfupdate"
+	"secrets-lister/pkg/snapshot"
+	"secrets-lister/pkg/sqlitestore"
+	"secrets-lister/pkg/tagindex"
+	"secrets-lister/pkg/tagpolicy"
+	"secrets-lister/pkg/telemetry"
+	"secrets-lister/pkg/version"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/glue"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type SecretRecord struct {
+	Name                 string            `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"name"`
+	Description          *string           `parquet:"name=description, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"description,omitempty"`
+	CreatedDate          *int32            `parquet:"name=created_date, type=INT32, convertedtype=DATE" json:"created_date,omitempty"`
+	LastAccessedDate     *int32            `parquet:"name=last_accessed_date, type=INT32, convertedtype=DATE" json:"last_accessed_date,omitempty"`
+	DeletedDate          *int32            `parquet:"name=deleted_date, type=INT32, convertedtype=DATE" json:"deleted_date,omitempty"`
+	OwningService        *string           `parquet:"name=owning_service, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"owning_service,omitempty"`
+	KMSKeyID             *string           `parquet:"name=kms_key_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"kms_key_id,omitempty"`
+	RotationEnabled      *bool             `parquet:"name=rotation_enabled, type=BOOLEAN" json:"rotation_enabled,omitempty"`
+	RotationLambdaARN    *string           `parquet:"name=rotation_lambda_arn, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"rotation_lambda_arn,omitempty"`
+	RotationIntervalDays *int64            `parquet:"name=rotation_interval_days, type=INT64" json:"rotation_interval_days,omitempty"`
+	RotationSchedule     *string           `parquet:"name=rotation_schedule, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"rotation_schedule,omitempty"`
+	LastRotatedDate      *int32            `parquet:"name=last_rotated_date, type=INT32, convertedtype=DATE" json:"last_rotated_date,omitempty"`
+	NextRotationDate     *int32            `parquet:"name=next_rotation_date, type=INT32, convertedtype=DATE" json:"next_rotation_date,omitempty"`
+	StaleReason          *string           `parquet:"name=stale_reason, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"stale_reason,omitempty"`
+	SourceRegion         string            `parquet:"name=source_region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"source_region"`
+	AccountID            string            `parquet:"name=account_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"account_id,omitempty"`
+	PrimaryRegion        *string           `parquet:"name=primary_region, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY" json:"primary_region,omitempty"`
+	ReplicaRegions       []string          `parquet:"name=replica_regions, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"replica_regions,omitempty"`
+	ReplicationStatus    map[string]string `parquet:"name=replication_status, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"replication_status,omitempty"`
+	Tags                 map[string]string `parquet:"name=tags, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"tags,omitempty"`
+	// Unknown lists the degrade features that could not be read for the secret
+	Unknown []string `parquet:"name=unknown, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" json:"unknown,omitempty"`
+}
+
+type SecretJSON struct {
+	Name                 string            `json:"name"`
+	Description          *string           `json:"description,omitempty"`
+	CreatedDate          *string           `json:"created_date,omitempty"`
+	LastAccessedDate     *string           `json:"last_accessed_date,omitempty"`
+	DeletedDate          *string           `json:"deleted_date,omitempty"`
+	OwningService        *string           `json:"owning_service,omitempty"`
+	KMSKeyID             *string           `json:"kms_key_id,omitempty"`
+	RotationEnabled      bool              `json:"rotation_enabled"`
+	RotationLambdaARN    *string           `json:"rotation_lambda_arn,omitempty"`
+	RotationIntervalDays *int64            `json:"rotation_interval_days,omitempty"`
+	RotationSchedule     *string           `json:"rotation_schedule,omitempty"`
+	LastRotatedDate      *string           `json:"last_rotated_date,omitempty"`
+	NextRotationDate     *string           `json:"next_rotation_date,omitempty"`
+	StaleReason          *string           `json:"stale_reason,omitempty"`
+	SourceRegion         string            `json:"source_region"`
+	AccountID            string            `json:"account_id,omitempty"`
+	PrimaryRegion        *string           `json:"primary_region,omitempty"`
+	ReplicaRegions       []string          `json:"replica_regions,omitempty"`
+	ReplicationStatus    map[string]string `json:"replication_status,omitempty"`
+	Tags                 map[string]string `json:"tags,omitempty"`
+	Unknown              []string          `json:"unknown,omitempty"`
+}
+
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version":
+			telemetryOptions := telemetry.Defaults()
+			usage := telemetry.Start(&telemetryOptions, "secrets-lister", "version")
+			version.Print(os.Stdout, "secrets-lister")
+			usage.Finish(0)
+			return
+		case "self-update":
+			runSelfUpdate(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "key-report":
+			runKeyReport(os.Args[2:])
+			return
+		}
+	}
+
+	telemetryOptions := telemetry.Defaults()
+	usage := telemetry.Start(&telemetryOptions, "secrets-lister", "list")
+
+	var filterName, filterTagKey, filterTagValue, filterPrimaryRegion, filterAll, filterTags, roleARNs stringSliceFlag
+
+	format := flag.String("format", "parquet", "Output format: table, json, html (a self-contained rotation report), parquet, or sqlite")
+	outputPath := flag.String("output", "", "Output parquet file path or s3://bucket/key (default secrets.parquet), or SQLite database to append to (default inventory.db); {date} and {region} are expanded")
+	registerGlue := flag.String("register-glue", "", "After an s3:// parquet export, create or update this Glue table (db.table) and add the partition")
+	includeDeleted := flag.Bool("include-deleted", false, "Include secrets scheduled for deletion")
+	serviceLinked := flag.String("service-linked", "include", "Service-linked secrets (OwningService set): include, exclude, or only")
+	flag.Var(&filterName, "filter-name", "Server-side filter on secret name prefix (repeatable, prefix with ! to negate)")
+	flag.Var(&filterTagKey, "filter-tag-key", "Server-side filter on tag key prefix (repeatable)")
+	flag.Var(&filterTagValue, "filter-tag-value", "Server-side filter on tag value prefix (repeatable)")
+	flag.Var(&filterPrimaryRegion, "filter-primary-region", "Server-side filter on primary region (repeatable)")
+	flag.Var(&filterAll, "filter-all", "Server-side filter across name, description, tags and ARN (repeatable)")
+	flag.Var(&filterTags, "filter-tag", "Only include secrets with this tag, as Key=Value or Key (repeatable)")
+	requiredTagsList := flag.String("required-tags", "", "Comma-separated tag keys every secret must have; exit non-zero if any are missing")
+	limit := flag.Int("limit", 0, "Stop listing after N secrets (quick smoke tests)")
+	sample := flag.Int("sample", 0, "Export a random sample of N secrets instead of all of them (up to N from each region, so not weighted by region size)")
+	manifestPath := flag.String("manifest", "", "Write a JSON run manifest (caller, region, counts, errors, artifact hashes) to this file")
+	snapshotOut := flag.String("snapshot", "", "Write the inventory to this snapshot file for a later --diff-against")
+	diffAgainst := flag.String("diff-against", "", "Compare the inventory with a previous snapshot and exit non-zero on drift")
+	staleDays := flag.Int("stale-days", 0, "Flag secrets not rotated or not accessed in N days and exit non-zero if any")
+	progressMode := progress.RegisterFlag(flag.CommandLine)
+	offline := flag.String("offline", "", "Build the inventory from this --snapshot file instead of calling AWS (no credentials needed)")
+	taggingAPI := flag.Bool("tagging-api", false, "Find the secrets matching --filter-tag with the Resource Groups Tagging API and describe only those, instead of listing every secret")
+	regionList := flag.String("regions", "", "Comma-separated regions to export, or 'all' for every enabled region (default: --region)")
+	excludeRegions := flag.String("exclude-regions", "", "Comma-separated regions to skip (e.g. regions blocked by SCPs)")
+	flag.Var(&roleARNs, "role-arns", "Export the account of each of these roles too, assumed with the profile's credentials (repeatable or comma-separated; replaces --role-arn)")
+	concurrency := flag.Int("concurrency", 4, "Export up to N regions and accounts at once")
+	interactive := flag.Bool("interactive", false, "Browse the secrets in a searchable terminal view instead of writing the output")
+	awsOptions := awsconfig.Defaults()
+	configPath := config.RegisterFlag(flag.CommandLine)
+	awsOptions.RegisterFlags(flag.CommandLine)
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	run := manifest.New("secrets-lister")
+	// Optional calls that fail are summarised once, on exit, instead of per secret
+	degraded := degrade.NewTracker()
+	// Every exit from here on, including early errors, writes the manifest,
+	// if requested, with the real exit code and reports telemetry
+	exit := func(code int) {
+		for _, warning := range degraded.Warnings() {
+			run.Warnf("%s", warning)
+		}
+		if *manifestPath != "" {
+			if err := run.Write(*manifestPath, code); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+				usage.Finish(1)
+				os.Exit(1)
+			}
+		}
+		usage.Finish(code)
+		os.Exit(code)
+	}
+
+	if err := config.Apply(flag.CommandLine, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	tagFilters, err := tagpolicy.ParseFilters(filterTags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	requiredTags := tagpolicy.ParseRequired(*requiredTagsList)
+
+	if *format != "table" && *format != "json" && *format != "html" && *format != "parquet" && *format != "sqlite" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table, json, html, parquet, or sqlite)\n", *format)
+		exit(1)
+	}
+	if *outputPath == "" {
+		*outputPath = "secrets.parquet"
+		if *format == "sqlite" {
+			*outputPath = "inventory.db"
+		}
+	}
+	// A database is appended to in place, which S3 can't do
+	if *format == "sqlite" && output.IsS3(*outputPath) {
+		fmt.Fprintln(os.Stderr, "Error: --format sqlite writes a local file; --output can't be s3://")
+		exit(1)
+	}
+
+	if *limit > 0 && *sample > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --limit and --sample are mutually exclusive")
+		exit(1)
+	}
+	// A partial export would be drift against every secret it didn't reach
+	if (*limit > 0 || *sample > 0) && (*snapshotOut != "" || *diffAgainst != "") {
+		fmt.Fprintln(os.Stderr, "Error: --limit and --sample can't be used with --snapshot or --diff-against")
+		exit(1)
+	}
+
+	if err := progress.Validate(*progressMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *taggingAPI {
+		if len(tagFilters) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: --tagging-api requires --filter-tag")
+			exit(1)
+		}
+		if len(filterName)+len(filterTagKey)+len(filterTagValue)+len(filterPrimaryRegion)+len(filterAll) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --tagging-api can't be combined with the server-side --filter-* flags; use --filter-tag")
+			exit(1)
+		}
+	}
+
+	var glueDatabase, glueTable string
+	if *registerGlue != "" {
+		if *format != "parquet" || !output.IsS3(*outputPath) {
+			fmt.Fprintln(os.Stderr, "Error: --register-glue requires --format parquet and an s3:// --output")
+			exit(1)
+		}
+		glueDatabase, glueTable, err = catalog.ParseName(*registerGlue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+
+	if *serviceLinked != "include" && *serviceLinked != "exclude" && *serviceLinked != "only" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --service-linked value %q (use include, exclude, or only)\n", *serviceLinked)
+		exit(1)
+	}
+
+	// The server-side filters, sampling, and anything writing to AWS need the API
+	if *offline != "" && (len(filterName)+len(filterTagKey)+len(filterTagValue)+len(filterPrimaryRegion)+len(filterAll) > 0 || *taggingAPI || *limit > 0 || *sample > 0 || *registerGlue != "" || output.IsS3(*outputPath)) {
+		fmt.Fprintln(os.Stderr, "Error: the server-side --filter-* flags, --tagging-api, --limit, --sample, --register-glue, and s3:// output can't be used with --offline")
+		exit(1)
+	}
+
+	// Drift compares whole inventories; a filtered one would report every
+	// secret it left out as removed
+	if *diffAgainst != "" && (len(filterName)+len(filterTagKey)+len(filterTagValue)+len(filterPrimaryRegion)+len(filterAll)+len(tagFilters) > 0 || *serviceLinked != "include") {
+		fmt.Fprintln(os.Stderr, "Error: the --filter-* flags and --service-linked can't be used with --diff-against")
+		exit(1)
+	}
+
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --concurrency must be at least 1")
+		exit(1)
+	}
+	if *interactive {
+		if err := browse.Available(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if *registerGlue != "" {
+			fmt.Fprintln(os.Stderr, "Error: --register-glue needs an export; it can't be used with --interactive")
+			exit(1)
+		}
+	}
+	var roles []string
+	for _, list := range roleARNs {
+		roles = append(roles, regions.Parse(list)...)
+	}
+	if *offline != "" && len(roles) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --role-arns can't be used with --offline")
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	requestedRegions := regions.Parse(*regionList)
+	var offlineSnapshot snapshot.Snapshot
+	var offlineSecrets []SecretRecord
+	var targets []exportTarget
+	var callers []*identity.Caller
+	// outputCfg writes s3:// output and registers it in Glue: the first account's
+	var outputCfg aws.Config
+	var scanRegions []string
+	// stderr keeps stdout (JSON/table) parseable
+	if *offline != "" {
+		offlineSnapshot, offlineSecrets, err = readSecretSnapshot(*offline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading snapshot: %v\n", err)
+			exit(1)
+		}
+		// By default every region in the snapshot, or the one --region names
+		if len(requestedRegions) == 0 && awsOptions.Region != "" {
+			requestedRegions = []string{awsOptions.Region}
+		}
+		available := distinctSorted(offlineSecrets, func(record SecretRecord) string { return record.SourceRegion })
+		scanRegions = regions.Select(available, requestedRegions, regions.Parse(*excludeRegions))
+		fmt.Fprintf(os.Stderr, "Offline: %s (taken %s, account %s)\n", *offline, offlineSnapshot.TakenAt.Format(time.RFC3339), render.ValueOrDash(offlineSnapshot.Account))
+		fmt.Fprintf(os.Stderr, "Using Region:  %s\n", strings.Join(scanRegions, ", "))
+	} else {
+		// Each role is one account; without --role-arns it's the account of
+		// the profile, or of --role-arn
+		if len(roles) == 0 {
+			roles = []string{awsOptions.RoleARN}
+		}
+		for i, role := range roles {
+			accountOptions := awsOptions
+			accountOptions.RoleARN = role
+			cfg, err := accountOptions.Load(ctx)
+			if err != nil {
+				usage.Error(err)
+				fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+				exit(1)
+			}
+
+			if i == 0 {
+				outputCfg = cfg
+			}
+
+			caller, err := identity.Lookup(ctx, cfg)
+			degraded.Record(degrade.Caller, err)
+			callers = append(callers, caller)
+
+			// Regions are resolved per account, since each opts in to its own
+			accountRegions, skippedRegions, err := regions.Resolve(ctx, cfg, requestedRegions, regions.Parse(*excludeRegions))
+			if errors.Is(err, regions.ErrOptInUnknown) {
+				degraded.Record(degrade.Regions, err)
+				run.Warnf("%v", err)
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "Error resolving regions: %v\n", err)
+				exit(1)
+			}
+
+			if i > 0 {
+				fmt.Fprintln(os.Stderr)
+			}
+			identity.Banner(os.Stderr, awsOptions.Profile, caller, accountRegions)
+			if role != "" {
+				fmt.Fprintf(os.Stderr, "Using Role:    %s\n", role)
+			}
+			for _, skipped := range skippedRegions {
+				fmt.Fprintf(os.Stderr, "Skipping Region: %s (%s)\n", skipped.Region, skipped.Reason)
+				run.Errors = append(run.Errors, fmt.Sprintf("skipped region %s: %s", skipped.Region, skipped.Reason))
+			}
+
+			account := accountOf(caller, role)
+			for _, region := range accountRegions {
+				regionCfg := cfg.Copy()
+				regionCfg.Region = region
+				targets = append(targets, exportTarget{cfg: regionCfg, account: account})
+				if !slices.Contains(scanRegions, region) {
+					scanRegions = append(scanRegions, region)
+				}
+			}
+		}
+		if len(callers) == 1 {
+			run.Caller = callers[0]
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	run.Regions = scanRegions
+
+	// One file or table holds every region, so {region} can only name one
+	region := strings.Join(scanRegions, ", ")
+	var outputRegion string
+	if len(scanRegions) == 1 {
+		outputRegion = scanRegions[0]
+	} else if strings.Contains(*outputPath, "{region}") && (*format == "parquet" || *format == "sqlite") {
+		fmt.Fprintln(os.Stderr, "Error: --output can't use {region} when exporting several regions into one file")
+		exit(1)
+	}
+	// The database records one account per scan
+	if *format == "sqlite" && len(roles) > 1 {
+		fmt.Fprintln(os.Stderr, "Error: --format sqlite records one account per scan; run once per account instead of using --role-arns")
+		exit(1)
+	}
+
+	account := degrade.Unknown
+	if len(callers) == 1 && callers[0] != nil {
+		account = callers[0].Account
+	} else if *offline != "" && offlineSnapshot.Account != "" {
+		account = offlineSnapshot.Account
+	}
+
+	var secrets []SecretRecord
+	// scanned are the account/regions whose secrets were all listed, which
+	// the snapshot records so a failed region isn't reported as drift
+	var scanned []string
+	if *offline != "" {
+		for _, scope := range offlineScopes(offlineSnapshot, offlineSecrets) {
+			if slices.Contains(scanRegions, snapshot.ScopeRegion(scope)) {
+				scanned = append(scanned, scope)
+			}
+		}
+		for _, record := range offlineSecrets {
+			if !slices.Contains(scanRegions, record.SourceRegion) {
+				continue
+			}
+			if record.DeletedDate != nil && !*includeDeleted {
+				continue
+			}
+			// Recomputed below against today and this run's --stale-days
+			record.StaleReason = nil
+			secrets = append(secrets, record)
+		}
+	} else {
+		options := exportOptions{
+			run:      run,
+			degraded: degraded,
+			filters: buildFilters(map[types.FilterNameStringType][]string{
+				types.FilterNameStringTypeName:          filterName,
+				types.FilterNameStringTypeTagKey:        filterTagKey,
+				types.FilterNameStringTypeTagValue:      filterTagValue,
+				types.FilterNameStringTypePrimaryRegion: filterPrimaryRegion,
+				types.FilterNameStringTypeAll:           filterAll,
+			}),
+			tagFilters:     tagFilters,
+			taggingAPI:     *taggingAPI,
+			includeDeleted: *includeDeleted,
+			limit:          *limit,
+			sample:         *sample,
+		}
+
+		// One target keeps the per-secret progress line; several count
+		// finished regions instead, since their secrets are described at once
+		bar := progress.New(*progressMode, awsOptions.Log.Enabled())
+		if len(targets) == 1 {
+			options.bar = bar
+		} else {
+			bar.Start(fmt.Sprintf("Exporting %d regions", len(targets)), len(targets), "regions")
+		}
+
+		results := make([][]SecretRecord, len(targets))
+		complete := make([]bool, len(targets))
+		errs := make([]error, len(targets))
+		slots := make(chan struct{}, *concurrency)
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			i, target := i, target
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				results[i], complete[i], errs[i] = exportSecrets(ctx, target, options)
+				if len(targets) > 1 {
+					bar.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if len(targets) > 1 {
+			bar.Clear()
+		}
+
+		// Merged in target order, so output is stable however the exports finished;
+		// with several targets one failing shouldn't stop the run
+		failed := 0
+		for i, target := range targets {
+			if errs[i] != nil {
+				usage.Error(errs[i])
+				if len(targets) == 1 {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", errs[i])
+					exit(1)
+				}
+				run.Warnf("Could not export %s (account %s): %v", target.cfg.Region, target.account, errs[i])
+				failed++
+				continue
+			}
+			secrets = append(secrets, results[i]...)
+			if complete[i] {
+				scanned = append(scanned, snapshot.Scope(knownAccount(target.account), target.cfg.Region))
+			}
+		}
+		if failed == len(targets) {
+			fmt.Fprintln(os.Stderr, "Error: no region could be exported")
+			exit(1)
+		}
+
+		// --limit and --sample bound each target's describe calls; the merged
+		// result is then held to the same count
+		if *sample > 0 && len(secrets) > *sample {
+			rand.Shuffle(len(secrets), func(i, j int) { secrets[i], secrets[j] = secrets[j], secrets[i] })
+			secrets = secrets[:*sample]
+		}
+		if *limit > 0 && len(secrets) > *limit {
+			secrets = secrets[:*limit]
+		}
+	}
+
+	secrets = filterServiceLinked(secrets, *serviceLinked)
+
+	if len(tagFilters) > 0 {
+		var filtered []SecretRecord
+		for _, record := range secrets {
+			if tagpolicy.Match(record.Tags, tagFilters) {
+				filtered = append(filtered, record)
+			}
+		}
+		secrets = filtered
+	}
+
+	staleSecrets := 0
+	if *staleDays > 0 {
+		staleSecrets = markStaleSecrets(secrets, *staleDays, time.Now())
+	}
+
+	// Snapshots are taken before the empty check so "every secret was deleted" is still drift
+	var drift []snapshot.Change
+	if *snapshotOut != "" || *diffAgainst != "" {
+		current, err := secretSnapshot(secrets, account, scanned)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error taking snapshot: %v\n", err)
+			exit(1)
+		}
+		if *diffAgainst != "" {
+			previous, err := snapshot.Read(*diffAgainst)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading snapshot: %v\n", err)
+				exit(1)
+			}
+			upgradeSecretIDs(&previous)
+			drift, err = snapshot.Diff(previous, current)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error comparing snapshots: %v\n", err)
+				exit(1)
+			}
+		}
+		if *snapshotOut != "" {
+			if err := snapshot.Write(*snapshotOut, current); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing snapshot: %v\n", err)
+				exit(1)
+			}
+			if err := run.AddFile(*snapshotOut); err != nil {
+				run.Warnf("Could not hash snapshot: %v", err)
+			}
+		}
+	}
+
+	run.Counts["secrets"] = len(secrets)
+	run.Counts["stale"] = staleSecrets
+	run.Counts["drift"] = len(drift)
+
+	if *interactive {
+		items := make([]browse.Item, 0, len(secrets))
+		for _, record := range secrets {
+			items = append(items, secretBrowseItem(record))
+		}
+		if err := browse.Run("Secrets in "+region, items); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	// JSON consumers get an empty array, HTML readers an empty report, and a
+	// database an empty scan, rather than no output
+	if len(secrets) == 0 && *format != "json" && *format != "html" && *format != "sqlite" && len(drift) == 0 {
+		fmt.Fprintln(os.Stderr, "No secrets found")
+		exit(0)
+	}
+
+	switch *format {
+	case "table":
+		headers, rows := secretsRows(secrets)
+		render.Table(os.Stdout, headers, rows)
+	case "html":
+		if err := render.HTML(os.Stdout, secretsHTMLReport(secrets, run.Caller, region, *staleDays, requiredTags)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing HTML: %v\n", err)
+			exit(1)
+		}
+	case "json":
+		if err := render.JSON(os.Stdout, toSecretJSON(secrets)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+	case "sqlite":
+		destination := output.Expand(*outputPath, time.Now(), outputRegion)
+		scan := sqlitestore.Scan{Tool: "secrets-lister", Account: account, Regions: run.Regions}
+		for _, record := range secrets {
+			scan.Secrets = append(scan.Secrets, sqliteSecret(record))
+		}
+		scanID, err := sqlitestore.Append(ctx, destination, scan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing SQLite: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Appended %d secrets to %s (scan %d)\n", len(secrets), destination, scanID)
+	default:
+		destination := output.Expand(*outputPath, time.Now(), outputRegion)
+		if output.IsS3(destination) {
+			err = output.StreamToS3(ctx, s3.NewFromConfig(outputCfg), destination, "application/vnd.apache.parquet", func(w io.Writer) error {
+				hw := manifest.NewHashingWriter(w)
+				if err := writeParquetStream(hw, secrets); err != nil {
+					return err
+				}
+				run.AddStream(destination, hw)
+				return nil
+			})
+		} else {
+			err = writeParquet(destination, secrets)
+			if err == nil {
+				err = run.AddFile(destination)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing parquet: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d secrets to %s\n", len(secrets), destination)
+
+		if *registerGlue != "" {
+			if err := registerGlueTable(ctx, glue.NewFromConfig(outputCfg), glueDatabase, glueTable, destination); err != nil {
+				fmt.Fprintf(os.Stderr, "Error registering Glue table: %v\n", err)
+				exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Registered %s in Glue table %s\n", destination, *registerGlue)
+		}
+	}
+
+	if len(requiredTags) > 0 {
+		violations := 0
+		for _, record := range secrets {
+			if missing := tagpolicy.Missing(record.Tags, requiredTags); len(missing) > 0 {
+				fmt.Fprintf(os.Stderr, "Missing required tags: %s (%s)\n", record.Name, strings.Join(missing, ", "))
+				violations++
+			}
+		}
+		run.Counts["missing_tags"] = violations
+		if violations > 0 {
+			fmt.Fprintf(os.Stderr, "Secrets missing required tags: %d\n", violations)
+			exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "All secrets have required tags: %s\n", strings.Join(requiredTags, ", "))
+	}
+
+	if *staleDays > 0 {
+		for _, record := range secrets {
+			if record.StaleReason != nil {
+				fmt.Fprintf(os.Stderr, "Stale: %s (%s)\n", record.Name, *record.StaleReason)
+			}
+		}
+		if staleSecrets > 0 {
+			fmt.Fprintf(os.Stderr, "Secrets not rotated or accessed in %d days: %d\n", *staleDays, staleSecrets)
+			exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "All secrets rotated and accessed within %d days\n", *staleDays)
+	}
+
+	if *diffAgainst != "" {
+		if len(drift) > 0 {
+			// stderr keeps stdout (JSON) parseable
+			render.Table(os.Stderr, []string{"Change", "Secret", "Details"}, driftRows(drift))
+			fmt.Fprintf(os.Stderr, "Changes since %s: %d\n", *diffAgainst, len(drift))
+			exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "No drift since %s\n", *diffAgainst)
+	}
+
+	exit(0)
+}
+
+func runSelfUpdate(args []string) {
+	telemetryOptions := telemetry.Defaults()
+	usage := telemetry.Start(&telemetryOptions, "secrets-lister", "self-update")
+
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	awsOptions := awsconfig.Defaults()
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	var updateFlags selfupdate.Flags
+	updateFlags.Register(fs)
+	fs.Parse(args)
+
+	exit := func(code int) {
+		usage.Finish(code)
+		os.Exit(code)
+	}
+
+	ctx := context.Background()
+
+	verifier, err := updateFlags.Verifier(func() (*kms.Client, error) {
+		cfg, err := awsOptions.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		return kms.NewFromConfig(cfg), nil
+	})
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	if err := selfupdate.Run(ctx, client, os.Stdout, updateFlags.Options("secrets-lister", version.Version, verifier)); err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error updating: %v\n", err)
+		exit(1)
+	}
+	exit(0)
+}
+
+// runBackup writes the values of the selected secrets to an archive encrypted
+// under a KMS data key. It reads every selected secret's value, so it never
+// runs without a filter or an explicit --all.
+func runBackup(args []string) {
+	telemetryOptions := telemetry.Defaults()
+	usage := telemetry.Start(&telemetryOptions, "secrets-lister", "backup")
+
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	var filterName, filterTags stringSliceFlag
+	kmsKey := fs.String("kms-key", "", "KMS key ID, ARN, or alias to encrypt the archive under (required)")
+	outputPath := fs.String("output", "", "Archive file to write (required)")
+	all := fs.Bool("all", false, "Back up every secret; without it --filter-name or --filter-tag is required")
+	fs.Var(&filterName, "filter-name", "Server-side filter on secret name prefix (repeatable, prefix with ! to negate)")
+	fs.Var(&filterTags, "filter-tag", "Only back up secrets with this tag, as Key=Value or Key (repeatable)")
+	allowPartial := fs.Bool("allow-partial", false, "Write the archive even if some secret values can't be read")
+	manifestPath := fs.String("manifest", "", "Write a JSON run manifest (caller, region, counts, errors, archive hash) to this file")
+	awsOptions := awsconfig.Defaults()
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	run := manifest.New("secrets-lister")
+	// Every exit, including early errors, writes the manifest, if requested,
+	// and reports telemetry
+	exit := func(code int) {
+		if *manifestPath != "" {
+			if err := run.Write(*manifestPath, code); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+				usage.Finish(1)
+				os.Exit(1)
+			}
+		}
+		usage.Finish(code)
+		os.Exit(code)
+	}
+
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *kmsKey == "" || *outputPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --kms-key and --output are required")
+		exit(1)
+	}
+	if !*all && len(filterName) == 0 && len(filterTags) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: select secrets with --filter-name or --filter-tag, or pass --all")
+		exit(1)
+	}
+	tagFilters, err := tagpolicy.ParseFilters(filterTags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		exit(1)
+	}
+
+	run.Regions = []string{cfg.Region}
+	caller, err := identity.Lookup(ctx, cfg)
+	if err != nil {
+		run.Warnf("Could not resolve caller: %v", err)
+	}
+	run.Caller = caller
+	identity.Banner(os.Stderr, awsOptions.Profile, caller, run.Regions)
+	fmt.Fprintln(os.Stderr)
+
+	client := secretsmanager.NewFromConfig(cfg)
+	entries, err := secretsinv.List(ctx, client, secretsinv.ListOptions{
+		Filters: buildFilters(map[types.FilterNameStringType][]string{types.FilterNameStringTypeName: filterName}),
+	})
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error listing secrets: %v\n", err)
+		exit(1)
+	}
+	if len(tagFilters) > 0 {
+		var filtered []types.SecretListEntry
+		for _, entry := range entries {
+			if tagpolicy.Match(tagMap(entry.Tags), tagFilters) {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "No secrets selected; nothing to back up")
+		exit(1)
+	}
+
+	secrets, failures := backup.Fetch(ctx, client, entries)
+	for _, failure := range failures {
+		run.Warnf("Could not read %s (%s): %v", failure.Name, failure.Class, failure.Err)
+	}
+	run.Counts["secrets"] = len(secrets)
+	run.Counts["failed"] = len(failures)
+	if len(failures) > 0 && !*allowPartial {
+		fmt.Fprintf(os.Stderr, "Error: could not read %d of %d secrets; no archive written (pass --allow-partial to write the rest)\n", len(failures), len(entries))
+		exit(1)
+	}
+
+	account := ""
+	if caller != nil {
+		account = caller.Account
+	}
+	archive, err := backup.Seal(ctx, kms.NewFromConfig(cfg), *kmsKey, account, cfg.Region, secrets)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error encrypting archive: %v\n", err)
+		exit(1)
+	}
+	if err := backup.Write(*outputPath, archive); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing archive: %v\n", err)
+		exit(1)
+	}
+	if err := run.AddFile(*outputPath); err != nil {
+		run.Warnf("Could not hash archive: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Backed up %d secrets to %s (key %s)\n", len(secrets), *outputPath, archive.KeyID)
+	exit(0)
+}
+
+// runKeyReport maps every secret to the KMS key encrypting it, exiting 2 if
+// any secret uses the default aws/secretsmanager key or a key that is
+// disabled, pending deletion, or gone.
+func runKeyReport(args []string) {
+	telemetryOptions := telemetry.Defaults()
+	usage := telemetry.Start(&telemetryOptions, "secrets-lister", "key-report")
+
+	fs := flag.NewFlagSet("key-report", flag.ExitOnError)
+	var filterName stringSliceFlag
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Var(&filterName, "filter-name", "Server-side filter on secret name prefix (repeatable, prefix with ! to negate)")
+	includeDeleted := fs.Bool("include-deleted", false, "Include secrets scheduled for deletion")
+	manifestPath := fs.String("manifest", "", "Write a JSON run manifest (caller, region, counts, errors) to this file")
+	awsOptions := awsconfig.Defaults()
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	run := manifest.New("secrets-lister")
+	// Every exit, including early errors, writes the manifest, if requested,
+	// and reports telemetry
+	exit := func(code int) {
+		if *manifestPath != "" {
+			if err := run.Write(*manifestPath, code); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+				usage.Finish(1)
+				os.Exit(1)
+			}
+		}
+		usage.Finish(code)
+		os.Exit(code)
+	}
+
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use table or json)\n", *format)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		exit(1)
+	}
+
+	run.Regions = []string{cfg.Region}
+	caller, err := identity.Lookup(ctx, cfg)
+	if err != nil {
+		run.Warnf("Could not resolve caller: %v", err)
+	}
+	run.Caller = caller
+	identity.Banner(os.Stderr, awsOptions.Profile, caller, run.Regions)
+	fmt.Fprintln(os.Stderr)
+
+	secrets, err := secretsinv.List(ctx, secretsmanager.NewFromConfig(cfg), secretsinv.ListOptions{
+		Filters:        buildFilters(map[types.FilterNameStringType][]string{types.FilterNameStringTypeName: filterName}),
+		IncludeDeleted: *includeDeleted,
+	})
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error listing secrets: %v\n", err)
+		exit(1)
+	}
+
+	// Secrets name the same key in different ways; each is described once
+	inventory := kmsinv.NewCache(kms.NewFromConfig(cfg))
+	resolver := kmsinv.NewResolver(inventory)
+	if _, err := resolver.AliasesByKey(ctx); err != nil {
+		run.Warnf("Could not list aliases, key aliases are left out: %v", err)
+	}
+	entries, err := secretkeys.Join(ctx, resolver, inventory, secrets)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	counts := secretkeys.Count(entries)
+	flagged := 0
+	notAuthorized := 0
+	for _, entry := range entries {
+		if len(entry.Findings) > 0 {
+			flagged++
+		}
+		if entry.Key.State == secretkeys.NotAuthorized {
+			notAuthorized++
+		}
+	}
+	run.Counts["secrets"] = len(entries)
+	run.Counts["flagged"] = flagged
+	run.Counts["not_authorized"] = notAuthorized
+	for finding, count := range counts {
+		run.Counts[finding] = count
+	}
+	if notAuthorized > 0 {
+		run.Warnf("Not authorized to describe the key of %d secret(s); they are not checked", notAuthorized)
+	}
+
+	if *format == "json" {
+		if err := render.JSON(os.Stdout, entries); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			exit(1)
+		}
+	} else {
+		render.Table(os.Stdout, []string{"Name", "KMS Key", "Aliases", "Key Manager", "Key State", "Findings"}, keyReportRows(entries))
+		fmt.Println()
+		fmt.Printf("Secrets on the default %s key: %d\n", secretkeys.DefaultAlias, counts[secretkeys.DefaultKey])
+		fmt.Printf("Secrets on a disabled key: %d\n", counts[secretkeys.KeyDisabled])
+		fmt.Printf("Secrets on a key pending deletion: %d\n", counts[secretkeys.KeyPendingDeletion])
+		fmt.Printf("Secrets on a key that no longer exists: %d\n", counts[secretkeys.KeyNotFound])
+	}
+
+	if flagged > 0 {
+		exit(2)
+	}
+	exit(0)
+}
+
+func keyReportRows(entries []secretkeys.Entry) [][]string {
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		key := entry.Key.KeyID
+		if key == "" {
+			// Not described: show the key as the secret names it
+			key = entry.KMSKeyID
+			if key == "" {
+				key = secretkeys.DefaultAlias
+			}
+		}
+		rows = append(rows, []string{
+			entry.Name,
+			key,
+			render.ValueOrDash(strings.Join(entry.Key.Aliases, ", ")),
+			render.ValueOrDash(entry.Key.KeyManager),
+			entry.Key.State,
+			render.ValueOrDash(strings.Join(entry.Findings, ", ")),
+		})
+	}
+	return rows
+}
+
+// runRestore creates the secrets in an archive, in the configured region.
+// --dry-run lists the archive from its plain text header without calling AWS.
+func runRestore(args []string) {
+	telemetryOptions := telemetry.Defaults()
+	usage := telemetry.Start(&telemetryOptions, "secrets-lister", "restore")
+
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var filterName stringSliceFlag
+	inputPath := fs.String("input", "", "Archive file written by backup (required)")
+	fs.Var(&filterName, "filter-name", "Only restore secrets whose name starts with this prefix (repeatable)")
+	overwrite := fs.Bool("overwrite", false, "Put the backed up value as a new version of secrets that already exist, instead of skipping them")
+	kmsKey := fs.String("kms-key", "", "KMS key ID, ARN, or alias for restored secrets (default: the original key in the backup's account and region, else aws/secretsmanager)")
+	dryRun := fs.Bool("dry-run", false, "List what the archive holds without decrypting it or calling AWS")
+	yes := fs.Bool("yes", false, "Skip the interactive confirmation")
+	manifestPath := fs.String("manifest", "", "Write a JSON run manifest (caller, region, counts, errors) to this file")
+	awsOptions := awsconfig.Defaults()
+	configPath := config.RegisterFlag(fs)
+	awsOptions.RegisterFlags(fs)
+	telemetryOptions.RegisterFlags(fs)
+	fs.Parse(args)
+
+	run := manifest.New("secrets-lister")
+	// Every exit, including early errors, writes the manifest, if requested,
+	// and reports telemetry
+	exit := func(code int) {
+		if *manifestPath != "" {
+			if err := run.Write(*manifestPath, code); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+				usage.Finish(1)
+				os.Exit(1)
+			}
+		}
+		usage.Finish(code)
+		os.Exit(code)
+	}
+
+	if err := config.Apply(fs, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if *inputPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --input is required")
+		exit(1)
+	}
+	archive, err := backup.Read(*inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading archive: %v\n", err)
+		exit(1)
+	}
+	selected := func(name string) bool {
+		if len(filterName) == 0 {
+			return true
+		}
+		for _, prefix := range filterName {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Archive: %s\n", *inputPath)
+	fmt.Fprintf(os.Stderr, "  Created: %s\n", archive.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(os.Stderr, "  Source:  %s %s\n", render.ValueOrDash(archive.Account), archive.Region)
+	fmt.Fprintf(os.Stderr, "  Key:     %s\n", archive.KeyID)
+	fmt.Fprintf(os.Stderr, "  Secrets: %d\n", len(archive.Secrets))
+	fmt.Fprintln(os.Stderr)
+
+	if *dryRun {
+		var rows [][]string
+		for _, entry := range archive.Secrets {
+			if selected(entry.Name) {
+				rows = append(rows, []string{entry.Name, entry.VersionID, entry.ARN})
+			}
+		}
+		render.Table(os.Stdout, []string{"Name", "Version", "Backed Up From"}, rows)
+		exit(0)
+	}
+
+	ctx := context.Background()
+
+	cfg, err := awsOptions.Load(ctx)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		exit(1)
+	}
+
+	run.Regions = []string{cfg.Region}
+	caller, err := identity.Lookup(ctx, cfg)
+	if err != nil {
+		run.Warnf("Could not resolve caller: %v", err)
+	}
+	run.Caller = caller
+	identity.Banner(os.Stderr, awsOptions.Profile, caller, run.Regions)
+	fmt.Fprintln(os.Stderr)
+
+	if !*yes {
+		// Never ask someone to confirm an account we couldn't show them
+		if caller == nil {
+			fmt.Fprintln(os.Stderr, "Error: could not resolve the caller identity; pass --yes to proceed anyway")
+			exit(1)
+		}
+		message := "This will create the archived secrets"
+		if *overwrite {
+			message += " and overwrite the values of any that already exist"
+		}
+		if !identity.Confirm(caller, run.Regions, message+".") {
+			fmt.Println("Operation cancelled")
+			exit(0)
+		}
+	}
+
+	// The data key can only be decrypted in the region of the key it was
+	// encrypted under, wherever the secrets are restored to
+	keyRegion, err := archive.KeyRegion()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	kmsCfg := cfg.Copy()
+	kmsCfg.Region = keyRegion
+	secrets, err := backup.Open(ctx, kms.NewFromConfig(kmsCfg), archive)
+	if err != nil {
+		usage.Error(err)
+		fmt.Fprintf(os.Stderr, "Error opening archive: %v\n", err)
+		exit(1)
+	}
+
+	opts := backup.RestoreOptions{
+		Overwrite:  *overwrite,
+		KMSKeyID:   *kmsKey,
+		SameRegion: cfg.Region == archive.Region && caller != nil && caller.Account == archive.Account,
+	}
+	client := secretsmanager.NewFromConfig(cfg)
+	var rows [][]string
+	failed := 0
+	for _, secret := range secrets {
+		if !selected(secret.Name) {
+			continue
+		}
+		outcome, err := backup.Restore(ctx, client, secret, opts)
+		result := outcome
+		if err != nil {
+			failed++
+			outcome = "failed"
+			result = "failed: " + awserr.Describe(err)
+			run.Warnf("Could not restore %s: %v", secret.Name, err)
+		} else if outcome == backup.Skipped {
+			result = "skipped: already exists (use --overwrite)"
+		}
+		run.Counts[outcome]++
+		rows = append(rows, []string{secret.Name, secret.VersionID, result})
+	}
+	render.Table(os.Stdout, []string{"Name", "Backed Up Version", "Result"}, rows)
+
+	fmt.Fprintf(os.Stderr, "Restored to %s: %d created, %d updated\n", cfg.Region, run.Counts[backup.Created], run.Counts[backup.Updated])
+	if skipped := run.Counts[backup.Skipped]; skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d secrets that already exist (use --overwrite to update them)\n", skipped)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Failed to restore %d of %d secrets\n", failed, len(rows))
+		exit(1)
+	}
+	exit(0)
+}
+
+// tagMap flattens Secrets Manager tags for tagpolicy.
+func tagMap(tags []types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
+
+// secretSnapshot keys items by account, region, and name, since names are
+// only unique per account and region.
+func secretSnapshot(secrets []SecretRecord, account string, scanned []string) (snapshot.Snapshot, error) {
+	snap := snapshot.Snapshot{Kind: "secrets", TakenAt: time.Now().UTC(), Scanned: scanned}
+	if account != degrade.Unknown {
+		snap.Account = account
+	}
+	for _, record := range secrets {
+		id := secretItemID(record.AccountID, record.SourceRegion, record.Name)
+		state := "Active"
+		if record.DeletedDate != nil {
+			state = "PendingDeletion"
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return snap, fmt.Errorf("encoding secret %s: %w", record.Name, err)
+		}
+		snap.Items = append(snap.Items, snapshot.Item{
+			ID:      id,
+			Name:    record.Name,
+			Account: record.AccountID,
+			Region:  record.SourceRegion,
+			State:   state,
+			Tags:    record.Tags,
+			Data:    data,
+		})
+	}
+	return snap, nil
+}
+
+// secretItemID is account/region/name, or region/name when the account
+// isn't known.
+func secretItemID(account, region, name string) string {
+	return snapshot.Scope(account, region) + "/" + name
+}
+
+// upgradeSecretIDs rekeys a snapshot taken before item IDs always named the
+// account, so comparing with it doesn't report every secret as replaced.
+func upgradeSecretIDs(snap *snapshot.Snapshot) {
+	if len(snap.Scanned) > 0 {
+		return
+	}
+	for i, item := range snap.Items {
+		var record SecretRecord
+		if item.Account != "" || json.Unmarshal(item.Data, &record) != nil {
+			continue
+		}
+		if record.AccountID == "" {
+			record.AccountID = snap.Account
+		}
+		snap.Items[i].Account = record.AccountID
+		snap.Items[i].ID = secretItemID(record.AccountID, item.Region, item.Name)
+	}
+}
+
+// offlineScopes are the scopes an --offline snapshot listed completely: the
+// ones it records, or for a snapshot that predates them, every account and
+// region its secrets came from.
+func offlineScopes(snap snapshot.Snapshot, secrets []SecretRecord) []string {
+	if len(snap.Scanned) > 0 {
+		return snap.Scanned
+	}
+	return distinctSorted(secrets, func(record SecretRecord) string {
+		return snapshot.Scope(record.AccountID, record.SourceRegion)
+	})
+}
+
+// readSecretSnapshot reads a secrets snapshot for --offline.
+func readSecretSnapshot(path string) (snapshot.Snapshot, []SecretRecord, error) {
+	snap, err := snapshot.ReadOffline(path, "secrets")
+	if err != nil {
+		return snap, nil, err
+	}
+	secrets := make([]SecretRecord, 0, len(snap.Items))
+	for _, item := range snap.Items {
+		var record SecretRecord
+		if err := json.Unmarshal(item.Data, &record); err != nil {
+			return snap, nil, fmt.Errorf("parsing secret %s in %s: %w", item.ID, path, err)
+		}
+		secrets = append(secrets, record)
+	}
+	return snap, secrets, nil
+}
+
+func driftRows(changes []snapshot.Change) [][]string {
+	var rows [][]string
+	for _, c := range changes {
+		rows = append(rows, []string{c.Type, c.ID, render.ValueOrDash(c.Details)})
+	}
+	return rows
+}
+
+func buildFilters(values map[types.FilterNameStringType][]string) []types.Filter {
+	// Fixed order keeps the request deterministic
+	keys := []types.FilterNameStringType{
+		types.FilterNameStringTypeName,
+		types.FilterNameStringTypeTagKey,
+		types.FilterNameStringTypeTagValue,
+		types.FilterNameStringTypePrimaryRegion,
+		types.FilterNameStringTypeAll,
+	}
+
+	var filters []types.Filter
+	for _, key := range keys {
+		if len(values[key]) == 0 {
+			continue
+		}
+		filters = append(filters, types.Filter{
+			Key:    key,
+			Values: values[key],
+		})
+	}
+	return filters
+}
+
+// exportTarget is one account and region of an export.
+type exportTarget struct {
+	// cfg has Region set to the target's region
+	cfg     aws.Config
+	account string
+}
+
+// exportOptions are the listing settings every target of a run shares.
+type exportOptions struct {
+	run            *manifest.Manifest
+	degraded       *degrade.Tracker
+	bar            *progress.Bar
+	filters        []types.Filter
+	tagFilters     []tagpolicy.Filter
+	taggingAPI     bool
+	includeDeleted bool
+	limit          int
+	sample         int
+}
+
+// exportSecrets lists and describes the secrets of one target, and reports
+// whether the listing was complete. Targets run concurrently, so it only
+// reports through the concurrency-safe run, degraded, and bar.
+func exportSecrets(ctx context.Context, target exportTarget, opts exportOptions) ([]SecretRecord, bool, error) {
+	region := target.cfg.Region
+	client := secretsmanager.NewFromConfig(target.cfg)
+
+	// The tagging API returns only the secrets matching --filter-tag, so just
+	// those are described instead of listing the account
+	var secrets []SecretRecord
+	listed := false
+	complete := true
+	if opts.taggingAPI {
+		resources, err := tagindex.Find(ctx, resourcegroupstaggingapi.NewFromConfig(target.cfg), tagindex.Secret, opts.tagFilters)
+		if err != nil {
+			opts.run.Warnf("Could not use the tagging API in %s, listing every secret instead: %v", region, err)
+		} else {
+			secrets, complete, err = describeTagged(ctx, client, opts.run, region, opts.includeDeleted, resources, opts.limit)
+			if err != nil {
+				return nil, false, fmt.Errorf("describing secrets in %s: %w", region, err)
+			}
+			listed = true
+		}
+	}
+	if !listed {
+		var err error
+		secrets, complete, err = listSecrets(ctx, client, opts.run, region, opts.includeDeleted, opts.filters, opts.limit)
+		if err != nil {
+			return nil, false, fmt.Errorf("listing secrets in %s: %w", region, err)
+		}
+	}
+
+	// Sample before the per-secret DescribeSecret calls, which dominate runtime
+	if opts.sample > 0 && len(secrets) > opts.sample {
+		rand.Shuffle(len(secrets), func(i, j int) { secrets[i], secrets[j] = secrets[j], secrets[i] })
+		secrets = secrets[:opts.sample]
+	}
+
+	slog.Info("listed secrets", "region", region, "account", target.account, "secrets", len(secrets))
+	describeReplication(ctx, client, opts.degraded, opts.bar, fmt.Sprintf("Describing %s (account %s)", region, target.account), secrets)
+
+	if target.account != degrade.Unknown {
+		for i := range secrets {
+			secrets[i].AccountID = target.account
+		}
+	}
+	return secrets, complete, nil
+}
+
+// knownAccount is account, or "" when it is degrade.Unknown, as secrets
+// record it.
+func knownAccount(account string) string {
+	if account == degrade.Unknown {
+		return ""
+	}
+	return account
+}
+
+// accountOf is the caller's account, or the role's when the caller couldn't
+// be looked up.
+func accountOf(caller *identity.Caller, role string) string {
+	if caller != nil {
+		return caller.Account
+	}
+	if parsed, err := arn.Parse(role); err == nil && parsed.AccountID != "" {
+		return parsed.AccountID
+	}
+	return degrade.Unknown
+}
+
+// distinctSorted returns the non-empty values key takes over secrets, sorted.
+func distinctSorted(secrets []SecretRecord, key func(SecretRecord) string) []string {
+	var values []string
+	for _, record := range secrets {
+		if value := key(record); value != "" && !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// listSecrets stops paging once limit secrets are collected (0 means no
+// limit). It reports false when listing wasn't authorized, so nothing was
+// listed.
+func listSecrets(ctx context.Context, client secretsinv.API, run *manifest.Manifest, region string, includeDeleted bool, filters []types.Filter, limit int) ([]SecretRecord, bool, error) {
+	entries, err := secretsinv.List(ctx, client, secretsinv.ListOptions{
+		Filters:        filters,
+		IncludeDeleted: includeDeleted,
+		Limit:          limit,
+	})
+	if errors.Is(err, secretsinv.ErrNotAuthorized) {
+		run.Warnf("Not authorized to list secrets, skipping...")
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return secretRecords(entries, region), true, nil
+}
+
+// describeTagged describes only the secrets the tagging API matched, instead
+// of listing the account, and like listSecrets reports whether it could.
+func describeTagged(ctx context.Context, client secretsinv.API, run *manifest.Manifest, region string, includeDeleted bool, resources []tagindex.Resource, limit int) ([]SecretRecord, bool, error) {
+	var arns []string
+	for _, resource := range resources {
+		arns = append(arns, resource.ARN)
+	}
+	if limit > 0 && len(arns) > limit {
+		arns = arns[:limit]
+	}
+
+	entries, err := secretsinv.DescribeAll(ctx, client, arns, includeDeleted)
+	if errors.Is(err, secretsinv.ErrNotAuthorized) {
+		run.Warnf("%v, skipping...", err)
+		return secretRecords(entries, region), false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return secretRecords(entries, region), true, nil
+}
+
+func secretRecords(entries []types.SecretListEntry, region string) []SecretRecord {
+	var secrets []SecretRecord
+	for _, secret := range entries {
+		record := SecretRecord{
+			Name:         aws.ToString(secret.Name),
+			SourceRegion: region,
+		}
+
+		if secret.Description != nil && *secret.Description != "" {
+			record.Description = secret.Description
+		}
+
+		if secret.CreatedDate != nil {
+			// Convert to days since Unix epoch for DATE type
+			days := int32(secret.CreatedDate.Unix() / 86400)
+			record.CreatedDate = &days
+		}
+
+		if secret.LastAccessedDate != nil {
+			// Convert to days since Unix epoch for DATE type
+			days := int32(secret.LastAccessedDate.Unix() / 86400)
+			record.LastAccessedDate = &days
+		}
+
+		if secret.OwningService != nil && *secret.OwningService != "" {
+			record.OwningService = secret.OwningService
+		}
+		if secret.KmsKeyId != nil && *secret.KmsKeyId != "" {
+			record.KMSKeyID = secret.KmsKeyId
+		}
+
+		// Rotation posture
+		record.RotationEnabled = aws.Bool(aws.ToBool(secret.RotationEnabled))
+		if secret.RotationLambdaARN != nil && *secret.RotationLambdaARN != "" {
+			record.RotationLambdaARN = secret.RotationLambdaARN
+		}
+		if secret.RotationRules != nil {
+			record.RotationIntervalDays = secret.RotationRules.AutomaticallyAfterDays
+			if secret.RotationRules.ScheduleExpression != nil && *secret.RotationRules.ScheduleExpression != "" {
+				record.RotationSchedule = secret.RotationRules.ScheduleExpression
+			}
+		}
+		if secret.LastRotatedDate != nil {
+			days := int32(secret.LastRotatedDate.Unix() / 86400)
+			record.LastRotatedDate = &days
+		}
+		if secret.NextRotationDate != nil {
+			days := int32(secret.NextRotationDate.Unix() / 86400)
+			record.NextRotationDate = &days
+		}
+
+		if secret.DeletedDate != nil {
+			// Only set for secrets scheduled for deletion (--include-deleted)
+			days := int32(secret.DeletedDate.Unix() / 86400)
+			record.DeletedDate = &days
+		}
+
+		if secret.PrimaryRegion != nil && *secret.PrimaryRegion != "" {
+			record.PrimaryRegion = secret.PrimaryRegion
+		}
+
+		if len(secret.Tags) > 0 {
+			record.Tags = make(map[string]string)
+			for _, tag := range secret.Tags {
+				key := aws.ToString(tag.Key)
+				value := aws.ToString(tag.Value)
+				record.Tags[key] = value
+			}
+		}
+
+		secrets = append(secrets, record)
+	}
+	return secrets
+}
+
+// replicationWorkers is how many DescribeSecret calls describeReplication
+// keeps in flight per target; --rps still paces them all.
+const replicationWorkers = 8
+
+// describeReplication fills in replica regions and their status. ListSecrets
+// only returns the primary region, so DescribeSecret is called for each secret
+// that is the primary of a replicated set, several at a time; replicas only
+// know their primary. Secrets that can't be described are marked unknown and
+// recorded in degraded.
+func describeReplication(ctx context.Context, client secretsinv.API, degraded *degrade.Tracker, bar *progress.Bar, label string, secrets []SecretRecord) {
+	var primaries []*SecretRecord
+	var names []string
+	for i := range secrets {
+		if record := &secrets[i]; record.PrimaryRegion != nil && *record.PrimaryRegion == record.SourceRegion {
+			primaries = append(primaries, record)
+			names = append(names, record.Name)
+		}
+	}
+
+	bar.Start(label, len(primaries), "replicated secrets")
+	defer bar.Clear()
+	replications, errs := secretsinv.ReplicasAll(ctx, client, names, replicationWorkers, func() { bar.Add(1) })
+	for i, record := range primaries {
+		if errs[i] != nil {
+			degraded.Record(degrade.Replication, errs[i])
+			record.Unknown = append(record.Unknown, degrade.Replication)
+			continue
+		}
+		record.ReplicaRegions = replications[i].Regions
+		record.ReplicationStatus = replications[i].Status
+	}
+}
+
+func filterServiceLinked(secrets []SecretRecord, mode string) []SecretRecord {
+	if mode == "include" {
+		return secrets
+	}
+
+	var filtered []SecretRecord
+	for _, record := range secrets {
+		isServiceLinked := record.OwningService != nil
+		if (mode == "only") == isServiceLinked {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// markStaleSecrets sets StaleReason on secrets not rotated or not accessed in
+// the last staleDays days and returns how many were flagged. Secrets that were
+// never rotated or accessed are judged by their creation date.
+func markStaleSecrets(secrets []SecretRecord, staleDays int, now time.Time) int {
+	today := int32(now.Unix() / 86400)
+	isStale := func(date, created *int32) bool {
+		if date == nil {
+			date = created
+		}
+		return date != nil && int(today-*date) > staleDays
+	}
+
+	flagged := 0
+	for i := range secrets {
+		record := &secrets[i]
+		var reasons []string
+		if isStale(record.LastRotatedDate, record.CreatedDate) {
+			reasons = append(reasons, fmt.Sprintf("not rotated in %d days", staleDays))
+		}
+		if isStale(record.LastAccessedDate, record.CreatedDate) {
+			reasons = append(reasons, fmt.Sprintf("not accessed in %d days", staleDays))
+		}
+		if len(reasons) > 0 {
+			record.StaleReason = aws.String(strings.Join(reasons, ", "))
+			flagged++
+		}
+	}
+	return flagged
+}
+
+func secretsRows(secrets []SecretRecord) ([]string, [][]string) {
+	// Collect tag keys for consistent column order
+	tagKeySet := make(map[string]bool)
+	for _, record := range secrets {
+		for key := range record.Tags {
+			tagKeySet[key] = true
+		}
+	}
+	var tagKeys []string
+	for key := range tagKeySet {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+
+	// Account and region columns only when the export spans several
+	multiAccount := len(distinctSorted(secrets, func(record SecretRecord) string { return record.AccountID })) > 1
+	multiRegion := len(distinctSorted(secrets, func(record SecretRecord) string { return record.SourceRegion })) > 1
+
+	headers := []string{"Name"}
+	if multiAccount {
+		headers = append(headers, "Account")
+	}
+	if multiRegion {
+		headers = append(headers, "Region")
+	}
+	headers = append(headers, "Description", "Created", "Last Accessed", "Owning Service", "Deleted", "Rotation", "Last Rotated", "Next Rotation", "Stale", "Primary Region", "Replicas")
+	headers = append(headers, tagKeys...)
+
+	var rows [][]string
+	for _, record := range secrets {
+		row := []string{record.Name}
+		if multiAccount {
+			row = append(row, render.ValueOrDash(record.AccountID))
+		}
+		if multiRegion {
+			row = append(row, record.SourceRegion)
+		}
+		row = append(row,
+			render.ValueOrDash(aws.ToString(record.Description)),
+			render.ValueOrDash(aws.ToString(formatDays(record.CreatedDate))),
+			render.ValueOrDash(aws.ToString(formatDays(record.LastAccessedDate))),
+			render.ValueOrDash(aws.ToString(record.OwningService)),
+			render.ValueOrDash(aws.ToString(formatDays(record.DeletedDate))),
+			formatSecretRotation(record),
+			render.ValueOrDash(aws.ToString(formatDays(record.LastRotatedDate))),
+			render.ValueOrDash(aws.ToString(formatDays(record.NextRotationDate))),
+			render.ValueOrDash(aws.ToString(record.StaleReason)),
+			render.ValueOrDash(aws.ToString(record.PrimaryRegion)),
+			render.ValueOrDash(formatReplicas(record)),
+		)
+		for _, key := range tagKeys {
+			row = append(row, render.ValueOrDash(record.Tags[key]))
+		}
+		rows = append(rows, row)
+	}
+
+	return headers, rows
+}
+
+// secretsHTMLReport leads with rotation, what security review reads first,
+// followed by the full inventory.
+func secretsHTMLReport(secrets []SecretRecord, caller *identity.Caller, region string, staleDays int, requiredTags []string) render.HTMLReport {
+	report := render.HTMLReport{
+		Title:       "Secrets Manager Rotation Report",
+		GeneratedAt: time.Now(),
+		Context:     []string{"Region: " + region},
+	}
+	if caller != nil {
+		report.Context = append([]string{"Account: " + caller.Account, "Caller: " + caller.ARN}, report.Context...)
+	}
+
+	var rotationRows, staleRows, missingTagRows [][]string
+	var rotationLinks, staleLinks, missingTagLinks []string
+	pendingDeletion := 0
+	for _, record := range secrets {
+		if record.DeletedDate != nil {
+			pendingDeletion++
+			continue
+		}
+		link := console.Secret(record.SourceRegion, record.Name)
+		if !aws.ToBool(record.RotationEnabled) {
+			rotationLinks = append(rotationLinks, link)
+			rotationRows = append(rotationRows, []string{
+				record.Name,
+				render.ValueOrDash(aws.ToString(formatDays(record.CreatedDate))),
+				render.ValueOrDash(aws.ToString(formatDays(record.LastAccessedDate))),
+				render.ValueOrDash(aws.ToString(record.OwningService)),
+				render.ValueOrDash(aws.ToString(record.Description)),
+			})
+		}
+		if record.StaleReason != nil {
+			staleLinks = append(staleLinks, link)
+			staleRows = append(staleRows, []string{record.Name, formatSecretRotation(record), render.ValueOrDash(aws.ToString(formatDays(record.LastRotatedDate))), render.ValueOrDash(aws.ToString(formatDays(record.LastAccessedDate))), *record.StaleReason})
+		}
+		if missing := tagpolicy.Missing(record.Tags, requiredTags); len(requiredTags) > 0 && len(missing) > 0 {
+			missingTagLinks = append(missingTagLinks, link)
+			missingTagRows = append(missingTagRows, []string{record.Name, strings.Join(missing, ", ")})
+		}
+	}
+
+	report.Summary = []render.HTMLCount{
+		{Label: "Secrets", Value: len(secrets)},
+		{Label: "Rotation disabled", Value: len(rotationRows), Alert: true},
+		{Label: "Pending deletion", Value: pendingDeletion},
+	}
+	report.AddSection("Rotation Disabled").SetTable([]string{"Name", "Created", "Last Accessed", "Owning Service", "Description"}, rotationRows).LinkColumn("Name", rotationLinks)
+	if staleDays > 0 {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: fmt.Sprintf("Not rotated or accessed in %d days", staleDays), Value: len(staleRows), Alert: true})
+		report.AddSection("Stale Secrets").SetTable([]string{"Name", "Rotation", "Last Rotated", "Last Accessed", "Reason"}, staleRows).LinkColumn("Name", staleLinks)
+	}
+	if len(requiredTags) > 0 {
+		report.Summary = append(report.Summary, render.HTMLCount{Label: "Missing required tags", Value: len(missingTagRows), Alert: true})
+		report.AddSection("Secrets Missing Required Tags").SetTable([]string{"Name", "Missing Tags"}, missingTagRows).LinkColumn("Name", missingTagLinks)
+	}
+	allLinks := make([]string, len(secrets))
+	for i, record := range secrets {
+		allLinks[i] = console.Secret(record.SourceRegion, record.Name)
+	}
+	report.AddSection("All Secrets").SetTable(secretsRows(secrets)).LinkColumn("Name", allLinks)
+	return report
+}
+
+func toSecretJSON(secrets []SecretRecord) []SecretJSON {
+	result := make([]SecretJSON, 0, len(secrets))
+	for _, record := range secrets {
+		result = append(result, SecretJSON{
+			Name:                 record.Name,
+			Description:          record.Description,
+			CreatedDate:          formatDays(record.CreatedDate),
+			LastAccessedDate:     formatDays(record.LastAccessedDate),
+			DeletedDate:          formatDays(record.DeletedDate),
+			OwningService:        record.OwningService,
+			KMSKeyID:             record.KMSKeyID,
+			RotationEnabled:      aws.ToBool(record.RotationEnabled),
+			RotationLambdaARN:    record.RotationLambdaARN,
+			RotationIntervalDays: record.RotationIntervalDays,
+			RotationSchedule:     record.RotationSchedule,
+			LastRotatedDate:      formatDays(record.LastRotatedDate),
+			NextRotationDate:     formatDays(record.NextRotationDate),
+			StaleReason:          record.StaleReason,
+			SourceRegion:         record.SourceRegion,
+			AccountID:            record.AccountID,
+			PrimaryRegion:        record.PrimaryRegion,
+			ReplicaRegions:       record.ReplicaRegions,
+			ReplicationStatus:    record.ReplicationStatus,
+			Tags:                 record.Tags,
+			Unknown:              record.Unknown,
+		})
+	}
+	return result
+}
+
+func sqliteSecret(record SecretRecord) sqlitestore.Secret {
+	return sqlitestore.Secret{
+		Region:               record.SourceRegion,
+		Name:                 record.Name,
+		Description:          record.Description,
+		CreatedDate:          formatDays(record.CreatedDate),
+		LastAccessedDate:     formatDays(record.LastAccessedDate),
+		DeletedDate:          formatDays(record.DeletedDate),
+		OwningService:        record.OwningService,
+		RotationEnabled:      record.RotationEnabled,
+		RotationLambdaARN:    record.RotationLambdaARN,
+		RotationIntervalDays: record.RotationIntervalDays,
+		RotationSchedule:     record.RotationSchedule,
+		LastRotatedDate:      formatDays(record.LastRotatedDate),
+		NextRotationDate:     formatDays(record.NextRotationDate),
+		PrimaryRegion:        record.PrimaryRegion,
+		KMSKeyID:             record.KMSKeyID,
+		Tags:                 record.Tags,
+		ReplicationStatus:    record.ReplicationStatus,
+	}
+}
+
+// secretBrowseItem is the --interactive view of a secret.
+func secretBrowseItem(record SecretRecord) browse.Item {
+	state := "Active"
+	if record.DeletedDate != nil {
+		state = "PendingDeletion"
+	}
+	item := browse.Item{
+		ID:     record.Name,
+		Region: record.SourceRegion,
+		State:  state,
+		Tags:   record.Tags,
+	}
+	add := func(label string, value *string) {
+		if value != nil && *value != "" {
+			item.Details = append(item.Details, browse.Field{Label: label, Value: *value})
+		}
+	}
+	add("Account", aws.String(record.AccountID))
+	add("Description", record.Description)
+	add("Owning Service", record.OwningService)
+	add("Created", formatDays(record.CreatedDate))
+	add("Last Accessed", formatDays(record.LastAccessedDate))
+	add("Deleted", formatDays(record.DeletedDate))
+	add("Rotation", aws.String(formatSecretRotation(record)))
+	add("Rotation Lambda", record.RotationLambdaARN)
+	add("Last Rotated", formatDays(record.LastRotatedDate))
+	add("Next Rotation", formatDays(record.NextRotationDate))
+	add("Stale", record.StaleReason)
+	add("Primary Region", record.PrimaryRegion)
+	add("Replicas", aws.String(formatReplicas(record)))
+	add("Unknown", aws.String(strings.Join(record.Unknown, ", ")))
+	return item
+}
+
+func formatSecretRotation(record SecretRecord) string {
+	if !aws.ToBool(record.RotationEnabled) {
+		return "Disabled"
+	}
+	if record.RotationIntervalDays != nil {
+		return fmt.Sprintf("Enabled (%dd)", *record.RotationIntervalDays)
+	}
+	if record.RotationSchedule != nil {
+		return fmt.Sprintf("Enabled (%s)", *record.RotationSchedule)
+	}
+	return "Enabled"
+}
+
+func formatReplicas(record SecretRecord) string {
+	if slices.Contains(record.Unknown, degrade.Replication) {
+		return degrade.Unknown
+	}
+	var replicas []string
+	for _, replicaRegion := range record.ReplicaRegions {
+		replicas = append(replicas, fmt.Sprintf("%s (%s)", replicaRegion, record.ReplicationStatus[replicaRegion]))
+	}
+	return strings.Join(replicas, ", ")
+}
+
+// formatDays renders a DATE column (days since Unix epoch) as YYYY-MM-DD
+func formatDays(days *int32) *string {
+	if days == nil {
+		return nil
+	}
+	date := time.Unix(int64(*days)*86400, 0).UTC().Format("2006-01-02")
+	return &date
+}
+
+func writeParquet(filename string, secrets []SecretRecord) (err error) {
+	fw, err := local.NewLocalFileWriter(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	// A failed flush or close leaves a truncated file behind
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close file: %w", closeErr)
+		}
+	}()
+
+	pw, err := writer.NewParquetWriter(fw, new(SecretRecord), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+
+	return writeRecords(pw, secrets)
+}
+
+// writeParquetStream writes to an arbitrary stream, e.g. an S3 upload.
+func writeParquetStream(w io.Writer, secrets []SecretRecord) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(SecretRecord), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+
+	return writeRecords(pw, secrets)
+}
+
+func writeRecords(pw *writer.ParquetWriter, secrets []SecretRecord) error {
+	pw.RowGroupSize = 128 * 1024 * 1024 // 128MB
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, record := range secrets {
+		if err := pw.Write(record); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		return fmt.Errorf("failed to finalize parquet: %w", err)
+	}
+
+	return nil
+}
+
+func registerGlueTable(ctx context.Context, client *glue.Client, database, name, uri string) error {
+	table, err := catalog.TableFromObject(database, name, uri)
+	if err != nil {
+		return err
+	}
+
+	columns, err := catalog.Columns(SecretRecord{})
+	if err != nil {
+		return err
+	}
+
+	return catalog.Register(ctx, client, table, columns)
+}
@@ -0,0 +1,270 @@
+//go:build integration
+
+// Package integration runs kms-keys and secrets-lister end to end against
+// LocalStack: it seeds keys and secrets, runs the listers, scan, and the
+// mutating commands, and checks their output in every format.
+//
+// Run it with 'make integration' or 'go test -tags integration ./integration/'.
+// It starts a throwaway LocalStack container with testcontainers-go, so it
+// needs docker; set LOCALSTACK_ENDPOINT (e.g. http://localhost:4566) to use
+// a running LocalStack instead. Checks assume an empty LocalStack, so only
+// reuse one right after a restart.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/localstack"
+)
+
+const defaultImage = "localstack/localstack:3"
+
+var (
+	// binDir holds the kms-keys and secrets-lister binaries built for the run
+	binDir   string
+	endpoint string
+
+	kmsClient     *kms.Client
+	secretsClient *secretsmanager.Client
+
+	seeded seedData
+)
+
+// seedData is what every test can rely on finding in LocalStack.
+type seedData struct {
+	// AppKey is tagged Owner=payments, has alias/itest-app and rotation, and
+	// encrypts the itest/db-password secret
+	AppKey string
+	// UntaggedKey has no tags, so --required-tags always fails
+	UntaggedKey string
+	// DoomedKey is scheduled for deletion in 7 days
+	DoomedKey string
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	// LocalStack accepts any credentials; fixed ones keep the real chain out of it
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	os.Setenv("AWS_REGION", "us-east-1")
+	os.Unsetenv("AWS_PROFILE")
+
+	dir, err := os.MkdirTemp("", "awskms-integration")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating temp dir: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	binDir = dir
+
+	for _, tool := range []string{"kms-keys", "secrets-lister"} {
+		build := exec.Command("go", "build", "-o", filepath.Join(binDir, tool), "../cmd/"+tool)
+		build.Stdout = os.Stderr
+		build.Stderr = os.Stderr
+		if err := build.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error building %s: %v\n", tool, err)
+			return 1
+		}
+	}
+
+	endpoint = os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		image := os.Getenv("LOCALSTACK_IMAGE")
+		if image == "" {
+			image = defaultImage
+		}
+		container, err := localstack.Run(ctx, image, testcontainers.WithEnv(map[string]string{
+			"SERVICES": "kms,secretsmanager,sts,ec2",
+		}))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting LocalStack: %v\n", err)
+			return 1
+		}
+		defer container.Terminate(ctx)
+
+		endpoint, err = container.PortEndpoint(ctx, "4566/tcp", "http")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding the LocalStack endpoint: %v\n", err)
+			return 1
+		}
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithBaseEndpoint(endpoint))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		return 1
+	}
+	kmsClient = kms.NewFromConfig(cfg)
+	secretsClient = secretsmanager.NewFromConfig(cfg)
+
+	seeded, err = seed(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error seeding LocalStack: %v\n", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+func seed(ctx context.Context) (seedData, error) {
+	var data seedData
+	var err error
+
+	data.AppKey, err = createKey(ctx, "integration app key", map[string]string{"Owner": "payments", "Environment": "test"})
+	if err != nil {
+		return data, err
+	}
+	if _, err := kmsClient.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String("alias/itest-app"), TargetKeyId: aws.String(data.AppKey)}); err != nil {
+		return data, fmt.Errorf("creating alias: %w", err)
+	}
+	if _, err := kmsClient.EnableKeyRotation(ctx, &kms.EnableKeyRotationInput{KeyId: aws.String(data.AppKey)}); err != nil {
+		return data, fmt.Errorf("enabling rotation: %w", err)
+	}
+
+	data.UntaggedKey, err = createKey(ctx, "integration untagged key", nil)
+	if err != nil {
+		return data, err
+	}
+
+	data.DoomedKey, err = createKey(ctx, "integration doomed key", map[string]string{"Owner": "platform"})
+	if err != nil {
+		return data, err
+	}
+	if _, err := kmsClient.ScheduleKeyDeletion(ctx, &kms.ScheduleKeyDeletionInput{KeyId: aws.String(data.DoomedKey), PendingWindowInDays: aws.Int32(7)}); err != nil {
+		return data, fmt.Errorf("scheduling deletion: %w", err)
+	}
+
+	if err := createSecret(ctx, "itest/db-password", data.AppKey, map[string]string{"Owner": "payments"}); err != nil {
+		return data, err
+	}
+	if err := createSecret(ctx, "itest/untagged", "", nil); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+func createKey(ctx context.Context, description string, tags map[string]string) (string, error) {
+	input := &kms.CreateKeyInput{Description: aws.String(description)}
+	for key, value := range tags {
+		input.Tags = append(input.Tags, kmstypes.Tag{TagKey: aws.String(key), TagValue: aws.String(value)})
+	}
+	output, err := kmsClient.CreateKey(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("creating key %q: %w", description, err)
+	}
+	return aws.ToString(output.KeyMetadata.KeyId), nil
+}
+
+func createSecret(ctx context.Context, name, keyID string, tags map[string]string) error {
+	input := &secretsmanager.CreateSecretInput{Name: aws.String(name), SecretString: aws.String("hunter2")}
+	if keyID != "" {
+		input.KmsKeyId = aws.String(keyID)
+	}
+	for key, value := range tags {
+		input.Tags = append(input.Tags, smtypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	if _, err := secretsClient.CreateSecret(ctx, input); err != nil {
+		return fmt.Errorf("creating secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// runTool runs kms-keys or secrets-lister against LocalStack and returns its
+// stdout and exit code. Flags only, since --endpoint-url is appended.
+func runTool(t *testing.T, tool string, args ...string) ([]byte, int) {
+	t.Helper()
+	cmd := exec.Command(filepath.Join(binDir, tool), append(args, "--endpoint-url", endpoint)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.Bytes(), 0
+	case errors.As(err, &exitErr):
+		if exitErr.ExitCode() == 1 {
+			t.Logf("%s %v: %s", tool, args, stderr.String())
+		}
+		return stdout.Bytes(), exitErr.ExitCode()
+	default:
+		t.Fatalf("running %s: %v", tool, err)
+		return nil, 0
+	}
+}
+
+// mustRun is runTool for runs that must exit 0.
+func mustRun(t *testing.T, tool string, args ...string) []byte {
+	t.Helper()
+	out, code := runTool(t, tool, args...)
+	if code != 0 {
+		t.Fatalf("%s %v: exit %d, want 0", tool, args, code)
+	}
+	return out
+}
+
+func expectExit(t *testing.T, want int, tool string, args ...string) {
+	t.Helper()
+	if _, code := runTool(t, tool, args...); code != want {
+		t.Errorf("%s %v: exit %d, want %d", tool, args, code, want)
+	}
+}
+
+func decodeJSON(t *testing.T, data []byte, v any) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decoding JSON output: %v\n%s", err, data)
+	}
+}
+
+// runManifest is the part of a --manifest file the tests check.
+type runManifest struct {
+	Tool      string         `json:"tool"`
+	Counts    map[string]int `json:"counts"`
+	ExitCode  int            `json:"exit_code"`
+	Artifacts []struct {
+		Path   string `json:"path"`
+		SHA256 string `json:"sha256"`
+	} `json:"artifacts"`
+}
+
+func readManifest(t *testing.T, path string) runManifest {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+	var m runManifest
+	decodeJSON(t, data, &m)
+	return m
+}
+
+func (m runManifest) hasArtifact(path string) bool {
+	for _, artifact := range m.Artifacts {
+		if artifact.Path == path && artifact.SHA256 != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,405 @@
+//go:build integration
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	_ "modernc.org/sqlite"
+)
+
+// keyReport is the part of kms-keys --format json the tests check.
+type keyReport struct {
+	EnabledKeys         []reportKey `json:"enabled_keys"`
+	PendingDeletionKeys []reportKey `json:"pending_deletion_keys"`
+	MissingRequiredTags []reportKey `json:"missing_required_tags"`
+}
+
+type reportKey struct {
+	KeyID   string            `json:"key_id"`
+	Aliases []string          `json:"aliases"`
+	Tags    map[string]string `json:"tags"`
+}
+
+func findKey(keys []reportKey, id string) *reportKey {
+	for i := range keys {
+		if keys[i].KeyID == id {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+func TestKeysJSON(t *testing.T) {
+	var report keyReport
+	decodeJSON(t, mustRun(t, "kms-keys", "--format", "json"), &report)
+
+	app := findKey(report.EnabledKeys, seeded.AppKey)
+	if app == nil {
+		t.Fatalf("enabled_keys is missing %s", seeded.AppKey)
+	}
+	if !slices.Contains(app.Aliases, "alias/itest-app") {
+		t.Errorf("aliases = %v, want alias/itest-app", app.Aliases)
+	}
+	if app.Tags["Owner"] != "payments" {
+		t.Errorf("tags = %v, want Owner=payments", app.Tags)
+	}
+	if findKey(report.PendingDeletionKeys, seeded.DoomedKey) == nil {
+		t.Errorf("pending_deletion_keys is missing %s", seeded.DoomedKey)
+	}
+}
+
+func TestKeysTable(t *testing.T) {
+	out := string(mustRun(t, "kms-keys", "--format", "table"))
+	for _, want := range []string{"=== ENABLED KEYS ===", "=== PENDING DELETION KEYS ===", seeded.UntaggedKey} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table output is missing %q", want)
+		}
+	}
+}
+
+func TestKeysHTML(t *testing.T) {
+	out := string(mustRun(t, "kms-keys", "--format", "html"))
+	if !strings.Contains(out, "<html") || !strings.Contains(out, seeded.AppKey) {
+		t.Errorf("html report is missing the document or %s", seeded.AppKey)
+	}
+}
+
+func TestKeysSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.db")
+	mustRun(t, "kms-keys", "--format", "sqlite", "--output", path)
+	// A second run appends a second scan
+	mustRun(t, "kms-keys", "--format", "sqlite", "--output", path)
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var scans int
+	if err := db.QueryRow(`SELECT count(*) FROM scans`).Scan(&scans); err != nil {
+		t.Fatal(err)
+	}
+	if scans != 2 {
+		t.Errorf("scans = %d, want 2", scans)
+	}
+	var owner string
+	err = db.QueryRow(`SELECT tag_value FROM key_tags WHERE key_id = ? AND tag_key = 'Owner' ORDER BY scan_id DESC LIMIT 1`, seeded.AppKey).Scan(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != "payments" {
+		t.Errorf("Owner tag = %q, want payments", owner)
+	}
+}
+
+func TestKeysPolicies(t *testing.T) {
+	dir := t.TempDir()
+	mustRun(t, "kms-keys", "--format", "json", "--policy-dir", dir)
+	if _, err := os.Stat(filepath.Join(dir, "us-east-1", seeded.AppKey+".json")); err != nil {
+		t.Errorf("policy file: %v", err)
+	}
+
+	table := string(mustRun(t, "kms-keys", "--format", "table", "--include-policies", "--filter-tag", "Owner=payments"))
+	if !strings.Contains(table, "=== KEY POLICIES ===") || !strings.Contains(table, `"Statement"`) {
+		t.Error("table output is missing the key policies")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(mustRun(t, "kms-keys", "--format", "csv", "--include-policies", "--filter-tag", "Owner=payments"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("csv = %v, want a header and the app key", records)
+	}
+	header, row := records[0], records[1]
+	if header[len(header)-1] != "Policy" || !strings.Contains(row[len(row)-1], `"Statement"`) {
+		t.Errorf("csv = %v, want a Policy column with the policy", records)
+	}
+
+	output := filepath.Join(dir, "keys.parquet")
+	mustRun(t, "kms-keys", "--format", "parquet", "--output", output, "--include-policies")
+	if info, err := os.Stat(output); err != nil || info.Size() == 0 {
+		t.Errorf("parquet file: %v, want a non-empty file", err)
+	}
+}
+
+func TestKeysFilters(t *testing.T) {
+	for _, args := range [][]string{
+		{"--filter-tag", "Owner=payments"},
+		{"--scope", "alias-prefix:alias/itest-"},
+		{"--scope", "tag:Owner=payments"},
+		{"--filter-alias", "alias/itest-*"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			var report keyReport
+			decodeJSON(t, mustRun(t, "kms-keys", append([]string{"--format", "json"}, args...)...), &report)
+			if len(report.EnabledKeys) != 1 || report.EnabledKeys[0].KeyID != seeded.AppKey {
+				t.Errorf("enabled_keys = %v, want only %s", report.EnabledKeys, seeded.AppKey)
+			}
+		})
+	}
+}
+
+func TestKeysComplianceExitCodes(t *testing.T) {
+	expectExit(t, 2, "kms-keys", "--format", "json", "--required-tags", "Owner")
+	expectExit(t, 2, "kms-keys", "--format", "json", "--warn-within-days", "30")
+	expectExit(t, 0, "kms-keys", "--format", "json", "--filter-tag", "Owner=payments", "--required-tags", "Owner")
+	expectExit(t, 1, "kms-keys", "--format", "yaml")
+}
+
+func TestKeysManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+	mustRun(t, "kms-keys", "--format", "json", "--manifest", path)
+	m := readManifest(t, path)
+	if m.Tool != "kms-keys" || m.ExitCode != 0 || m.Counts["pending_deletion"] < 1 {
+		t.Errorf("manifest = %+v, want kms-keys, exit 0, pending_deletion >= 1", m)
+	}
+
+	// Failed checks, and errors before anything was listed, are recorded too
+	expectExit(t, 2, "kms-keys", "--format", "json", "--required-tags", "Owner", "--manifest", path)
+	if m := readManifest(t, path); m.ExitCode != 2 || m.Counts["missing_tags"] < 1 {
+		t.Errorf("manifest = %+v, want exit 2, missing_tags >= 1", m)
+	}
+	expectExit(t, 1, "kms-keys", "--format", "yaml", "--manifest", path)
+	if m := readManifest(t, path); m.ExitCode != 1 {
+		t.Errorf("manifest = %+v, want exit 1", m)
+	}
+
+	db := filepath.Join(t.TempDir(), "inventory.db")
+	mustRun(t, "kms-keys", "--format", "sqlite", "--output", db, "--manifest", path)
+	if m := readManifest(t, path); !m.hasArtifact(db) {
+		t.Errorf("manifest = %+v, want a hash of %s", m, db)
+	}
+}
+
+func TestKeysDrift(t *testing.T) {
+	ctx := context.Background()
+	// A key of its own, so re-tagging doesn't change what other tests see
+	keyID, err := createKey(ctx, "integration drift key", map[string]string{"Owner": "drift"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap := filepath.Join(t.TempDir(), "keys.snap")
+	mustRun(t, "kms-keys", "--format", "json", "--snapshot", snap)
+	expectExit(t, 0, "kms-keys", "--format", "json", "--diff-against", snap)
+
+	if _, err := kmsClient.TagResource(ctx, &kms.TagResourceInput{
+		KeyId: aws.String(keyID),
+		Tags:  []kmstypes.Tag{{TagKey: aws.String("Owner"), TagValue: aws.String("drifted")}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectExit(t, 2, "kms-keys", "--format", "json", "--diff-against", snap)
+}
+
+func TestGrants(t *testing.T) {
+	var out struct {
+		Grants []any `json:"grants"`
+	}
+	decodeJSON(t, mustRun(t, "kms-keys", "grants", "--format", "json"), &out)
+}
+
+func TestScan(t *testing.T) {
+	var records []struct {
+		Scanner string `json:"scanner"`
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+	}
+	decodeJSON(t, mustRun(t, "kms-keys", "scan", "--format", "json"), &records)
+
+	var foundKey, foundSecret bool
+	for _, r := range records {
+		foundKey = foundKey || (r.Scanner == "kms" && r.ID == seeded.AppKey)
+		foundSecret = foundSecret || (r.Scanner == "secretsmanager" && r.Name == "itest/db-password")
+	}
+	if !foundKey || !foundSecret {
+		t.Errorf("scan found key: %v, secret: %v; want both", foundKey, foundSecret)
+	}
+
+	expectExit(t, 1, "kms-keys", "scan", "--scanners", "nope")
+}
+
+func TestScanServe(t *testing.T) {
+	const addr = "127.0.0.1:19090"
+	cmd := exec.Command(filepath.Join(binDir, "kms-keys"), "scan", "--serve", addr, "--interval", "1h", "--endpoint-url", endpoint)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	var metrics string
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if bytes.Contains(body, []byte("awskms_scans_total")) {
+			metrics = string(body)
+			break
+		}
+	}
+	if metrics == "" {
+		t.Fatal("no metrics served within 30s")
+	}
+
+	values := make(map[string]string)
+	lines := bufio.NewScanner(strings.NewReader(metrics))
+	for lines.Scan() {
+		if name, value, ok := strings.Cut(lines.Text(), " "); ok && !strings.HasPrefix(name, "#") {
+			values[name] = value
+		}
+	}
+	if values["awskms_scans_total"] != "1" {
+		t.Errorf("awskms_scans_total = %q, want 1", values["awskms_scans_total"])
+	}
+	if _, ok := values[`awskms_kms_keys_pending_deletion{region="us-east-1"}`]; !ok {
+		t.Error("awskms_kms_keys_pending_deletion is missing for us-east-1")
+	}
+}
+
+// deletionCandidate is the part of schedule-deletion --format json the tests
+// check.
+type deletionCandidate struct {
+	KeyID    string   `json:"key_id"`
+	Secrets  []string `json:"secrets"`
+	Replicas []string `json:"replicas"`
+	Blockers []string `json:"blockers"`
+	Action   string   `json:"action"`
+}
+
+func TestScheduleDeletion(t *testing.T) {
+	ctx := context.Background()
+
+	// The app key encrypts a secret, so it is blocked and left alone
+	out, code := runTool(t, "kms-keys", "schedule-deletion", "--key", "alias/itest-app", "--format", "json", "--yes")
+	if code != 2 {
+		t.Errorf("blocked key: exit %d, want 2", code)
+	}
+	var candidates []deletionCandidate
+	decodeJSON(t, out, &candidates)
+	if len(candidates) != 1 || candidates[0].Action != "blocked" || !slices.Contains(candidates[0].Secrets, "itest/db-password") {
+		t.Errorf("candidates = %+v, want the app key blocked by itest/db-password", candidates)
+	}
+	assertKeyState(t, seeded.AppKey, kmstypes.KeyStateEnabled)
+
+	keyID, err := createKey(ctx, "integration deletion key", map[string]string{"Owner": "deletion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run changes nothing. LocalStack has no CloudTrail, so the usage
+	// check always blocks and --force is needed
+	decodeJSON(t, mustRun(t, "kms-keys", "schedule-deletion", "--key", keyID, "--force", "--format", "json"), &candidates)
+	if len(candidates) != 1 || candidates[0].Action != "would_schedule" {
+		t.Errorf("dry run candidates = %+v, want would_schedule", candidates)
+	}
+	assertKeyState(t, keyID, kmstypes.KeyStateEnabled)
+
+	decodeJSON(t, mustRun(t, "kms-keys", "schedule-deletion", "--filter-tag", "Owner=deletion", "--force", "--yes", "--pending-days", "7", "--format", "json"), &candidates)
+	if len(candidates) != 1 || candidates[0].Action != "scheduled" {
+		t.Errorf("candidates = %+v, want scheduled", candidates)
+	}
+	assertKeyState(t, keyID, kmstypes.KeyStatePendingDeletion)
+
+	// Running again finds it already pending
+	decodeJSON(t, mustRun(t, "kms-keys", "schedule-deletion", "--key", keyID, "--format", "json"), &candidates)
+	if len(candidates) != 1 || candidates[0].Action != "already_pending" {
+		t.Errorf("candidates = %+v, want already_pending", candidates)
+	}
+}
+
+func TestScheduleDeletionReplicas(t *testing.T) {
+	ctx := context.Background()
+	output, err := kmsClient.CreateKey(ctx, &kms.CreateKeyInput{Description: aws.String("integration multi-Region key"), MultiRegion: aws.Bool(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := aws.ToString(output.KeyMetadata.KeyId)
+	if _, err := kmsClient.ReplicateKey(ctx, &kms.ReplicateKeyInput{KeyId: aws.String(keyID), ReplicaRegion: aws.String("eu-west-1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Its replica blocks the primary even with --yes
+	out, code := runTool(t, "kms-keys", "schedule-deletion", "--key", keyID, "--format", "json", "--yes")
+	if code != 2 {
+		t.Errorf("replicated key: exit %d, want 2", code)
+	}
+	var candidates []deletionCandidate
+	decodeJSON(t, out, &candidates)
+	if len(candidates) != 1 || candidates[0].Action != "blocked" || !slices.Contains(candidates[0].Replicas, "eu-west-1") {
+		t.Errorf("candidates = %+v, want the key blocked by its eu-west-1 replica", candidates)
+	}
+	assertKeyState(t, keyID, kmstypes.KeyStateEnabled)
+}
+
+func TestPolicyBlocks(t *testing.T) {
+	ctx := context.Background()
+	keyID, err := createKey(ctx, "integration policy key", map[string]string{"Owner": "policy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const breakGlass = "arn:aws:iam::000000000000:role/break-glass"
+
+	// Without --yes the policy is only printed
+	mustRun(t, "kms-keys", "protect", "--key", keyID, "--break-glass-role", breakGlass)
+	if strings.Contains(keyPolicy(t, keyID), "DenyDeletionExceptBreakGlass") {
+		t.Error("protect changed the policy without --yes")
+	}
+
+	mustRun(t, "kms-keys", "protect", "--key", keyID, "--break-glass-role", breakGlass, "--yes")
+	if policy := keyPolicy(t, keyID); !strings.Contains(policy, "DenyDeletionExceptBreakGlass") || !strings.Contains(policy, breakGlass) {
+		t.Errorf("policy after protect = %s, want the deletion guard", policy)
+	}
+
+	mustRun(t, "kms-keys", "policy", "put", "--key", keyID, "--usage-role", "arn:aws:iam::000000000000:role/app", "--yes")
+	if policy := keyPolicy(t, keyID); !strings.Contains(policy, "arn:aws:iam::000000000000:root") || strings.Contains(policy, "DenyDeletionExceptBreakGlass") {
+		t.Errorf("policy after put = %s, want only the composed blocks", policy)
+	}
+
+	mustRun(t, "kms-keys", "create-key", "--description", "integration dry run")
+}
+
+func keyPolicy(t *testing.T, keyID string) string {
+	t.Helper()
+	output, err := kmsClient.GetKeyPolicy(context.Background(), &kms.GetKeyPolicyInput{KeyId: aws.String(keyID), PolicyName: aws.String("default")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aws.ToString(output.Policy)
+}
+
+func assertKeyState(t *testing.T, keyID string, want kmstypes.KeyState) {
+	t.Helper()
+	output, err := kmsClient.DescribeKey(context.Background(), &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.KeyMetadata.KeyState != want {
+		t.Errorf("key %s is %s, want %s", keyID, output.KeyMetadata.KeyState, want)
+	}
+}
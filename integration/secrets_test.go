@@ -0,0 +1,169 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretRecord is the part of secrets-lister --format json the tests check.
+type secretRecord struct {
+	Name string            `json:"name"`
+	Tags map[string]string `json:"tags"`
+}
+
+func findSecret(secrets []secretRecord, name string) *secretRecord {
+	for i := range secrets {
+		if secrets[i].Name == name {
+			return &secrets[i]
+		}
+	}
+	return nil
+}
+
+func TestSecretsJSON(t *testing.T) {
+	var secrets []secretRecord
+	decodeJSON(t, mustRun(t, "secrets-lister", "--format", "json"), &secrets)
+
+	secret := findSecret(secrets, "itest/db-password")
+	if secret == nil {
+		t.Fatal("itest/db-password is missing")
+	}
+	if secret.Tags["Owner"] != "payments" {
+		t.Errorf("tags = %v, want Owner=payments", secret.Tags)
+	}
+}
+
+func TestSecretsTable(t *testing.T) {
+	out := string(mustRun(t, "secrets-lister", "--format", "table"))
+	if !strings.Contains(out, "itest/untagged") {
+		t.Error("table output is missing itest/untagged")
+	}
+}
+
+func TestSecretsHTML(t *testing.T) {
+	out := string(mustRun(t, "secrets-lister", "--format", "html"))
+	if !strings.Contains(out, "<html") || !strings.Contains(out, "itest/db-password") {
+		t.Error("html report is missing the document or itest/db-password")
+	}
+}
+
+func TestSecretsParquet(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "secrets.parquet")
+	manifestPath := filepath.Join(dir, "run.json")
+	mustRun(t, "secrets-lister", "--output", output, "--manifest", manifestPath)
+
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Error("parquet file is empty")
+	}
+	m := readManifest(t, manifestPath)
+	if m.Tool != "secrets-lister" || !m.hasArtifact(output) {
+		t.Errorf("manifest = %+v, want secrets-lister with a hash of %s", m, output)
+	}
+
+	// Runs that fail writing their output, or before listing anything, are
+	// recorded too
+	expectExit(t, 1, "secrets-lister", "--output", filepath.Join(dir, "missing", "secrets.parquet"), "--manifest", manifestPath)
+	if m := readManifest(t, manifestPath); m.ExitCode != 1 || m.Counts["secrets"] < 2 {
+		t.Errorf("manifest = %+v, want exit 1, secrets >= 2", m)
+	}
+	expectExit(t, 1, "secrets-lister", "--format", "yaml", "--manifest", manifestPath)
+	if m := readManifest(t, manifestPath); m.ExitCode != 1 {
+		t.Errorf("manifest = %+v, want exit 1", m)
+	}
+}
+
+func TestSecretsSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.db")
+	mustRun(t, "secrets-lister", "--format", "sqlite", "--output", path)
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM secrets WHERE name LIKE 'itest/%'`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count < 2 {
+		t.Errorf("secrets = %d, want at least 2", count)
+	}
+	var keyID string
+	if err := db.QueryRow(`SELECT kms_key_id FROM secrets WHERE name = 'itest/db-password'`).Scan(&keyID); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(keyID, seeded.AppKey) {
+		t.Errorf("kms_key_id = %q, want %s", keyID, seeded.AppKey)
+	}
+}
+
+func TestSecretsFiltersAndCompliance(t *testing.T) {
+	expectExit(t, 2, "secrets-lister", "--format", "json", "--required-tags", "Owner")
+
+	var secrets []secretRecord
+	decodeJSON(t, mustRun(t, "secrets-lister", "--format", "json", "--filter-name", "itest/db"), &secrets)
+	if len(secrets) != 1 || secrets[0].Name != "itest/db-password" {
+		t.Errorf("--filter-name itest/db = %v, want only itest/db-password", secrets)
+	}
+
+	decodeJSON(t, mustRun(t, "secrets-lister", "--format", "json", "--filter-tag", "Owner=payments"), &secrets)
+	if len(secrets) != 1 || secrets[0].Name != "itest/db-password" {
+		t.Errorf("--filter-tag Owner=payments = %v, want only itest/db-password", secrets)
+	}
+}
+
+func TestSecretsDrift(t *testing.T) {
+	snap := filepath.Join(t.TempDir(), "secrets.snap")
+	mustRun(t, "secrets-lister", "--format", "json", "--snapshot", snap)
+	expectExit(t, 0, "secrets-lister", "--format", "json", "--diff-against", snap)
+
+	if err := createSecret(context.Background(), "itest/new", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	expectExit(t, 2, "secrets-lister", "--format", "json", "--diff-against", snap)
+
+	// The snapshot alone rebuilds the listing, without calling AWS
+	var secrets []secretRecord
+	decodeJSON(t, mustRun(t, "secrets-lister", "--format", "json", "--offline", snap), &secrets)
+	if findSecret(secrets, "itest/db-password") == nil || findSecret(secrets, "itest/new") != nil {
+		t.Errorf("--offline = %v, want the snapshot's secrets", secrets)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	archive := filepath.Join(t.TempDir(), "secrets.bak")
+	mustRun(t, "secrets-lister", "backup", "--kms-key", "alias/itest-app", "--output", archive, "--filter-name", "itest/db-password")
+
+	// Change the value, then put the backed up one back
+	if _, err := secretsClient.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String("itest/db-password"),
+		SecretString: aws.String("changed"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mustRun(t, "secrets-lister", "restore", "--input", archive, "--overwrite", "--yes")
+
+	output, err := secretsClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String("itest/db-password")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(output.SecretString); got != "hunter2" {
+		t.Errorf("restored value = %q, want hunter2", got)
+	}
+}
@@ -0,0 +1,156 @@
+// Package accessdenied explains AccessDenied errors returned by AWS APIs: which
+// principal, action, and resource were involved, and which policy layer denied
+// the call.
+package accessdenied
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+type Layer string
+
+const (
+	LayerIdentity    Layer = "identity-based policy"
+	LayerKeyPolicy   Layer = "key policy"
+	LayerSCP         Layer = "service control policy"
+	LayerRCP         Layer = "resource control policy"
+	LayerBoundary    Layer = "permissions boundary"
+	LayerSession     Layer = "session policy"
+	LayerVPCEndpoint Layer = "VPC endpoint policy"
+	LayerUnknown     Layer = "unknown"
+)
+
+// Explanation is what could be recovered from an AccessDenied error message.
+type Explanation struct {
+	Principal    string `json:"principal,omitempty"`
+	Action       string `json:"action,omitempty"`
+	Resource     string `json:"resource,omitempty"`
+	Layer        Layer  `json:"layer"`
+	ExplicitDeny bool   `json:"explicit_deny"`
+	Encoded      string `json:"encoded_message,omitempty"`
+}
+
+var (
+	notAuthorizedPattern = regexp.MustCompile(`User: (\S+) is not authorized to perform: (\S+)(?: on resource: (\S+))?`)
+	explicitDenyPattern  = regexp.MustCompile(`with an explicit deny in an? ([a-zA-Z -]+?)(?:\s*:|\.|$)`)
+	noAllowPattern       = regexp.MustCompile(`because no ([a-zA-Z -]+?) allows`)
+	encodedPattern       = regexp.MustCompile(`Encoded authorization failure message: (\S+)`)
+)
+
+// layerNames maps the policy type wording AWS uses in error messages to a layer.
+// KMS key policies are reported as resource-based policies.
+var layerNames = map[string]Layer{
+	"identity-based policy":   LayerIdentity,
+	"resource-based policy":   LayerKeyPolicy,
+	"service control policy":  LayerSCP,
+	"resource control policy": LayerRCP,
+	"permissions boundary":    LayerBoundary,
+	"session policy":          LayerSession,
+	"VPC endpoint policy":     LayerVPCEndpoint,
+}
+
+// Parse extracts the principal, action, resource, and denying layer from an
+// AccessDenied error message. Fields that cannot be recovered are left empty.
+func Parse(message string) Explanation {
+	e := Explanation{Layer: LayerUnknown}
+
+	if m := notAuthorizedPattern.FindStringSubmatch(message); m != nil {
+		e.Principal = m[1]
+		e.Action = m[2]
+		e.Resource = strings.TrimRight(m[3], ".,")
+	}
+
+	if m := explicitDenyPattern.FindStringSubmatch(message); m != nil {
+		e.ExplicitDeny = true
+		e.Layer = layerFor(m[1])
+	} else if m := noAllowPattern.FindStringSubmatch(message); m != nil {
+		e.Layer = layerFor(m[1])
+	}
+
+	if m := encodedPattern.FindStringSubmatch(message); m != nil {
+		e.Encoded = m[1]
+	}
+
+	return e
+}
+
+func layerFor(name string) Layer {
+	if layer, ok := layerNames[strings.TrimSpace(name)]; ok {
+		return layer
+	}
+	return LayerUnknown
+}
+
+// Advice returns a short suggestion for where to look next.
+func (e Explanation) Advice() string {
+	switch e.Layer {
+	case LayerKeyPolicy:
+		if e.ExplicitDeny {
+			return "A Deny statement in the key policy matches this request; check its conditions (e.g. aws:PrincipalArn, kms:ViaService)."
+		}
+		return "No key policy statement allows this principal. Add it to the key policy, or allow the account root so IAM policies can grant access."
+	case LayerIdentity:
+		if e.ExplicitDeny {
+			return "A Deny statement in one of the principal's IAM policies matches this request."
+		}
+		return "The key policy delegates to IAM, but none of the principal's IAM policies allow this action on the key."
+	case LayerSCP:
+		return "An AWS Organizations service control policy blocks this action for the account; contact the organization administrators."
+	case LayerRCP:
+		return "An AWS Organizations resource control policy blocks access to the key."
+	case LayerBoundary:
+		return "The principal's permissions boundary does not allow this action."
+	case LayerSession:
+		return "The session policy passed when assuming the role does not allow this action."
+	case LayerVPCEndpoint:
+		return "The request went through a VPC endpoint whose policy does not allow this action."
+	}
+	if e.Encoded != "" {
+		return "Decode the authorization message to see the matched statements."
+	}
+	return "The message does not say which policy layer denied the request; check the key policy first, then the principal's IAM policies."
+}
+
+// Decoded is the document returned by sts:DecodeAuthorizationMessage.
+type Decoded struct {
+	Allowed           bool `json:"allowed"`
+	ExplicitDeny      bool `json:"explicitDeny"`
+	MatchedStatements struct {
+		Items []DecodedStatement `json:"items"`
+	} `json:"matchedStatements"`
+	Failures struct {
+		Items []json.RawMessage `json:"items"`
+	} `json:"failures"`
+	Context struct {
+		Principal struct {
+			ID  string `json:"id"`
+			ARN string `json:"arn"`
+		} `json:"principal"`
+		Action     string `json:"action"`
+		Resource   string `json:"resource"`
+		Conditions struct {
+			Items []struct {
+				Key    string `json:"key"`
+				Values struct {
+					Items []struct {
+						Value string `json:"value"`
+					} `json:"items"`
+				} `json:"values"`
+			} `json:"items"`
+		} `json:"conditions"`
+	} `json:"context"`
+}
+
+type DecodedStatement struct {
+	StatementID string `json:"statementId"`
+	Effect      string `json:"effect"`
+	Source      string `json:"source,omitempty"`
+}
+
+func ParseDecoded(message string) (Decoded, error) {
+	var d Decoded
+	err := json.Unmarshal([]byte(message), &d)
+	return d, err
+}
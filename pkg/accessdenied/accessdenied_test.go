@@ -0,0 +1,32 @@
+package accessdenied
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzParse feeds arbitrary error messages to Parse, which sees whatever an
+// AWS API or proxy returns.
+func FuzzParse(f *testing.F) {
+	for _, message := range []string{
+		"User: arn:aws:sts::111122223333:assumed-role/app/session is not authorized to perform: kms:Decrypt on resource: arn:aws:kms:us-east-1:111122223333:key/1234abcd because no resource-based policy allows the kms:Decrypt action",
+		"User: arn:aws:iam::111122223333:user/ci is not authorized to perform: kms:ListKeys with an explicit deny in a service control policy",
+		"You are not authorized to perform this operation. Encoded authorization failure message: abc123-_",
+		"User:  is not authorized to perform: ",
+		"",
+	} {
+		f.Add(message)
+	}
+	f.Fuzz(func(t *testing.T, message string) {
+		e := Parse(message)
+		for _, field := range []string{e.Principal, e.Action, e.Resource, e.Encoded} {
+			if !strings.Contains(message, field) {
+				t.Fatalf("Parse(%q) returned %q, which is not in the message", message, field)
+			}
+		}
+		if e.Layer == "" {
+			t.Fatalf("Parse(%q) left the layer empty", message)
+		}
+		ParseDecoded(message)
+	})
+}
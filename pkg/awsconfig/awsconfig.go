@@ -0,0 +1,108 @@
+// Package awsconfig loads the AWS config every command starts from, so both
+// tools take the same connection flags and build their clients the same way.
+package awsconfig
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"secrets-lister/pkg/httpclient"
+	"secrets-lister/pkg/logging"
+	"secrets-lister/pkg/throttle"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// SessionName identifies sessions started by --role-arn in CloudTrail.
+const SessionName = "awskms-inventory"
+
+type Options struct {
+	Profile string
+	Region  string
+	// EndpointURL overrides the endpoint of every service, e.g. LocalStack's
+	// http://localhost:4566
+	EndpointURL string
+	// RoleARN is assumed with the profile's credentials before any other call
+	RoleARN string
+
+	HTTP  httpclient.Options
+	Retry throttle.Options
+	Log   logging.Options
+}
+
+func Defaults() Options {
+	return Options{
+		HTTP:  httpclient.Defaults(),
+		Retry: throttle.Defaults(),
+		Log:   logging.Defaults(),
+	}
+}
+
+// RegisterFlags adds the connection flags, the HTTP and retry tuning flags,
+// and the logging flags, to fs with o's values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Profile, "profile", o.Profile, "AWS SSO profile name")
+	fs.StringVar(&o.Region, "region", o.Region, "AWS region")
+	fs.StringVar(&o.EndpointURL, "endpoint-url", o.EndpointURL, "Send every AWS API call to this endpoint (e.g. http://localhost:4566 for LocalStack)")
+	fs.StringVar(&o.RoleARN, "role-arn", o.RoleARN, "Assume this IAM role before making any other call")
+	o.HTTP.RegisterFlags(fs)
+	o.Retry.RegisterFlags(fs)
+	o.Log.RegisterFlags(fs)
+}
+
+// Load builds the config from the default chain plus o. With RoleARN set the
+// returned config carries the assumed role's credentials, refreshed as they
+// expire. Every config Load returns shares the process's HTTP client and
+// --rps limiter. Load also makes the --log-level logger the slog default, and
+// with logging on every client built from the config logs its API calls.
+func (o Options) Load(ctx context.Context) (aws.Config, error) {
+	logger, err := o.Log.Logger(os.Stderr)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	slog.SetDefault(logger)
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithHTTPClient(throttle.Limit(httpclient.Shared(o.HTTP), o.Retry.Shared())),
+		config.WithRetryer(o.Retry.Retryer()),
+	}
+	if o.Log.Enabled() {
+		opts = append(opts, config.WithAPIOptions([]func(*middleware.Stack) error{logging.Middleware(logger)}))
+	}
+
+	if o.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(o.Profile))
+	}
+
+	if o.Region != "" {
+		opts = append(opts, config.WithRegion(o.Region))
+	}
+
+	if o.EndpointURL != "" {
+		opts = append(opts, config.WithBaseEndpoint(o.EndpointURL))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, err
+	}
+
+	if o.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), o.RoleARN, func(ao *stscreds.AssumeRoleOptions) {
+			ao.RoleSessionName = SessionName
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+		if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+			return cfg, fmt.Errorf("assuming role %s: %w", o.RoleARN, err)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,85 @@
+// Package awserr classifies AWS API errors by their error code and type rather
+// than by matching message text, which varies by service and can contain
+// resource names.
+package awserr
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+)
+
+type Class string
+
+const (
+	NotAuthorized Class = "not_authorized"
+	NotFound      Class = "not_found"
+	Throttled     Class = "throttled"
+	// Transient covers failures that may succeed on a later run: 5xx
+	// responses, connection errors, and timeouts
+	Transient Class = "transient"
+	Other     Class = "other"
+)
+
+var notAuthorizedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"UnauthorizedOperation": true,
+	"UnauthorizedException": true,
+}
+
+var notFoundCodes = map[string]bool{
+	"NotFoundException":         true,
+	"ResourceNotFoundException": true,
+	"NoSuchEntity":              true,
+	"NoSuchKey":                 true,
+	"NoSuchBucket":              true,
+}
+
+// Classify reports what kind of failure err is; nil is Other.
+func Classify(err error) Class {
+	if err == nil {
+		return Other
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		switch {
+		case notAuthorizedCodes[code] || strings.Contains(code, "NotAuthorized"):
+			return NotAuthorized
+		case notFoundCodes[code]:
+			return NotFound
+		}
+	}
+
+	// The SDK's own retry tables know every service's throttling codes and
+	// which status codes and network errors are worth retrying
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return Throttled
+	}
+	if retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return Transient
+	}
+	return Other
+}
+
+func IsNotAuthorized(err error) bool {
+	return Classify(err) == NotAuthorized
+}
+
+// Describe is a short reason for reports: the class and, for API errors, the
+// error code.
+func Describe(err error) string {
+	class := Classify(err)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return string(class) + " (" + apiErr.ErrorCode() + ")"
+	}
+	return string(class)
+}
@@ -0,0 +1,328 @@
+// Package backup writes secret values to an envelope-encrypted archive for
+// disaster recovery, and restores them. The values are encrypted with a fresh
+// AES-256 data key from KMS GenerateDataKey; only the KMS-encrypted copy of
+// that key is stored, so opening an archive needs kms:Decrypt on the key and
+// leaves a CloudTrail event. The list of secrets in the archive stays in
+// plain text, so an archive can be audited without decrypting it.
+package backup
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"secrets-lister/pkg/awserr"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// FormatVersion is bumped when the archive layout changes.
+const FormatVersion = 1
+
+// purpose is the encryption context every archive's data key is bound to, so
+// a data key encrypted for something else can't be passed off as a backup.
+const purpose = "secrets-lister-backup"
+
+// ValueAPI reads secret values. *secretsmanager.Client satisfies it.
+type ValueAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// RestoreAPI writes secrets back. *secretsmanager.Client satisfies it.
+type RestoreAPI interface {
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+// KeyAPI seals and opens archives. *kms.Client satisfies it.
+type KeyAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// Secret is one backed up secret, as stored encrypted in the archive.
+type Secret struct {
+	Name         string            `json:"name"`
+	ARN          string            `json:"arn"`
+	Description  string            `json:"description,omitempty"`
+	KMSKeyID     string            `json:"kms_key_id,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	VersionID    string            `json:"version_id"`
+	SecretString *string           `json:"secret_string,omitempty"`
+	SecretBinary []byte            `json:"secret_binary,omitempty"`
+}
+
+// Entry is the plain text record of a secret in the archive.
+type Entry struct {
+	Name      string `json:"name"`
+	ARN       string `json:"arn"`
+	VersionID string `json:"version_id"`
+}
+
+type Archive struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Account   string    `json:"account,omitempty"`
+	Region    string    `json:"region"`
+	// KeyID is the ARN of the KMS key the data key is encrypted under
+	KeyID             string            `json:"kms_key_id"`
+	EncryptionContext map[string]string `json:"encryption_context"`
+	EncryptedDataKey  []byte            `json:"encrypted_data_key"`
+	Secrets           []Entry           `json:"secrets"`
+	Nonce             []byte            `json:"nonce"`
+	Ciphertext        []byte            `json:"ciphertext"`
+}
+
+// Failure is a secret whose value could not be read.
+type Failure struct {
+	Name  string
+	Class awserr.Class
+	Err   error
+}
+
+// Fetch reads the current value of each secret. Secrets that fail are
+// returned as failures rather than failing the backup, so one denied secret
+// doesn't lose the rest; the caller decides whether a partial backup is
+// acceptable.
+func Fetch(ctx context.Context, client ValueAPI, entries []types.SecretListEntry) ([]Secret, []Failure) {
+	var secrets []Secret
+	var failures []Failure
+	for _, entry := range entries {
+		name := aws.ToString(entry.Name)
+		output, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: entry.ARN})
+		if err != nil {
+			failures = append(failures, Failure{Name: name, Class: awserr.Classify(err), Err: err})
+			continue
+		}
+		secret := Secret{
+			Name:         name,
+			ARN:          aws.ToString(entry.ARN),
+			Description:  aws.ToString(entry.Description),
+			KMSKeyID:     aws.ToString(entry.KmsKeyId),
+			VersionID:    aws.ToString(output.VersionId),
+			SecretString: output.SecretString,
+			SecretBinary: output.SecretBinary,
+		}
+		for _, tag := range entry.Tags {
+			if secret.Tags == nil {
+				secret.Tags = make(map[string]string)
+			}
+			secret.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, failures
+}
+
+// Seal encrypts secrets under a new data key from keyID. The plain text
+// header is authenticated along with the values, so the secret list can't be
+// edited without the archive failing to open.
+func Seal(ctx context.Context, client KeyAPI, keyID, account, region string, secrets []Secret) (*Archive, error) {
+	archive := &Archive{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Account:   account,
+		Region:    region,
+	}
+	archive.EncryptionContext = map[string]string{
+		"purpose":    purpose,
+		"created_at": archive.CreatedAt.Format(time.RFC3339),
+	}
+	for _, secret := range secrets {
+		archive.Secrets = append(archive.Secrets, Entry{Name: secret.Name, ARN: secret.ARN, VersionID: secret.VersionID})
+	}
+
+	dataKey, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(keyID),
+		KeySpec:           kmstypes.DataKeySpecAes256,
+		EncryptionContext: archive.EncryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generating data key: %w", err)
+	}
+	defer clear(dataKey.Plaintext)
+	archive.KeyID = aws.ToString(dataKey.KeyId)
+	archive.EncryptedDataKey = dataKey.CiphertextBlob
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(plaintext)
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	archive.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(archive.Nonce); err != nil {
+		return nil, err
+	}
+	aad, err := archive.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	archive.Ciphertext = gcm.Seal(nil, archive.Nonce, plaintext, aad)
+	return archive, nil
+}
+
+// Open decrypts the data key with KMS and returns the secrets. client must be
+// in the region of archive.KeyID.
+func Open(ctx context.Context, client KeyAPI, archive *Archive) ([]Secret, error) {
+	if archive.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+	dataKey, err := client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(archive.KeyID),
+		CiphertextBlob:    archive.EncryptedDataKey,
+		EncryptionContext: archive.EncryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypting data key: %w", err)
+	}
+	defer clear(dataKey.Plaintext)
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	aad, err := archive.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, archive.Nonce, archive.Ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("archive failed authentication; it is corrupt or has been modified")
+	}
+	defer clear(plaintext)
+
+	var secrets []Secret
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("parsing archive contents: %w", err)
+	}
+	return secrets, nil
+}
+
+// KeyRegion is the region of the archive's KMS key, which Open must call.
+func (a *Archive) KeyRegion() (string, error) {
+	parsed, err := arn.Parse(a.KeyID)
+	if err != nil {
+		return "", fmt.Errorf("archive key %q is not an ARN: %w", a.KeyID, err)
+	}
+	return parsed.Region, nil
+}
+
+// additionalData is everything in the header except the encrypted parts.
+func (a *Archive) additionalData() ([]byte, error) {
+	return json.Marshal(struct {
+		Version           int
+		CreatedAt         time.Time
+		Account           string
+		Region            string
+		KeyID             string
+		EncryptionContext map[string]string
+		Secrets           []Entry
+	}{a.Version, a.CreatedAt, a.Account, a.Region, a.KeyID, a.EncryptionContext, a.Secrets})
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Write saves the archive readable by the owner only.
+func Write(path string, archive *Archive) error {
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func Read(path string) (*Archive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var archive Archive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &archive, nil
+}
+
+// Outcomes of Restore. Skipped means the secret already exists.
+const (
+	Created = "created"
+	Updated = "updated"
+	Skipped = "skipped"
+)
+
+type RestoreOptions struct {
+	// Overwrite puts the backed up value as a new version of a secret that
+	// already exists, instead of skipping it
+	Overwrite bool
+	// KMSKeyID encrypts created secrets; empty keeps the original key when
+	// restoring to the region the backup came from, and uses the account's
+	// default Secrets Manager key anywhere else
+	KMSKeyID string
+	// SameRegion is true when restoring to the region the backup came from
+	SameRegion bool
+}
+
+// Restore creates secret, or with Overwrite updates its value if it exists.
+// Tags and description are only set on created secrets.
+func Restore(ctx context.Context, client RestoreAPI, secret Secret, opts RestoreOptions) (string, error) {
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(secret.Name),
+		SecretString: secret.SecretString,
+		SecretBinary: secret.SecretBinary,
+	}
+	if secret.Description != "" {
+		input.Description = aws.String(secret.Description)
+	}
+	switch {
+	case opts.KMSKeyID != "":
+		input.KmsKeyId = aws.String(opts.KMSKeyID)
+	case opts.SameRegion && secret.KMSKeyID != "":
+		input.KmsKeyId = aws.String(secret.KMSKeyID)
+	}
+	for key, value := range secret.Tags {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	_, err := client.CreateSecret(ctx, input)
+	var exists *types.ResourceExistsException
+	if err == nil {
+		return Created, nil
+	} else if !errors.As(err, &exists) {
+		return "", err
+	}
+	if !opts.Overwrite {
+		return Skipped, nil
+	}
+
+	_, err = client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secret.Name),
+		SecretString: secret.SecretString,
+		SecretBinary: secret.SecretBinary,
+	})
+	if err != nil {
+		return "", err
+	}
+	return Updated, nil
+}
@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+const testKeyARN = "arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+// fakeKeys stands in for KMS: the "encrypted" data key is the plaintext
+// behind a prefix, and Decrypt insists on the context it was generated with.
+type fakeKeys struct {
+	contexts map[string]map[string]string
+}
+
+var wrapPrefix = []byte("wrapped:")
+
+func (f *fakeKeys) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, err
+	}
+	blob := append(bytes.Clone(wrapPrefix), plaintext...)
+	if f.contexts == nil {
+		f.contexts = make(map[string]map[string]string)
+	}
+	f.contexts[string(blob)] = maps.Clone(params.EncryptionContext)
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          aws.String(testKeyARN),
+		Plaintext:      bytes.Clone(plaintext),
+		CiphertextBlob: blob,
+	}, nil
+}
+
+func (f *fakeKeys) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	want, ok := f.contexts[string(params.CiphertextBlob)]
+	if !ok || !maps.Equal(want, params.EncryptionContext) {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+	return &kms.DecryptOutput{Plaintext: bytes.Clone(params.CiphertextBlob[len(wrapPrefix):])}, nil
+}
+
+func sealed(t *testing.T, keys *fakeKeys, secrets []Secret) *Archive {
+	t.Helper()
+	archive, err := Seal(context.Background(), keys, "alias/backup", "111122223333", "eu-west-1", secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestSealOpen(t *testing.T) {
+	secrets := []Secret{
+		{Name: "app/db", ARN: "arn:aws:secretsmanager:eu-west-1:111122223333:secret:app/db", VersionID: "v1", SecretString: aws.String("hunter2"), Tags: map[string]string{"Owner": "payments"}},
+		{Name: "app/cert", ARN: "arn:aws:secretsmanager:eu-west-1:111122223333:secret:app/cert", VersionID: "v2", SecretBinary: []byte{0, 1, 2}},
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(*Archive)
+		wantErr string
+	}{
+		{name: "round trip"},
+		{name: "renamed secret in the header", tamper: func(a *Archive) { a.Secrets[0].Name = "app/other" }, wantErr: "failed authentication"},
+		{name: "changed account in the header", tamper: func(a *Archive) { a.Account = "444455556666" }, wantErr: "failed authentication"},
+		{name: "changed ciphertext", tamper: func(a *Archive) { a.Ciphertext[0] ^= 0xff }, wantErr: "failed authentication"},
+		{name: "changed encryption context", tamper: func(a *Archive) { a.EncryptionContext["purpose"] = "other" }, wantErr: "decrypting data key"},
+		{name: "unsupported version", tamper: func(a *Archive) { a.Version = FormatVersion + 1 }, wantErr: "unsupported archive version"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keys := &fakeKeys{}
+			archive := sealed(t, keys, secrets)
+			if archive.KeyID != testKeyARN || archive.EncryptionContext["purpose"] != purpose {
+				t.Fatalf("archive key = %s, context = %v, want %s bound to %s", archive.KeyID, archive.EncryptionContext, testKeyARN, purpose)
+			}
+			if tc.tamper != nil {
+				tc.tamper(archive)
+			}
+
+			got, err := Open(context.Background(), keys, archive)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, secrets) {
+				t.Errorf("secrets = %+v, want %+v", got, secrets)
+			}
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	keys := &fakeKeys{}
+	archive := sealed(t, keys, []Secret{{Name: "app/db", VersionID: "v1", SecretString: aws.String("hunter2")}})
+	path := t.TempDir() + "/secrets.bak"
+	if err := Write(path, archive); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(context.Background(), keys, read); err != nil {
+		t.Errorf("opening the archive read back: %v", err)
+	}
+	if region, err := read.KeyRegion(); err != nil || region != "eu-west-1" {
+		t.Errorf("key region = %q, %v, want eu-west-1", region, err)
+	}
+}
+
+// fakeSecrets stands in for Secrets Manager: CreateSecret fails for names
+// that already exist, like the real one.
+type fakeSecrets struct {
+	existing map[string]bool
+	created  []*secretsmanager.CreateSecretInput
+	updated  []string
+}
+
+func (f *fakeSecrets) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	if f.existing[aws.ToString(params.Name)] {
+		return nil, &types.ResourceExistsException{Message: aws.String("exists")}
+	}
+	f.created = append(f.created, params)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func (f *fakeSecrets) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	f.updated = append(f.updated, aws.ToString(params.SecretId))
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func TestRestore(t *testing.T) {
+	secret := Secret{Name: "app/db", KMSKeyID: "alias/original", VersionID: "v1", SecretString: aws.String("hunter2"), Tags: map[string]string{"Owner": "payments"}}
+
+	tests := []struct {
+		name        string
+		existing    bool
+		opts        RestoreOptions
+		want        string
+		wantKey     string
+		wantUpdated bool
+	}{
+		{name: "created in another region", want: Created},
+		{name: "created in the same region keeps the key", opts: RestoreOptions{SameRegion: true}, want: Created, wantKey: "alias/original"},
+		{name: "created under --kms-key", opts: RestoreOptions{KMSKeyID: "alias/restore", SameRegion: true}, want: Created, wantKey: "alias/restore"},
+		{name: "existing is skipped", existing: true, want: Skipped},
+		{name: "existing is overwritten", existing: true, opts: RestoreOptions{Overwrite: true}, want: Updated, wantUpdated: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeSecrets{existing: map[string]bool{secret.Name: tc.existing}}
+			got, err := Restore(context.Background(), client, secret, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("outcome = %s, want %s", got, tc.want)
+			}
+			if tc.want == Created {
+				if len(client.created) != 1 || aws.ToString(client.created[0].KmsKeyId) != tc.wantKey || len(client.created[0].Tags) != 1 {
+					t.Errorf("created = %+v, want one secret with key %q and its tag", client.created, tc.wantKey)
+				}
+			}
+			if updated := len(client.updated) > 0; updated != tc.wantUpdated {
+				t.Errorf("updated = %v, want %v", client.updated, tc.wantUpdated)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package bench
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"secrets-lister/pkg/kmsinv"
+	"secrets-lister/pkg/secretsinv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Set after -args, e.g. go test -bench . ./pkg/bench/ -args -keys 1000
+var (
+	keyCount    = flag.Int("keys", 10000, "Number of KMS keys in the fake account")
+	secretCount = flag.Int("secrets", 50000, "Number of secrets in the fake account")
+	// latency is added to every fake API call, to see how a change behaves
+	// when calls are network bound rather than CPU bound
+	latency = flag.Duration("latency", 0, "Add this latency to every fake API call (e.g. 5ms)")
+)
+
+// The fixtures are built once, after flags are parsed, and shared by every
+// benchmark. Each iteration starts from a fresh cache, so caching inside the
+// pipeline is measured but nothing carries over between iterations.
+var (
+	fixtures      sync.Once
+	keys          *kmsinv.Fake
+	secrets       *secretsinv.Fake
+	kmsClient     kmsinv.API
+	secretsClient secretsinv.API
+)
+
+func loadFixtures() {
+	fixtures.Do(func() {
+		keys = kmsFixture(*keyCount)
+		secrets = secretsFixture(*secretCount)
+		kmsClient, secretsClient = keys, secrets
+		if *latency > 0 {
+			kmsClient = slowKMS{keys, *latency}
+			secretsClient = slowSecrets{secrets, *latency}
+		}
+	})
+}
+
+// benchKMS and benchSecrets name the one sub-benchmark after the fixture
+// size, so runs at different sizes don't line up in benchstat or Compare.
+func benchKMS(b *testing.B, fn func(ctx context.Context, client kmsinv.API)) {
+	loadFixtures()
+	b.Run(fmt.Sprintf("keys=%d", *keyCount), func(b *testing.B) {
+		run(b, &keys.Calls, func() { fn(context.Background(), kmsinv.NewCache(kmsClient)) })
+	})
+}
+
+func benchSecrets(b *testing.B, fn func(ctx context.Context, client secretsinv.API)) {
+	loadFixtures()
+	b.Run(fmt.Sprintf("secrets=%d", *secretCount), func(b *testing.B) {
+		run(b, &secrets.Calls, func() { fn(context.Background(), secretsClient) })
+	})
+}
+
+func BenchmarkKMSListCustomerManaged(b *testing.B) {
+	benchKMS(b, func(ctx context.Context, client kmsinv.API) {
+		kmsinv.ListCustomerManaged(ctx, client)
+	})
+}
+
+// BenchmarkKMSInventory is the kms-keys listing: alias index, scoped list,
+// then every key described.
+func BenchmarkKMSInventory(b *testing.B) {
+	benchKMS(b, func(ctx context.Context, client kmsinv.API) {
+		inventory(ctx, client, kmsinv.Scope{})
+	})
+}
+
+func BenchmarkKMSInventoryTagScope(b *testing.B) {
+	scope, err := kmsinv.ParseScope([]string{"tag:Owner=payments"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchKMS(b, func(ctx context.Context, client kmsinv.API) {
+		inventory(ctx, client, scope)
+	})
+}
+
+func inventory(ctx context.Context, client kmsinv.API, scope kmsinv.Scope) {
+	aliases, _ := kmsinv.AliasesByKey(ctx, client)
+	entries, _ := kmsinv.ListScoped(ctx, client, scope, aliases, nil)
+	for _, entry := range entries {
+		kmsinv.Describe(ctx, client, aws.ToString(entry.KeyId))
+	}
+}
+
+func BenchmarkSecretsList(b *testing.B) {
+	benchSecrets(b, func(ctx context.Context, client secretsinv.API) {
+		secretsinv.List(ctx, client, secretsinv.ListOptions{IncludeDeleted: true})
+	})
+}
+
+func BenchmarkSecretsListNameFilter(b *testing.B) {
+	filters := []smtypes.Filter{{Key: smtypes.FilterNameStringTypeName, Values: []string{"prod/"}}}
+	benchSecrets(b, func(ctx context.Context, client secretsinv.API) {
+		secretsinv.List(ctx, client, secretsinv.ListOptions{Filters: filters})
+	})
+}
+
+// run times fn and reports the API calls it makes, which is what a caching
+// change should move even when the fakes are too fast for ns/op to show it.
+func run(b *testing.B, calls *map[string]int, fn func()) {
+	b.ReportAllocs()
+	*calls = nil
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn()
+	}
+	b.StopTimer()
+
+	total := 0
+	for _, n := range *calls {
+		total += n
+	}
+	b.ReportMetric(float64(total)/float64(b.N), "calls/op")
+}
+
+// kmsFixture returns a fake account of n keys: one in ten AWS managed, one in
+// twenty pending deletion, half with rotation enabled, and a mix of owners.
+func kmsFixture(n int) *kmsinv.Fake {
+	owners := []string{"payments", "platform", "data", "identity", "search"}
+	services := []string{"s3", "ebs", "rds", "lambda", "secretsmanager"}
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fake := &kmsinv.Fake{Keys: make(map[string]*kmsinv.FakeKey, n), PageSize: 1000}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%08x-0000-4000-8000-%012x", i, i)
+		key := &kmsinv.FakeKey{
+			Metadata: kmstypes.KeyMetadata{
+				Arn:          aws.String("arn:aws:kms:us-east-1:123456789012:key/" + id),
+				CreationDate: aws.Time(created.Add(time.Duration(i) * time.Hour)),
+				KeyManager:   kmstypes.KeyManagerTypeCustomer,
+				KeyState:     kmstypes.KeyStateEnabled,
+				KeySpec:      kmstypes.KeySpecSymmetricDefault,
+				Origin:       kmstypes.OriginTypeAwsKms,
+			},
+			Tags:            map[string]string{"Owner": owners[i%len(owners)], "Environment": "prod"},
+			Aliases:         []string{fmt.Sprintf("alias/app-%d", i)},
+			RotationEnabled: i%2 == 0,
+			RotationPeriod:  365,
+		}
+		switch {
+		case i%10 == 0:
+			key.Metadata.KeyManager = kmstypes.KeyManagerTypeAws
+			key.Tags = nil
+			key.Aliases = []string{"alias/aws/" + services[i/10%len(services)]}
+		case i%20 == 1:
+			key.Metadata.KeyState = kmstypes.KeyStatePendingDeletion
+			key.Metadata.DeletionDate = aws.Time(created.AddDate(4, 0, 0))
+		}
+		fake.Keys[id] = key
+	}
+	return fake
+}
+
+// secretsFixture returns a fake account of n secrets, a fifth of them under
+// prod/ and one in fifty scheduled for deletion.
+func secretsFixture(n int) *secretsinv.Fake {
+	prefixes := []string{"prod/", "staging/", "dev/", "shared/", "ci/"}
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fake := &secretsinv.Fake{Secrets: make([]smtypes.SecretListEntry, 0, n), PageSize: 100}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("%sservice-%d/credentials", prefixes[i%len(prefixes)], i)
+		secret := smtypes.SecretListEntry{
+			ARN:             aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:" + name),
+			Name:            aws.String(name),
+			CreatedDate:     aws.Time(created.Add(time.Duration(i) * time.Minute)),
+			RotationEnabled: aws.Bool(i%3 == 0),
+			Tags:            []smtypes.Tag{{Key: aws.String("Owner"), Value: aws.String("team-" + fmt.Sprint(i%7))}},
+		}
+		if i%50 == 0 {
+			secret.DeletedDate = aws.Time(created.AddDate(3, 0, 0))
+		}
+		fake.Secrets = append(fake.Secrets, secret)
+	}
+	return fake
+}
+
+// slowKMS and slowSecrets add a fixed latency to every call.
+type slowKMS struct {
+	*kmsinv.Fake
+	latency time.Duration
+}
+
+func (s slowKMS) ListKeys(ctx context.Context, params *kms.ListKeysInput, optFns ...func(*kms.Options)) (*kms.ListKeysOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.ListKeys(ctx, params, optFns...)
+}
+
+func (s slowKMS) ListAliases(ctx context.Context, params *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.ListAliases(ctx, params, optFns...)
+}
+
+func (s slowKMS) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.DescribeKey(ctx, params, optFns...)
+}
+
+func (s slowKMS) ListResourceTags(ctx context.Context, params *kms.ListResourceTagsInput, optFns ...func(*kms.Options)) (*kms.ListResourceTagsOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.ListResourceTags(ctx, params, optFns...)
+}
+
+func (s slowKMS) GetKeyRotationStatus(ctx context.Context, params *kms.GetKeyRotationStatusInput, optFns ...func(*kms.Options)) (*kms.GetKeyRotationStatusOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.GetKeyRotationStatus(ctx, params, optFns...)
+}
+
+type slowSecrets struct {
+	*secretsinv.Fake
+	latency time.Duration
+}
+
+func (s slowSecrets) ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.ListSecrets(ctx, params, optFns...)
+}
+
+func (s slowSecrets) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	time.Sleep(s.latency)
+	return s.Fake.DescribeSecret(ctx, params, optFns...)
+}
@@ -0,0 +1,134 @@
+// Package bench holds the inventory benchmarks (in bench_test.go, run with
+// go test -bench against the in-memory fakes at account scale) and Compare,
+// which gates a run's go test -bench output against a saved baseline.
+package bench
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result is one run of one benchmark, its metrics keyed by unit (ns/op, B/op,
+// allocs/op, calls/op).
+type Result struct {
+	Name    string
+	Metrics map[string]float64
+}
+
+// gomaxprocsSuffix is the -N go test appends to names when GOMAXPROCS > 1.
+var gomaxprocsSuffix = regexp.MustCompile(`-\d+$`)
+
+// Parse reads benchmark lines in the go test -bench format, ignoring
+// everything else. Names lose their Benchmark prefix and GOMAXPROCS suffix,
+// so runs on different machines still line up.
+func Parse(r io.Reader) ([]Result, error) {
+	var results []Result
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		// Name, iterations, then value/unit pairs
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		result := Result{
+			Name:    gomaxprocsSuffix.ReplaceAllString(strings.TrimPrefix(fields[0], "Benchmark"), ""),
+			Metrics: make(map[string]float64),
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			result.Metrics[fields[i+1]] = value
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// Delta is the change in one metric of one benchmark between two runs.
+type Delta struct {
+	Name      string
+	Unit      string
+	Old       float64
+	New       float64
+	Change    float64
+	Regressed bool
+}
+
+// GatedUnits are the metrics Compare checks. calls/op is deterministic, so
+// any increase in it is a regression; the others are allowed the threshold
+// as noise.
+var GatedUnits = []string{"ns/op", "allocs/op", "calls/op"}
+
+// Compare takes the median of each benchmark's runs in baseline and current
+// and flags metrics that grew by more than threshold (0.1 is 10%).
+// Benchmarks missing from either side are skipped.
+func Compare(baseline, current []Result, threshold float64) []Delta {
+	old := medians(baseline)
+	now := medians(current)
+
+	var names []string
+	for name := range now {
+		if _, ok := old[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var deltas []Delta
+	for _, name := range names {
+		for _, unit := range GatedUnits {
+			oldValue, okOld := old[name][unit]
+			newValue, okNew := now[name][unit]
+			if !okOld || !okNew {
+				continue
+			}
+			delta := Delta{Name: name, Unit: unit, Old: oldValue, New: newValue}
+			if oldValue != 0 {
+				delta.Change = (newValue - oldValue) / oldValue
+			}
+			allowed := threshold
+			if unit == "calls/op" {
+				allowed = 0
+			}
+			delta.Regressed = newValue > oldValue && (oldValue == 0 || delta.Change > allowed)
+			deltas = append(deltas, delta)
+		}
+	}
+	return deltas
+}
+
+func medians(results []Result) map[string]map[string]float64 {
+	values := make(map[string]map[string][]float64)
+	for _, result := range results {
+		if values[result.Name] == nil {
+			values[result.Name] = make(map[string][]float64)
+		}
+		for unit, value := range result.Metrics {
+			values[result.Name][unit] = append(values[result.Name][unit], value)
+		}
+	}
+
+	out := make(map[string]map[string]float64)
+	for name, units := range values {
+		out[name] = make(map[string]float64)
+		for unit, samples := range units {
+			sort.Float64s(samples)
+			middle := len(samples) / 2
+			if len(samples)%2 == 0 {
+				out[name][unit] = (samples[middle-1] + samples[middle]) / 2
+			} else {
+				out[name][unit] = samples[middle]
+			}
+		}
+	}
+	return out
+}
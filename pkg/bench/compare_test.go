@@ -0,0 +1,68 @@
+package bench
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const output = `goos: linux
+goarch: amd64
+pkg: secrets-lister/pkg/bench
+BenchmarkKMSInventory/keys=10000-8   	      12	  95000000 ns/op	      4501 calls/op	 3200000 B/op	   41000 allocs/op
+BenchmarkSecretsList/secrets=50000   	      30	  40000000 ns/op	       501 calls/op
+BenchmarkBroken   	 notanumber
+PASS
+ok  	secrets-lister/pkg/bench	12.3s
+`
+	results, err := Parse(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{
+		{Name: "KMSInventory/keys=10000", Metrics: map[string]float64{"ns/op": 95000000, "calls/op": 4501, "B/op": 3200000, "allocs/op": 41000}},
+		{Name: "SecretsList/secrets=50000", Metrics: map[string]float64{"ns/op": 40000000, "calls/op": 501}},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Parse = %+v, want %+v", results, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	runs := func(name string, values ...float64) []Result {
+		var results []Result
+		for i := 0; i+2 < len(values); i += 3 {
+			results = append(results, Result{Name: name, Metrics: map[string]float64{"ns/op": values[i], "allocs/op": values[i+1], "calls/op": values[i+2]}})
+		}
+		return results
+	}
+
+	tests := []struct {
+		name      string
+		baseline  []Result
+		current   []Result
+		regressed []string
+	}{
+		{name: "within threshold", baseline: runs("A", 100, 10, 5), current: runs("A", 109, 10, 5)},
+		{name: "slower", baseline: runs("A", 100, 10, 5), current: runs("A", 111, 10, 5), regressed: []string{"ns/op"}},
+		{name: "any extra call", baseline: runs("A", 100, 10, 5), current: runs("A", 100, 10, 6), regressed: []string{"calls/op"}},
+		{name: "from zero", baseline: runs("A", 100, 0, 5), current: runs("A", 100, 1, 5), regressed: []string{"allocs/op"}},
+		{name: "median ignores an outlier", baseline: runs("A", 100, 10, 5, 100, 10, 5, 100, 10, 5), current: runs("A", 100, 10, 5, 500, 10, 5, 101, 10, 5)},
+		{name: "faster", baseline: runs("A", 100, 10, 5), current: runs("A", 50, 5, 4)},
+		{name: "no common benchmark", baseline: runs("A", 100, 10, 5), current: runs("B", 500, 50, 50)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var regressed []string
+			for _, delta := range Compare(tc.baseline, tc.current, 0.1) {
+				if delta.Regressed {
+					regressed = append(regressed, delta.Unit)
+				}
+			}
+			if !reflect.DeepEqual(regressed, tc.regressed) {
+				t.Errorf("regressed = %v, want %v", regressed, tc.regressed)
+			}
+		})
+	}
+}
@@ -0,0 +1,492 @@
+// Package browse is the --interactive inventory browser: a searchable list of
+// keys or secrets beside a detail pane, narrowed by state, region, and tag
+// without re-running the scan.
+package browse
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"secrets-lister/pkg/tagpolicy"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Field is one labelled value in the detail pane. A multi-line Value, such as
+// a key policy, is shown indented under its label.
+type Field struct {
+	Label string
+	Value string
+}
+
+// Item is one key or secret.
+type Item struct {
+	ID string
+	// Name is what the list shows beside the ID: a key's aliases, a secret's name
+	Name   string
+	Region string
+	State  string
+	Tags   map[string]string
+	// Details follow the ID, name, region, and state in the detail pane
+	Details []Field
+}
+
+// Available reports why the browser can't run, if it can't: it draws on
+// stdout and reads keys from stdin, so both must be terminals.
+func Available() error {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		if stat, err := f.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+			return fmt.Errorf("--interactive needs a terminal on stdin and stdout")
+		}
+	}
+	return nil
+}
+
+// Run shows items until the user quits.
+func Run(title string, items []Item) error {
+	_, err := tea.NewProgram(newModel(title, items), tea.WithAltScreen()).Run()
+	return err
+}
+
+// Input modes: keys either move around or edit the search or tag filter.
+const (
+	inputNone = iota
+	inputSearch
+	inputTag
+)
+
+// splitWidth is the narrowest terminal that shows the list and the detail
+// pane side by side; narrower ones show the detail pane in place of the list.
+const splitWidth = 100
+
+type model struct {
+	title string
+	items []Item
+	// states and regions are the values s and r cycle through
+	states  []string
+	regions []string
+
+	// Filters; empty matches everything
+	state      string
+	region     string
+	tag        string
+	tagFilters []tagpolicy.Filter
+	query      string
+
+	input   int
+	draft   string
+	message string
+
+	visible      []int
+	cursor       int
+	offset       int
+	detail       bool
+	detailOffset int
+
+	width  int
+	height int
+}
+
+func newModel(title string, items []Item) *model {
+	m := &model{title: title, items: items, width: 80, height: 24}
+	m.states = distinct(items, func(item Item) string { return item.State })
+	m.regions = distinct(items, func(item Item) string { return item.Region })
+	m.refilter()
+	return m
+}
+
+func (m *model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.input != inputNone {
+			m.edit(msg)
+			return m, nil
+		}
+		if m.detail {
+			return m, m.navigateDetail(msg)
+		}
+		return m, m.navigateList(msg)
+	}
+	return m, nil
+}
+
+// edit handles keys while the search or tag filter is being typed. The
+// search applies as it is typed; the tag filter when it is entered.
+func (m *model) edit(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "enter":
+		if m.input == inputTag {
+			m.setTag(m.draft)
+		}
+		m.input = inputNone
+		return
+	case "esc":
+		if m.input == inputSearch {
+			m.query = ""
+			m.refilter()
+		}
+		m.input = inputNone
+		return
+	case "backspace":
+		if runes := []rune(m.draft); len(runes) > 0 {
+			m.draft = string(runes[:len(runes)-1])
+		}
+	case " ":
+		m.draft += " "
+	default:
+		if msg.Type != tea.KeyRunes {
+			return
+		}
+		m.draft += string(msg.Runes)
+	}
+	if m.input == inputSearch {
+		m.query = m.draft
+		m.refilter()
+	}
+}
+
+func (m *model) navigateList(msg tea.KeyMsg) tea.Cmd {
+	m.message = ""
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "esc":
+		if m.query == "" {
+			return tea.Quit
+		}
+		m.query = ""
+		m.refilter()
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.rows())
+	case "pgdown":
+		m.move(m.rows())
+	case "home", "g":
+		m.move(-len(m.visible))
+	case "end", "G":
+		m.move(len(m.visible))
+	case "/":
+		m.input, m.draft = inputSearch, m.query
+	case "t":
+		m.input, m.draft = inputTag, m.tag
+	case "s":
+		m.state = next(m.states, m.state)
+		m.refilter()
+	case "r":
+		m.region = next(m.regions, m.region)
+		m.refilter()
+	case "c":
+		m.state, m.region, m.query = "", "", ""
+		m.setTag("")
+	case "enter", "tab", "right", "l":
+		if len(m.visible) > 0 {
+			m.detail, m.detailOffset = true, 0
+		}
+	}
+	return nil
+}
+
+func (m *model) navigateDetail(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "esc", "enter", "tab", "left", "h":
+		m.detail = false
+	case "up", "k":
+		m.detailOffset = max(m.detailOffset-1, 0)
+	case "down", "j":
+		m.detailOffset++
+	case "pgup":
+		m.detailOffset = max(m.detailOffset-m.rows(), 0)
+	case "pgdown":
+		m.detailOffset += m.rows()
+	case "home", "g":
+		m.detailOffset = 0
+	}
+	return nil
+}
+
+func (m *model) setTag(value string) {
+	value = strings.TrimSpace(value)
+	filters, err := tagpolicy.ParseFilters(nonEmpty(value))
+	if err != nil {
+		m.message = err.Error()
+		return
+	}
+	m.tag, m.tagFilters = value, filters
+	m.refilter()
+}
+
+// refilter recomputes the visible items, keeping the selected one selected
+// when it still matches.
+func (m *model) refilter() {
+	selected := -1
+	if m.cursor < len(m.visible) {
+		selected = m.visible[m.cursor]
+	}
+
+	query := strings.ToLower(m.query)
+	m.visible = m.visible[:0]
+	m.cursor = 0
+	for i, item := range m.items {
+		if m.state != "" && item.State != m.state {
+			continue
+		}
+		if m.region != "" && item.Region != m.region {
+			continue
+		}
+		if len(m.tagFilters) > 0 && !tagpolicy.Match(item.Tags, m.tagFilters) {
+			continue
+		}
+		if query != "" && !matches(item, query) {
+			continue
+		}
+		if i == selected {
+			m.cursor = len(m.visible)
+		}
+		m.visible = append(m.visible, i)
+	}
+	m.scroll()
+}
+
+// matches reports whether the lowercased query appears in the item's ID,
+// name, or tags.
+func matches(item Item, query string) bool {
+	if strings.Contains(strings.ToLower(item.ID), query) || strings.Contains(strings.ToLower(item.Name), query) {
+		return true
+	}
+	for key, value := range item.Tags {
+		if strings.Contains(strings.ToLower(key), query) || strings.Contains(strings.ToLower(value), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *model) move(delta int) {
+	m.cursor = min(max(m.cursor+delta, 0), max(len(m.visible)-1, 0))
+	m.scroll()
+}
+
+// scroll keeps the cursor on screen.
+func (m *model) scroll() {
+	rows := m.rows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	m.offset = max(min(m.offset, len(m.visible)-rows), 0)
+}
+
+// rows is the height of the list and detail pane: the screen less the title,
+// filter, and help lines.
+func (m *model) rows() int {
+	return max(m.height-4, 1)
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  (%d of %d)\n", m.title, len(m.visible), len(m.items))
+	b.WriteString(truncate(fmt.Sprintf("State: %s  Region: %s  Tag: %s  Search: %s", orAll(m.state), orAll(m.region), orAll(m.tag), orAll(m.query)), m.width))
+	b.WriteString("\n\n")
+
+	rows := m.rows()
+	var left, right []string
+	switch {
+	case m.width >= splitWidth:
+		listWidth := m.width * 2 / 5
+		left = m.listLines(listWidth, rows)
+		right = m.detailLines(m.width-listWidth-3, rows)
+		for i := 0; i < rows; i++ {
+			b.WriteString(pad(line(left, i), listWidth))
+			b.WriteString(" │ ")
+			b.WriteString(line(right, i))
+			b.WriteString("\n")
+		}
+	case m.detail:
+		right = m.detailLines(m.width, rows)
+		for i := 0; i < rows; i++ {
+			b.WriteString(line(right, i) + "\n")
+		}
+	default:
+		left = m.listLines(m.width, rows)
+		for i := 0; i < rows; i++ {
+			b.WriteString(line(left, i) + "\n")
+		}
+	}
+
+	switch {
+	case m.input == inputSearch:
+		b.WriteString("Search: " + m.draft + "█")
+	case m.input == inputTag:
+		b.WriteString("Tag (Key=Value or Key, empty to clear): " + m.draft + "█")
+	case m.message != "":
+		b.WriteString(truncate("Error: "+m.message, m.width))
+	case m.detail:
+		b.WriteString(truncate("↑/↓ scroll  esc back  q quit", m.width))
+	default:
+		b.WriteString(truncate("↑/↓ move  enter details  / search  s state  r region  t tag  c clear  q quit", m.width))
+	}
+	return b.String()
+}
+
+func (m *model) listLines(width, rows int) []string {
+	if len(m.visible) == 0 {
+		return []string{"No matches"}
+	}
+	var lines []string
+	for i := m.offset; i < len(m.visible) && i < m.offset+rows; i++ {
+		item := m.items[m.visible[i]]
+		label := item.ID
+		if item.Name != "" {
+			label = item.Name + "  " + item.ID
+		}
+		text := truncate(fmt.Sprintf("%-16s %-14s %s", item.State, item.Region, label), width-2)
+		if i == m.cursor {
+			// Reverse video marks the selection
+			lines = append(lines, "\x1b[7m> "+pad(text, width-2)+"\x1b[0m")
+		} else {
+			lines = append(lines, "  "+text)
+		}
+	}
+	return lines
+}
+
+// detailLines renders the selected item, wrapped to width, from the scroll
+// offset.
+func (m *model) detailLines(width, rows int) []string {
+	if len(m.visible) == 0 || width < 1 {
+		return nil
+	}
+	item := m.items[m.visible[m.cursor]]
+
+	fields := []Field{{"ID", item.ID}, {"Name", item.Name}, {"Region", item.Region}, {"State", item.State}}
+	fields = append(fields, item.Details...)
+	var tagKeys []string
+	for key := range item.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	var tags []string
+	for _, key := range tagKeys {
+		tags = append(tags, key+" = "+item.Tags[key])
+	}
+	fields = append(fields, Field{"Tags", strings.Join(tags, "\n")})
+
+	var lines []string
+	for _, field := range fields {
+		value := field.Value
+		if value == "" {
+			value = "-"
+		}
+		if !strings.Contains(value, "\n") {
+			lines = append(lines, wrap(field.Label+": "+value, width)...)
+			continue
+		}
+		lines = append(lines, field.Label+":")
+		for _, l := range strings.Split(value, "\n") {
+			lines = append(lines, wrap("  "+l, width)...)
+		}
+	}
+
+	// Scrolling stops at the last screenful
+	m.detailOffset = min(m.detailOffset, max(len(lines)-rows, 0))
+	return lines[m.detailOffset:]
+}
+
+// next cycles through values, with "" (all) before the first.
+func next(values []string, current string) string {
+	for i, value := range values {
+		if value == current && i+1 < len(values) {
+			return values[i+1]
+		}
+		if value == current {
+			return ""
+		}
+	}
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func distinct(items []Item, key func(Item) string) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, item := range items {
+		if value := key(item); value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func orAll(value string) string {
+	if value == "" {
+		return "all"
+	}
+	return value
+}
+
+func line(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width < 1 {
+		return ""
+	}
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// pad right-pads s to width, ignoring the escape codes of a selected row.
+func pad(s string, width int) string {
+	visible := len([]rune(strings.NewReplacer("\x1b[7m", "", "\x1b[0m", "").Replace(s)))
+	if visible >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-visible)
+}
+
+func wrap(s string, width int) []string {
+	runes := []rune(s)
+	var lines []string
+	for len(runes) > width {
+		lines = append(lines, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(lines, string(runes))
+}
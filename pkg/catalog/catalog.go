@@ -0,0 +1,227 @@
+// Package catalog registers exported Parquet files as Glue Data Catalog tables
+// so they can be queried from Athena without hand-written DDL.
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/glue"
+	"github.com/aws/aws-sdk-go-v2/service/glue/types"
+)
+
+const (
+	parquetInputFormat  = "org.apache.hadoop.hive.ql.io.parquet.MapredParquetInputFormat"
+	parquetOutputFormat = "org.apache.hadoop.hive.ql.io.parquet.MapredParquetOutputFormat"
+	parquetSerDe        = "org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe"
+)
+
+// Table describes where an export lives and how it is partitioned.
+type Table struct {
+	Database string
+	Name     string
+	// Location is the table root, e.g. s3://lake/secrets/
+	Location string
+	// Partition holds key=value path segments below Location, in order.
+	Partition []Partition
+}
+
+type Partition struct {
+	Key   string
+	Value string
+}
+
+// ParseName splits "db.table".
+func ParseName(name string) (string, string, error) {
+	database, table, ok := strings.Cut(name, ".")
+	if !ok || database == "" || table == "" {
+		return "", "", fmt.Errorf("invalid table name %q (expected db.table)", name)
+	}
+	return database, table, nil
+}
+
+// TableFromObject derives the table root and partition values from an S3 object
+// URI such as s3://lake/secrets/dt=2024-05-01/region=us-east-1/secrets.parquet.
+// Everything above the first key=value segment is the table location.
+func TableFromObject(database, name, uri string) (Table, error) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return Table{}, fmt.Errorf("a Glue table needs an s3:// location, got %q", uri)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(uri, "s3://"), "/")
+	dirs := segments[:len(segments)-1]
+
+	table := Table{Database: database, Name: name}
+	root := len(dirs)
+	for i, segment := range dirs {
+		key, value, ok := strings.Cut(segment, "=")
+		if !ok {
+			if table.Partition != nil {
+				return Table{}, fmt.Errorf("partition segments must be last in %q", uri)
+			}
+			continue
+		}
+		if table.Partition == nil {
+			root = i
+		}
+		table.Partition = append(table.Partition, Partition{Key: key, Value: value})
+	}
+
+	if root == 0 {
+		return Table{}, fmt.Errorf("no bucket prefix above the partitions in %q", uri)
+	}
+	table.Location = "s3://" + strings.Join(dirs[:root], "/") + "/"
+	return table, nil
+}
+
+// Columns maps the parquet struct tags of record to Glue column types.
+func Columns(record interface{}) ([]types.Column, error) {
+	t := reflect.TypeOf(record)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var columns []types.Column
+	for i := 0; i < t.NumField(); i++ {
+		tag := parseTag(t.Field(i).Tag.Get("parquet"))
+		if tag["name"] == "" {
+			continue
+		}
+		columnType, err := glueType(tag)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", tag["name"], err)
+		}
+		columns = append(columns, types.Column{
+			Name: aws.String(tag["name"]),
+			Type: aws.String(columnType),
+		})
+	}
+	return columns, nil
+}
+
+func parseTag(tag string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[strings.ToLower(key)] = value
+	}
+	return fields
+}
+
+func glueType(tag map[string]string) (string, error) {
+	switch tag["type"] {
+	case "LIST":
+		element, err := primitiveType(tag["valuetype"], tag["valueconvertedtype"])
+		return "array<" + element + ">", err
+	case "MAP":
+		key, err := primitiveType(tag["keytype"], tag["keyconvertedtype"])
+		if err != nil {
+			return "", err
+		}
+		value, err := primitiveType(tag["valuetype"], tag["valueconvertedtype"])
+		return "map<" + key + "," + value + ">", err
+	}
+	return primitiveType(tag["type"], tag["convertedtype"])
+}
+
+func primitiveType(physical, converted string) (string, error) {
+	switch {
+	case converted == "DATE":
+		return "date", nil
+	case converted == "TIMESTAMP_MILLIS", converted == "TIMESTAMP_MICROS":
+		return "timestamp", nil
+	case physical == "BYTE_ARRAY":
+		return "string", nil
+	case physical == "BOOLEAN":
+		return "boolean", nil
+	case physical == "INT32":
+		return "int", nil
+	case physical == "INT64":
+		return "bigint", nil
+	case physical == "FLOAT":
+		return "float", nil
+	case physical == "DOUBLE":
+		return "double", nil
+	}
+	return "", fmt.Errorf("unsupported parquet type %s/%s", physical, converted)
+}
+
+// Register creates the table, or updates its schema if it already exists, and
+// adds the partition the export was written to.
+func Register(ctx context.Context, client *glue.Client, table Table, columns []types.Column) error {
+	var partitionKeys []types.Column
+	for _, p := range table.Partition {
+		partitionKeys = append(partitionKeys, types.Column{Name: aws.String(p.Key), Type: aws.String("string")})
+	}
+
+	input := &types.TableInput{
+		Name:              aws.String(table.Name),
+		TableType:         aws.String("EXTERNAL_TABLE"),
+		Parameters:        map[string]string{"classification": "parquet"},
+		PartitionKeys:     partitionKeys,
+		StorageDescriptor: storageDescriptor(columns, table.Location),
+	}
+
+	_, err := client.CreateTable(ctx, &glue.CreateTableInput{
+		DatabaseName: aws.String(table.Database),
+		TableInput:   input,
+	})
+	var exists *types.AlreadyExistsException
+	if errors.As(err, &exists) {
+		_, err = client.UpdateTable(ctx, &glue.UpdateTableInput{
+			DatabaseName: aws.String(table.Database),
+			TableInput:   input,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to register table %s.%s: %w", table.Database, table.Name, err)
+	}
+
+	if len(table.Partition) == 0 {
+		return nil
+	}
+
+	var values, dirs []string
+	for _, p := range table.Partition {
+		values = append(values, p.Value)
+		dirs = append(dirs, p.Key+"="+p.Value)
+	}
+	partition := &types.PartitionInput{
+		Values:            values,
+		StorageDescriptor: storageDescriptor(columns, table.Location+strings.Join(dirs, "/")+"/"),
+	}
+
+	_, err = client.CreatePartition(ctx, &glue.CreatePartitionInput{
+		DatabaseName:   aws.String(table.Database),
+		TableName:      aws.String(table.Name),
+		PartitionInput: partition,
+	})
+	if errors.As(err, &exists) {
+		_, err = client.UpdatePartition(ctx, &glue.UpdatePartitionInput{
+			DatabaseName:       aws.String(table.Database),
+			TableName:          aws.String(table.Name),
+			PartitionInput:     partition,
+			PartitionValueList: values,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add partition %s: %w", strings.Join(dirs, "/"), err)
+	}
+	return nil
+}
+
+func storageDescriptor(columns []types.Column, location string) *types.StorageDescriptor {
+	return &types.StorageDescriptor{
+		Columns:      columns,
+		Location:     aws.String(location),
+		InputFormat:  aws.String(parquetInputFormat),
+		OutputFormat: aws.String(parquetOutputFormat),
+		SerdeInfo: &types.SerDeInfo{
+			SerializationLibrary: aws.String(parquetSerDe),
+		},
+	}
+}
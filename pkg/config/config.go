@@ -0,0 +1,158 @@
+// Package config reads scan profiles: YAML or TOML files of flag values, so a
+// scheduled job or a team can check in a scan's settings instead of a dozen
+// flags. Keys are flag names without the dashes (regions, filter-tag,
+// required-tags, format, output, role-arn, rps, ...), with underscores
+// accepted for hyphens. A list sets a repeatable flag once per item and any
+// other flag to the items joined with commas; a map sets Key=Value items,
+// e.g. for filter-tag. Flags given on the command line win over the file.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// RegisterFlag adds --config to fs.
+func RegisterFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", "", "Read flag values from this YAML or TOML scan profile; flags on the command line override it")
+}
+
+// Load reads the settings in path, by flag name.
+func Load(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s (use .yaml, .yml, or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	settings := make(map[string][]string, len(raw))
+	for key, value := range raw {
+		name := strings.ReplaceAll(key, "_", "-")
+		values, err := flatten(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		settings[name] = values
+	}
+	return settings, nil
+}
+
+// Apply sets every flag in fs that the file at path names and the command
+// line didn't, so it must be called after fs.Parse. An empty path does
+// nothing. A setting fs has no flag for is an error, so typos don't pass
+// silently.
+func Apply(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		return nil
+	}
+	settings, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		values := settings[name]
+		if !repeatable(f.Value) {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// repeatable flags are the slice types (e.g. --filter-tag), which append on
+// every Set; the standard flag values replace.
+func repeatable(value flag.Value) bool {
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice
+}
+
+func flatten(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(v))
+		for _, key := range keys {
+			s, err := scalar(v[key])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, key+"="+s)
+		}
+		return values, nil
+	}
+	s, err := scalar(value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+func scalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v (use a string, number, boolean, list, or map)", value)
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		profile string
+		args    []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "role list and concurrency",
+			file:    "profile.yaml",
+			profile: "role_arns:\n  - arn:aws:iam::111122223333:role/a\n  - arn:aws:iam::444455556666:role/b\nconcurrency: 8\n",
+			want:    map[string]string{"role-arns": "arn:aws:iam::111122223333:role/a,arn:aws:iam::444455556666:role/b", "concurrency": "8"},
+		},
+		{
+			name:    "toml",
+			file:    "profile.toml",
+			profile: "regions = [\"us-east-1\", \"eu-west-1\"]\nconcurrency = 2\n",
+			want:    map[string]string{"regions": "us-east-1,eu-west-1", "concurrency": "2"},
+		},
+		{
+			name:    "command line wins",
+			file:    "profile.yaml",
+			profile: "concurrency: 8\nformat: json\nfilter-tag:\n  - Team=payments\n",
+			args:    []string{"--concurrency", "2", "--filter-tag", "Env=prod"},
+			want:    map[string]string{"concurrency": "2", "format": "json", "filter-tag": "Env=prod"},
+		},
+		{
+			name:    "bool and scalar list",
+			file:    "profile.yaml",
+			profile: "yes: true\nregions: us-east-1\n",
+			want:    map[string]string{"yes": "true", "regions": "us-east-1"},
+		},
+		{
+			name:    "unknown key",
+			file:    "profile.yaml",
+			profile: "concurency: 8\n",
+			wantErr: `unknown setting "concurency"`,
+		},
+		{
+			name:    "config in a profile",
+			file:    "profile.yaml",
+			profile: "config: other.yaml\n",
+			wantErr: `unknown setting "config"`,
+		},
+		{
+			name:    "invalid value",
+			file:    "profile.toml",
+			profile: "concurrency = \"many\"\n",
+			wantErr: "concurrency",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(path, []byte(tc.profile), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var roles, tags listFlag
+			fs.Var(&roles, "role-arns", "")
+			fs.Var(&tags, "filter-tag", "")
+			fs.String("regions", "", "")
+			fs.String("format", "table", "")
+			fs.Int("concurrency", 4, "")
+			fs.Bool("yes", false, "")
+			RegisterFlag(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Apply(fs, path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			fs.Visit(func(f *flag.Flag) { got[f.Name] = f.Value.String() })
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("flags = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
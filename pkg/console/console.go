@@ -0,0 +1,38 @@
+// Package console builds AWS Management Console links to resources, so a
+// report reader can jump from a finding straight to the resource.
+package console
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Domain is the console host for the region's partition: GovCloud and China
+// regions have their own consoles, and a commercial link would not resolve
+// there.
+func Domain(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return "console.amazonaws-us-gov.com"
+	case strings.HasPrefix(region, "cn-"):
+		return "console.amazonaws.cn"
+	default:
+		return "console.aws.amazon.com"
+	}
+}
+
+// KMSKey links to a key's detail page. AWS managed keys live on a separate
+// console page from customer managed ones.
+func KMSKey(region, keyID string, awsManaged bool) string {
+	page := "keys"
+	if awsManaged {
+		page = "defaultKeys"
+	}
+	return fmt.Sprintf("https://%s.%s/kms/home?region=%s#/kms/%s/%s", region, Domain(region), region, page, url.PathEscape(keyID))
+}
+
+// Secret links to a secret's detail page, which the console looks up by name.
+func Secret(region, name string) string {
+	return fmt.Sprintf("https://%s.%s/secretsmanager/secret?name=%s&region=%s", region, Domain(region), url.QueryEscape(name), region)
+}
@@ -0,0 +1,144 @@
+// Package degrade is the permission matrix for optional AWS calls: which
+// column or report each one feeds, and what the tools show when it fails.
+// Audit roles rarely have every permission, so a failed optional call turns
+// its column into Unknown for the resources affected and is reported once per
+// feature at the end of the run, rather than failing the run or leaving the
+// column silently empty. Calls the run can't do without, such as ListKeys or
+// ListSecrets, are not in the matrix and still fail the run.
+package degrade
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"secrets-lister/pkg/awserr"
+)
+
+// Unknown is shown in place of data that could not be read.
+const Unknown = "unknown"
+
+// Feature names, used in Record and in the unknown field of JSON output.
+const (
+	Aliases           = "aliases"
+	Tags              = "tags"
+	Rotation          = "rotation"
+	Policy            = "policy"
+	LockoutBypass     = "lockout_bypass"
+	CostRotations     = "cost_rotations"
+	Grants            = "grants"
+	Caller            = "caller"
+	Replication       = "replication"
+	Usage             = "usage"
+	EncryptionContext = "encryption_context"
+	Regions           = "regions"
+)
+
+type Feature struct {
+	Name string
+	// Permission is the IAM action the feature needs
+	Permission string
+	// Unit is what failures are counted in
+	Unit string
+	// Effect is what the reader sees instead
+	Effect string
+}
+
+// Matrix lists every optional call, in the order warnings are printed.
+var Matrix = []Feature{
+	{Caller, "sts:GetCallerIdentity", "run", "account and caller shown as unknown in the banner and manifest"},
+	{Regions, "ec2:DescribeRegions", "account", "requested regions scanned as given, without skipping those not enabled (--regions all fails the run)"},
+	{Aliases, "kms:ListAliases", "region", "aliases shown as unknown (alias filters and scopes still fail the run)"},
+	{Tags, "kms:ListResourceTags", "key", "tags shown as unknown; the key never matches --filter-tag or a tag: --scope and is skipped by --required-tags"},
+	{Rotation, "kms:GetKeyRotationStatus", "key", "rotation shown as Unknown, which --require-rotation counts as non-compliant"},
+	{Policy, "kms:GetKeyPolicy", "key", "policy left out of the JSON, table, CSV, and parquet output and --policy-dir"},
+	{LockoutBypass, "cloudtrail:LookupEvents", "region", "--check-lockout-bypass can't flag keys in the region"},
+	{CostRotations, "kms:ListKeyRotations", "key", "cost estimate assumes no billed rotations"},
+	{Grants, "kms:ListGrants", "key", "grants for the key left out; keys denied outright are listed as not authorized"},
+	{Replication, "secretsmanager:DescribeSecret", "secret", "replica regions and replication status shown as unknown"},
+	{Usage, "cloudtrail:LookupEvents", "key", "last use shown as unknown in kms-keys usage; the key isn't counted as unused"},
+	{EncryptionContext, "cloudtrail:LookupEvents", "key", "encryption contexts shown as unknown in kms-keys encryption-context"},
+}
+
+// Degradation is one feature that could not be read for some resources.
+type Degradation struct {
+	Feature    string `json:"feature"`
+	Permission string `json:"permission"`
+	Count      int    `json:"count"`
+	Unit       string `json:"unit"`
+	Effect     string `json:"effect"`
+	// Classes counts the failures by error class (e.g. not_authorized)
+	Classes map[awserr.Class]int `json:"classes"`
+}
+
+// Tracker collects failed optional calls over a run. It is safe for
+// concurrent use, and a nil Tracker ignores everything.
+type Tracker struct {
+	mu       sync.Mutex
+	failures map[string]map[awserr.Class]int
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{failures: make(map[string]map[awserr.Class]int)}
+}
+
+// Record notes that feature could not be read for one unit because of err.
+func (t *Tracker) Record(feature string, err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failures[feature] == nil {
+		t.failures[feature] = make(map[awserr.Class]int)
+	}
+	t.failures[feature][awserr.Classify(err)]++
+}
+
+// Degraded returns the features that failed, in matrix order.
+func (t *Tracker) Degraded() []Degradation {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var degraded []Degradation
+	for _, feature := range Matrix {
+		classes := t.failures[feature.Name]
+		if len(classes) == 0 {
+			continue
+		}
+		d := Degradation{
+			Feature:    feature.Name,
+			Permission: feature.Permission,
+			Unit:       feature.Unit,
+			Effect:     feature.Effect,
+			Classes:    make(map[awserr.Class]int),
+		}
+		for class, count := range classes {
+			d.Count += count
+			d.Classes[class] = count
+		}
+		degraded = append(degraded, d)
+	}
+	return degraded
+}
+
+// Warnings is one line per degraded feature, e.g. "kms:ListResourceTags
+// failed for 12 key(s) (not_authorized: 10, throttled: 2): tags shown as
+// unknown; ...".
+func (t *Tracker) Warnings() []string {
+	var warnings []string
+	for _, d := range t.Degraded() {
+		var classes []string
+		for class, count := range d.Classes {
+			classes = append(classes, fmt.Sprintf("%s: %d", class, count))
+		}
+		sort.Strings(classes)
+		warnings = append(warnings, fmt.Sprintf("%s failed for %d %s(s) (%s): %s",
+			d.Permission, d.Count, d.Unit, strings.Join(classes, ", "), d.Effect))
+	}
+	return warnings
+}
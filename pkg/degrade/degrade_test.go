@@ -0,0 +1,80 @@
+package degrade
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+var (
+	denied    = &smithy.GenericAPIError{Code: "AccessDeniedException"}
+	throttled = &smithy.GenericAPIError{Code: "ThrottlingException"}
+)
+
+func TestTrackerWarnings(t *testing.T) {
+	type failure struct {
+		feature string
+		err     error
+	}
+	tests := []struct {
+		name     string
+		failures []failure
+		want     []string
+	}{
+		{name: "nothing failed"},
+		{
+			name:     "nil errors are not failures",
+			failures: []failure{{Tags, nil}, {Policy, nil}},
+		},
+		{
+			name:     "counted by class",
+			failures: []failure{{Tags, denied}, {Tags, throttled}, {Tags, denied}},
+			want: []string{
+				"kms:ListResourceTags failed for 3 key(s) (not_authorized: 2, throttled: 1): " + effect(Tags),
+			},
+		},
+		{
+			name:     "in matrix order",
+			failures: []failure{{Grants, denied}, {Caller, errors.New("no credentials")}, {Aliases, denied}},
+			want: []string{
+				"sts:GetCallerIdentity failed for 1 run(s) (other: 1): " + effect(Caller),
+				"kms:ListAliases failed for 1 region(s) (not_authorized: 1): " + effect(Aliases),
+				"kms:ListGrants failed for 1 key(s) (not_authorized: 1): " + effect(Grants),
+			},
+		},
+		{
+			name:     "features outside the matrix are left out",
+			failures: []failure{{"unlisted", denied}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := NewTracker()
+			for _, f := range tc.failures {
+				tracker.Record(f.feature, f.err)
+			}
+			if got := tracker.Warnings(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("warnings = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	tracker.Record(Tags, denied)
+	if got := tracker.Warnings(); got != nil {
+		t.Errorf("warnings = %q, want none", got)
+	}
+}
+
+func effect(feature string) string {
+	for _, f := range Matrix {
+		if f.Name == feature {
+			return f.Effect
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+// Package enccontext summarizes the encryption contexts a KMS key is used
+// with, from its CloudTrail events, to document how the key is used and what
+// kms:EncryptionContext policy conditions it could enforce. Only the context
+// key names are kept: values often identify the data (a bucket, a table, a
+// tenant) and don't belong in an inventory.
+package enccontext
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operations take an encryption context; other cryptographic operations
+// (Sign, Verify, GenerateMac, ...) never have one, so they are not counted.
+var Operations = map[string]bool{
+	"Encrypt": true, "Decrypt": true, "ReEncrypt": true,
+	"GenerateDataKey": true, "GenerateDataKeyWithoutPlaintext": true,
+	"GenerateDataKeyPair": true, "GenerateDataKeyPairWithoutPlaintext": true,
+}
+
+// Set is one distinct combination of context key names.
+type Set struct {
+	// Keys is sorted; empty for calls made without a context
+	Keys       []string  `json:"keys"`
+	Events     int       `json:"events"`
+	Operations []string  `json:"operations"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+type Stats struct {
+	Events         int `json:"events"`
+	WithoutContext int `json:"without_context"`
+	// Sets is most used first
+	Sets []Set `json:"contexts"`
+	// AlwaysPresent are the context keys in every event, the ones a policy
+	// condition could require without breaking current callers
+	AlwaysPresent []string `json:"always_present,omitempty"`
+}
+
+// Aggregator collects events for one key. The zero value is ready to use.
+type Aggregator struct {
+	events    int
+	sets      map[string]*aggregate
+	keyCounts map[string]int
+}
+
+type aggregate struct {
+	set        Set
+	operations map[string]bool
+}
+
+// Add records one call. Values in context are ignored.
+func (a *Aggregator) Add(operation string, at time.Time, context map[string]string) {
+	if a.sets == nil {
+		a.sets = make(map[string]*aggregate)
+		a.keyCounts = make(map[string]int)
+	}
+	a.events++
+
+	keys := make([]string, 0, len(context))
+	for key := range context {
+		keys = append(keys, key)
+		a.keyCounts[key]++
+	}
+	sort.Strings(keys)
+
+	// Context keys can contain any character but NUL isn't one people use
+	id := strings.Join(keys, "\x00")
+	agg, ok := a.sets[id]
+	if !ok {
+		agg = &aggregate{set: Set{Keys: keys}, operations: make(map[string]bool)}
+		a.sets[id] = agg
+	}
+	agg.set.Events++
+	agg.operations[operation] = true
+	if at.After(agg.set.LastSeen) {
+		agg.set.LastSeen = at
+	}
+}
+
+func (a *Aggregator) Stats() Stats {
+	stats := Stats{Events: a.events}
+	for _, agg := range a.sets {
+		set := agg.set
+		for operation := range agg.operations {
+			set.Operations = append(set.Operations, operation)
+		}
+		sort.Strings(set.Operations)
+		if len(set.Keys) == 0 {
+			stats.WithoutContext += set.Events
+		}
+		stats.Sets = append(stats.Sets, set)
+	}
+	sort.Slice(stats.Sets, func(i, j int) bool {
+		if stats.Sets[i].Events != stats.Sets[j].Events {
+			return stats.Sets[i].Events > stats.Sets[j].Events
+		}
+		return strings.Join(stats.Sets[i].Keys, ",") < strings.Join(stats.Sets[j].Keys, ",")
+	})
+
+	for key, count := range a.keyCounts {
+		if count == a.events {
+			stats.AlwaysPresent = append(stats.AlwaysPresent, key)
+		}
+	}
+	sort.Strings(stats.AlwaysPresent)
+	return stats
+}
@@ -0,0 +1,64 @@
+// Package httpclient builds the one HTTP client every AWS service client in a
+// process shares, so connections are pooled across services and regions
+// instead of each client dialing its own.
+package httpclient
+
+import (
+	"flag"
+	"net/http"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// Options tunes the shared transport.
+type Options struct {
+	MaxIdleConns int
+	// MaxIdleConnsPerHost should be at least the scan concurrency, or
+	// connections are closed and re-dialed between requests
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps dials per endpoint (0 means no limit), which bounds
+	// local port use however busy a scan gets
+	MaxConnsPerHost int
+	IdleConnTimeout time.Duration
+	DisableHTTP2    bool
+}
+
+func Defaults() Options {
+	return Options{
+		MaxIdleConns:        256,
+		MaxIdleConnsPerHost: 64,
+		MaxConnsPerHost:     128,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// RegisterFlags adds the tuning flags to fs, with o's values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.MaxIdleConns, "http-max-idle-conns", o.MaxIdleConns, "Idle HTTP connections kept across all AWS endpoints")
+	fs.IntVar(&o.MaxIdleConnsPerHost, "http-max-idle-conns-per-host", o.MaxIdleConnsPerHost, "Idle HTTP connections kept per AWS endpoint")
+	fs.IntVar(&o.MaxConnsPerHost, "http-max-conns-per-host", o.MaxConnsPerHost, "Maximum HTTP connections per AWS endpoint (0 for no limit)")
+	fs.DurationVar(&o.IdleConnTimeout, "http-idle-timeout", o.IdleConnTimeout, "Close idle HTTP connections after this long")
+	fs.BoolVar(&o.DisableHTTP2, "http-disable-http2", o.DisableHTTP2, "Use HTTP/1.1 only")
+}
+
+var (
+	shared     *awshttp.BuildableClient
+	sharedOnce sync.Once
+)
+
+// Shared returns the process-wide client, built from o on first use; later
+// calls return the same client whatever options they pass.
+func Shared(o Options) *awshttp.BuildableClient {
+	sharedOnce.Do(func() {
+		shared = awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.MaxIdleConns = o.MaxIdleConns
+			tr.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+			tr.MaxConnsPerHost = o.MaxConnsPerHost
+			tr.IdleConnTimeout = o.IdleConnTimeout
+			tr.ForceAttemptHTTP2 = !o.DisableHTTP2
+		})
+	})
+	return shared
+}
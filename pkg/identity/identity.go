@@ -0,0 +1,71 @@
+// Package identity resolves who a run is acting as, so every run can say which
+// account it is about to read from or change before it does anything.
+package identity
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type Caller struct {
+	Account string `json:"account"`
+	ARN     string `json:"arn"`
+	UserID  string `json:"user_id"`
+}
+
+// Lookup calls sts:GetCallerIdentity, which needs no IAM permissions.
+func Lookup(ctx context.Context, cfg aws.Config) (*Caller, error) {
+	output, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	return &Caller{
+		Account: aws.ToString(output.Account),
+		ARN:     aws.ToString(output.Arn),
+		UserID:  aws.ToString(output.UserId),
+	}, nil
+}
+
+// Banner prints the profile, caller, and regions a run is using. A nil caller
+// is shown as unknown.
+func Banner(w io.Writer, profile string, caller *Caller, regions []string) {
+	if profile == "" {
+		profile = "default"
+	}
+	fmt.Fprintf(w, "Using Profile: %s\n", profile)
+	if caller != nil {
+		fmt.Fprintf(w, "Using Account: %s\n", caller.Account)
+		fmt.Fprintf(w, "Using Caller:  %s\n", caller.ARN)
+	} else {
+		fmt.Fprintln(w, "Using Account: unknown")
+	}
+	fmt.Fprintf(w, "Using Region:  %s\n", strings.Join(regions, ", "))
+}
+
+// Confirm shows the identity a mutating command is about to act as and asks
+// for an explicit "yes". Without a terminal on stdin there is nobody to ask,
+// so it refuses; scripts must pass --yes.
+func Confirm(caller *Caller, regions []string, message string) bool {
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "Error: stdin is not a terminal; pass --yes to confirm non-interactively")
+		return false
+	}
+
+	fmt.Printf("WARNING: %s\n", message)
+	fmt.Printf("  Account: %s\n", caller.Account)
+	fmt.Printf("  Caller:  %s\n", caller.ARN)
+	fmt.Printf("  Region:  %s\n", strings.Join(regions, ", "))
+	fmt.Print("Are you sure you want to continue? (yes/no): ")
+
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+	fmt.Println()
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,279 @@
+package keypolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityHigh   Severity = "HIGH"
+	SeverityMedium Severity = "MEDIUM"
+	SeverityLow    Severity = "LOW"
+)
+
+// AuditFinding is one risky Allow statement, with the statement itself so a
+// reviewer can see what to change.
+type AuditFinding struct {
+	Severity  Severity  `json:"severity"`
+	Rule      string    `json:"rule"`
+	Label     string    `json:"statement_label"`
+	Message   string    `json:"message"`
+	Statement Statement `json:"statement"`
+}
+
+type AuditOptions struct {
+	// Account owns the key; its own principals are never cross-account
+	Account string
+	// TrustedAccounts may be named as principals without a finding
+	TrustedAccounts []string
+	// BroadPrincipals are principal ARN patterns (* and ? wildcards) shared
+	// by many people, such as SSO permission set roles
+	BroadPrincipals []string
+}
+
+// DefaultBroadPrincipals are the roles IAM Identity Center creates for
+// permission sets, which everyone assigned the permission set can assume.
+var DefaultBroadPrincipals = []string{"arn:*:iam::*:role/aws-reserved/sso.amazonaws.com/*"}
+
+// restrictingConditionKeys narrow who can use a statement, so a wildcard
+// principal limited by one of them (to values without wildcards in the
+// account, organization, or service) is not open to the world.
+var restrictingConditionKeys = map[string]bool{
+	"kms:calleraccount":        true,
+	"aws:principalaccount":     true,
+	"aws:principalorgid":       true,
+	"aws:principalorgpaths":    true,
+	"aws:principalarn":         true,
+	"aws:sourceaccount":        true,
+	"aws:sourcearn":            true,
+	"aws:principalservicename": true,
+}
+
+// networkConditionKeys limit where a call comes from but not who makes it:
+// any account's principals inside the VPC or endpoint can still use the key.
+var networkConditionKeys = map[string]bool{
+	"aws:sourcevpc":  true,
+	"aws:sourcevpce": true,
+}
+
+// restrictingOperators require the key to be present and match one of the
+// values. Negated operators, IfExists, and ForAllValues all pass for callers
+// the values don't name; wildcardOperators treat * and ? in values as
+// wildcards.
+var (
+	restrictingOperators = map[string]bool{
+		"StringEquals": true, "StringEqualsIgnoreCase": true, "StringLike": true, "ArnEquals": true, "ArnLike": true,
+		"ForAnyValue:StringEquals": true, "ForAnyValue:StringEqualsIgnoreCase": true, "ForAnyValue:StringLike": true,
+	}
+	wildcardOperators = map[string]bool{"StringLike": true, "ArnEquals": true, "ArnLike": true, "ForAnyValue:StringLike": true}
+)
+
+// adminActions let a principal take over or destroy the key.
+var adminActions = []string{"kms:PutKeyPolicy", "kms:ScheduleKeyDeletion", "kms:CreateGrant", "kms:DisableKey"}
+
+var accountID = regexp.MustCompile(`^\d{12}$`)
+
+// Audit flags Allow statements that open the key more widely than intended:
+// wildcard principals without a condition restricting the caller, principals
+// in accounts other than the key's and the trusted ones, and full kms:* access
+// for roles many people can assume. Deny statements only ever narrow access
+// and are not flagged.
+func Audit(policy Document, opts AuditOptions) []AuditFinding {
+	trusted := make(map[string]bool)
+	for _, account := range opts.TrustedAccounts {
+		trusted[account] = true
+	}
+	if opts.Account != "" {
+		trusted[opts.Account] = true
+	}
+
+	var findings []AuditFinding
+	for i, statement := range policy.Statement {
+		if !strings.EqualFold(statement.Effect, "Allow") {
+			continue
+		}
+		add := func(severity Severity, rule, format string, args ...interface{}) {
+			findings = append(findings, AuditFinding{
+				Severity:  severity,
+				Rule:      rule,
+				Label:     statementLabel(statement, i),
+				Message:   fmt.Sprintf(format, args...),
+				Statement: statement,
+			})
+		}
+		admin := grantsAny(statement, adminActions)
+		full := grantsAll(statement, append([]string{"kms:Decrypt"}, adminActions...))
+
+		if statement.NotPrincipal != nil {
+			add(SeverityHigh, "allow-not-principal", "Allow with NotPrincipal grants access to every principal not listed, in any account")
+		}
+		if len(statement.NotAction) > 0 {
+			add(SeverityMedium, "allow-not-action", "Allow with NotAction grants every action not listed, including ones added to KMS later")
+		}
+
+		if hasWildcardPrincipal(statement.Principal) {
+			switch {
+			case len(statement.Condition) == 0:
+				add(SeverityHigh, "wildcard-principal", "Principal \"*\" without conditions lets any AWS account use the key")
+			case restrictsCaller(statement.Condition, restrictingConditionKeys):
+			case restrictsCaller(statement.Condition, networkConditionKeys):
+				add(SeverityLow, "wildcard-principal-network", "Principal \"*\" restricted only to a VPC or VPC endpoint lets any account's principals there use the key")
+			default:
+				add(SeverityMedium, "wildcard-principal", "Principal \"*\" with conditions that don't restrict the caller's account, organization, or ARN")
+			}
+			continue
+		}
+
+		if statement.Principal == nil {
+			continue
+		}
+		for _, value := range statement.Principal.Values["AWS"] {
+			account := principalAccount(value)
+			if account != "" && !trusted[account] {
+				if admin {
+					add(SeverityHigh, "cross-account", "%s in account %s can administer the key or grant others access to it", value, account)
+				} else {
+					add(SeverityMedium, "cross-account", "%s in account %s can use the key", value, account)
+				}
+			}
+			if full && !isAccountRoot(value) {
+				if matchesAnyPattern(value, opts.BroadPrincipals) {
+					add(SeverityHigh, "broad-full-access", "%s is assumable by many people and has full access to the key", value)
+				} else {
+					add(SeverityLow, "full-access", "%s has full access to the key; consider separate admin and usage statements", value)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// HasSeverity reports whether any finding is at least as severe as min.
+func HasSeverity(findings []AuditFinding, min Severity) bool {
+	for _, finding := range findings {
+		if severityRank[finding.Severity] >= severityRank[min] {
+			return true
+		}
+	}
+	return false
+}
+
+var severityRank = map[Severity]int{SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3}
+
+// ParseSeverity accepts high, medium, or low in any case.
+func ParseSeverity(value string) (Severity, error) {
+	severity := Severity(strings.ToUpper(value))
+	if _, ok := severityRank[severity]; !ok {
+		return "", fmt.Errorf("invalid severity %q (use high, medium, or low)", value)
+	}
+	return severity, nil
+}
+
+func hasWildcardPrincipal(p *Principal) bool {
+	if p == nil {
+		return false
+	}
+	if p.Wildcard {
+		return true
+	}
+	for _, value := range p.Values["AWS"] {
+		if value == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictsCaller reports whether a condition on one of keys limits callers
+// to the values it names. A value that matches anything, such as StringLike
+// aws:PrincipalArn "*" or an ARN with a wildcard account, doesn't.
+func restrictsCaller(conditions map[string]map[string]StringList, keys map[string]bool) bool {
+	for operator, values := range conditions {
+		if !restrictingOperators[operator] {
+			continue
+		}
+		for key, list := range values {
+			key = strings.ToLower(key)
+			if !keys[key] || len(list) == 0 {
+				continue
+			}
+			restricts := true
+			for _, value := range list {
+				if wildcardOperators[operator] && !pinsCaller(key, value) {
+					restricts = false
+				}
+			}
+			if restricts {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pinsCaller reports whether a wildcard pattern for key still names a single
+// account, organization, service, VPC, or endpoint.
+func pinsCaller(key, pattern string) bool {
+	var fixed string
+	switch key {
+	case "aws:principalarn", "aws:sourcearn":
+		// arn:partition:service:region:account:resource; the account is what
+		// keeps other accounts out (service ARNs such as S3 buckets have none)
+		parts := strings.SplitN(pattern, ":", 6)
+		if len(parts) != 6 {
+			return false
+		}
+		fixed = parts[4]
+		if fixed == "" {
+			fixed = parts[5]
+		}
+	case "aws:principalorgpaths":
+		fixed, _, _ = strings.Cut(pattern, "/")
+	default:
+		fixed = pattern
+	}
+	return fixed != "" && !strings.ContainsAny(fixed, "*?")
+}
+
+// principalAccount returns the account of an AWS principal given as an
+// account ID or an ARN, or "" for anything else.
+func principalAccount(value string) string {
+	if accountID.MatchString(value) {
+		return value
+	}
+	return arnAccount(value)
+}
+
+func isAccountRoot(value string) bool {
+	return accountID.MatchString(value) || strings.HasSuffix(value, ":root")
+}
+
+func grantsAny(statement Statement, actions []string) bool {
+	for _, action := range actions {
+		if actionMatches(statement, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func grantsAll(statement Statement, actions []string) bool {
+	for _, action := range actions {
+		if !actionMatches(statement, action) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAnyPattern(value string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package keypolicy
+
+import "testing"
+
+func TestAuditWildcardPrincipalConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition map[string]map[string]StringList
+		// rule is the expected wildcard finding, "" for none
+		rule     string
+		severity Severity
+	}{
+		{name: "no condition", rule: "wildcard-principal", severity: SeverityHigh},
+		{name: "caller account", condition: map[string]map[string]StringList{"StringEquals": {"kms:CallerAccount": {"111122223333"}}}},
+		{name: "organization", condition: map[string]map[string]StringList{"StringEquals": {"aws:PrincipalOrgID": {"o-a1b2c3d4e5"}}}},
+		{name: "principal ARN pattern in one account", condition: map[string]map[string]StringList{"ArnLike": {"aws:PrincipalArn": {"arn:aws:iam::111122223333:role/app-*"}}}},
+		{name: "org path under one organization", condition: map[string]map[string]StringList{"ForAnyValue:StringLike": {"aws:PrincipalOrgPaths": {"o-a1b2c3d4e5/r-ab12/ou-*"}}}},
+		{name: "source bucket", condition: map[string]map[string]StringList{"ArnLike": {"aws:SourceArn": {"arn:aws:s3:::logs-bucket"}}}},
+		{name: "wildcard principal ARN", condition: map[string]map[string]StringList{"StringLike": {"aws:PrincipalArn": {"*"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "principal ARN in any account", condition: map[string]map[string]StringList{"ArnLike": {"aws:PrincipalArn": {"arn:aws:iam::*:role/admin"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "one open value", condition: map[string]map[string]StringList{"StringLike": {"kms:CallerAccount": {"111122223333", "*"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "wildcard organization", condition: map[string]map[string]StringList{"StringLike": {"aws:PrincipalOrgID": {"o-*"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "negated", condition: map[string]map[string]StringList{"StringNotEquals": {"kms:CallerAccount": {"444455556666"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "if exists", condition: map[string]map[string]StringList{"StringEqualsIfExists": {"aws:SourceAccount": {"111122223333"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "unrelated key", condition: map[string]map[string]StringList{"StringEquals": {"kms:ViaService": {"s3.us-east-1.amazonaws.com"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+		{name: "VPC endpoint only", condition: map[string]map[string]StringList{"StringEquals": {"aws:SourceVpce": {"vpce-0123456789abcdef0"}}}, rule: "wildcard-principal-network", severity: SeverityLow},
+		{name: "VPC endpoint and account", condition: map[string]map[string]StringList{"StringEquals": {"aws:SourceVpce": {"vpce-0123456789abcdef0"}, "kms:CallerAccount": {"111122223333"}}}},
+		{name: "any VPC", condition: map[string]map[string]StringList{"StringLike": {"aws:SourceVpc": {"vpc-*"}}}, rule: "wildcard-principal", severity: SeverityMedium},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := Document{Statement: []Statement{{
+				Effect:    "Allow",
+				Principal: &Principal{Wildcard: true},
+				Action:    StringList{"kms:Decrypt"},
+				Resource:  StringList{"*"},
+				Condition: tc.condition,
+			}}}
+			findings := Audit(policy, AuditOptions{Account: "111122223333"})
+			switch {
+			case tc.rule == "" && len(findings) > 0:
+				t.Errorf("findings = %+v, want none", findings)
+			case tc.rule != "" && len(findings) != 1:
+				t.Errorf("findings = %+v, want one %s", findings, tc.rule)
+			case tc.rule != "" && (findings[0].Rule != tc.rule || findings[0].Severity != tc.severity):
+				t.Errorf("finding = %s %s, want %s %s", findings[0].Severity, findings[0].Rule, tc.severity, tc.rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package keypolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Named policy building blocks. Generated policies should be composed from
+// these rather than hand-written statements so they are reviewed once.
+
+var (
+	kmsAdminActions = StringList{
+		"kms:Create*", "kms:Describe*", "kms:Enable*", "kms:List*", "kms:Put*",
+		"kms:Update*", "kms:Revoke*", "kms:Disable*", "kms:Get*", "kms:Delete*",
+		"kms:TagResource", "kms:UntagResource", "kms:ScheduleKeyDeletion",
+		"kms:CancelKeyDeletion", "kms:RotateKeyOnDemand",
+	}
+	kmsUsageActions = StringList{
+		"kms:Encrypt", "kms:Decrypt", "kms:ReEncrypt*", "kms:GenerateDataKey*", "kms:DescribeKey",
+	}
+	kmsDeletionActions = StringList{
+		"kms:ScheduleKeyDeletion", "kms:DisableKey",
+	}
+)
+
+func awsPrincipal(arns ...string) *Principal {
+	return &Principal{Values: map[string]StringList{"AWS": arns}}
+}
+
+// Partition returns the partition of an ARN (aws, aws-cn, aws-us-gov, ...),
+// or aws for anything that isn't one.
+func Partition(arn string) string {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" || parts[1] == "" {
+		return "aws"
+	}
+	return parts[1]
+}
+
+func accountRootArn(partition, account string) string {
+	return fmt.Sprintf("arn:%s:iam::%s:root", partition, account)
+}
+
+// RootAccessBlock delegates the key to IAM in the account. The partition is
+// the key's, e.g. Partition(keyArn) or Partition of the caller's ARN.
+func RootAccessBlock(partition, account string) Statement {
+	return Statement{
+		Sid:       "EnableIAMUserPermissions",
+		Effect:    "Allow",
+		Principal: awsPrincipal(accountRootArn(partition, account)),
+		Action:    StringList{"kms:*"},
+		Resource:  StringList{"*"},
+	}
+}
+
+func AdminBlock(adminRoles ...string) Statement {
+	return Statement{
+		Sid:       "AllowKeyAdministration",
+		Effect:    "Allow",
+		Principal: awsPrincipal(adminRoles...),
+		Action:    kmsAdminActions,
+		Resource:  StringList{"*"},
+	}
+}
+
+func UsageBlock(role string) Statement {
+	return Statement{
+		Sid:       "AllowKeyUsage" + sidSuffix(role),
+		Effect:    "Allow",
+		Principal: awsPrincipal(role),
+		Action:    kmsUsageActions,
+		Resource:  StringList{"*"},
+	}
+}
+
+func CrossAccountUse(partition, account string, conditions map[string]map[string]StringList) Statement {
+	return Statement{
+		Sid:       "AllowCrossAccountUse" + account,
+		Effect:    "Allow",
+		Principal: awsPrincipal(accountRootArn(partition, account)),
+		Action:    kmsUsageActions,
+		Resource:  StringList{"*"},
+		Condition: conditions,
+	}
+}
+
+func DenyDeletion(breakGlassRole string) Statement {
+	return Statement{
+		Sid:       "DenyDeletionExceptBreakGlass",
+		Effect:    "Deny",
+		Principal: &Principal{Wildcard: true},
+		Action:    kmsDeletionActions,
+		Resource:  StringList{"*"},
+		Condition: map[string]map[string]StringList{
+			"ArnNotLike": {"aws:PrincipalArn": {breakGlassRole}},
+		},
+	}
+}
+
+// SetStatement replaces the statement with the same Sid, or appends it, so
+// applying a block twice leaves one copy.
+func (d *Document) SetStatement(statement Statement) {
+	for i := range d.Statement {
+		if statement.Sid != "" && d.Statement[i].Sid == statement.Sid {
+			d.Statement[i] = statement
+			return
+		}
+	}
+	d.Statement = append(d.Statement, statement)
+}
+
+func sidSuffix(arn string) string {
+	// Sids only allow alphanumerics; use the last path element of the ARN
+	name := arn[strings.LastIndexAny(arn, "/:")+1:]
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package keypolicy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartition(t *testing.T) {
+	tests := map[string]string{
+		"arn:aws:kms:us-east-1:111122223333:key/abc":            "aws",
+		"arn:aws-us-gov:kms:us-gov-west-1:111122223333:key/abc": "aws-us-gov",
+		"arn:aws-cn:iam::111122223333:root":                     "aws-cn",
+		"111122223333":                                          "aws",
+		"arn::iam::111122223333:root":                           "aws",
+	}
+	for arn, want := range tests {
+		if got := Partition(arn); got != want {
+			t.Errorf("Partition(%q) = %q, want %q", arn, got, want)
+		}
+	}
+}
+
+func TestRootAccessBlockPartition(t *testing.T) {
+	got := RootAccessBlock("aws-us-gov", "111122223333").Principal.Values["AWS"]
+	if want := (StringList{"arn:aws-us-gov:iam::111122223333:root"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("principal = %v, want %v", got, want)
+	}
+
+	// The simulator matches the root principal in the caller's partition
+	doc := Document{Statement: []Statement{RootAccessBlock("aws-cn", "111122223333")}}
+	result := Simulate(doc, Request{Principal: "arn:aws-cn:iam::111122223333:role/app", Action: "kms:Decrypt"})
+	if result.Decision != DecisionDelegated {
+		t.Errorf("decision = %s, want %s", result.Decision, DecisionDelegated)
+	}
+}
+
+func TestSetStatement(t *testing.T) {
+	doc := Document{Statement: []Statement{RootAccessBlock("aws", "111122223333")}}
+	doc.SetStatement(DenyDeletion("arn:aws:iam::111122223333:role/old"))
+	doc.SetStatement(DenyDeletion("arn:aws:iam::111122223333:role/break-glass"))
+
+	if len(doc.Statement) != 2 {
+		t.Fatalf("statements = %d, want 2", len(doc.Statement))
+	}
+	got := doc.Statement[1].Condition["ArnNotLike"]["aws:PrincipalArn"]
+	if want := (StringList{"arn:aws:iam::111122223333:role/break-glass"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("break-glass role = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,281 @@
+package keypolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Finding struct {
+	Kind       string   `json:"kind"`
+	Statements []string `json:"statements"`
+	Message    string   `json:"message"`
+}
+
+// Minimize returns an equivalent policy without duplicate or shadowed
+// statements, with statements that differ only by principal merged.
+func Minimize(policy Document) (Document, []Finding) {
+	var findings []Finding
+	statements := make([]Statement, len(policy.Statement))
+	copy(statements, policy.Statement)
+
+	// Tidy each statement: drop actions covered by a wildcard in the same statement
+	for i := range statements {
+		kept, dropped := dropCoveredActions(statements[i].Action)
+		if len(dropped) > 0 {
+			findings = append(findings, Finding{
+				Kind:       "redundant-action",
+				Statements: []string{statementLabel(statements[i], i)},
+				Message:    fmt.Sprintf("%s already covered by a wildcard action in the same statement", strings.Join(dropped, ", ")),
+			})
+			statements[i].Action = kept
+		}
+	}
+
+	// Remove duplicate and shadowed statements
+	removed := make(map[int]bool)
+	for i := range statements {
+		for j := range statements {
+			if i == j || removed[i] || removed[j] {
+				continue
+			}
+			if !statementCovers(statements[j], statements[i]) {
+				continue
+			}
+			kind, verb := "shadowed", "is fully covered by"
+			if statementsEqual(statements[i], statements[j]) {
+				// Keep the first of two identical statements
+				if i < j {
+					continue
+				}
+				kind, verb = "duplicate", "duplicates"
+			}
+			findings = append(findings, Finding{
+				Kind:       kind,
+				Statements: []string{statementLabel(statements[i], i), statementLabel(statements[j], j)},
+				Message:    fmt.Sprintf("%s %s %s", statementLabel(statements[i], i), verb, statementLabel(statements[j], j)),
+			})
+			removed[i] = true
+		}
+	}
+
+	// Merge statements that differ only by principal. origin keeps each
+	// result's index in the input, so findings name the statement the
+	// reader sees in their policy.
+	var result []Statement
+	var origin []int
+	merged := make(map[int]bool)
+	for i := range statements {
+		if removed[i] || merged[i] {
+			continue
+		}
+		statement := statements[i]
+		for j := i + 1; j < len(statements); j++ {
+			if removed[j] || merged[j] || !sameExceptPrincipal(statement, statements[j]) {
+				continue
+			}
+			findings = append(findings, Finding{
+				Kind:       "mergeable",
+				Statements: []string{statementLabel(statements[i], i), statementLabel(statements[j], j)},
+				Message:    "statements grant the same actions and conditions to different principals",
+			})
+			statement.Principal = mergePrincipals(statement.Principal, statements[j].Principal)
+			merged[j] = true
+		}
+		result = append(result, statement)
+		origin = append(origin, i)
+	}
+
+	// Principals listed more than once in one statement
+	for i := range result {
+		if result[i].Principal == nil {
+			continue
+		}
+		deduped := &Principal{Values: make(map[string]StringList)}
+		for principalType, values := range result[i].Principal.Values {
+			unique := uniqueStrings(values)
+			if len(unique) < len(values) {
+				findings = append(findings, Finding{
+					Kind:       "duplicate-principal",
+					Statements: []string{statementLabel(result[i], origin[i])},
+					Message:    fmt.Sprintf("%s principal listed more than once", principalType),
+				})
+			}
+			deduped.Values[principalType] = unique
+		}
+		if !result[i].Principal.Wildcard {
+			result[i].Principal = deduped
+		}
+	}
+
+	minimized := policy
+	minimized.Statement = result
+	return minimized, findings
+}
+
+func statementLabel(statement Statement, index int) string {
+	if statement.Sid != "" {
+		return statement.Sid
+	}
+	return fmt.Sprintf("Statement[%d]", index)
+}
+
+func dropCoveredActions(actions StringList) (StringList, []string) {
+	var kept StringList
+	var dropped []string
+	for i, action := range actions {
+		covered := false
+		for j, other := range actions {
+			if i == j || !strings.Contains(other, "*") {
+				continue
+			}
+			if globMatch(strings.ToLower(other), strings.ToLower(action)) && (!strings.EqualFold(other, action) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			dropped = append(dropped, action)
+		} else {
+			kept = append(kept, action)
+		}
+	}
+	return kept, dropped
+}
+
+// statementCovers reports whether outer grants (or denies) everything inner does.
+// Outer must be unconditioned or carry exactly the same conditions as inner.
+func statementCovers(outer, inner Statement) bool {
+	if outer.Effect != inner.Effect || len(outer.Condition) > 0 && !conditionsEqual(outer.Condition, inner.Condition) {
+		return false
+	}
+	// NotAction/NotResource/NotPrincipal semantics are too subtle to reason about safely
+	if len(outer.NotAction) > 0 || len(inner.NotAction) > 0 || len(outer.NotResource) > 0 || len(inner.NotResource) > 0 ||
+		outer.NotPrincipal != nil || inner.NotPrincipal != nil {
+		return false
+	}
+	return principalCovers(outer.Principal, inner.Principal) &&
+		patternsCover(outer.Action, inner.Action) &&
+		patternsCover(outer.Resource, inner.Resource)
+}
+
+// principalCovers treats {"AWS": "*"} like "*", as IAM does.
+func principalCovers(outer, inner *Principal) bool {
+	if outer == nil || inner == nil {
+		return outer == inner
+	}
+	if hasWildcardPrincipal(outer) {
+		return true
+	}
+	if hasWildcardPrincipal(inner) {
+		return false
+	}
+	for principalType, values := range inner.Values {
+		for _, value := range values {
+			if !containsString(outer.Values[principalType], value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func patternsCover(outer, inner StringList) bool {
+	for _, value := range inner {
+		covered := false
+		for _, pattern := range outer {
+			if globMatch(strings.ToLower(pattern), strings.ToLower(value)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func statementsEqual(a, b Statement) bool {
+	a.Sid, b.Sid = "", ""
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return bytes.Equal(aJSON, bJSON)
+}
+
+func sameExceptPrincipal(a, b Statement) bool {
+	if a.Principal == nil || b.Principal == nil || hasWildcardPrincipal(a.Principal) || hasWildcardPrincipal(b.Principal) {
+		return false
+	}
+	a.Sid, b.Sid = "", ""
+	a.Principal, b.Principal = nil, nil
+	return statementsEqual(a, b)
+}
+
+func conditionsEqual(a, b map[string]map[string]StringList) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return bytes.Equal(aJSON, bJSON)
+}
+
+func mergePrincipals(a, b *Principal) *Principal {
+	merged := &Principal{Values: make(map[string]StringList)}
+	for _, p := range []*Principal{a, b} {
+		for principalType, values := range p.Values {
+			merged.Values[principalType] = uniqueStrings(append(merged.Values[principalType], values...))
+		}
+	}
+	return merged
+}
+
+func uniqueStrings(values StringList) StringList {
+	seen := make(map[string]bool)
+	var unique StringList
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches IAM-style patterns where * matches any run of characters
+// and ? matches exactly one. Policies come from untrusted accounts, so this
+// backtracks only to the most recent *, keeping patterns like "*a*a*a*b" from
+// taking exponential time.
+func globMatch(pattern, value string) bool {
+	p, v := []rune(pattern), []rune(value)
+	pi, vi := 0, 0
+	star, starValue := -1, 0
+	for vi < len(v) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			star, starValue = pi, vi
+			pi++
+		case pi < len(p) && (p[pi] == '?' || p[pi] == v[vi]):
+			pi++
+			vi++
+		case star >= 0:
+			// Let the last * absorb one more character and retry
+			starValue++
+			pi, vi = star+1, starValue
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
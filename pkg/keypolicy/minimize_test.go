@@ -0,0 +1,111 @@
+package keypolicy
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMinimize(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		// want is the Sids of the statements kept
+		want     []string
+		findings []Finding
+	}{
+		{
+			name: "AWS wildcard covers a named principal",
+			policy: `{"Statement":[
+				{"Sid":"Role","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:role/app"},"Action":"kms:Decrypt","Resource":"*"},
+				{"Sid":"Everyone","Effect":"Allow","Principal":{"AWS":"*"},"Action":"kms:*","Resource":"*"}]}`,
+			want:     []string{"Everyone"},
+			findings: []Finding{{Kind: "shadowed", Statements: []string{"Role", "Everyone"}, Message: "Role is fully covered by Everyone"}},
+		},
+		{
+			name: "named principal doesn't cover the AWS wildcard",
+			policy: `{"Statement":[
+				{"Sid":"Everyone","Effect":"Allow","Principal":{"AWS":"*"},"Action":"kms:Decrypt","Resource":"*"},
+				{"Sid":"Role","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:role/app"},"Action":"kms:*","Resource":"*"}]}`,
+			want: []string{"Everyone", "Role"},
+		},
+		{
+			name: "NotResource is kept and never shadowed",
+			policy: `{"Statement":[
+				{"Sid":"AllButOne","Effect":"Deny","Principal":"*","Action":"kms:Decrypt","NotResource":"arn:aws:kms:us-east-1:111122223333:key/1234"},
+				{"Sid":"All","Effect":"Deny","Principal":"*","Action":"kms:*","Resource":"*"}]}`,
+			want: []string{"AllButOne", "All"},
+		},
+		{
+			name: "labels use the index in the input",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:role/a"},"Action":"kms:Decrypt"},
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:role/a"},"Action":"kms:Decrypt"},
+				{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::111122223333:role/b","arn:aws:iam::111122223333:role/b"]},"Action":"kms:Encrypt"}]}`,
+			want: []string{"", ""},
+			findings: []Finding{
+				{Kind: "duplicate", Statements: []string{"Statement[1]", "Statement[0]"}, Message: "Statement[1] duplicates Statement[0]"},
+				{Kind: "duplicate-principal", Statements: []string{"Statement[2]"}, Message: "AWS principal listed more than once"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var policy Document
+			if err := json.Unmarshal([]byte(tc.policy), &policy); err != nil {
+				t.Fatal(err)
+			}
+			minimized, findings := Minimize(policy)
+			var kept []string
+			for _, statement := range minimized.Statement {
+				kept = append(kept, statement.Sid)
+			}
+			if !reflect.DeepEqual(kept, tc.want) {
+				t.Errorf("kept %q, want %q", kept, tc.want)
+			}
+			if !reflect.DeepEqual(findings, tc.findings) {
+				t.Errorf("findings = %+v, want %+v", findings, tc.findings)
+			}
+			for _, statement := range minimized.Statement {
+				if statement.Sid == "AllButOne" && len(statement.NotResource) != 1 {
+					t.Errorf("NotResource = %v, want it kept", statement.NotResource)
+				}
+			}
+		})
+	}
+}
+
+// FuzzGlobMatch checks the linear-time matcher against a regular expression
+// built from the same pattern.
+func FuzzGlobMatch(f *testing.F) {
+	f.Add("kms:*", "kms:Decrypt")
+	f.Add("kms:Describe?ey", "kms:DescribeKey")
+	f.Add("*a*a*a*a*a*a*b", strings.Repeat("a", 40))
+	f.Add("arn:aws:iam::*:role/AWSReservedSSO_*", "arn:aws:iam::111122223333:role/AWSReservedSSO_Admin_0123")
+	f.Add("", "")
+	f.Fuzz(func(t *testing.T, pattern, value string) {
+		if !utf8.ValidString(pattern) || !utf8.ValidString(value) {
+			return
+		}
+		var expr strings.Builder
+		expr.WriteString("(?s)^")
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		expr.WriteString("$")
+		want := regexp.MustCompile(expr.String()).MatchString(value)
+		if got := globMatch(pattern, value); got != want {
+			t.Fatalf("globMatch(%q, %q) = %v, want %v", pattern, value, got, want)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+// Package keypolicy models KMS key policy documents and provides the
+// building blocks, minimizer and simulator used by the policy subcommands.
+package keypolicy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Document struct {
+	Version   string      `json:"Version"`
+	ID        string      `json:"Id,omitempty"`
+	Statement []Statement `json:"Statement"`
+}
+
+type Statement struct {
+	Sid          string                           `json:"Sid,omitempty"`
+	Effect       string                           `json:"Effect"`
+	Principal    *Principal                       `json:"Principal,omitempty"`
+	NotPrincipal *Principal                       `json:"NotPrincipal,omitempty"`
+	Action       StringList                       `json:"Action,omitempty"`
+	NotAction    StringList                       `json:"NotAction,omitempty"`
+	Resource     StringList                       `json:"Resource,omitempty"`
+	NotResource  StringList                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]StringList `json:"Condition,omitempty"`
+}
+
+// Principal is either the wildcard "*" or a map such as {"AWS": [...]}.
+type Principal struct {
+	Wildcard bool
+	Values   map[string]StringList
+}
+
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if p.Wildcard {
+		return json.Marshal("*")
+	}
+	return json.Marshal(p.Values)
+}
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("unexpected principal %q", wildcard)
+		}
+		p.Wildcard = true
+		return nil
+	}
+	return json.Unmarshal(data, &p.Values)
+}
+
+// StringList accepts both a single string and a list of strings, as IAM policies do.
+type StringList []string
+
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if len(l) == 1 {
+		return json.Marshal(l[0])
+	}
+	return json.Marshal([]string(l))
+}
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
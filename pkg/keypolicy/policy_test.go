@@ -0,0 +1,59 @@
+package keypolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+var fuzzPolicies = []string{
+	`{"Version":"2012-10-17","Statement":[{"Sid":"Enable IAM User Permissions","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:root"},"Action":"kms:*","Resource":"*"}]}`,
+	`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":["kms:Decrypt","kms:Encrypt"],"Resource":"*","Condition":{"StringEquals":{"kms:CallerAccount":"111122223333","kms:ViaService":["s3.us-east-1.amazonaws.com"]}}}]}`,
+	`{"Statement":[{"Effect":"Deny","NotPrincipal":{"AWS":["arn:aws:iam::111122223333:role/admin"]},"NotAction":"kms:Describe*","Resource":"*"},{"Effect":"Allow","Principal":{"AWS":"444455556666"},"Action":"kms:*"}]}`,
+	`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"kms:*","Condition":{"NotIpAddress":{"aws:SourceIp":"203.0.113.0/24"}}}]}`,
+	`{"Statement":null}`,
+	`{"Statement":[{"Principal":"x"}]}`,
+}
+
+// FuzzPolicy feeds arbitrary documents through the parser and every analyzer:
+// none may panic, and a parsed policy must survive a round trip through JSON.
+func FuzzPolicy(f *testing.F) {
+	for _, policy := range fuzzPolicies {
+		f.Add([]byte(policy), "arn:aws:sts::111122223333:assumed-role/app/session", "kms:Decrypt")
+	}
+	f.Fuzz(func(t *testing.T, data []byte, principal, action string) {
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return
+		}
+
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("marshaling a parsed policy: %v", err)
+		}
+		var again Document
+		if err := json.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("re-parsing %s: %v", encoded, err)
+		}
+		if reencoded, _ := json.Marshal(again); !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("round trip changed the policy:\n%s\n%s", encoded, reencoded)
+		}
+
+		Audit(doc, AuditOptions{Account: "111122223333", BroadPrincipals: []string{"arn:aws:iam::*:role/AWSReservedSSO_*"}})
+
+		minimized, _ := Minimize(doc)
+		if len(minimized.Statement) > len(doc.Statement) {
+			t.Fatalf("Minimize grew %d statements to %d", len(doc.Statement), len(minimized.Statement))
+		}
+
+		result := Simulate(doc, Request{Principal: principal, Action: action, Context: map[string][]string{"kms:ViaService": {action}}})
+		switch result.Decision {
+		case DecisionExplicitDeny, DecisionAllow, DecisionDelegated, DecisionImplicitDeny, DecisionIndeterminate:
+		default:
+			t.Fatalf("unexpected decision %q", result.Decision)
+		}
+		if len(result.Statements) != len(doc.Statement) {
+			t.Fatalf("Simulate reported %d statements for %d", len(result.Statements), len(doc.Statement))
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package keypolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Decision string
+
+const (
+	DecisionExplicitDeny Decision = "EXPLICIT_DENY"
+	DecisionAllow        Decision = "ALLOW"
+	DecisionDelegated    Decision = "DELEGATED_TO_IAM"
+	DecisionImplicitDeny Decision = "IMPLICIT_DENY"
+	// DecisionIndeterminate means a Deny statement may apply but uses a
+	// condition operator Simulate cannot evaluate, so no allow is reported.
+	DecisionIndeterminate Decision = "INDETERMINATE"
+)
+
+// Request describes a single what-if call against a key: who is calling, which
+// KMS action, and the request context keys (e.g. kms:ViaService).
+type Request struct {
+	Principal string
+	Action    string
+	Context   map[string][]string
+}
+
+type StatementResult struct {
+	Label          string
+	Effect         string
+	PrincipalMatch bool
+	ActionMatch    bool
+	ConditionMatch bool
+	Applies        bool
+	// DelegatesToIAM is set when the statement matched only because it names
+	// the caller's account root, which hands the decision to IAM policies.
+	DelegatesToIAM bool
+	// Indeterminate is set when a condition uses an operator Simulate cannot
+	// evaluate and no other part of the statement rules it out.
+	Indeterminate bool
+	Reason        string
+}
+
+type Result struct {
+	Decision   Decision
+	Statements []StatementResult
+}
+
+// Simulate evaluates a key policy for a request using the IAM evaluation order:
+// an explicit deny wins, then an explicit allow, then an allow delegated to
+// IAM through the account root, and otherwise the request is implicitly denied.
+// It fails closed: a Deny whose condition it cannot evaluate makes the result
+// indeterminate rather than letting a later Allow through.
+func Simulate(policy Document, req Request) Result {
+	principalArn := NormalizePrincipal(req.Principal)
+	account := arnAccount(principalArn)
+
+	ctx := map[string][]string{}
+	for key, values := range req.Context {
+		ctx[strings.ToLower(key)] = values
+	}
+	if _, ok := ctx["aws:principalarn"]; !ok {
+		ctx["aws:principalarn"] = []string{principalArn}
+	}
+	if _, ok := ctx["aws:principalaccount"]; !ok && account != "" {
+		ctx["aws:principalaccount"] = []string{account}
+	}
+
+	var result Result
+	var denied, maybeDenied, allowed, delegated bool
+
+	for i, statement := range policy.Statement {
+		sr := StatementResult{Label: statementLabel(statement, i), Effect: statement.Effect}
+
+		var viaRoot bool
+		sr.PrincipalMatch, viaRoot = principalMatches(statement, principalArn, account)
+		sr.ActionMatch = actionMatches(statement, req.Action)
+
+		var reasons []string
+		var unknown bool
+		sr.ConditionMatch = true
+		for operator, keys := range statement.Condition {
+			for key, values := range keys {
+				ok, err := evaluateCondition(operator, values, ctx[strings.ToLower(key)])
+				switch {
+				case err != nil:
+					unknown = true
+					reasons = append(reasons, err.Error())
+				case !ok:
+					sr.ConditionMatch = false
+					reasons = append(reasons, fmt.Sprintf("%s %s not satisfied", operator, key))
+				}
+			}
+		}
+
+		switch {
+		case !sr.PrincipalMatch:
+			reasons = append(reasons, "principal does not match")
+		case !sr.ActionMatch:
+			reasons = append(reasons, "action does not match")
+		}
+
+		// A condition that can't be evaluated never makes a statement apply:
+		// an Allow is not counted, and a Deny makes the decision indeterminate
+		sr.Indeterminate = unknown && sr.PrincipalMatch && sr.ActionMatch && sr.ConditionMatch
+		if unknown {
+			sr.ConditionMatch = false
+		}
+		sr.Applies = sr.PrincipalMatch && sr.ActionMatch && sr.ConditionMatch
+		if sr.Indeterminate {
+			if strings.EqualFold(statement.Effect, "Deny") {
+				maybeDenied = true
+				reasons = append(reasons, "may deny the request; condition could not be evaluated")
+			} else {
+				reasons = append(reasons, "not counted as allowing; condition could not be evaluated")
+			}
+		}
+		if sr.Applies {
+			switch {
+			case strings.EqualFold(statement.Effect, "Deny"):
+				denied = true
+				reasons = append(reasons, "explicitly denies the request")
+			case viaRoot:
+				sr.DelegatesToIAM = true
+				delegated = true
+				reasons = append(reasons, "allows via account root; IAM policies must also allow")
+			default:
+				allowed = true
+				reasons = append(reasons, "explicitly allows the request")
+			}
+		}
+		sr.Reason = strings.Join(reasons, "; ")
+
+		result.Statements = append(result.Statements, sr)
+	}
+
+	switch {
+	case denied:
+		result.Decision = DecisionExplicitDeny
+	case maybeDenied:
+		result.Decision = DecisionIndeterminate
+	case allowed:
+		result.Decision = DecisionAllow
+	case delegated:
+		result.Decision = DecisionDelegated
+	default:
+		result.Decision = DecisionImplicitDeny
+	}
+
+	return result
+}
+
+// NormalizePrincipal maps an assumed-role session ARN to the role ARN that key
+// policies name, and leaves any other ARN unchanged.
+func NormalizePrincipal(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return arn
+	}
+	resource := strings.Split(parts[5], "/")
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], resource[1])
+}
+
+func arnAccount(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// principalMatches reports whether the statement applies to the caller and
+// whether it did so only by naming the caller's account.
+func principalMatches(statement Statement, principalArn, account string) (bool, bool) {
+	if statement.NotPrincipal != nil {
+		matched, _ := principalListed(statement.NotPrincipal, principalArn, account)
+		return !matched, false
+	}
+	if statement.Principal == nil {
+		return false, false
+	}
+	return principalListed(statement.Principal, principalArn, account)
+}
+
+func principalListed(p *Principal, principalArn, account string) (bool, bool) {
+	if p.Wildcard {
+		return true, false
+	}
+	viaRoot := false
+	for _, value := range p.Values["AWS"] {
+		switch {
+		case value == "*", strings.EqualFold(value, principalArn):
+			return true, false
+		case account != "" && (value == account || value == accountRootArn(Partition(principalArn), account)):
+			viaRoot = true
+		}
+	}
+	return viaRoot, viaRoot
+}
+
+func actionMatches(statement Statement, action string) bool {
+	action = strings.ToLower(action)
+	if len(statement.NotAction) > 0 {
+		for _, pattern := range statement.NotAction {
+			if globMatch(strings.ToLower(pattern), action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, pattern := range statement.Action {
+		if globMatch(strings.ToLower(pattern), action) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateCondition evaluates one operator/key pair against the request
+// context values for that key (nil when the key is absent).
+func evaluateCondition(operator string, policyValues StringList, contextValues []string) (bool, error) {
+	base := operator
+	var forAny, forAll bool
+	if strings.HasPrefix(base, "ForAnyValue:") {
+		forAny = true
+		base = strings.TrimPrefix(base, "ForAnyValue:")
+	} else if strings.HasPrefix(base, "ForAllValues:") {
+		forAll = true
+		base = strings.TrimPrefix(base, "ForAllValues:")
+	}
+
+	if base == "Null" {
+		absent := len(contextValues) == 0
+		for _, value := range policyValues {
+			if strings.EqualFold(value, "true") != absent {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	ifExists := strings.HasSuffix(base, "IfExists")
+	base = strings.TrimSuffix(base, "IfExists")
+
+	negated := strings.Contains(base, "Not")
+	positive := strings.Replace(base, "Not", "", 1)
+
+	var match func(pattern, value string) bool
+	switch positive {
+	case "StringEquals":
+		match = func(pattern, value string) bool { return pattern == value }
+	case "StringEqualsIgnoreCase":
+		match = strings.EqualFold
+	case "StringLike", "ArnEquals", "ArnLike":
+		match = globMatch
+	case "Bool":
+		match = strings.EqualFold
+	default:
+		return false, fmt.Errorf("unsupported condition operator %s", operator)
+	}
+
+	if len(contextValues) == 0 {
+		switch {
+		case forAll:
+			return true, nil
+		case forAny:
+			return false, nil
+		}
+		return ifExists || negated, nil
+	}
+
+	holds := func(value string) bool {
+		for _, pattern := range policyValues {
+			if match(pattern, value) {
+				return !negated
+			}
+		}
+		return negated
+	}
+
+	// Without a set prefix, positive operators need any value to match and
+	// negated operators need every value to miss.
+	all := forAll || (!forAny && negated)
+	for _, value := range contextValues {
+		if holds(value) != all {
+			return !all, nil
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,82 @@
+package keypolicy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSimulateUnsupportedConditionFailsClosed(t *testing.T) {
+	const policy = `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Sid": "Use", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111122223333:role/app"}, "Action": "kms:Decrypt", "Resource": "*"},
+			{"Sid": "OnlyFromOffice", "Effect": "Deny", "Principal": "*", "Action": "kms:*", "Resource": "*",
+			 "Condition": {"NotIpAddress": {"aws:SourceIp": "203.0.113.0/24"}}}
+		]
+	}`
+	var doc Document
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		context map[string][]string
+		action  string
+		want    Decision
+	}{
+		{"deny may apply", map[string][]string{"aws:SourceIp": {"198.51.100.7"}}, "kms:Decrypt", DecisionIndeterminate},
+		{"deny may apply without context", nil, "kms:Decrypt", DecisionIndeterminate},
+		{"deny action does not match", nil, "sts:GetCallerIdentity", DecisionImplicitDeny},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Simulate(doc, Request{
+				Principal: "arn:aws:sts::111122223333:assumed-role/app/session",
+				Action:    tc.action,
+				Context:   tc.context,
+			})
+			if result.Decision != tc.want {
+				t.Errorf("decision = %s, want %s", result.Decision, tc.want)
+			}
+		})
+	}
+}
+
+func TestSimulateUnsupportedConditionOnAllow(t *testing.T) {
+	doc := Document{Statement: []Statement{{
+		Effect:    "Allow",
+		Principal: &Principal{Values: map[string]StringList{"AWS": {"arn:aws:iam::111122223333:role/app"}}},
+		Action:    StringList{"kms:Decrypt"},
+		Condition: map[string]map[string]StringList{"DateLessThan": {"aws:CurrentTime": {"2030-01-01T00:00:00Z"}}},
+	}}}
+	result := Simulate(doc, Request{Principal: "arn:aws:iam::111122223333:role/app", Action: "kms:Decrypt"})
+	if result.Decision != DecisionImplicitDeny {
+		t.Errorf("decision = %s, want %s", result.Decision, DecisionImplicitDeny)
+	}
+	if !result.Statements[0].Indeterminate {
+		t.Error("statement is not marked indeterminate")
+	}
+}
+
+// FuzzNormalizePrincipal checks the ARN handling on caller-supplied principals.
+func FuzzNormalizePrincipal(f *testing.F) {
+	for _, arn := range []string{
+		"arn:aws:sts::111122223333:assumed-role/app/session",
+		"arn:aws-us-gov:sts::111122223333:assumed-role/app",
+		"arn:aws:sts::111122223333:assumed-role/",
+		"arn:aws:iam::111122223333:role/app",
+		"arn:aws:sts:::",
+		"111122223333",
+	} {
+		f.Add(arn)
+	}
+	f.Fuzz(func(t *testing.T, arn string) {
+		normalized := NormalizePrincipal(arn)
+		if again := NormalizePrincipal(normalized); again != normalized {
+			t.Fatalf("NormalizePrincipal(%q) = %q, but normalizing that gives %q", arn, normalized, again)
+		}
+		if account := arnAccount(normalized); account != arnAccount(arn) {
+			t.Fatalf("account changed from %q to %q", arnAccount(arn), account)
+		}
+	})
+}
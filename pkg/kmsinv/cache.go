@@ -0,0 +1,109 @@
+package kmsinv
+
+import (
+	"context"
+	"sync"
+
+	"secrets-lister/pkg/awserr"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Cache is an API that remembers DescribeKey and ListResourceTags results, so
+// filtering keys and then describing them costs one call per key instead of
+// two. Access denied and not found errors are remembered too; throttling and
+// transient errors are not, so a later call gets a fresh attempt. Other calls
+// pass through.
+type Cache struct {
+	API
+
+	mu        sync.Mutex
+	described map[string]describeResult
+	tagged    map[string]tagsResult
+}
+
+type describeResult struct {
+	output *kms.DescribeKeyOutput
+	err    error
+}
+
+type tagsResult struct {
+	output *kms.ListResourceTagsOutput
+	err    error
+}
+
+func NewCache(client API) *Cache {
+	return &Cache{
+		API:       client,
+		described: make(map[string]describeResult),
+		tagged:    make(map[string]tagsResult),
+	}
+}
+
+// DescribeKey is cached by the KeyId as given, so a key looked up by ID and
+// then by ARN is described twice.
+func (c *Cache) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+	c.mu.Lock()
+	result, ok := c.described[keyID]
+	c.mu.Unlock()
+	if ok {
+		return result.output, result.err
+	}
+
+	output, err := c.API.DescribeKey(ctx, params, optFns...)
+	if cacheable(err) {
+		c.mu.Lock()
+		c.described[keyID] = describeResult{output: output, err: err}
+		c.mu.Unlock()
+	}
+	return output, err
+}
+
+// ListResourceTags is only cached for unpaginated calls, which is how the
+// inventory reads tags.
+func (c *Cache) ListResourceTags(ctx context.Context, params *kms.ListResourceTagsInput, optFns ...func(*kms.Options)) (*kms.ListResourceTagsOutput, error) {
+	if params.Marker != nil || params.Limit != nil {
+		return c.API.ListResourceTags(ctx, params, optFns...)
+	}
+
+	keyID := aws.ToString(params.KeyId)
+	c.mu.Lock()
+	result, ok := c.tagged[keyID]
+	c.mu.Unlock()
+	if ok {
+		return result.output, result.err
+	}
+
+	output, err := c.API.ListResourceTags(ctx, params, optFns...)
+	if cacheable(err) {
+		c.mu.Lock()
+		c.tagged[keyID] = tagsResult{output: output, err: err}
+		c.mu.Unlock()
+	}
+	return output, err
+}
+
+// SeedTags records tags already read elsewhere, such as from the tagging API,
+// so the inventory doesn't call ListResourceTags for those keys.
+func (c *Cache) SeedTags(tags map[string]map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for keyID, keyTags := range tags {
+		output := &kms.ListResourceTagsOutput{}
+		for key, value := range keyTags {
+			output.Tags = append(output.Tags, types.Tag{TagKey: aws.String(key), TagValue: aws.String(value)})
+		}
+		c.tagged[keyID] = tagsResult{output: output}
+	}
+}
+
+func cacheable(err error) bool {
+	if err == nil {
+		return true
+	}
+	class := awserr.Classify(err)
+	return class == awserr.NotAuthorized || class == awserr.NotFound
+}
@@ -0,0 +1,186 @@
+package kmsinv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+)
+
+// FakeKey is one key held by a Fake.
+type FakeKey struct {
+	Metadata        types.KeyMetadata
+	Tags            map[string]string
+	Aliases         []string
+	RotationEnabled bool
+	RotationPeriod  int32
+}
+
+// Fake is an in-memory API for exercising the inventory without AWS. It pages
+// ListKeys and ListAliases like the service does and can fail individual calls.
+type Fake struct {
+	// Keys is indexed by key ID
+	Keys map[string]*FakeKey
+	// PageSize is the number of entries per ListKeys/ListAliases page
+	// (default 2, so small fixtures still paginate)
+	PageSize int
+	// Errors fails list calls by operation name ("ListKeys") from the second
+	// page on, so partial results can be tested, and per-key calls by
+	// "<operation>:<key ID>" (e.g. "DescribeKey:1234abcd-...").
+	Errors map[string]error
+	// Calls counts calls by operation name
+	Calls map[string]int
+
+	mu sync.Mutex
+}
+
+// AccessDenied returns the error KMS returns for a missing permission.
+func AccessDenied(operation, keyID string) error {
+	return &smithy.GenericAPIError{
+		Code:    "AccessDeniedException",
+		Message: fmt.Sprintf("User is not authorized to perform: kms:%s on resource: key/%s", operation, keyID),
+	}
+}
+
+func (f *Fake) call(operation, keyID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Calls == nil {
+		f.Calls = make(map[string]int)
+	}
+	f.Calls[operation]++
+
+	if err := f.Errors[operation+":"+keyID]; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *Fake) key(keyID string) (*FakeKey, error) {
+	key, ok := f.Keys[keyID]
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "NotFoundException", Message: fmt.Sprintf("Key '%s' does not exist", keyID)}
+	}
+	return key, nil
+}
+
+func (f *Fake) keyIDs() []string {
+	var ids []string
+	for id := range f.Keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// page returns the bounds of the page starting at marker, and the next marker.
+func (f *Fake) page(operation string, marker *string, total int) (int, int, *string, error) {
+	start := 0
+	if marker != nil {
+		var err error
+		if start, err = strconv.Atoi(*marker); err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid marker %q", *marker)
+		}
+		if err := f.Errors[operation]; err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	pageSize := f.PageSize
+	if pageSize == 0 {
+		pageSize = 2
+	}
+	end := min(start+pageSize, total)
+	if end < total {
+		return start, end, aws.String(strconv.Itoa(end)), nil
+	}
+	return start, end, nil, nil
+}
+
+func (f *Fake) ListKeys(ctx context.Context, params *kms.ListKeysInput, optFns ...func(*kms.Options)) (*kms.ListKeysOutput, error) {
+	f.call("ListKeys", "")
+
+	ids := f.keyIDs()
+	start, end, next, err := f.page("ListKeys", params.Marker, len(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &kms.ListKeysOutput{NextMarker: next, Truncated: next != nil}
+	for _, id := range ids[start:end] {
+		output.Keys = append(output.Keys, types.KeyListEntry{KeyId: aws.String(id), KeyArn: f.Keys[id].Metadata.Arn})
+	}
+	return output, nil
+}
+
+func (f *Fake) ListAliases(ctx context.Context, params *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error) {
+	f.call("ListAliases", "")
+
+	var aliases []types.AliasListEntry
+	for _, id := range f.keyIDs() {
+		for _, name := range f.Keys[id].Aliases {
+			aliases = append(aliases, types.AliasListEntry{AliasName: aws.String(name), TargetKeyId: aws.String(id)})
+		}
+	}
+	start, end, next, err := f.page("ListAliases", params.Marker, len(aliases))
+	if err != nil {
+		return nil, err
+	}
+	return &kms.ListAliasesOutput{Aliases: aliases[start:end], NextMarker: next, Truncated: next != nil}, nil
+}
+
+func (f *Fake) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+	if err := f.call("DescribeKey", keyID); err != nil {
+		return nil, err
+	}
+	key, err := f.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := key.Metadata
+	metadata.KeyId = aws.String(keyID)
+	return &kms.DescribeKeyOutput{KeyMetadata: &metadata}, nil
+}
+
+func (f *Fake) ListResourceTags(ctx context.Context, params *kms.ListResourceTagsInput, optFns ...func(*kms.Options)) (*kms.ListResourceTagsOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+	if err := f.call("ListResourceTags", keyID); err != nil {
+		return nil, err
+	}
+	key, err := f.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &kms.ListResourceTagsOutput{}
+	for tagKey, value := range key.Tags {
+		output.Tags = append(output.Tags, types.Tag{TagKey: aws.String(tagKey), TagValue: aws.String(value)})
+	}
+	sort.Slice(output.Tags, func(i, j int) bool { return *output.Tags[i].TagKey < *output.Tags[j].TagKey })
+	return output, nil
+}
+
+func (f *Fake) GetKeyRotationStatus(ctx context.Context, params *kms.GetKeyRotationStatusInput, optFns ...func(*kms.Options)) (*kms.GetKeyRotationStatusOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+	if err := f.call("GetKeyRotationStatus", keyID); err != nil {
+		return nil, err
+	}
+	key, err := f.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &kms.GetKeyRotationStatusOutput{KeyId: aws.String(keyID), KeyRotationEnabled: key.RotationEnabled}
+	if key.RotationEnabled && key.RotationPeriod > 0 {
+		output.RotationPeriodInDays = aws.Int32(key.RotationPeriod)
+	}
+	return output, nil
+}
@@ -0,0 +1,418 @@
+// Package kmsinv lists and describes customer managed KMS keys through a small
+// interface rather than a concrete client, so the inventory can be embedded in
+// other programs and exercised against the in-memory Fake.
+package kmsinv
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"secrets-lister/pkg/awserr"
+	"secrets-lister/pkg/degrade"
+	"secrets-lister/pkg/tagpolicy"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// API is the subset of KMS the inventory calls. *kms.Client satisfies it.
+type API interface {
+	ListKeys(ctx context.Context, params *kms.ListKeysInput, optFns ...func(*kms.Options)) (*kms.ListKeysOutput, error)
+	ListAliases(ctx context.Context, params *kms.ListAliasesInput, optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error)
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+	ListResourceTags(ctx context.Context, params *kms.ListResourceTagsInput, optFns ...func(*kms.Options)) (*kms.ListResourceTagsOutput, error)
+	GetKeyRotationStatus(ctx context.Context, params *kms.GetKeyRotationStatusInput, optFns ...func(*kms.Options)) (*kms.GetKeyRotationStatusOutput, error)
+}
+
+// Status values for keys that could not be described.
+const (
+	NotAuthorized = "Not Authorized"
+	Failed        = "Error"
+)
+
+// Key manager selections for Scope.KeyManager.
+const (
+	ManagerCustomer = "customer"
+	ManagerAWS      = "aws"
+	ManagerAll      = "all"
+)
+
+// ParseKeyManager validates a --key-manager value; empty means customer.
+func ParseKeyManager(value string) (string, error) {
+	switch value {
+	case "":
+		return ManagerCustomer, nil
+	case ManagerCustomer, ManagerAWS, ManagerAll:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid key manager %q (use customer, aws, or all)", value)
+}
+
+// Key is what DescribeKey, ListResourceTags, and GetKeyRotationStatus say
+// about a key.
+type Key struct {
+	KeyID string
+	// Status is the key state, or NotAuthorized or Failed if the key could
+	// not be described
+	Status string
+	// ErrorClass and Error say why DescribeKey failed
+	ErrorClass   awserr.Class
+	Error        string
+	CreationDate time.Time
+	// KeyManager is CUSTOMER or AWS
+	KeyManager string
+	KeyType    string
+	Origin     string
+	// MultiRegion is PRIMARY or REPLICA for multi-Region keys
+	MultiRegion string
+	// PrimaryRegion and ReplicaRegions are set for multi-Region keys
+	PrimaryRegion      string
+	ReplicaRegions     []string
+	RotationStatus     string
+	RotationPeriodDays int32
+	DeletionDate       *time.Time
+	DaysUntilDeletion  *int
+	Tags               map[string]string
+	// TagsErr and RotationErr say why tags or rotation status could not be
+	// read; the rest of the key is still reported
+	TagsErr     error
+	RotationErr error
+}
+
+// ListKeys pages through ListKeys, including AWS managed keys.
+func ListKeys(ctx context.Context, client API) ([]types.KeyListEntry, error) {
+	var allKeys []types.KeyListEntry
+	var marker *string
+
+	for {
+		input := &kms.ListKeysInput{
+			Marker: marker,
+		}
+
+		output, err := client.ListKeys(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		allKeys = append(allKeys, output.Keys...)
+
+		if !output.Truncated {
+			break
+		}
+		marker = output.NextMarker
+	}
+
+	return allKeys, nil
+}
+
+// ListCustomerManaged lists every customer managed key.
+func ListCustomerManaged(ctx context.Context, client API) ([]types.KeyListEntry, error) {
+	keys, err := ListKeys(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return FilterCustomerManaged(ctx, client, keys, 0), nil
+}
+
+// FilterCustomerManaged keeps customer managed keys, stopping once limit keys
+// are found (0 means no limit).
+func FilterCustomerManaged(ctx context.Context, client API, keys []types.KeyListEntry, limit int) []types.KeyListEntry {
+	return FilterKeyManager(ctx, client, keys, ManagerCustomer, limit)
+}
+
+// ManagedBy reports whether manager (ManagerCustomer, ManagerAWS, or
+// ManagerAll) selects a key whose KeyManager is keyManager. Like
+// FilterKeyManager, it keeps keys whose manager is unknown.
+func ManagedBy(keyManager, manager string) bool {
+	switch {
+	case manager == ManagerAll, keyManager == "":
+		return true
+	case manager == ManagerAWS:
+		return keyManager == string(types.KeyManagerTypeAws)
+	}
+	return keyManager == string(types.KeyManagerTypeCustomer)
+}
+
+// FilterKeyManager keeps keys managed by manager (ManagerCustomer, ManagerAWS,
+// or ManagerAll), stopping once limit keys are found (0 means no limit).
+func FilterKeyManager(ctx context.Context, client API, keys []types.KeyListEntry, manager string, limit int) []types.KeyListEntry {
+	if manager == ManagerAll {
+		if limit > 0 && len(keys) > limit {
+			keys = keys[:limit]
+		}
+		return keys
+	}
+	want := types.KeyManagerTypeCustomer
+	if manager == ManagerAWS {
+		want = types.KeyManagerTypeAws
+	}
+
+	var filtered []types.KeyListEntry
+	for _, key := range keys {
+		if limit > 0 && len(filtered) >= limit {
+			break
+		}
+
+		// Check if it's a customer managed key
+		describeInput := &kms.DescribeKeyInput{
+			KeyId: key.KeyId,
+		}
+		describeOutput, err := client.DescribeKey(ctx, describeInput)
+		if err != nil {
+			// If we can't describe it, still include it (might be not authorized)
+			filtered = append(filtered, key)
+			continue
+		}
+
+		if describeOutput.KeyMetadata.KeyManager == want {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+// Scope narrows a scan before any key is described, so a team can scan its
+// own keys in a large shared account.
+type Scope struct {
+	AliasPrefixes []string
+	TagFilters    []tagpolicy.Filter
+	// Limit caps how many keys are returned; with Shuffle they are a random sample
+	Limit   int
+	Shuffle bool
+	// KeyManager selects customer managed (the default), AWS managed, or all keys
+	KeyManager string
+	// Tagged, when not nil, is the keys already known to match TagFilters by
+	// key ID, e.g. from the tagging API; it replaces ListKeys and the per-key
+	// tag check
+	Tagged map[string]map[string]string
+}
+
+// ParseScope parses alias-prefix:<prefix> and tag:Key=Value values.
+func ParseScope(values []string) (Scope, error) {
+	var scope Scope
+	var tagValues []string
+	for _, value := range values {
+		kind, arg, _ := strings.Cut(value, ":")
+		switch {
+		case arg == "":
+			return scope, fmt.Errorf("invalid --scope %q (expected alias-prefix:<prefix> or tag:Key=Value)", value)
+		case kind == "alias-prefix":
+			scope.AliasPrefixes = append(scope.AliasPrefixes, arg)
+		case kind == "tag":
+			tagValues = append(tagValues, arg)
+		default:
+			return scope, fmt.Errorf("unknown --scope kind %q (expected alias-prefix or tag)", kind)
+		}
+	}
+
+	filters, err := tagpolicy.ParseFilters(tagValues)
+	if err != nil {
+		return scope, err
+	}
+	scope.TagFilters = filters
+	return scope, nil
+}
+
+// ListScoped returns the keys in scope managed by scope.KeyManager. Alias
+// scopes are resolved from the alias index without calling ListKeys, and tag
+// scopes only call ListResourceTags, so out-of-scope keys are never described.
+// With scope.Tagged set, neither is called for tags. A key whose tags can't be
+// read is left out of a tag scope and recorded in degraded.
+func ListScoped(ctx context.Context, client API, scope Scope, aliasIndex map[string][]string, degraded *degrade.Tracker) ([]types.KeyListEntry, error) {
+	var keys []types.KeyListEntry
+	if scope.Tagged != nil {
+		var keyIDs []string
+		for keyID := range scope.Tagged {
+			if len(scope.AliasPrefixes) == 0 || hasAliasPrefixes(aliasIndex[keyID], scope.AliasPrefixes) {
+				keyIDs = append(keyIDs, keyID)
+			}
+		}
+		sort.Strings(keyIDs)
+		for _, keyID := range keyIDs {
+			keys = append(keys, types.KeyListEntry{KeyId: aws.String(keyID)})
+		}
+	} else if len(scope.AliasPrefixes) > 0 {
+		var keyIDs []string
+		for keyID, aliases := range aliasIndex {
+			if hasAliasPrefixes(aliases, scope.AliasPrefixes) {
+				keyIDs = append(keyIDs, keyID)
+			}
+		}
+		sort.Strings(keyIDs)
+		for _, keyID := range keyIDs {
+			keys = append(keys, types.KeyListEntry{KeyId: aws.String(keyID)})
+		}
+	} else {
+		var err error
+		keys, err = ListKeys(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(scope.TagFilters) > 0 && scope.Tagged == nil {
+		var tagged []types.KeyListEntry
+		for _, key := range keys {
+			output, err := client.ListResourceTags(ctx, &kms.ListResourceTagsInput{KeyId: key.KeyId})
+			if err != nil {
+				// Tags can't be verified, so the key is out of scope
+				degraded.Record(degrade.Tags, err)
+				continue
+			}
+			tags := make(map[string]string)
+			for _, tag := range output.Tags {
+				tags[aws.ToString(tag.TagKey)] = aws.ToString(tag.TagValue)
+			}
+			if tagpolicy.Match(tags, scope.TagFilters) {
+				tagged = append(tagged, key)
+			}
+		}
+		keys = tagged
+	}
+
+	// Shuffling before the key manager filter lets a sample stop early
+	if scope.Shuffle {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	}
+
+	manager := scope.KeyManager
+	if manager == "" {
+		manager = ManagerCustomer
+	}
+	return FilterKeyManager(ctx, client, keys, manager, scope.Limit), nil
+}
+
+// ManagedService returns the service that created an AWS managed key, from
+// its alias/aws/<service> alias, or "" if it has none.
+func ManagedService(aliases []string) string {
+	for _, alias := range aliases {
+		if service, ok := strings.CutPrefix(alias, "alias/aws/"); ok {
+			return service
+		}
+	}
+	return ""
+}
+
+func hasAliasPrefixes(aliases, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		matched := false
+		for _, alias := range aliases {
+			if strings.HasPrefix(alias, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// AliasesByKey maps key IDs to their sorted alias names. On error the aliases
+// read so far are returned.
+func AliasesByKey(ctx context.Context, client API) (map[string][]string, error) {
+	aliases, err := listAliases(ctx, client)
+	return aliasIndex(aliases), err
+}
+
+// Describe reads a key's metadata, tags, and rotation status. Errors are
+// reported in Status rather than returned so one bad key doesn't stop a scan.
+func Describe(ctx context.Context, client API, keyID string) Key {
+	info := Key{
+		KeyID: keyID,
+		Tags:  make(map[string]string),
+	}
+
+	// Get key metadata
+	describeInput := &kms.DescribeKeyInput{
+		KeyId: &keyID,
+	}
+
+	describeOutput, err := client.DescribeKey(ctx, describeInput)
+	if err != nil {
+		info.ErrorClass = awserr.Classify(err)
+		info.Error = err.Error()
+		if info.ErrorClass == awserr.NotAuthorized {
+			info.Status = NotAuthorized
+		} else {
+			info.Status = Failed
+		}
+		return info
+	}
+
+	// Set status
+	info.Status = string(describeOutput.KeyMetadata.KeyState)
+
+	// Set creation date
+	if describeOutput.KeyMetadata.CreationDate != nil {
+		info.CreationDate = *describeOutput.KeyMetadata.CreationDate
+	}
+
+	info.KeyManager = string(describeOutput.KeyMetadata.KeyManager)
+
+	// Set key type (spec)
+	info.KeyType = string(describeOutput.KeyMetadata.KeySpec)
+	info.Origin = string(describeOutput.KeyMetadata.Origin)
+	if config := describeOutput.KeyMetadata.MultiRegionConfiguration; config != nil {
+		info.MultiRegion = string(config.MultiRegionKeyType)
+		if config.PrimaryKey != nil {
+			info.PrimaryRegion = aws.ToString(config.PrimaryKey.Region)
+		}
+		for _, replica := range config.ReplicaKeys {
+			info.ReplicaRegions = append(info.ReplicaRegions, aws.ToString(replica.Region))
+		}
+		sort.Strings(info.ReplicaRegions)
+	}
+
+	// Set deletion date for keys scheduled for deletion
+	if describeOutput.KeyMetadata.DeletionDate != nil {
+		deletionDate := *describeOutput.KeyMetadata.DeletionDate
+		daysLeft := int(time.Until(deletionDate).Hours() / 24)
+		info.DeletionDate = &deletionDate
+		info.DaysUntilDeletion = &daysLeft
+	}
+
+	// Get tags (all states, so tag filters also apply to keys pending deletion)
+	tagsInput := &kms.ListResourceTagsInput{
+		KeyId: &keyID,
+	}
+
+	tagsOutput, err := client.ListResourceTags(ctx, tagsInput)
+	if err != nil {
+		info.TagsErr = err
+	} else {
+		for _, tag := range tagsOutput.Tags {
+			info.Tags[*tag.TagKey] = *tag.TagValue
+		}
+	}
+
+	// Only check rotation if the key is enabled
+	if describeOutput.KeyMetadata.KeyState == types.KeyStateEnabled {
+		// Automatic rotation only applies to symmetric keys with KMS-generated key material
+		info.RotationStatus = "Unsupported"
+		if describeOutput.KeyMetadata.KeySpec == types.KeySpecSymmetricDefault &&
+			describeOutput.KeyMetadata.Origin == types.OriginTypeAwsKms {
+			rotationOutput, err := client.GetKeyRotationStatus(ctx, &kms.GetKeyRotationStatusInput{
+				KeyId: &keyID,
+			})
+			if err != nil {
+				info.RotationStatus = "Unknown"
+				info.RotationErr = err
+			} else if rotationOutput.KeyRotationEnabled {
+				info.RotationStatus = "Enabled"
+				if rotationOutput.RotationPeriodInDays != nil {
+					info.RotationPeriodDays = *rotationOutput.RotationPeriodInDays
+				}
+			} else {
+				info.RotationStatus = "Disabled"
+			}
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,368 @@
+package kmsinv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"secrets-lister/pkg/awserr"
+	"secrets-lister/pkg/degrade"
+	"secrets-lister/pkg/tagpolicy"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+)
+
+var errBoom = errors.New("boom")
+
+func customerKey(tags map[string]string, aliases ...string) *FakeKey {
+	return &FakeKey{
+		Metadata: types.KeyMetadata{
+			KeyManager: types.KeyManagerTypeCustomer,
+			KeyState:   types.KeyStateEnabled,
+			KeySpec:    types.KeySpecSymmetricDefault,
+			Origin:     types.OriginTypeAwsKms,
+		},
+		Tags:    tags,
+		Aliases: aliases,
+	}
+}
+
+func awsKey(aliases ...string) *FakeKey {
+	key := customerKey(nil, aliases...)
+	key.Metadata.KeyManager = types.KeyManagerTypeAws
+	return key
+}
+
+func fakeWith(pageSize int, keys map[string]*FakeKey) *Fake {
+	return &Fake{Keys: keys, PageSize: pageSize}
+}
+
+func keyIDs(keys []types.KeyListEntry) []string {
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, aws.ToString(key.KeyId))
+	}
+	return ids
+}
+
+func TestListKeys(t *testing.T) {
+	keys := map[string]*FakeKey{}
+	for i := 0; i < 5; i++ {
+		keys[fmt.Sprintf("key-%d", i)] = customerKey(nil)
+	}
+
+	tests := []struct {
+		name      string
+		pageSize  int
+		errors    map[string]error
+		wantIDs   []string
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "one page", pageSize: 10, wantIDs: []string{"key-0", "key-1", "key-2", "key-3", "key-4"}, wantCalls: 1},
+		{name: "several pages", pageSize: 2, wantIDs: []string{"key-0", "key-1", "key-2", "key-3", "key-4"}, wantCalls: 3},
+		{name: "exact pages", pageSize: 5, wantIDs: []string{"key-0", "key-1", "key-2", "key-3", "key-4"}, wantCalls: 1},
+		{name: "second page fails", pageSize: 2, errors: map[string]error{"ListKeys": errBoom}, wantCalls: 2, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := fakeWith(tc.pageSize, keys)
+			fake.Errors = tc.errors
+
+			got, err := ListKeys(context.Background(), fake)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(keyIDs(got), tc.wantIDs) {
+				t.Errorf("keys = %v, want %v", keyIDs(got), tc.wantIDs)
+			}
+			if fake.Calls["ListKeys"] != tc.wantCalls {
+				t.Errorf("ListKeys calls = %d, want %d", fake.Calls["ListKeys"], tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestListScoped(t *testing.T) {
+	keys := map[string]*FakeKey{
+		"app":      customerKey(map[string]string{"Team": "payments"}, "alias/app"),
+		"app-old":  customerKey(map[string]string{"Team": "payments", "Env": "old"}, "alias/app-old"),
+		"data":     customerKey(map[string]string{"Team": "data"}, "alias/data"),
+		"untagged": customerKey(nil),
+		"managed":  awsKey("alias/aws/s3"),
+	}
+
+	tests := []struct {
+		name   string
+		scope  Scope
+		errors map[string]error
+		want   []string
+		// wantUnknown is how many keys' tags couldn't be checked
+		wantUnknown int
+		wantErr     bool
+	}{
+		{name: "customer keys by default", want: []string{"app", "app-old", "data", "untagged"}},
+		{name: "AWS managed keys", scope: Scope{KeyManager: ManagerAWS}, want: []string{"managed"}},
+		{name: "all keys", scope: Scope{KeyManager: ManagerAll}, want: []string{"app", "app-old", "data", "managed", "untagged"}},
+		{name: "alias prefix", scope: Scope{AliasPrefixes: []string{"alias/app"}}, want: []string{"app", "app-old"}},
+		{name: "tag", scope: Scope{TagFilters: []tagpolicy.Filter{{Key: "Team", Value: "payments", HasValue: true}}}, want: []string{"app", "app-old"}},
+		{name: "alias prefix and tag", scope: Scope{AliasPrefixes: []string{"alias/app"}, TagFilters: []tagpolicy.Filter{{Key: "Env"}}}, want: []string{"app-old"}},
+		{name: "tagged from the tagging API", scope: Scope{Tagged: map[string]map[string]string{"data": {"Team": "data"}}}, want: []string{"data"}},
+		{name: "limit", scope: Scope{Limit: 2}, want: []string{"app", "app-old"}},
+		{name: "undescribable key is kept", errors: map[string]error{"DescribeKey:managed": AccessDenied("DescribeKey", "managed")}, want: []string{"app", "app-old", "data", "managed", "untagged"}},
+		{name: "key whose tags can't be read is out of tag scope", scope: Scope{TagFilters: []tagpolicy.Filter{{Key: "Team"}}}, errors: map[string]error{"ListResourceTags:data": AccessDenied("ListResourceTags", "data")}, want: []string{"app", "app-old"}, wantUnknown: 1},
+		{name: "listing fails", errors: map[string]error{"ListKeys": errBoom}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := fakeWith(2, keys)
+			fake.Errors = tc.errors
+			aliases, err := AliasesByKey(context.Background(), fake)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			degraded := degrade.NewTracker()
+			got, err := ListScoped(context.Background(), fake, tc.scope, aliases, degraded)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tc.wantErr)
+			}
+			unknown := 0
+			for _, d := range degraded.Degraded() {
+				if d.Feature == degrade.Tags {
+					unknown = d.Count
+				}
+			}
+			if unknown != tc.wantUnknown {
+				t.Errorf("keys with unknown tags = %d, want %d", unknown, tc.wantUnknown)
+			}
+			ids := keyIDs(got)
+			sort.Strings(ids)
+			if !tc.wantErr && !reflect.DeepEqual(ids, tc.want) {
+				t.Errorf("keys = %v, want %v", ids, tc.want)
+			}
+		})
+	}
+}
+
+func TestListScopedAliasScopeSkipsListKeys(t *testing.T) {
+	fake := fakeWith(2, map[string]*FakeKey{"app": customerKey(nil, "alias/app"), "other": customerKey(nil)})
+	aliases, _ := AliasesByKey(context.Background(), fake)
+	if _, err := ListScoped(context.Background(), fake, Scope{AliasPrefixes: []string{"alias/app"}}, aliases, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Calls["ListKeys"] != 0 || fake.Calls["DescribeKey"] != 1 {
+		t.Errorf("calls = %v, want only the in-scope key described", fake.Calls)
+	}
+}
+
+func TestAliasesByKey(t *testing.T) {
+	keys := map[string]*FakeKey{
+		"a": customerKey(nil, "alias/z", "alias/a"),
+		"b": customerKey(nil, "alias/b"),
+		"c": customerKey(nil, "alias/c"),
+	}
+
+	got, err := AliasesByKey(context.Background(), fakeWith(2, keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"a": {"alias/a", "alias/z"}, "b": {"alias/b"}, "c": {"alias/c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("aliases = %v, want %v", got, want)
+	}
+
+	// A failure after the first page returns what was read so far
+	fake := fakeWith(2, keys)
+	fake.Errors = map[string]error{"ListAliases": errBoom}
+	got, err = AliasesByKey(context.Background(), fake)
+	if !errors.Is(err, errBoom) {
+		t.Errorf("err = %v, want %v", err, errBoom)
+	}
+	if !reflect.DeepEqual(got, map[string][]string{"a": {"alias/a", "alias/z"}}) {
+		t.Errorf("partial aliases = %v, want the first page", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	deletion := time.Now().Add(72 * time.Hour)
+	pending := customerKey(nil)
+	pending.Metadata.KeyState = types.KeyStatePendingDeletion
+	pending.Metadata.DeletionDate = &deletion
+	rotated := customerKey(map[string]string{"Team": "payments"})
+	rotated.RotationEnabled = true
+	rotated.RotationPeriod = 90
+	asymmetric := customerKey(nil)
+	asymmetric.Metadata.KeySpec = types.KeySpecRsa2048
+	replica := customerKey(nil)
+	replica.Metadata.MultiRegionConfiguration = &types.MultiRegionConfiguration{
+		MultiRegionKeyType: types.MultiRegionKeyTypePrimary,
+		PrimaryKey:         &types.MultiRegionKey{Region: aws.String("us-east-1")},
+		ReplicaKeys:        []types.MultiRegionKey{{Region: aws.String("eu-west-1")}, {Region: aws.String("ap-south-1")}},
+	}
+
+	fake := fakeWith(2, map[string]*FakeKey{
+		"pending": pending, "rotated": rotated, "disabled": customerKey(nil),
+		"asymmetric": asymmetric, "replica": replica, "denied": customerKey(nil),
+		"broken": customerKey(nil), "no-tags": customerKey(nil), "no-rotation": customerKey(nil),
+	})
+	fake.Errors = map[string]error{
+		"DescribeKey:denied":               AccessDenied("DescribeKey", "denied"),
+		"DescribeKey:broken":               &smithy.GenericAPIError{Code: "KMSInternalException"},
+		"ListResourceTags:no-tags":         AccessDenied("ListResourceTags", "no-tags"),
+		"GetKeyRotationStatus:no-rotation": AccessDenied("GetKeyRotationStatus", "no-rotation"),
+	}
+	fake.Keys["disabled"].Metadata.KeyState = types.KeyStateDisabled
+
+	tests := []struct {
+		keyID string
+		check func(t *testing.T, key Key)
+	}{
+		{"rotated", func(t *testing.T, key Key) {
+			if key.Status != "Enabled" || key.RotationStatus != "Enabled" || key.RotationPeriodDays != 90 || key.Tags["Team"] != "payments" {
+				t.Errorf("key = %+v", key)
+			}
+		}},
+		{"pending", func(t *testing.T, key Key) {
+			if key.Status != "PendingDeletion" || key.DeletionDate == nil || key.DaysUntilDeletion == nil || *key.DaysUntilDeletion != 2 || key.RotationStatus != "" {
+				t.Errorf("key = %+v", key)
+			}
+		}},
+		{"disabled", func(t *testing.T, key Key) {
+			if key.Status != "Disabled" || key.RotationStatus != "" {
+				t.Errorf("key = %+v, want no rotation check", key)
+			}
+		}},
+		{"asymmetric", func(t *testing.T, key Key) {
+			if key.RotationStatus != "Unsupported" {
+				t.Errorf("rotation = %q, want Unsupported", key.RotationStatus)
+			}
+		}},
+		{"replica", func(t *testing.T, key Key) {
+			if key.MultiRegion != "PRIMARY" || key.PrimaryRegion != "us-east-1" || !reflect.DeepEqual(key.ReplicaRegions, []string{"ap-south-1", "eu-west-1"}) {
+				t.Errorf("key = %+v", key)
+			}
+		}},
+		{"denied", func(t *testing.T, key Key) {
+			if key.Status != NotAuthorized || key.ErrorClass != awserr.NotAuthorized {
+				t.Errorf("key = %+v, want %s", key, NotAuthorized)
+			}
+		}},
+		{"broken", func(t *testing.T, key Key) {
+			if key.Status != Failed || key.Error == "" {
+				t.Errorf("key = %+v, want %s", key, Failed)
+			}
+		}},
+		{"no-tags", func(t *testing.T, key Key) {
+			if key.Status != "Enabled" || key.TagsErr == nil {
+				t.Errorf("key = %+v, want TagsErr and the rest described", key)
+			}
+		}},
+		{"no-rotation", func(t *testing.T, key Key) {
+			if key.RotationStatus != "Unknown" || key.RotationErr == nil {
+				t.Errorf("key = %+v, want rotation Unknown", key)
+			}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.keyID, func(t *testing.T) {
+			tc.check(t, Describe(context.Background(), fake, tc.keyID))
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	fake := fakeWith(2, map[string]*FakeKey{"a": customerKey(map[string]string{"Team": "x"}), "denied": customerKey(nil), "flaky": customerKey(nil)})
+	fake.Errors = map[string]error{
+		"DescribeKey:denied": AccessDenied("DescribeKey", "denied"),
+		"DescribeKey:flaky":  &smithy.GenericAPIError{Code: "ThrottlingException"},
+	}
+	cache := NewCache(fake)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		Describe(ctx, cache, "a")
+		Describe(ctx, cache, "denied")
+		Describe(ctx, cache, "flaky")
+	}
+	// a and denied are described once; throttling is retried on the next call
+	if fake.Calls["DescribeKey"] != 4 {
+		t.Errorf("DescribeKey calls = %d, want 4", fake.Calls["DescribeKey"])
+	}
+	if fake.Calls["ListResourceTags"] != 1 {
+		t.Errorf("ListResourceTags calls = %d, want 1", fake.Calls["ListResourceTags"])
+	}
+
+	cache.SeedTags(map[string]map[string]string{"flaky": {"Team": "y"}})
+	delete(fake.Errors, "DescribeKey:flaky")
+	if key := Describe(ctx, cache, "flaky"); key.Tags["Team"] != "y" {
+		t.Errorf("tags = %v, want the seeded tags", key.Tags)
+	}
+	if fake.Calls["ListResourceTags"] != 1 {
+		t.Errorf("ListResourceTags calls = %d, want seeded tags used", fake.Calls["ListResourceTags"])
+	}
+}
+
+func TestResolver(t *testing.T) {
+	fake := fakeWith(2, map[string]*FakeKey{"a": customerKey(nil, "alias/a"), "b": customerKey(nil, "alias/b")})
+	fake.Keys["a"].Metadata.Arn = aws.String("arn:aws:kms:us-east-1:111122223333:key/a")
+	resolver := NewResolver(fake)
+	ctx := context.Background()
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "a", want: "a"},
+		{ref: "arn:aws:kms:us-east-1:111122223333:key/b", want: "arn:aws:kms:us-east-1:111122223333:key/b"},
+		{ref: "alias/b", want: "b"},
+		{ref: "alias/missing", wantErr: ErrAliasNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			got, err := resolver.Resolve(ctx, tc.ref)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tc.ref, got, tc.want)
+			}
+		})
+	}
+	if fake.Calls["ListAliases"] != 1 {
+		t.Errorf("ListAliases calls = %d, want one pass shared by every Resolve", fake.Calls["ListAliases"])
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		values  []string
+		want    Scope
+		wantErr bool
+	}{
+		{values: nil, want: Scope{}},
+		{values: []string{"alias-prefix:alias/app-", "tag:Team=payments"}, want: Scope{
+			AliasPrefixes: []string{"alias/app-"},
+			TagFilters:    []tagpolicy.Filter{{Key: "Team", Value: "payments", HasValue: true}},
+		}},
+		{values: []string{"alias-prefix:"}, wantErr: true},
+		{values: []string{"region:us-east-1"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseScope(tc.values)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseScope(%v) err = %v, want error: %v", tc.values, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseScope(%v) = %+v, want %+v", tc.values, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package kmsinv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"secrets-lister/pkg/awserr"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Resolver turns the key references people type (key IDs, key ARNs, alias
+// names, and alias ARNs) into something every KMS call accepts. Several calls,
+// GetKeyPolicy and ListGrants among them, take only key IDs and ARNs. Aliases
+// are looked up in one ListAliases pass, made the first time one is resolved
+// and shared with AliasesByKey, so resolving many costs no more than one.
+type Resolver struct {
+	client API
+
+	mu      sync.Mutex
+	loaded  bool
+	targets map[string]string
+	byKey   map[string][]string
+	err     error
+}
+
+func NewResolver(client API) *Resolver {
+	return &Resolver{client: client}
+}
+
+// ErrAliasNotFound is returned by Resolve for an alias that doesn't exist.
+var ErrAliasNotFound = errors.New("alias not found")
+
+// IsAlias reports whether ref names an alias rather than a key.
+func IsAlias(ref string) bool {
+	return strings.HasPrefix(ref, "alias/") || (strings.HasPrefix(ref, "arn:") && strings.Contains(ref, ":alias/"))
+}
+
+// Resolve returns ref unchanged if it is a key ID or key ARN, and the target
+// key ID if it is an alias. An alias missing from the index, such as one in
+// another account or when ListAliases is denied, is resolved with DescribeKey
+// and returned as the key ARN.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	if !IsAlias(ref) {
+		return ref, nil
+	}
+
+	r.load(ctx)
+	r.mu.Lock()
+	keyID, ok := r.targets[ref]
+	r.mu.Unlock()
+	if ok {
+		return keyID, nil
+	}
+
+	output, err := r.client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(ref)})
+	if err != nil {
+		if awserr.Classify(err) == awserr.NotFound {
+			return "", fmt.Errorf("%w: %s", ErrAliasNotFound, ref)
+		}
+		return "", fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	return aws.ToString(output.KeyMetadata.Arn), nil
+}
+
+// ResolveAll resolves every ref, stopping at the first that fails.
+func (r *Resolver) ResolveAll(ctx context.Context, refs []string) ([]string, error) {
+	resolved := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		keyID, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, keyID)
+	}
+	return resolved, nil
+}
+
+// AliasesByKey is the package-level AliasesByKey, from the pass Resolve uses.
+func (r *Resolver) AliasesByKey(ctx context.Context) (map[string][]string, error) {
+	r.load(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byKey, r.err
+}
+
+func (r *Resolver) load(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loaded {
+		return
+	}
+	r.loaded = true
+
+	aliases, err := listAliases(ctx, r.client)
+	r.err = err
+	r.targets = make(map[string]string, 2*len(aliases))
+	r.byKey = aliasIndex(aliases)
+	for _, alias := range aliases {
+		r.targets[*alias.AliasName] = *alias.TargetKeyId
+		if alias.AliasArn != nil {
+			r.targets[*alias.AliasArn] = *alias.TargetKeyId
+		}
+	}
+}
+
+// listAliases returns the aliases that point at a key. On error the aliases
+// read so far are returned.
+func listAliases(ctx context.Context, client API) ([]types.AliasListEntry, error) {
+	var aliases []types.AliasListEntry
+	var marker *string
+
+	for {
+		output, err := client.ListAliases(ctx, &kms.ListAliasesInput{
+			Marker: marker,
+		})
+		if err != nil {
+			return aliases, err
+		}
+
+		for _, alias := range output.Aliases {
+			// Aliases not pointing at a key (e.g. unused AWS managed aliases) are skipped
+			if alias.TargetKeyId == nil || alias.AliasName == nil {
+				continue
+			}
+			aliases = append(aliases, alias)
+		}
+
+		if !output.Truncated {
+			return aliases, nil
+		}
+		marker = output.NextMarker
+	}
+}
+
+func aliasIndex(aliases []types.AliasListEntry) map[string][]string {
+	index := make(map[string][]string)
+	for _, alias := range aliases {
+		index[*alias.TargetKeyId] = append(index[*alias.TargetKeyId], *alias.AliasName)
+	}
+	for keyID := range index {
+		sort.Strings(index[keyID])
+	}
+	return index
+}
@@ -0,0 +1,101 @@
+// Package logging sets up the structured (slog) log both tools write to
+// stderr, and an SDK middleware that logs the outcome of every AWS API call,
+// so a long or failing run can be diagnosed after the fact.
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"secrets-lister/pkg/awserr"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Off disables logging, the default so stderr keeps its usual output.
+const Off = "off"
+
+type Options struct {
+	// Level is debug, info, warn, error, or off
+	Level string
+	// Format is text or json
+	Format string
+}
+
+func Defaults() Options {
+	return Options{Level: Off, Format: "text"}
+}
+
+// RegisterFlags adds --log-level and --log-format to fs, with o's values as
+// defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Level, "log-level", o.Level, "Log to stderr at this level: debug (every AWS API call), info, warn (failed API calls), error, or off")
+	fs.StringVar(&o.Format, "log-format", o.Format, "Log format: text or json (one object per line)")
+}
+
+func (o Options) Enabled() bool {
+	return o.Level != Off
+}
+
+// Logger returns a logger writing to w, discarding everything when logging
+// is off.
+func (o Options) Logger(w io.Writer) (*slog.Logger, error) {
+	level := slog.Level(math.MaxInt32)
+	if o.Enabled() {
+		if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+			return nil, fmt.Errorf("invalid --log-level %q (use debug, info, warn, error, or off)", o.Level)
+		}
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(o.Format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, handlerOptions)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, handlerOptions)), nil
+	}
+	return nil, fmt.Errorf("invalid --log-format %q (use text or json)", o.Format)
+}
+
+// Middleware logs each API call once it has finished, retries included:
+// successes at debug and failures at warn, with the error class, so a
+// denied or throttled call can be traced to its service, operation, region,
+// and request ID.
+func Middleware(logger *slog.Logger) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		// After the SDK's own initialize middleware, which records the
+		// service, operation, and region in the context
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LogAPICall", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			attrs := []slog.Attr{
+				slog.String("service", awsmiddleware.GetServiceID(ctx)),
+				slog.String("operation", awsmiddleware.GetOperationName(ctx)),
+				slog.String("region", awsmiddleware.GetRegion(ctx)),
+				slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			}
+			if results, ok := retry.GetAttemptResults(metadata); ok {
+				attrs = append(attrs, slog.Int("attempts", len(results.Results)))
+			}
+			if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+				attrs = append(attrs, slog.String("request_id", requestID))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("class", string(awserr.Classify(err))), slog.String("error", err.Error()))
+				logger.LogAttrs(ctx, slog.LevelWarn, "api call failed", attrs...)
+			} else {
+				logger.LogAttrs(ctx, slog.LevelDebug, "api call", attrs...)
+			}
+			return out, metadata, err
+		}), middleware.After)
+	}
+}
@@ -0,0 +1,124 @@
+// Package manifest records what a run did — who ran it, where, what it found,
+// what went wrong, and which files it wrote — so downstream pipelines can
+// check a run is complete before ingesting its output.
+package manifest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"secrets-lister/pkg/identity"
+	"secrets-lister/pkg/version"
+)
+
+type Artifact struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type Manifest struct {
+	RunID      string           `json:"run_id"`
+	Tool       string           `json:"tool"`
+	Version    version.Info     `json:"version"`
+	Args       []string         `json:"args"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Caller     *identity.Caller `json:"caller,omitempty"`
+	Regions    []string         `json:"regions"`
+	Counts     map[string]int   `json:"counts"`
+	Errors     []string         `json:"errors"`
+	Artifacts  []Artifact       `json:"artifacts"`
+	ExitCode   int              `json:"exit_code"`
+
+	// mu guards Errors, which regions exported in parallel warn into
+	mu sync.Mutex
+}
+
+// New starts a manifest for this process.
+func New(tool string) *Manifest {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &Manifest{
+		RunID:     hex.EncodeToString(id),
+		Tool:      tool,
+		Version:   version.Get(),
+		Args:      os.Args[1:],
+		StartedAt: time.Now().UTC(),
+		Counts:    make(map[string]int),
+		Errors:    []string{},
+		Artifacts: []Artifact{},
+	}
+}
+
+// Warnf prints a warning to stderr and records it in the manifest. It is
+// safe for concurrent use.
+func (m *Manifest) Warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+	m.Errors = append(m.Errors, message)
+}
+
+// AddFile hashes a local file the run wrote.
+func (m *Manifest) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	m.Artifacts = append(m.Artifacts, Artifact{Path: path, SHA256: hex.EncodeToString(h.Sum(nil)), Bytes: n})
+	return nil
+}
+
+// HashingWriter hashes everything written through it, for artifacts that are
+// streamed somewhere they can't be read back from cheaply (e.g. S3).
+type HashingWriter struct {
+	w     io.Writer
+	h     hash.Hash
+	bytes int64
+}
+
+func NewHashingWriter(w io.Writer) *HashingWriter {
+	return &HashingWriter{w: w, h: sha256.New()}
+}
+
+func (hw *HashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	hw.bytes += int64(n)
+	return n, err
+}
+
+// AddStream records an artifact hashed by a HashingWriter.
+func (m *Manifest) AddStream(path string, hw *HashingWriter) {
+	m.Artifacts = append(m.Artifacts, Artifact{Path: path, SHA256: hex.EncodeToString(hw.h.Sum(nil)), Bytes: hw.bytes})
+}
+
+// Write finishes the manifest with the exit code and writes it as JSON.
+func (m *Manifest) Write(path string, exitCode int) error {
+	m.FinishedAt = time.Now().UTC()
+	m.ExitCode = exitCode
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,57 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+// FuzzManifest checks that whatever a run records (warnings quote AWS error
+// messages, artifact paths come from flags) reads back unchanged, since
+// pipelines parse the manifest to decide whether to ingest a run.
+func FuzzManifest(f *testing.F) {
+	f.Add("us-east-1", "listing keys: AccessDeniedException: \"kms:ListKeys\"", "s3://bucket/keys.json", "keys", 3, 2)
+	f.Add("", "\x00\n\t<>&", "out/секреты.parquet", "", -1, 0)
+	f.Fuzz(func(t *testing.T, region, warning, path, count string, n, exitCode int) {
+		m := New("kms-keys")
+		m.Regions = append(m.Regions, region)
+		m.Errors = append(m.Errors, warning)
+		m.Counts[count] = n
+		m.AddStream(path, NewHashingWriter(nil))
+
+		out := filepath.Join(t.TempDir(), "run.json")
+		if err := m.Write(out, exitCode); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Manifest
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("reading back %s: %v", data, err)
+		}
+
+		if got.RunID != m.RunID || got.ExitCode != exitCode || len(got.Counts) != 1 || len(got.Artifacts) != 1 {
+			t.Fatalf("read back %+v, want %+v", &got, m)
+		}
+		// encoding/json replaces invalid UTF-8, so only valid strings survive
+		if valid(region, warning, path, count) {
+			if got.Counts[count] != n || !reflect.DeepEqual(got.Regions, m.Regions) || !reflect.DeepEqual(got.Errors, m.Errors) || got.Artifacts[0].Path != path {
+				t.Fatalf("read back %+v, want %+v", &got, m)
+			}
+		}
+	})
+}
+
+func valid(values ...string) bool {
+	for _, value := range values {
+		if !utf8.ValidString(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+// Package metrics serves inventory metrics in the Prometheus text exposition
+// format. Each scan replaces the whole set, so a resource that disappears
+// takes its series with it; there is no client library state to reset.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Type string
+
+const (
+	Gauge   Type = "gauge"
+	Counter Type = "counter"
+)
+
+// Family is one metric name with its help text and samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Add appends a sample, returning f for chaining.
+func (f *Family) Add(value float64, labels ...string) *Family {
+	sample := Sample{Value: value}
+	if len(labels) > 0 {
+		sample.Labels = make(map[string]string)
+		for i := 0; i+1 < len(labels); i += 2 {
+			sample.Labels[labels[i]] = labels[i+1]
+		}
+	}
+	f.Samples = append(f.Samples, sample)
+	return f
+}
+
+// Write renders families in the text exposition format, samples sorted by
+// labels so output is stable between scrapes.
+func Write(w io.Writer, families []*Family) error {
+	for _, family := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, escapeHelp(family.Help), family.Name, family.Type); err != nil {
+			return err
+		}
+		lines := make([]string, 0, len(family.Samples))
+		for _, sample := range family.Samples {
+			lines = append(lines, family.Name+formatLabels(sample.Labels)+" "+strconv.FormatFloat(sample.Value, 'g', -1, 64))
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// Server holds the latest families and serves them on /metrics.
+type Server struct {
+	mu       sync.RWMutex
+	families []*Family
+}
+
+// Set replaces everything served.
+func (s *Server) Set(families []*Family) {
+	s.mu.Lock()
+	s.families = families
+	s.mu.Unlock()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	families := s.families
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w, families)
+}
@@ -0,0 +1,71 @@
+// Package output resolves export destinations: local paths or s3:// URIs with
+// {date} and {region} partition placeholders.
+package output
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// partSize is the multipart chunk size; objects smaller than this are sent
+// with a single PutObject.
+const partSize = 16 * 1024 * 1024
+
+// Expand fills in the {date} (YYYY-MM-DD, UTC) and {region} placeholders, e.g.
+// s3://lake/secrets/dt={date}/region={region}/secrets.parquet.
+func Expand(path string, now time.Time, region string) string {
+	return strings.NewReplacer(
+		"{date}", now.UTC().Format("2006-01-02"),
+		"{region}", region,
+	).Replace(path)
+}
+
+func IsS3(path string) bool {
+	return strings.HasPrefix(path, "s3://")
+}
+
+// ParseS3 splits s3://bucket/key into its bucket and key.
+func ParseS3(uri string) (string, string, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("invalid S3 URI %q (expected s3://bucket/key)", uri)
+	}
+	return bucket, key, nil
+}
+
+// StreamToS3 uploads whatever write produces to uri without buffering the whole
+// object locally; large outputs are sent as a multipart upload.
+func StreamToS3(ctx context.Context, client *s3.Client, uri, contentType string, write func(io.Writer) error) error {
+	bucket, key, err := ParseS3(uri)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+	})
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        pr,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		// Unblock the writer if the upload gave up early
+		pr.CloseWithError(err)
+		return fmt.Errorf("failed to upload to %s: %w", uri, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Package pricing estimates KMS key costs from a built-in price table
+// (us-east-1 list prices), so estimates work without Pricing API access.
+package pricing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// KeyMonthly is charged for every customer managed key that is not pending
+	// deletion, including each multi-Region replica and keys in custom key stores.
+	KeyMonthly = 1.00
+	// RotationMonthly is added for each of the first two rotations of a key;
+	// later rotations are free.
+	RotationMonthly = 1.00
+	// maxBilledRotations caps the rotation surcharge.
+	maxBilledRotations = 2
+)
+
+// Key is what the estimate depends on.
+type Key struct {
+	State string
+	// Origin is AWS_KMS, EXTERNAL, AWS_CLOUDHSM, or EXTERNAL_KEY_STORE.
+	Origin      string
+	MultiRegion string
+	Rotations   int
+}
+
+// MonthlyCost returns the estimated monthly cost in USD and a short
+// description of how it was derived. Request charges are not included, and
+// CloudHSM cluster charges for custom key stores are billed separately.
+func MonthlyCost(k Key) (float64, string) {
+	if k.State == "PendingDeletion" || k.State == "PendingReplicaDeletion" {
+		return 0, "pending deletion"
+	}
+
+	var basis []string
+	switch k.Origin {
+	case "AWS_CLOUDHSM":
+		basis = append(basis, "CloudHSM key store")
+	case "EXTERNAL_KEY_STORE":
+		basis = append(basis, "external key store")
+	case "EXTERNAL":
+		basis = append(basis, "imported")
+	default:
+		basis = append(basis, "standard")
+	}
+	if k.MultiRegion == "REPLICA" {
+		basis = append(basis, "replica")
+	}
+
+	cost := KeyMonthly
+	if rotations := min(k.Rotations, maxBilledRotations); rotations > 0 {
+		cost += float64(rotations) * RotationMonthly
+		basis = append(basis, fmt.Sprintf("%d rotation(s)", rotations))
+	}
+	return cost, strings.Join(basis, ", ")
+}
+
+// Subtotal is the estimated cost of all keys sharing one tag value.
+type Subtotal struct {
+	Value string
+	Keys  int
+	Cost  float64
+}
+
+// ByTag totals costs by the value of tagKey; untagged keys are grouped under
+// "(untagged)". Results are ordered by cost, highest first.
+func ByTag(tags []map[string]string, costs []float64, tagKey string) []Subtotal {
+	totals := make(map[string]*Subtotal)
+	for i, keyTags := range tags {
+		value, ok := keyTags[tagKey]
+		if !ok {
+			value = "(untagged)"
+		}
+		if totals[value] == nil {
+			totals[value] = &Subtotal{Value: value}
+		}
+		totals[value].Keys++
+		totals[value].Cost += costs[i]
+	}
+
+	var result []Subtotal
+	for _, subtotal := range totals {
+		result = append(result, *subtotal)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cost != result[j].Cost {
+			return result[i].Cost > result[j].Cost
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
@@ -0,0 +1,106 @@
+// Package progress draws a one-line progress indicator on stderr while a
+// long scan runs, so hundreds of keys don't pass in silence.
+package progress
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Modes for --progress.
+const (
+	Auto = "auto"
+	On   = "on"
+	Off  = "off"
+)
+
+// RegisterFlag adds --progress to fs.
+func RegisterFlag(fs *flag.FlagSet) *string {
+	return fs.String("progress", Auto, "Show scan progress on stderr: auto (when stderr is a terminal and --log-level is off), on, or off")
+}
+
+// Validate checks a --progress value.
+func Validate(mode string) error {
+	if mode != Auto && mode != On && mode != Off {
+		return fmt.Errorf("invalid --progress value %q (use auto, on, or off)", mode)
+	}
+	return nil
+}
+
+// interval limits redraws, which otherwise dominate the cost of a fast scan.
+const interval = 100 * time.Millisecond
+
+// Bar is the progress line. It is safe for concurrent use, and a nil Bar
+// draws nothing.
+type Bar struct {
+	mu    sync.Mutex
+	w     io.Writer
+	label string
+	done  int
+	total int
+	unit  string
+	drawn time.Time
+}
+
+// New returns a Bar drawing on stderr, or nil if mode and the environment
+// say not to draw. Log lines would interleave with the bar, so auto stays off
+// while logging is.
+func New(mode string, logging bool) *Bar {
+	switch mode {
+	case Off:
+		return nil
+	case Auto:
+		if logging {
+			return nil
+		}
+		if stat, err := os.Stderr.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+			return nil
+		}
+	}
+	return &Bar{w: os.Stderr}
+}
+
+// Start begins a stage of total units, e.g. the keys of one region, labelled
+// with where the scan is.
+func (b *Bar) Start(label string, total int, unit string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.label, b.done, b.total, b.unit = label, 0, total, unit
+	b.draw()
+}
+
+// Add records n more units done, redrawing at most every interval and always
+// on the last one.
+func (b *Bar) Add(n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done += n
+	if b.done >= b.total || time.Since(b.drawn) >= interval {
+		b.draw()
+	}
+}
+
+// Clear erases the line, before the results are printed.
+func (b *Bar) Clear() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fmt.Fprint(b.w, "\r\033[K")
+}
+
+func (b *Bar) draw() {
+	b.drawn = time.Now()
+	fmt.Fprintf(b.w, "\r\033[K%s: %d/%d %s", b.label, b.done, b.total, b.unit)
+}
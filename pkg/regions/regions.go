@@ -0,0 +1,155 @@
+// Package regions resolves which AWS regions a scan should cover, skipping
+// regions that are excluded or not enabled for the account.
+package regions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// All selects every region enabled for the account.
+const All = "all"
+
+// ErrOptInUnknown is returned alongside the regions to scan when the
+// account's regions couldn't be listed: an explicit list is scanned as given,
+// without skipping regions that aren't enabled, and callers should warn.
+var ErrOptInUnknown = errors.New("could not check which regions are enabled")
+
+// Skipped records a requested region that will not be scanned and why.
+type Skipped struct {
+	Region string
+	Reason string
+}
+
+// Parse splits a comma-separated region list, dropping empty entries.
+func Parse(list string) []string {
+	var result []string
+	for _, region := range strings.Split(list, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			result = append(result, region)
+		}
+	}
+	return result
+}
+
+// Select is Resolve for regions already known, such as those in a snapshot:
+// the available regions that are requested (all of them when none or "all"
+// is) and not excluded, in the order given.
+func Select(available, requested, exclude []string) []string {
+	wanted := make(map[string]bool)
+	for _, region := range requested {
+		wanted[region] = true
+	}
+	all := len(requested) == 0 || wanted[All]
+	excluded := make(map[string]bool)
+	for _, region := range exclude {
+		excluded[region] = true
+	}
+
+	var selected []string
+	for _, region := range available {
+		if (all || wanted[region]) && !excluded[region] {
+			selected = append(selected, region)
+		}
+	}
+	return selected
+}
+
+// Resolve returns the regions to scan. With no requested regions it scans the
+// configured region only; "all" expands to every region enabled for the
+// account, and fails if they can't be listed. Regions that are not opted in,
+// or listed in exclude, are skipped; if opt-in can't be checked, the rest are
+// returned with ErrOptInUnknown.
+func Resolve(ctx context.Context, cfg aws.Config, requested, exclude []string) ([]string, []Skipped, error) {
+	if len(requested) == 0 {
+		if cfg.Region == "" {
+			return nil, nil, fmt.Errorf("no region configured; set --region or AWS_REGION")
+		}
+		// The configured region needs no opt-in lookup
+		if len(exclude) == 0 {
+			return []string{cfg.Region}, nil, nil
+		}
+		requested = []string{cfg.Region}
+	}
+
+	excluded := make(map[string]bool)
+	for _, region := range exclude {
+		excluded[region] = true
+	}
+
+	optIn, optInErr := optInStatus(ctx, cfg)
+	if optInErr != nil {
+		// Without ec2:DescribeRegions we can still scan an explicit list
+		if len(requested) == 1 && requested[0] == All {
+			return nil, nil, fmt.Errorf("listing regions: %w", optInErr)
+		}
+		optIn = nil
+	}
+
+	if len(requested) == 1 && requested[0] == All {
+		requested = nil
+		for region := range optIn {
+			requested = append(requested, region)
+		}
+		sort.Strings(requested)
+	}
+
+	var selected []string
+	var skipped []Skipped
+	seen := make(map[string]bool)
+	for _, region := range requested {
+		if seen[region] {
+			continue
+		}
+		seen[region] = true
+
+		status, known := optIn[region]
+		switch {
+		case excluded[region]:
+			skipped = append(skipped, Skipped{Region: region, Reason: "excluded"})
+		case optIn != nil && !known:
+			skipped = append(skipped, Skipped{Region: region, Reason: "unknown region"})
+		case status == "not-opted-in":
+			skipped = append(skipped, Skipped{Region: region, Reason: "not opted in"})
+		default:
+			selected = append(selected, region)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, skipped, fmt.Errorf("no regions left to scan")
+	}
+	if optInErr != nil {
+		return selected, skipped, fmt.Errorf("%w (%v); scanning %s as given", ErrOptInUnknown, optInErr, strings.Join(selected, ", "))
+	}
+	return selected, skipped, nil
+}
+
+// optInStatus maps every region name to its opt-in status
+// (opt-in-not-required, opted-in, or not-opted-in).
+func optInStatus(ctx context.Context, cfg aws.Config) (map[string]string, error) {
+	client := ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+		if o.Region == "" {
+			o.Region = "us-east-1"
+		}
+	})
+
+	output, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{
+		AllRegions: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]string)
+	for _, region := range output.Regions {
+		status[aws.ToString(region.RegionName)] = aws.ToString(region.OptInStatus)
+	}
+	return status, nil
+}
@@ -0,0 +1,177 @@
+package render
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// HTMLReport is a self-contained page for readers who won't run the CLI:
+// summary counts up top, then one sortable, filterable table per section.
+type HTMLReport struct {
+	Title       string
+	GeneratedAt time.Time
+	// Context lines, e.g. account and regions, shown under the title
+	Context  []string
+	Summary  []HTMLCount
+	Sections []*HTMLSection
+}
+
+type HTMLCount struct {
+	Label string
+	Value int
+	// Alert highlights a non-zero count that needs attention
+	Alert bool
+}
+
+type HTMLSection struct {
+	Title   string
+	Headers []string
+	Rows    [][]string
+	// Links are per-row URLs for a column's cells, keyed by column index
+	Links map[int][]string
+}
+
+// HTMLCell is one rendered cell, with Link set when the cell is a link.
+type HTMLCell struct {
+	Text string
+	Link string
+}
+
+// AddSection appends an empty section; fill it with SetTable.
+func (r *HTMLReport) AddSection(title string) *HTMLSection {
+	section := &HTMLSection{Title: title}
+	r.Sections = append(r.Sections, section)
+	return section
+}
+
+// SetTable takes the same headers and rows as Table, so the text and HTML
+// reports share their row builders.
+func (s *HTMLSection) SetTable(headers []string, rows [][]string) *HTMLSection {
+	s.Headers = headers
+	s.Rows = rows
+	return s
+}
+
+// LinkColumn turns the cells under header into links, urls[i] being the link
+// for row i. Looking the column up by header keeps it right when a region
+// column is prepended. Rows without a URL, and unknown headers, are left as
+// text.
+func (s *HTMLSection) LinkColumn(header string, urls []string) *HTMLSection {
+	for i, h := range s.Headers {
+		if h == header {
+			if s.Links == nil {
+				s.Links = make(map[int][]string)
+			}
+			s.Links[i] = urls
+		}
+	}
+	return s
+}
+
+// Cells returns the rows with their links, for the template.
+func (s *HTMLSection) Cells() [][]HTMLCell {
+	cells := make([][]HTMLCell, len(s.Rows))
+	for i, row := range s.Rows {
+		cells[i] = make([]HTMLCell, len(row))
+		for j, text := range row {
+			cells[i][j].Text = text
+			if urls := s.Links[j]; i < len(urls) {
+				cells[i][j].Link = urls[i]
+			}
+		}
+	}
+	return cells
+}
+
+// HTML writes the report as a single page with inline styles and script, so
+// it can be attached to a ticket or mailed as is.
+func HTML(w io.Writer, report HTMLReport) error {
+	return htmlTemplate.Execute(w, report)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05 UTC") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1 { margin-bottom: 0.2em; }
+.context { color: #59636e; margin: 0; }
+.summary { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.count { border: 1px solid #d1d9e0; border-radius: 6px; padding: 0.8em 1.2em; min-width: 8em; }
+.count .value { font-size: 1.8em; font-weight: 600; }
+.count.alert { border-color: #cf222e; background: #ffebe9; }
+section { margin-top: 2em; }
+input.filter { padding: 0.3em 0.5em; width: 20em; margin-bottom: 0.5em; }
+table { border-collapse: collapse; font-size: 0.9em; }
+th, td { border: 1px solid #d1d9e0; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; white-space: nowrap; }
+th[data-dir="asc"]::after { content: " \25B2"; }
+th[data-dir="desc"]::after { content: " \25BC"; }
+tr:nth-child(even) td { background: #f6f8fa; }
+td a { color: #0969da; }
+.empty { color: #59636e; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="context">Generated {{date .GeneratedAt}}</p>
+{{range .Context}}<p class="context">{{.}}</p>
+{{end}}
+<div class="summary">
+{{range .Summary}}<div class="count{{if and .Alert .Value}} alert{{end}}"><div class="value">{{.Value}}</div>{{.Label}}</div>
+{{end}}</div>
+{{range .Sections}}<section>
+<h2>{{.Title}} ({{len .Rows}})</h2>
+{{if .Rows}}<input class="filter" type="search" placeholder="Filter rows...">
+<table>
+<thead><tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Cells}}<tr>{{range .}}<td>{{if .Link}}<a href="{{.Link}}" target="_blank" rel="noopener">{{.Text}}</a>{{else}}{{.Text}}{{end}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="empty">None</p>
+{{end}}</section>
+{{end}}
+<script>
+var number = /^\$?-?\d+(\.\d+)?$/;
+
+document.querySelectorAll("section").forEach(function (section) {
+  var table = section.querySelector("table");
+  if (!table) return;
+  var body = table.tBodies[0];
+
+  section.querySelector("input.filter").addEventListener("input", function (e) {
+    var needle = e.target.value.toLowerCase();
+    Array.from(body.rows).forEach(function (row) {
+      row.style.display = row.textContent.toLowerCase().indexOf(needle) === -1 ? "none" : "";
+    });
+  });
+
+  table.querySelectorAll("th").forEach(function (th, column) {
+    th.addEventListener("click", function () {
+      var dir = th.dataset.dir === "asc" ? "desc" : "asc";
+      table.querySelectorAll("th").forEach(function (other) { delete other.dataset.dir; });
+      th.dataset.dir = dir;
+      var rows = Array.from(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column].textContent, y = b.cells[column].textContent;
+        // Blank cells ("-") sort last either way
+        if (x === "-" || y === "-") return x === y ? 0 : (x === "-" ? 1 : -1);
+        var order = number.test(x) && number.test(y)
+          ? parseFloat(x.replace("$", "")) - parseFloat(y.replace("$", ""))
+          : x.localeCompare(y);
+        return dir === "asc" ? order : -order;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
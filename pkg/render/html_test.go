@@ -0,0 +1,43 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func renderFuzzReport(t *testing.T, title, cell, link string) string {
+	report := HTMLReport{Title: title, GeneratedAt: time.Unix(0, 0), Context: []string{cell}}
+	report.Summary = append(report.Summary, HTMLCount{Label: cell, Value: 1, Alert: true})
+	report.AddSection(title).SetTable([]string{"Name", cell}, [][]string{{cell, cell}, {"", ""}}).LinkColumn("Name", []string{link})
+
+	var out bytes.Buffer
+	if err := HTML(&out, report); err != nil {
+		t.Fatalf("rendering: %v", err)
+	}
+	return out.String()
+}
+
+// FuzzHTML renders reports with arbitrary cell text and links, which come
+// from resource names, tags and descriptions anyone in an account can set.
+// The page must always render, and nothing in the input may come through as
+// markup or a script URL.
+func FuzzHTML(f *testing.F) {
+	f.Add("Keys", "alias/app", "https://console.aws.amazon.com/kms/home")
+	f.Add("<script>alert(1)</script>", "\"><img src=x onerror=alert(1)>", "javascript:alert(1)")
+	f.Add("", "", "")
+	f.Fuzz(func(t *testing.T, title, cell, link string) {
+		page := renderFuzzReport(t, title, cell, link)
+
+		// Escaped input adds no tags, so the page has as many as one
+		// rendered from the same input with every '<' replaced
+		plain := renderFuzzReport(t, strings.ReplaceAll(title, "<", "x"), strings.ReplaceAll(cell, "<", "x"), strings.ReplaceAll(link, "<", "x"))
+		if got, want := strings.Count(page, "<"), strings.Count(plain, "<"); got != want {
+			t.Fatalf("title %q, cell %q and link %q add %d tags", title, cell, link, got-want)
+		}
+		if strings.Contains(strings.ToLower(page), `href="javascript:`) {
+			t.Fatalf("link %q is rendered as a script URL", link)
+		}
+	})
+}
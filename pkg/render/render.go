@@ -0,0 +1,62 @@
+// Package render writes the fixed-width tables and JSON documents used by the
+// command-line reports.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Table writes headers, a separator line, and rows with each column padded to
+// its widest value.
+func Table(w io.Writer, headers []string, rows [][]string) {
+	// Calculate column widths
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = len(h)
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			if i < len(widths) && len(v) > widths[i] {
+				widths[i] = len(v)
+			}
+		}
+	}
+
+	printRow(w, headers, widths)
+	printSeparator(w, widths)
+	for _, row := range rows {
+		printRow(w, row, widths)
+	}
+}
+
+// JSON writes v as indented JSON followed by a newline.
+func JSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// ValueOrDash returns "-" for empty values so table cells are never blank.
+func ValueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func printRow(w io.Writer, values []string, widths []int) {
+	for i, v := range values {
+		fmt.Fprintf(w, "| %-*s ", widths[i], v)
+	}
+	fmt.Fprintln(w, "|")
+}
+
+func printSeparator(w io.Writer, widths []int) {
+	for _, width := range widths {
+		fmt.Fprintf(w, "+-%s-", strings.Repeat("-", width))
+	}
+	fmt.Fprintln(w, "+")
+}
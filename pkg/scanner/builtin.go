@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"secrets-lister/pkg/kmsinv"
+	"secrets-lister/pkg/secretsinv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+func init() {
+	Register(kmsScanner{})
+	Register(secretsScanner{})
+}
+
+// kmsScanner lists customer managed keys.
+type kmsScanner struct{}
+
+func (kmsScanner) Name() string { return "kms" }
+
+func (kmsScanner) Scan(ctx context.Context, cfg aws.Config) ([]Record, error) {
+	// Filtering describes every key, so the describe below is served from cache
+	client := kmsinv.NewCache(kms.NewFromConfig(cfg))
+	keys, err := kmsinv.ListCustomerManaged(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	aliases, _ := kmsinv.AliasesByKey(ctx, client)
+
+	var records []Record
+	for _, entry := range keys {
+		key := kmsinv.Describe(ctx, client, aws.ToString(entry.KeyId))
+		record := Record{
+			Scanner:      "kms",
+			ResourceType: "AWS::KMS::Key",
+			ID:           key.KeyID,
+			ARN:          aws.ToString(entry.KeyArn),
+			Region:       cfg.Region,
+			State:        key.Status,
+			Tags:         key.Tags,
+			Error:        key.Error,
+		}
+		if names := aliases[key.KeyID]; len(names) > 0 {
+			record.Name = names[0]
+		}
+		if !key.CreationDate.IsZero() {
+			created := key.CreationDate
+			record.CreatedAt = &created
+		}
+		if key.ErrorClass != "" {
+			record.Attributes = map[string]string{"error_class": string(key.ErrorClass)}
+		} else {
+			record.Attributes = map[string]string{
+				"key_type":        key.KeyType,
+				"origin":          key.Origin,
+				"multi_region":    key.MultiRegion,
+				"rotation_status": key.RotationStatus,
+			}
+			if key.PrimaryRegion != "" {
+				record.Attributes["primary_region"] = key.PrimaryRegion
+			}
+			if len(key.ReplicaRegions) > 0 {
+				record.Attributes["replica_regions"] = strings.Join(key.ReplicaRegions, ",")
+			}
+			if key.RotationPeriodDays > 0 {
+				record.Attributes["rotation_period_days"] = strconv.Itoa(int(key.RotationPeriodDays))
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// secretsScanner lists Secrets Manager secrets, including those scheduled for
+// deletion.
+type secretsScanner struct{}
+
+func (secretsScanner) Name() string { return "secretsmanager" }
+
+func (secretsScanner) Scan(ctx context.Context, cfg aws.Config) ([]Record, error) {
+	secrets, err := secretsinv.List(ctx, secretsmanager.NewFromConfig(cfg), secretsinv.ListOptions{IncludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, secret := range secrets {
+		record := Record{
+			Scanner:      "secretsmanager",
+			ResourceType: "AWS::SecretsManager::Secret",
+			ID:           aws.ToString(secret.ARN),
+			ARN:          aws.ToString(secret.ARN),
+			Name:         aws.ToString(secret.Name),
+			Region:       cfg.Region,
+			State:        "Active",
+			CreatedAt:    secret.CreatedDate,
+			Attributes:   make(map[string]string),
+		}
+		if secret.DeletedDate != nil {
+			record.State = "PendingDeletion"
+		}
+		if len(secret.Tags) > 0 {
+			record.Tags = make(map[string]string)
+			for _, tag := range secret.Tags {
+				record.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+		}
+		if secret.KmsKeyId != nil {
+			record.Attributes["kms_key_id"] = aws.ToString(secret.KmsKeyId)
+		}
+		if secret.OwningService != nil {
+			record.Attributes["owning_service"] = aws.ToString(secret.OwningService)
+		}
+		if secret.RotationEnabled != nil {
+			record.Attributes["rotation_enabled"] = strconv.FormatBool(*secret.RotationEnabled)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
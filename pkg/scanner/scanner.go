@@ -0,0 +1,102 @@
+// Package scanner is the extension point for inventory modules. A scanner
+// lists one kind of AWS resource in one region and returns service-neutral
+// Records; the CLI handles regions, output, and error reporting, so adding a
+// service means implementing Scanner and registering it, nothing more.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Scanner inventories one service. Scan uses cfg.Region; the caller sets it
+// for each region scanned.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, cfg aws.Config) ([]Record, error)
+}
+
+// Record is one resource, in the fields every service shares. Anything
+// service specific goes in Attributes.
+type Record struct {
+	Scanner      string            `json:"scanner"`
+	ResourceType string            `json:"resource_type"`
+	ID           string            `json:"id"`
+	ARN          string            `json:"arn,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Region       string            `json:"region"`
+	State        string            `json:"state,omitempty"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	// Error says why the resource was listed but could not be described
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Scanner)
+)
+
+// Register makes s available by name. It is meant to be called from init, and
+// panics on a duplicate name, as two modules claiming one name is a build
+// mistake rather than something to handle at run time.
+func Register(s Scanner) {
+	mu.Lock()
+	defer mu.Unlock()
+	if s == nil {
+		panic("scanner: Register scanner is nil")
+	}
+	if _, dup := registry[s.Name()]; dup {
+		panic("scanner: Register called twice for " + s.Name())
+	}
+	registry[s.Name()] = s
+}
+
+func Lookup(name string) (Scanner, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Names lists the registered scanners, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select resolves a comma-separated list of scanner names, where "all" (or an
+// empty list) means every registered scanner.
+func Select(list string) ([]Scanner, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 || (len(names) == 1 && names[0] == "all") {
+		names = Names()
+	}
+	var selected []Scanner
+	for _, name := range names {
+		s, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown scanner %q (available: %v)", name, Names())
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
@@ -0,0 +1,143 @@
+// Package secretkeys joins secrets to the KMS keys that encrypt them and flags
+// the pairs that are wrong: secrets on the default aws/secretsmanager key,
+// which our policy doesn't allow, and secrets whose key is disabled, pending
+// deletion, or gone, which can no longer be read or soon won't be.
+package secretkeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"secrets-lister/pkg/awserr"
+	"secrets-lister/pkg/kmsinv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// DefaultAlias is the AWS managed key Secrets Manager uses when a secret
+// names none.
+const DefaultAlias = "alias/aws/secretsmanager"
+
+// Findings, in the order they are reported.
+const (
+	DefaultKey         = "default_key"
+	KeyDisabled        = "key_disabled"
+	KeyPendingDeletion = "key_pending_deletion"
+	KeyNotFound        = "key_not_found"
+)
+
+var Findings = []string{DefaultKey, KeyDisabled, KeyPendingDeletion, KeyNotFound}
+
+// Key states beside the ones KMS reports.
+const (
+	NotFound      = "NotFound"
+	NotAuthorized = kmsinv.NotAuthorized
+)
+
+type Key struct {
+	KeyID      string   `json:"key_id,omitempty"`
+	ARN        string   `json:"key_arn,omitempty"`
+	Aliases    []string `json:"aliases,omitempty"`
+	KeyManager string   `json:"key_manager,omitempty"`
+	State      string   `json:"key_state"`
+}
+
+type Entry struct {
+	Name string `json:"name"`
+	ARN  string `json:"arn"`
+	// KMSKeyID is the key as the secret names it, empty for the default key
+	KMSKeyID string   `json:"kms_key_id,omitempty"`
+	Key      Key      `json:"key"`
+	Findings []string `json:"findings,omitempty"`
+}
+
+// Join looks up the key of every secret, sorted by name. Secrets may name
+// their key by ID, ARN, alias, or alias ARN; resolver turns each into a key
+// ID so every form of a key is described once, through client (a
+// kmsinv.Cache). Keys that can't be described for lack of permission are
+// reported as NotAuthorized and not flagged; other errors stop the join.
+func Join(ctx context.Context, resolver *kmsinv.Resolver, client kmsinv.API, secrets []types.SecretListEntry) ([]Entry, error) {
+	// Aliases are only for display; without them keys are still resolved
+	aliases, _ := resolver.AliasesByKey(ctx)
+
+	entries := make([]Entry, 0, len(secrets))
+	for _, secret := range secrets {
+		entry := Entry{
+			Name:     aws.ToString(secret.Name),
+			ARN:      aws.ToString(secret.ARN),
+			KMSKeyID: aws.ToString(secret.KmsKeyId),
+		}
+		ref := entry.KMSKeyID
+		if ref == "" {
+			ref = DefaultAlias
+		}
+
+		key, err := describe(ctx, resolver, client, ref)
+		if err != nil {
+			return nil, fmt.Errorf("looking up the key of %s: %w", entry.Name, err)
+		}
+		key.Aliases = aliases[key.KeyID]
+		entry.Key = key
+
+		// aws/secretsmanager is the only AWS managed key a secret can use
+		if entry.KMSKeyID == "" || key.KeyManager == string(kmstypes.KeyManagerTypeAws) {
+			entry.Findings = append(entry.Findings, DefaultKey)
+		}
+		switch key.State {
+		case string(kmstypes.KeyStateDisabled):
+			entry.Findings = append(entry.Findings, KeyDisabled)
+		case string(kmstypes.KeyStatePendingDeletion), string(kmstypes.KeyStatePendingReplicaDeletion):
+			entry.Findings = append(entry.Findings, KeyPendingDeletion)
+		case NotFound:
+			entry.Findings = append(entry.Findings, KeyNotFound)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func describe(ctx context.Context, resolver *kmsinv.Resolver, client kmsinv.API, ref string) (Key, error) {
+	keyID, err := resolver.Resolve(ctx, ref)
+	if err == nil {
+		var output *kms.DescribeKeyOutput
+		output, err = client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+		if err == nil {
+			metadata := output.KeyMetadata
+			return Key{
+				KeyID:      aws.ToString(metadata.KeyId),
+				ARN:        aws.ToString(metadata.Arn),
+				KeyManager: string(metadata.KeyManager),
+				State:      string(metadata.KeyState),
+			}, nil
+		}
+	}
+
+	switch {
+	case errors.Is(err, kmsinv.ErrAliasNotFound), awserr.Classify(err) == awserr.NotFound:
+		return Key{State: NotFound}, nil
+	case awserr.IsNotAuthorized(err):
+		return Key{State: NotAuthorized}, nil
+	}
+	return Key{}, err
+}
+
+// Count returns how many entries have each finding.
+func Count(entries []Entry) map[string]int {
+	counts := make(map[string]int, len(Findings))
+	for _, finding := range Findings {
+		counts[finding] = 0
+	}
+	for _, entry := range entries {
+		for _, finding := range entry.Findings {
+			counts[finding]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,141 @@
+package secretsinv
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go"
+)
+
+// Fake is an in-memory API for exercising the inventory without AWS. It pages
+// ListSecrets like the service does and can fail individual calls.
+type Fake struct {
+	Secrets []types.SecretListEntry
+	// Replicas holds DescribeSecret replication status by secret name
+	Replicas map[string][]types.ReplicationStatusType
+	// PageSize is the number of secrets per ListSecrets page (default 2, so
+	// small fixtures still paginate)
+	PageSize int
+	// Errors fails calls by operation name ("ListSecrets") or by
+	// "DescribeSecret:<name>"; ListSecrets failures apply to every page after
+	// the first, so partial results can be tested.
+	Errors map[string]error
+	// Calls counts calls by operation name
+	Calls map[string]int
+
+	mu sync.Mutex
+}
+
+// AccessDenied returns the error the service returns for a missing permission.
+func AccessDenied(operation string) error {
+	return &smithy.GenericAPIError{
+		Code:    "AccessDeniedException",
+		Message: fmt.Sprintf("User is not authorized to perform secretsmanager:%s", operation),
+	}
+}
+
+func (f *Fake) record(operation string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Calls == nil {
+		f.Calls = make(map[string]int)
+	}
+	f.Calls[operation]++
+}
+
+func (f *Fake) ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	f.record("ListSecrets")
+
+	start := 0
+	if params.NextToken != nil {
+		var err error
+		if start, err = strconv.Atoi(*params.NextToken); err != nil {
+			return nil, fmt.Errorf("invalid NextToken %q", *params.NextToken)
+		}
+		if err := f.Errors["ListSecrets"]; err != nil {
+			return nil, err
+		}
+	}
+
+	pageSize := f.PageSize
+	if pageSize == 0 {
+		pageSize = 2
+	}
+
+	// The token is a position in Secrets, so paging stays linear in the
+	// fixture size even for large benchmark fixtures
+	output := &secretsmanager.ListSecretsOutput{}
+	i := start
+	for ; i < len(f.Secrets) && len(output.SecretList) < pageSize; i++ {
+		secret := f.Secrets[i]
+		if secret.DeletedDate != nil && !aws.ToBool(params.IncludePlannedDeletion) {
+			continue
+		}
+		if matchesFilters(secret, params.Filters) {
+			output.SecretList = append(output.SecretList, secret)
+		}
+	}
+	if i < len(f.Secrets) {
+		output.NextToken = aws.String(strconv.Itoa(i))
+	}
+	return output, nil
+}
+
+func (f *Fake) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	f.record("DescribeSecret")
+
+	name := aws.ToString(params.SecretId)
+	if err := f.Errors["DescribeSecret:"+name]; err != nil {
+		return nil, err
+	}
+	for _, secret := range f.Secrets {
+		if aws.ToString(secret.Name) == name {
+			return &secretsmanager.DescribeSecretOutput{
+				Name:              secret.Name,
+				PrimaryRegion:     secret.PrimaryRegion,
+				ReplicationStatus: f.Replicas[name],
+			}, nil
+		}
+	}
+	return nil, &smithy.GenericAPIError{Code: "ResourceNotFoundException", Message: "Secrets Manager can't find the specified secret."}
+}
+
+// matchesFilters supports the name and tag-key prefix filters (with ! negation
+// on names); other filter keys match everything.
+func matchesFilters(secret types.SecretListEntry, filters []types.Filter) bool {
+	for _, filter := range filters {
+		switch filter.Key {
+		case types.FilterNameStringTypeName:
+			if !matchesAnyPrefix([]string{aws.ToString(secret.Name)}, filter.Values) {
+				return false
+			}
+		case types.FilterNameStringTypeTagKey:
+			var keys []string
+			for _, tag := range secret.Tags {
+				keys = append(keys, aws.ToString(tag.Key))
+			}
+			if !matchesAnyPrefix(keys, filter.Values) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesAnyPrefix(candidates, values []string) bool {
+	for _, value := range values {
+		prefix, negated := strings.CutPrefix(value, "!")
+		for _, candidate := range candidates {
+			if strings.HasPrefix(candidate, prefix) != negated {
+				return true
+			}
+		}
+	}
+	return false
+}
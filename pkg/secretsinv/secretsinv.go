@@ -0,0 +1,184 @@
+// Package secretsinv lists Secrets Manager secrets through a small interface
+// rather than a concrete client, so the inventory can be embedded in other
+// programs and exercised against the in-memory Fake.
+package secretsinv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"secrets-lister/pkg/awserr"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// API is the subset of Secrets Manager the inventory calls. *secretsmanager.Client
+// satisfies it.
+type API interface {
+	ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error)
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+}
+
+// ErrNotAuthorized wraps access denied errors; List returns the secrets it
+// collected before the denial alongside it.
+var ErrNotAuthorized = errors.New("not authorized")
+
+type ListOptions struct {
+	Filters        []types.Filter
+	IncludeDeleted bool
+	// Limit stops paging once this many secrets are collected (0 means no limit)
+	Limit int
+}
+
+func List(ctx context.Context, client API, opts ListOptions) ([]types.SecretListEntry, error) {
+	var secrets []types.SecretListEntry
+
+	input := &secretsmanager.ListSecretsInput{
+		Filters: opts.Filters,
+	}
+	if opts.IncludeDeleted {
+		input.IncludePlannedDeletion = aws.Bool(true)
+	}
+
+	paginator := secretsmanager.NewListSecretsPaginator(client, input)
+
+	for paginator.HasMorePages() && (opts.Limit == 0 || len(secrets) < opts.Limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			if awserr.IsNotAuthorized(err) {
+				return secrets, fmt.Errorf("%w to list secrets: %v", ErrNotAuthorized, err)
+			}
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		secrets = append(secrets, page.SecretList...)
+	}
+
+	if opts.Limit > 0 && len(secrets) > opts.Limit {
+		secrets = secrets[:opts.Limit]
+	}
+	return secrets, nil
+}
+
+// DescribeAll returns the secrets with the given IDs as ListSecrets would,
+// at one DescribeSecret call each, for when the IDs come from somewhere
+// cheaper than listing the account (e.g. the tagging API). Secrets deleted
+// since are skipped, and so are ones scheduled for deletion unless
+// includeDeleted is set. Like List, a denial is returned alongside the
+// secrets that could be described.
+func DescribeAll(ctx context.Context, client API, ids []string, includeDeleted bool) ([]types.SecretListEntry, error) {
+	var secrets []types.SecretListEntry
+	denied := 0
+	for _, id := range ids {
+		output, err := client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(id)})
+		if err != nil {
+			switch awserr.Classify(err) {
+			case awserr.NotFound:
+				continue
+			case awserr.NotAuthorized:
+				denied++
+				continue
+			}
+			return nil, fmt.Errorf("failed to describe %s: %w", id, err)
+		}
+		if output.DeletedDate != nil && !includeDeleted {
+			continue
+		}
+		secrets = append(secrets, types.SecretListEntry{
+			ARN:                    output.ARN,
+			CreatedDate:            output.CreatedDate,
+			DeletedDate:            output.DeletedDate,
+			Description:            output.Description,
+			KmsKeyId:               output.KmsKeyId,
+			LastAccessedDate:       output.LastAccessedDate,
+			LastChangedDate:        output.LastChangedDate,
+			LastRotatedDate:        output.LastRotatedDate,
+			Name:                   output.Name,
+			NextRotationDate:       output.NextRotationDate,
+			OwningService:          output.OwningService,
+			PrimaryRegion:          output.PrimaryRegion,
+			RotationEnabled:        output.RotationEnabled,
+			RotationLambdaARN:      output.RotationLambdaARN,
+			RotationRules:          output.RotationRules,
+			SecretVersionsToStages: output.VersionIdsToStages,
+			Tags:                   output.Tags,
+		})
+	}
+	if denied > 0 {
+		return secrets, fmt.Errorf("%w to describe %d secret(s)", ErrNotAuthorized, denied)
+	}
+	return secrets, nil
+}
+
+// Replication is where a primary secret is replicated to.
+type Replication struct {
+	// Regions is sorted
+	Regions []string
+	Status  map[string]string
+}
+
+// Replicas describes a secret's replicas. Only primaries know their replicas;
+// ListSecrets doesn't return them, so this costs one DescribeSecret call.
+func Replicas(ctx context.Context, client API, secretID string) (Replication, error) {
+	var replication Replication
+
+	output, err := client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		if awserr.IsNotAuthorized(err) {
+			return replication, fmt.Errorf("%w to describe %s: %v", ErrNotAuthorized, secretID, err)
+		}
+		return replication, fmt.Errorf("failed to describe %s: %w", secretID, err)
+	}
+
+	for _, replica := range output.ReplicationStatus {
+		region := aws.ToString(replica.Region)
+		replication.Regions = append(replication.Regions, region)
+		if replication.Status == nil {
+			replication.Status = make(map[string]string)
+		}
+		replication.Status[region] = string(replica.Status)
+	}
+	sort.Strings(replication.Regions)
+	return replication, nil
+}
+
+// ReplicasAll describes the replicas of each of ids with up to workers
+// DescribeSecret calls in flight. ListSecrets has no replication status to
+// read instead, so this is still a call per secret, but not one at a time;
+// the calls are paced by the client's retryer and any rate limiter it was
+// built with. Results and errors are in the order of ids, and done, if set,
+// is called after each one.
+func ReplicasAll(ctx context.Context, client API, ids []string, workers int, done func()) ([]Replication, []error) {
+	results := make([]Replication, len(ids))
+	errs := make([]error, len(ids))
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i], errs[i] = Replicas(ctx, client, ids[i])
+				if done != nil {
+					done()
+				}
+			}
+		}()
+	}
+	for i := range ids {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results, errs
+}
@@ -0,0 +1,208 @@
+package secretsinv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+var errBoom = errors.New("boom")
+
+func secretNamed(name string, tagKeys ...string) types.SecretListEntry {
+	secret := types.SecretListEntry{Name: aws.String(name), ARN: aws.String("arn:aws:secretsmanager:us-east-1:111122223333:secret:" + name)}
+	for _, key := range tagKeys {
+		secret.Tags = append(secret.Tags, types.Tag{Key: aws.String(key), Value: aws.String("x")})
+	}
+	return secret
+}
+
+func names(secrets []types.SecretListEntry) []string {
+	var list []string
+	for _, secret := range secrets {
+		list = append(list, aws.ToString(secret.Name))
+	}
+	return list
+}
+
+func TestList(t *testing.T) {
+	deleted := secretNamed("app/deleted")
+	deleted.DeletedDate = aws.Time(time.Now())
+	fixture := []types.SecretListEntry{
+		secretNamed("app/db", "Team"), secretNamed("app/api"), deleted,
+		secretNamed("data/etl", "Team"), secretNamed("data/warehouse"),
+	}
+
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		errors    map[string]error
+		want      []string
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "every page", want: []string{"app/db", "app/api", "data/etl", "data/warehouse"}, wantCalls: 2},
+		{name: "including deleted", opts: ListOptions{IncludeDeleted: true}, want: []string{"app/db", "app/api", "app/deleted", "data/etl", "data/warehouse"}, wantCalls: 3},
+		{name: "name filter", opts: ListOptions{Filters: []types.Filter{{Key: types.FilterNameStringTypeName, Values: []string{"data/"}}}}, want: []string{"data/etl", "data/warehouse"}, wantCalls: 1},
+		{name: "negated name filter", opts: ListOptions{Filters: []types.Filter{{Key: types.FilterNameStringTypeName, Values: []string{"!data/"}}}}, want: []string{"app/db", "app/api"}, wantCalls: 2},
+		{name: "tag key filter", opts: ListOptions{Filters: []types.Filter{{Key: types.FilterNameStringTypeTagKey, Values: []string{"Team"}}}}, want: []string{"app/db", "data/etl"}, wantCalls: 2},
+		{name: "limit stops paging", opts: ListOptions{Limit: 3}, want: []string{"app/db", "app/api", "data/etl"}, wantCalls: 2},
+		{name: "limit inside a page", opts: ListOptions{Limit: 1}, want: []string{"app/db"}, wantCalls: 1},
+		{name: "denied after the first page keeps it", errors: map[string]error{"ListSecrets": AccessDenied("ListSecrets")}, want: []string{"app/db", "app/api"}, wantCalls: 2, wantErr: ErrNotAuthorized},
+		{name: "other failure", errors: map[string]error{"ListSecrets": errBoom}, wantCalls: 2, wantErr: errBoom},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &Fake{Secrets: fixture, Errors: tc.errors}
+			got, err := List(context.Background(), fake, tc.opts)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(names(got), tc.want) {
+				t.Errorf("secrets = %v, want %v", names(got), tc.want)
+			}
+			if fake.Calls["ListSecrets"] != tc.wantCalls {
+				t.Errorf("ListSecrets calls = %d, want %d", fake.Calls["ListSecrets"], tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestListPageSizes(t *testing.T) {
+	var fixture []types.SecretListEntry
+	for i := 0; i < 7; i++ {
+		fixture = append(fixture, secretNamed(fmt.Sprintf("s%d", i)))
+	}
+	for _, pageSize := range []int{1, 3, 7, 100} {
+		t.Run(fmt.Sprint(pageSize), func(t *testing.T) {
+			got, err := List(context.Background(), &Fake{Secrets: fixture, PageSize: pageSize}, ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(fixture) {
+				t.Errorf("listed %d secrets, want %d", len(got), len(fixture))
+			}
+		})
+	}
+}
+
+func TestDescribeAll(t *testing.T) {
+	deleted := secretNamed("deleted")
+	deleted.DeletedDate = aws.Time(time.Now())
+	fixture := []types.SecretListEntry{secretNamed("a"), secretNamed("b"), deleted}
+
+	tests := []struct {
+		name           string
+		ids            []string
+		includeDeleted bool
+		errors         map[string]error
+		want           []string
+		wantErr        error
+	}{
+		{name: "described", ids: []string{"a", "b"}, want: []string{"a", "b"}},
+		{name: "gone since listing", ids: []string{"a", "missing"}, want: []string{"a"}},
+		{name: "denied keeps the rest", ids: []string{"a", "b"}, errors: map[string]error{"DescribeSecret:a": AccessDenied("DescribeSecret")}, want: []string{"b"}, wantErr: ErrNotAuthorized},
+		{name: "other failure", ids: []string{"a", "b"}, errors: map[string]error{"DescribeSecret:b": errBoom}, wantErr: errBoom},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &Fake{Secrets: fixture, Errors: tc.errors}
+			got, err := DescribeAll(context.Background(), fake, tc.ids, tc.includeDeleted)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(names(got), tc.want) {
+				t.Errorf("secrets = %v, want %v", names(got), tc.want)
+			}
+		})
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	fake := &Fake{
+		Secrets: []types.SecretListEntry{secretNamed("primary"), secretNamed("single"), secretNamed("denied")},
+		Replicas: map[string][]types.ReplicationStatusType{
+			"primary": {
+				{Region: aws.String("eu-west-1"), Status: types.StatusTypeInSync},
+				{Region: aws.String("ap-south-1"), Status: types.StatusTypeFailed},
+			},
+		},
+		Errors: map[string]error{"DescribeSecret:denied": AccessDenied("DescribeSecret")},
+	}
+
+	tests := []struct {
+		id      string
+		want    Replication
+		wantErr error
+	}{
+		{id: "primary", want: Replication{
+			Regions: []string{"ap-south-1", "eu-west-1"},
+			Status:  map[string]string{"ap-south-1": "Failed", "eu-west-1": "InSync"},
+		}},
+		{id: "single"},
+		{id: "denied", wantErr: ErrNotAuthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.id, func(t *testing.T) {
+			got, err := Replicas(context.Background(), fake, tc.id)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("replication = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReplicasAll(t *testing.T) {
+	fake := &Fake{
+		Secrets: []types.SecretListEntry{secretNamed("denied")},
+		Replicas: map[string][]types.ReplicationStatusType{
+			"primary": {{Region: aws.String("eu-west-1"), Status: types.StatusTypeInSync}},
+		},
+		Errors: map[string]error{"DescribeSecret:denied": AccessDenied("DescribeSecret")},
+	}
+	var ids []string
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("s%d", i)
+		fake.Secrets = append(fake.Secrets, secretNamed(name))
+		ids = append(ids, name)
+	}
+	fake.Secrets = append(fake.Secrets, secretNamed("primary"))
+	ids = append(ids, "denied", "primary")
+
+	var mu sync.Mutex
+	done := 0
+	got, errs := ReplicasAll(context.Background(), fake, ids, 4, func() {
+		mu.Lock()
+		done++
+		mu.Unlock()
+	})
+
+	if done != len(ids) || fake.Calls["DescribeSecret"] != len(ids) {
+		t.Errorf("done = %d, DescribeSecret calls = %d, want %d each", done, fake.Calls["DescribeSecret"], len(ids))
+	}
+	for i, id := range ids {
+		switch id {
+		case "denied":
+			if !errors.Is(errs[i], ErrNotAuthorized) {
+				t.Errorf("%s: err = %v, want %v", id, errs[i], ErrNotAuthorized)
+			}
+		case "primary":
+			if errs[i] != nil || !reflect.DeepEqual(got[i].Regions, []string{"eu-west-1"}) {
+				t.Errorf("%s: replication = %+v, %v, want eu-west-1", id, got[i], errs[i])
+			}
+		default:
+			if errs[i] != nil || got[i].Regions != nil {
+				t.Errorf("%s: replication = %+v, %v, want none", id, got[i], errs[i])
+			}
+		}
+	}
+}
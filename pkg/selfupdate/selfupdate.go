@@ -0,0 +1,517 @@
+// Package selfupdate replaces the running binary with the latest release.
+// Releases publish checksums.txt signed with a KMS asymmetric key
+// (checksums.txt.sig, base64), so an archive is only installed if its SHA-256
+// appears in a checksums file whose signature verifies, and only if it is
+// newer than the running version.
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"golang.org/x/mod/semver"
+)
+
+// DefaultReleaseURL is the GitHub API endpoint for the latest release.
+const DefaultReleaseURL = "https://api.github.com/repos/forager365/awskms/releases/latest"
+
+// ReleaseKey is the release signing key's public key as base64 DER, the
+// PublicKey that `aws kms get-public-key` prints. Release builds set it with
+// -ldflags "-X secrets-lister/pkg/selfupdate.ReleaseKey=...", so self-update
+// verifies without --signing-key or --public-key.
+var ReleaseKey = ""
+
+const (
+	checksumsAsset = "checksums.txt"
+	signatureAsset = "checksums.txt.sig"
+	// maxDownload guards against a misbehaving endpoint filling memory
+	maxDownload = 256 << 20
+)
+
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Version is the tag without its leading "v", as used in archive names.
+func (r Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+func (r Release) Asset(name string) (Asset, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("release %s has no asset %s", r.Tag, name)
+}
+
+func Latest(ctx context.Context, client *http.Client, url string) (Release, error) {
+	var release Release
+	data, err := Download(ctx, client, url)
+	if err != nil {
+		return release, err
+	}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return release, fmt.Errorf("parsing release from %s: %w", url, err)
+	}
+	if release.Tag == "" {
+		return release, fmt.Errorf("no release tag in response from %s", url)
+	}
+	return release, nil
+}
+
+func Download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if len(data) > maxDownload {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxDownload)
+	}
+	return data, nil
+}
+
+// ArchiveName matches the goreleaser archive name_template for this platform.
+func ArchiveName(tool, version string) string {
+	ext := ".tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("%s_%s_%s_%s%s", tool, version, runtime.GOOS, runtime.GOARCH, ext)
+}
+
+// Verifier checks a signature over a message.
+type Verifier interface {
+	Verify(ctx context.Context, message, signature []byte) error
+}
+
+type kmsVerifier struct {
+	client    *kms.Client
+	keyID     string
+	algorithm types.SigningAlgorithmSpec
+}
+
+// KMSVerifier verifies with kms:Verify, so the caller needs that permission
+// on the signing key but no local copy of it.
+func KMSVerifier(client *kms.Client, keyID, algorithm string) Verifier {
+	return &kmsVerifier{client: client, keyID: keyID, algorithm: types.SigningAlgorithmSpec(algorithm)}
+}
+
+func (v *kmsVerifier) Verify(ctx context.Context, message, signature []byte) error {
+	output, err := v.client.Verify(ctx, &kms.VerifyInput{
+		KeyId:            aws.String(v.keyID),
+		Message:          message,
+		MessageType:      types.MessageTypeRaw,
+		Signature:        signature,
+		SigningAlgorithm: v.algorithm,
+	})
+	if err != nil {
+		var invalid *types.KMSInvalidSignatureException
+		if errors.As(err, &invalid) {
+			return errors.New("signature does not match")
+		}
+		return fmt.Errorf("kms:Verify failed: %w", err)
+	}
+	if !output.SignatureValid {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+type publicKeyVerifier struct {
+	key crypto.PublicKey
+}
+
+// PublicKeyVerifier verifies offline against a PEM public key, e.g. the output
+// of `aws kms get-public-key`. ECDSA keys expect ECDSA_SHA_256 signatures and
+// RSA keys RSASSA_PKCS1_V1_5_SHA_256.
+func PublicKeyVerifier(pemData []byte) (Verifier, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM block in public key")
+	}
+	return derVerifier(block.Bytes)
+}
+
+// ReleaseKeyVerifier verifies against the ReleaseKey built into the binary.
+func ReleaseKeyVerifier() (Verifier, error) {
+	der, err := base64.StdEncoding.DecodeString(ReleaseKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding the built-in release key: %w", err)
+	}
+	return derVerifier(der)
+}
+
+func derVerifier(der []byte) (Verifier, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return &publicKeyVerifier{key: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", key)
+}
+
+func (v *publicKeyVerifier) Verify(ctx context.Context, message, signature []byte) error {
+	digest := sha256.Sum256(message)
+	switch key := v.key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return errors.New("signature does not match")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("signature does not match")
+		}
+	}
+	return nil
+}
+
+// VerifiedChecksums downloads checksums.txt and its signature and returns the
+// checksums only if the signature verifies.
+func VerifiedChecksums(ctx context.Context, client *http.Client, release Release, verifier Verifier) ([]byte, error) {
+	checksums, err := downloadAsset(ctx, client, release, checksumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := downloadAsset(ctx, client, release, signatureAsset)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", signatureAsset, err)
+	}
+
+	if err := verifier.Verify(ctx, checksums, signature); err != nil {
+		return nil, fmt.Errorf("%s: %w", checksumsAsset, err)
+	}
+	return checksums, nil
+}
+
+// DownloadVerified downloads an asset and checks it against the checksums.
+func DownloadVerified(ctx context.Context, client *http.Client, release Release, name string, checksums []byte) ([]byte, error) {
+	want, err := checksum(checksums, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := downloadAsset(ctx, client, release, name)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("%s checksum mismatch: got %s, want %s", name, got, want)
+	}
+	return data, nil
+}
+
+func downloadAsset(ctx context.Context, client *http.Client, release Release, name string) ([]byte, error) {
+	asset, err := release.Asset(name)
+	if err != nil {
+		return nil, err
+	}
+	return Download(ctx, client, asset.URL)
+}
+
+// checksum finds name in sha256sum-format lines ("<hex>  <name>").
+func checksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s is not listed in %s", name, checksumsAsset)
+}
+
+// ExtractBinary returns the named file from a .tar.gz or .zip archive,
+// wherever it sits in the archive.
+func ExtractBinary(archive []byte, archiveName, binary string) ([]byte, error) {
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	if strings.HasSuffix(archiveName, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != binary {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, maxDownload))
+		}
+		return nil, fmt.Errorf("%s not found in %s", binary, archiveName)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", binary, archiveName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == binary {
+			return io.ReadAll(io.LimitReader(tr, maxDownload))
+		}
+	}
+}
+
+// Replace swaps the running executable for binary. The new file is written
+// next to it and renamed into place; the old one is moved aside first because
+// Windows won't overwrite a running executable.
+func Replace(binary []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".new-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot write next to %s: %w", exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", err
+	}
+
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		// Put the original back so the tool still runs
+		os.Rename(old, exe)
+		return "", err
+	}
+	// Fails on Windows while the old binary is still running; it is removed
+	// on the next update
+	os.Remove(old)
+	return exe, nil
+}
+
+type Options struct {
+	// Tool is the binary and archive name, e.g. kms-keys
+	Tool           string
+	CurrentVersion string
+	ReleaseURL     string
+	Verifier       Verifier
+	// CheckOnly reports whether an update is available without installing it
+	CheckOnly bool
+	// Force reinstalls even if the current version is the latest
+	Force bool
+	// AllowDowngrade installs the latest release even when it is older than
+	// the current version, or the current version is a development build
+	AllowDowngrade bool
+}
+
+// Run checks for a newer release and, unless CheckOnly, installs it.
+func Run(ctx context.Context, client *http.Client, w io.Writer, opts Options) error {
+	release, err := Latest(ctx, client, opts.ReleaseURL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Current version: %s\n", opts.CurrentVersion)
+	fmt.Fprintf(w, "Latest release:  %s\n", release.Tag)
+
+	latest := canonicalVersion(release.Tag)
+	if !semver.IsValid(latest) {
+		return fmt.Errorf("latest release tag %q is not a semantic version", release.Tag)
+	}
+	// A tampered or rolled back release feed must not walk users back to a
+	// version with known problems, even one that is validly signed
+	current := canonicalVersion(opts.CurrentVersion)
+	switch {
+	case !semver.IsValid(current):
+		if opts.CheckOnly {
+			fmt.Fprintf(w, "%s is not a release, so it can't be compared with %s\n", opts.CurrentVersion, release.Tag)
+			return nil
+		}
+		if !opts.AllowDowngrade {
+			return fmt.Errorf("%s is not a release, so %s can't be checked as newer: pass --allow-downgrade to install it anyway", opts.CurrentVersion, release.Tag)
+		}
+	case semver.Compare(latest, current) == 0:
+		if !opts.Force {
+			fmt.Fprintln(w, "Already up to date")
+			return nil
+		}
+	case semver.Compare(latest, current) < 0:
+		if opts.CheckOnly {
+			fmt.Fprintf(w, "Latest release %s is older than %s\n", release.Tag, opts.CurrentVersion)
+			return nil
+		}
+		if !opts.AllowDowngrade {
+			return fmt.Errorf("refusing to downgrade from %s to %s: pass --allow-downgrade to install it anyway", opts.CurrentVersion, release.Tag)
+		}
+	}
+	if opts.CheckOnly {
+		fmt.Fprintf(w, "Update available: run '%s self-update' to install %s\n", opts.Tool, release.Tag)
+		return nil
+	}
+
+	checksums, err := VerifiedChecksums(ctx, client, release, opts.Verifier)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Verified signature on %s\n", checksumsAsset)
+
+	archiveName := ArchiveName(opts.Tool, release.Version())
+	archive, err := DownloadVerified(ctx, client, release, archiveName, checksums)
+	if err != nil {
+		return err
+	}
+	binary, err := ExtractBinary(archive, archiveName, opts.Tool)
+	if err != nil {
+		return err
+	}
+
+	exe, err := Replace(binary)
+	if err != nil {
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+	fmt.Fprintf(w, "Updated %s to %s\n", exe, release.Tag)
+	return nil
+}
+
+// canonicalVersion adds the "v" semver expects; goreleaser stamps versions
+// without it.
+func canonicalVersion(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+// Flags are the self-update command line options, shared by both tools.
+type Flags struct {
+	ReleaseURL       string
+	SigningKey       string
+	SigningAlgorithm string
+	PublicKey        string
+	Check            bool
+	Force            bool
+	AllowDowngrade   bool
+}
+
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.ReleaseURL, "release-url", DefaultReleaseURL, "Release API endpoint returning the latest release and its assets")
+	fs.StringVar(&f.SigningKey, "signing-key", "", "KMS key ID or ARN that signed checksums.txt, verified with kms:Verify")
+	fs.StringVar(&f.SigningAlgorithm, "signing-algorithm", string(types.SigningAlgorithmSpecEcdsaSha256), "Signing algorithm used with --signing-key")
+	fs.StringVar(&f.PublicKey, "public-key", "", "PEM public key of the signing key, to verify offline instead of with kms:Verify")
+	fs.BoolVar(&f.Check, "check", false, "Only report whether a newer release is available")
+	fs.BoolVar(&f.Force, "force", false, "Reinstall even if already on the latest release")
+	fs.BoolVar(&f.AllowDowngrade, "allow-downgrade", false, "Install the latest release even if it is older than this version, or this is a development build")
+}
+
+// Verifier builds the verifier the flags ask for, falling back to the built-in
+// ReleaseKey. Installing always needs one; kmsClient is only called for
+// --signing-key.
+func (f Flags) Verifier(kmsClient func() (*kms.Client, error)) (Verifier, error) {
+	switch {
+	case f.SigningKey != "" && f.PublicKey != "":
+		return nil, errors.New("--signing-key and --public-key are mutually exclusive")
+	case f.PublicKey != "":
+		data, err := os.ReadFile(f.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return PublicKeyVerifier(data)
+	case f.SigningKey != "":
+		client, err := kmsClient()
+		if err != nil {
+			return nil, err
+		}
+		return KMSVerifier(client, f.SigningKey, f.SigningAlgorithm), nil
+	case f.Check:
+		return nil, nil
+	case ReleaseKey != "":
+		return ReleaseKeyVerifier()
+	}
+	return nil, errors.New("refusing to install an unverified release: this build has no release key, so pass --signing-key or --public-key")
+}
+
+func (f Flags) Options(tool, currentVersion string, verifier Verifier) Options {
+	return Options{
+		Tool:           tool,
+		CurrentVersion: currentVersion,
+		ReleaseURL:     f.ReleaseURL,
+		Verifier:       verifier,
+		CheckOnly:      f.Check,
+		Force:          f.Force,
+		AllowDowngrade: f.AllowDowngrade,
+	}
+}
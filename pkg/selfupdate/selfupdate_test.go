@@ -0,0 +1,111 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+func releaseServer(t *testing.T, tag string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Release{Tag: tag})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestRunVersionGate(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		latest  string
+		opts    Options
+		// want is in the output, or the error when wantErr is set
+		want    string
+		wantErr bool
+	}{
+		{name: "newer", current: "1.2.0", latest: "v1.3.0", opts: Options{CheckOnly: true}, want: "Update available"},
+		{name: "newer than a prerelease", current: "v1.3.0-rc.1", latest: "v1.3.0", opts: Options{CheckOnly: true}, want: "Update available"},
+		{name: "same", current: "1.3.0", latest: "v1.3.0", want: "Already up to date"},
+		{name: "older, check", current: "1.10.0", latest: "v1.9.0", opts: Options{CheckOnly: true}, want: "older than"},
+		{name: "older", current: "1.10.0", latest: "v1.9.0", want: "refusing to downgrade", wantErr: true},
+		{name: "older, forced", current: "1.10.0", latest: "v1.9.0", opts: Options{Force: true}, want: "refusing to downgrade", wantErr: true},
+		{name: "development build", current: "dev", latest: "v1.3.0", want: "--allow-downgrade", wantErr: true},
+		{name: "development build, check", current: "dev", latest: "v1.3.0", opts: Options{CheckOnly: true}, want: "can't be compared"},
+		{name: "not a version", current: "1.3.0", latest: "nightly", want: "not a semantic version", wantErr: true},
+		// Past the gate, the release has no checksums to download
+		{name: "older, allowed", current: "1.10.0", latest: "v1.9.0", opts: Options{AllowDowngrade: true}, want: "no asset checksums.txt", wantErr: true},
+		{name: "development build, allowed", current: "dev", latest: "v1.3.0", opts: Options{AllowDowngrade: true}, want: "no asset checksums.txt", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Tool = "kms-keys"
+			opts.CurrentVersion = tc.current
+			opts.ReleaseURL = releaseServer(t, tc.latest)
+
+			var out bytes.Buffer
+			err := Run(context.Background(), http.DefaultClient, &out, opts)
+			switch {
+			case tc.wantErr && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Fatalf("err = %v, want one containing %q", err, tc.want)
+			case !tc.wantErr && err != nil:
+				t.Fatal(err)
+			case !tc.wantErr && !strings.Contains(out.String(), tc.want):
+				t.Errorf("output = %q, want it to contain %q", out.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestReleaseKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved string) { ReleaseKey = saved }(ReleaseKey)
+
+	noKMS := func() (*kms.Client, error) {
+		t.Fatal("kms:Verify used without --signing-key")
+		return nil, nil
+	}
+
+	ReleaseKey = ""
+	if _, err := (Flags{}).Verifier(noKMS); err == nil {
+		t.Fatal("a build without a release key accepted an unverified install")
+	}
+
+	ReleaseKey = base64.StdEncoding.EncodeToString(der)
+	verifier, err := (Flags{}).Verifier(noKMS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("0123abcd  kms-keys_1.3.0_linux_amd64.tar.gz\n")
+	digest := sha256.Sum256(message)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(context.Background(), message, signature); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := verifier.Verify(context.Background(), append(message, 'x'), signature); err == nil {
+		t.Error("signature verified over a changed message")
+	}
+}
@@ -0,0 +1,185 @@
+// Package snapshot records an inventory as a JSON file and reports drift
+// between two snapshots: new and removed resources, state changes, and tag
+// changes.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Item is one inventoried resource. ID must be stable across runs.
+type Item struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Account is set when a snapshot spans several accounts; with Region it
+	// is the scope the item was listed from
+	Account string            `json:"account,omitempty"`
+	Region  string            `json:"region,omitempty"`
+	State   string            `json:"state"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	// TagsUnknown is set when the tags could not be read, so a missing
+	// permission isn't reported as every tag being removed
+	TagsUnknown bool `json:"tags_unknown,omitempty"`
+	// Data is the tool's full record of the resource, which --offline builds
+	// reports from; Diff ignores it
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type Snapshot struct {
+	Kind    string    `json:"kind"`
+	TakenAt time.Time `json:"taken_at"`
+	// Account is the account the inventory was taken in, if known
+	Account string `json:"account,omitempty"`
+	// Scanned lists the scopes whose listing completed, as "region" or
+	// "account/region" (see Scope). Diff only reports an item as added or
+	// removed when both snapshots scanned its scope; it is empty in
+	// snapshots that predate it, which count every scope as scanned.
+	Scanned []string `json:"scanned,omitempty"`
+	Items   []Item   `json:"items"`
+}
+
+const (
+	Added        = "added"
+	Removed      = "removed"
+	StateChanged = "state_changed"
+	TagsChanged  = "tags_changed"
+)
+
+type Change struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+// Scope names the account and region an item was listed from, as Scanned
+// records them.
+func Scope(account, region string) string {
+	if account == "" {
+		return region
+	}
+	return account + "/" + region
+}
+
+// ScopeRegion is the region a scope names.
+func ScopeRegion(scope string) string {
+	if _, region, ok := strings.Cut(scope, "/"); ok {
+		return region
+	}
+	return scope
+}
+
+// Covers reports whether the snapshot's listing of scope completed.
+func (snap Snapshot) Covers(scope string) bool {
+	return len(snap.Scanned) == 0 || slices.Contains(snap.Scanned, scope)
+}
+
+func Write(path string, snap Snapshot) error {
+	sort.Slice(snap.Items, func(i, j int) bool { return snap.Items[i].ID < snap.Items[j].ID })
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func Read(path string) (Snapshot, error) {
+	var snap Snapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("parsing snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// ReadOffline reads a snapshot of kind for --offline, which needs every
+// item's Data.
+func ReadOffline(path, kind string) (Snapshot, error) {
+	snap, err := Read(path)
+	if err != nil {
+		return snap, err
+	}
+	if snap.Kind != kind {
+		return snap, fmt.Errorf("%s is a %s snapshot, not %s", path, snap.Kind, kind)
+	}
+	for _, item := range snap.Items {
+		if item.Data == nil {
+			return snap, fmt.Errorf("%s predates --offline and has no resource details; take a new snapshot with --snapshot", path)
+		}
+	}
+	return snap, nil
+}
+
+// Diff reports what changed from before to after, ordered by ID. An item
+// that only one side has is added or removed only when the other side
+// scanned its scope, so a region that failed to list, or was left out, is not
+// reported as drift.
+func Diff(before, after Snapshot) ([]Change, error) {
+	if before.Kind != "" && after.Kind != "" && before.Kind != after.Kind {
+		return nil, fmt.Errorf("cannot compare a %s snapshot with a %s snapshot", before.Kind, after.Kind)
+	}
+
+	old := make(map[string]Item)
+	for _, item := range before.Items {
+		old[item.ID] = item
+	}
+
+	var changes []Change
+	seen := make(map[string]bool)
+	for _, item := range after.Items {
+		seen[item.ID] = true
+		prev, ok := old[item.ID]
+		if !ok {
+			if !before.Covers(Scope(item.Account, item.Region)) {
+				continue
+			}
+			changes = append(changes, Change{Type: Added, ID: item.ID, Name: item.Name, Details: item.State})
+			continue
+		}
+		if prev.State != item.State {
+			changes = append(changes, Change{Type: StateChanged, ID: item.ID, Name: item.Name, Details: prev.State + " -> " + item.State})
+		}
+		if prev.TagsUnknown || item.TagsUnknown {
+			continue
+		}
+		if details := tagChanges(prev.Tags, item.Tags); details != "" {
+			changes = append(changes, Change{Type: TagsChanged, ID: item.ID, Name: item.Name, Details: details})
+		}
+	}
+	for _, item := range before.Items {
+		if !seen[item.ID] && after.Covers(Scope(item.Account, item.Region)) {
+			changes = append(changes, Change{Type: Removed, ID: item.ID, Name: item.Name, Details: item.State})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes, nil
+}
+
+func tagChanges(before, after map[string]string) string {
+	var parts []string
+	for key, value := range after {
+		if prev, ok := before[key]; !ok {
+			parts = append(parts, fmt.Sprintf("+%s=%s", key, value))
+		} else if prev != value {
+			parts = append(parts, fmt.Sprintf("~%s=%s->%s", key, prev, value))
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			parts = append(parts, fmt.Sprintf("-%s=%s", key, value))
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i][1:] < parts[j][1:] })
+	return strings.Join(parts, ", ")
+}
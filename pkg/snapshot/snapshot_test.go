@@ -0,0 +1,78 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	key := func(id, region, state string) Item {
+		return Item{ID: id, Region: region, State: state}
+	}
+
+	tests := []struct {
+		name   string
+		before Snapshot
+		after  Snapshot
+		want   []Change
+	}{
+		{
+			name:   "no change",
+			before: Snapshot{Items: []Item{key("a", "us-east-1", "Enabled")}},
+			after:  Snapshot{Items: []Item{key("a", "us-east-1", "Enabled")}},
+		},
+		{
+			name:   "added, removed, and state changed",
+			before: Snapshot{Items: []Item{key("a", "us-east-1", "Enabled"), key("b", "us-east-1", "Enabled")}},
+			after:  Snapshot{Items: []Item{key("b", "us-east-1", "Disabled"), key("c", "us-east-1", "Enabled")}},
+			want: []Change{
+				{Type: Removed, ID: "a", Details: "Enabled"},
+				{Type: StateChanged, ID: "b", Details: "Enabled -> Disabled"},
+				{Type: Added, ID: "c", Details: "Enabled"},
+			},
+		},
+		{
+			name:   "region that failed to list is not removed",
+			before: Snapshot{Scanned: []string{"us-east-1", "eu-west-1"}, Items: []Item{key("a", "us-east-1", "Enabled"), key("b", "eu-west-1", "Enabled")}},
+			after:  Snapshot{Scanned: []string{"us-east-1"}, Items: []Item{key("a", "us-east-1", "Enabled")}},
+		},
+		{
+			name:   "region the previous run missed is not added",
+			before: Snapshot{Scanned: []string{"us-east-1"}, Items: []Item{key("a", "us-east-1", "Enabled")}},
+			after:  Snapshot{Scanned: []string{"us-east-1", "eu-west-1"}, Items: []Item{key("a", "us-east-1", "Enabled"), key("b", "eu-west-1", "Enabled")}},
+		},
+		{
+			name:   "account that failed is not removed",
+			before: Snapshot{Scanned: []string{"111/us-east-1", "222/us-east-1"}, Items: []Item{{ID: "111/a", Account: "111", Region: "us-east-1"}, {ID: "222/a", Account: "222", Region: "us-east-1"}}},
+			after:  Snapshot{Scanned: []string{"111/us-east-1"}, Items: []Item{{ID: "111/a", Account: "111", Region: "us-east-1"}}},
+		},
+		{
+			name:   "tags unknown are not re-tagged",
+			before: Snapshot{Items: []Item{{ID: "a", Tags: map[string]string{"Owner": "x"}}}},
+			after:  Snapshot{Items: []Item{{ID: "a", TagsUnknown: true}}},
+		},
+		{
+			name:   "tags changed",
+			before: Snapshot{Items: []Item{{ID: "a", Tags: map[string]string{"Owner": "x", "Team": "y"}}}},
+			after:  Snapshot{Items: []Item{{ID: "a", Tags: map[string]string{"Owner": "z", "Env": "prod"}}}},
+			want:   []Change{{Type: TagsChanged, ID: "a", Details: "+Env=prod, ~Owner=x->z, -Team=y"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Diff(tc.before, tc.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Diff = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiffKindMismatch(t *testing.T) {
+	if _, err := Diff(Snapshot{Kind: "kms-keys"}, Snapshot{Kind: "secrets"}); err == nil {
+		t.Error("Diff of a kms-keys and a secrets snapshot succeeded")
+	}
+}
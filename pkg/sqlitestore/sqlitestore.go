@@ -0,0 +1,407 @@
+// Package sqlitestore appends inventories to a SQLite database for offline
+// querying. Each run is a row in scans, and every other table carries the
+// run's scan_id and scanned_at, so a database built up over weeks can answer
+// both "what does the account look like now" and "when did this change".
+// Nothing is ever updated or deleted.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	// Pure Go driver, so the tools stay cgo-free and cross-compile
+	_ "modernc.org/sqlite"
+)
+
+// schemaVersion is stored in PRAGMA user_version; bump it, change schema,
+// and add the statements that bring the previous version up to it to
+// migrations when a table changes.
+const schemaVersion = 2
+
+// migrations[i] upgrades a database at version i+1 to version i+2. A new
+// database is created from schema at the current version and skips them.
+var migrations = [][]string{
+	// 2: the KMS key each secret is encrypted with
+	{
+		`ALTER TABLE secrets ADD COLUMN kms_key_id TEXT`,
+		`CREATE INDEX IF NOT EXISTS secrets_kms_key ON secrets (kms_key_id, scan_id)`,
+	},
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS scans (
+		scan_id    INTEGER PRIMARY KEY AUTOINCREMENT,
+		scanned_at TEXT NOT NULL,
+		tool       TEXT NOT NULL,
+		account    TEXT,
+		regions    TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS keys (
+		scan_id              INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at           TEXT NOT NULL,
+		region               TEXT NOT NULL,
+		key_id               TEXT NOT NULL,
+		status               TEXT,
+		key_type             TEXT,
+		key_manager          TEXT,
+		aws_service          TEXT,
+		origin               TEXT,
+		multi_region         TEXT,
+		primary_region       TEXT,
+		creation_date        TEXT,
+		rotation_status      TEXT,
+		rotation_period_days INTEGER,
+		deletion_date        TEXT,
+		monthly_cost_usd     REAL,
+		error_reason         TEXT,
+		PRIMARY KEY (scan_id, region, key_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS key_aliases (
+		scan_id    INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at TEXT NOT NULL,
+		region     TEXT NOT NULL,
+		key_id     TEXT NOT NULL,
+		alias      TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS key_tags (
+		scan_id    INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at TEXT NOT NULL,
+		region     TEXT NOT NULL,
+		key_id     TEXT NOT NULL,
+		tag_key    TEXT NOT NULL,
+		tag_value  TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS key_grants (
+		scan_id            INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at         TEXT NOT NULL,
+		region             TEXT NOT NULL,
+		key_id             TEXT NOT NULL,
+		grant_id           TEXT NOT NULL,
+		grant_name         TEXT,
+		grantee_principal  TEXT,
+		retiring_principal TEXT,
+		issuing_account    TEXT,
+		operations         TEXT,
+		creation_date      TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS secrets (
+		scan_id                INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at             TEXT NOT NULL,
+		region                 TEXT NOT NULL,
+		name                   TEXT NOT NULL,
+		description            TEXT,
+		created_date           TEXT,
+		last_accessed_date     TEXT,
+		deleted_date           TEXT,
+		owning_service         TEXT,
+		rotation_enabled       INTEGER,
+		rotation_lambda_arn    TEXT,
+		rotation_interval_days INTEGER,
+		rotation_schedule      TEXT,
+		last_rotated_date      TEXT,
+		next_rotation_date     TEXT,
+		primary_region         TEXT,
+		kms_key_id             TEXT,
+		PRIMARY KEY (scan_id, region, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS secret_tags (
+		scan_id    INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at TEXT NOT NULL,
+		region     TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		tag_key    TEXT NOT NULL,
+		tag_value  TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS secret_replicas (
+		scan_id        INTEGER NOT NULL REFERENCES scans(scan_id),
+		scanned_at     TEXT NOT NULL,
+		region         TEXT NOT NULL,
+		name           TEXT NOT NULL,
+		replica_region TEXT NOT NULL,
+		status         TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS key_aliases_key ON key_aliases (key_id, scan_id)`,
+	`CREATE INDEX IF NOT EXISTS key_tags_key ON key_tags (key_id, scan_id)`,
+	`CREATE INDEX IF NOT EXISTS key_grants_key ON key_grants (key_id, scan_id)`,
+	`CREATE INDEX IF NOT EXISTS secret_tags_name ON secret_tags (name, scan_id)`,
+	`CREATE INDEX IF NOT EXISTS secret_replicas_name ON secret_replicas (name, scan_id)`,
+	`CREATE INDEX IF NOT EXISTS secrets_kms_key ON secrets (kms_key_id, scan_id)`,
+}
+
+type Key struct {
+	Region             string
+	KeyID              string
+	Status             string
+	KeyType            string
+	KeyManager         string
+	AWSService         string
+	Origin             string
+	MultiRegion        string
+	PrimaryRegion      string
+	CreationDate       time.Time
+	RotationStatus     string
+	RotationPeriodDays int32
+	DeletionDate       *time.Time
+	MonthlyCost        *float64
+	ErrorReason        string
+	Aliases            []string
+	Tags               map[string]string
+}
+
+type Grant struct {
+	Region            string
+	KeyID             string
+	GrantID           string
+	GrantName         string
+	GranteePrincipal  string
+	RetiringPrincipal string
+	IssuingAccount    string
+	Operations        []string
+	CreationDate      time.Time
+}
+
+// Secret dates are YYYY-MM-DD, the precision the inventory keeps them at.
+type Secret struct {
+	Region               string
+	Name                 string
+	Description          *string
+	CreatedDate          *string
+	LastAccessedDate     *string
+	DeletedDate          *string
+	OwningService        *string
+	RotationEnabled      *bool
+	RotationLambdaARN    *string
+	RotationIntervalDays *int64
+	RotationSchedule     *string
+	LastRotatedDate      *string
+	NextRotationDate     *string
+	PrimaryRegion        *string
+	// KMSKeyID is the key ID or ARN the secret names; nil for the default
+	// aws/secretsmanager key
+	KMSKeyID *string
+	Tags     map[string]string
+	// ReplicationStatus maps each replica region to its status
+	ReplicationStatus map[string]string
+}
+
+// Scan is one run's inventory.
+type Scan struct {
+	Tool    string
+	Account string
+	Regions []string
+	// ScannedAt defaults to now
+	ScannedAt time.Time
+	Keys      []Key
+	Grants    []Grant
+	Secrets   []Secret
+}
+
+// Append creates the database at path if needed and adds scan to it in one
+// transaction, returning its scan_id.
+func Append(ctx context.Context, path string, scan Scan) (int64, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if err := migrate(ctx, db); err != nil {
+		return 0, fmt.Errorf("preparing %s: %w", path, err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if scan.ScannedAt.IsZero() {
+		scan.ScannedAt = time.Now()
+	}
+	w := &writer{ctx: ctx, tx: tx, scannedAt: timestamp(scan.ScannedAt)}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO scans (scanned_at, tool, account, regions) VALUES (?, ?, ?, ?)`,
+		w.scannedAt, scan.Tool, text(scan.Account), strings.Join(scan.Regions, ","))
+	if err != nil {
+		return 0, fmt.Errorf("recording scan: %w", err)
+	}
+	if w.scanID, err = result.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	for _, key := range scan.Keys {
+		if err := w.key(key); err != nil {
+			return 0, fmt.Errorf("writing key %s: %w", key.KeyID, err)
+		}
+	}
+	for _, grant := range scan.Grants {
+		if err := w.grant(grant); err != nil {
+			return 0, fmt.Errorf("writing grant %s: %w", grant.GrantID, err)
+		}
+	}
+	for _, secret := range scan.Secrets {
+		if err := w.secret(secret); err != nil {
+			return 0, fmt.Errorf("writing secret %s: %w", secret.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return w.scanID, nil
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("database schema version %d is newer than this tool supports (%d)", version, schemaVersion)
+	}
+	if version == schemaVersion {
+		return nil
+	}
+
+	statements := schema
+	if version > 0 {
+		statements = nil
+		for _, migration := range migrations[version-1:] {
+			statements = append(statements, migration...)
+		}
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migrating from schema version %d: %w", version, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, schemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type writer struct {
+	ctx       context.Context
+	tx        *sql.Tx
+	scanID    int64
+	scannedAt string
+}
+
+func (w *writer) exec(query string, args ...any) error {
+	_, err := w.tx.ExecContext(w.ctx, query, append([]any{w.scanID, w.scannedAt}, args...)...)
+	return err
+}
+
+func (w *writer) key(key Key) error {
+	var deletion any
+	if key.DeletionDate != nil {
+		deletion = timestamp(*key.DeletionDate)
+	}
+	var cost any
+	if key.MonthlyCost != nil {
+		cost = *key.MonthlyCost
+	}
+	err := w.exec(`INSERT INTO keys (scan_id, scanned_at, region, key_id, status, key_type, key_manager, aws_service, origin,
+		multi_region, primary_region, creation_date, rotation_status, rotation_period_days, deletion_date, monthly_cost_usd, error_reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.Region, key.KeyID, text(key.Status), text(key.KeyType), text(key.KeyManager), text(key.AWSService), text(key.Origin),
+		text(key.MultiRegion), text(key.PrimaryRegion), date(key.CreationDate), text(key.RotationStatus), integer(int64(key.RotationPeriodDays)),
+		deletion, cost, text(key.ErrorReason))
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range key.Aliases {
+		if err := w.exec(`INSERT INTO key_aliases (scan_id, scanned_at, region, key_id, alias) VALUES (?, ?, ?, ?, ?)`,
+			key.Region, key.KeyID, alias); err != nil {
+			return err
+		}
+	}
+	for _, tagKey := range sortedKeys(key.Tags) {
+		if err := w.exec(`INSERT INTO key_tags (scan_id, scanned_at, region, key_id, tag_key, tag_value) VALUES (?, ?, ?, ?, ?, ?)`,
+			key.Region, key.KeyID, tagKey, key.Tags[tagKey]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *writer) grant(grant Grant) error {
+	return w.exec(`INSERT INTO key_grants (scan_id, scanned_at, region, key_id, grant_id, grant_name, grantee_principal,
+		retiring_principal, issuing_account, operations, creation_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		grant.Region, grant.KeyID, grant.GrantID, text(grant.GrantName), text(grant.GranteePrincipal),
+		text(grant.RetiringPrincipal), text(grant.IssuingAccount), strings.Join(grant.Operations, ","), date(grant.CreationDate))
+}
+
+func (w *writer) secret(secret Secret) error {
+	err := w.exec(`INSERT INTO secrets (scan_id, scanned_at, region, name, description, created_date, last_accessed_date,
+		deleted_date, owning_service, rotation_enabled, rotation_lambda_arn, rotation_interval_days, rotation_schedule,
+		last_rotated_date, next_rotation_date, primary_region, kms_key_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		secret.Region, secret.Name, secret.Description, secret.CreatedDate, secret.LastAccessedDate,
+		secret.DeletedDate, secret.OwningService, secret.RotationEnabled, secret.RotationLambdaARN, secret.RotationIntervalDays,
+		secret.RotationSchedule, secret.LastRotatedDate, secret.NextRotationDate, secret.PrimaryRegion, secret.KMSKeyID)
+	if err != nil {
+		return err
+	}
+
+	for _, tagKey := range sortedKeys(secret.Tags) {
+		if err := w.exec(`INSERT INTO secret_tags (scan_id, scanned_at, region, name, tag_key, tag_value) VALUES (?, ?, ?, ?, ?, ?)`,
+			secret.Region, secret.Name, tagKey, secret.Tags[tagKey]); err != nil {
+			return err
+		}
+	}
+	for _, replica := range sortedKeys(secret.ReplicationStatus) {
+		if err := w.exec(`INSERT INTO secret_replicas (scan_id, scanned_at, region, name, replica_region, status) VALUES (?, ?, ?, ?, ?, ?)`,
+			secret.Region, secret.Name, replica, text(secret.ReplicationStatus[replica])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Timestamps are stored as UTC RFC 3339 text, which sorts correctly and which
+// SQLite's date and time functions read.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func date(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamp(t)
+}
+
+// text stores empty strings as NULL, so "not set" reads the same everywhere.
+func text(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func integer(n int64) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,88 @@
+// Package tagindex finds tagged KMS keys and secrets with the Resource Groups
+// Tagging API, which filters by tag server-side and returns each match with
+// its tags, a page of up to 100 per call. A tag-scoped scan can then describe
+// only the matches instead of listing every resource and reading each one's
+// tags. The index is eventually consistent, so a tag changed in the last
+// minute or so may not be reflected yet, and it only ever returns resources
+// that have tags.
+package tagindex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"secrets-lister/pkg/tagpolicy"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	rgt "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+)
+
+// Resource types, as the tagging API names them.
+const (
+	KMSKey = "kms:key"
+	Secret = "secretsmanager:secret"
+)
+
+// API is the tagging API call Find makes. *resourcegroupstaggingapi.Client
+// satisfies it.
+type API interface {
+	GetResources(ctx context.Context, params *rgt.GetResourcesInput, optFns ...func(*rgt.Options)) (*rgt.GetResourcesOutput, error)
+}
+
+type Resource struct {
+	ARN  string
+	Tags map[string]string
+}
+
+// Find returns the resources of resourceType in the client's region matching
+// every filter, sorted by ARN. Filters are ANDed, like tagpolicy.Match, which
+// is applied to the results as well so the two paths agree exactly.
+func Find(ctx context.Context, client API, resourceType string, filters []tagpolicy.Filter) ([]Resource, error) {
+	input := &rgt.GetResourcesInput{ResourceTypeFilters: []string{resourceType}}
+	for _, filter := range filters {
+		tagFilter := types.TagFilter{Key: aws.String(filter.Key)}
+		if filter.HasValue {
+			tagFilter.Values = []string{filter.Value}
+		}
+		input.TagFilters = append(input.TagFilters, tagFilter)
+	}
+
+	var resources []Resource
+	paginator := rgt.NewGetResourcesPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("querying the tagging API for %s: %w", resourceType, err)
+		}
+		for _, mapping := range page.ResourceTagMappingList {
+			resource := Resource{ARN: aws.ToString(mapping.ResourceARN), Tags: make(map[string]string)}
+			for _, tag := range mapping.Tags {
+				resource.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			if tagpolicy.Match(resource.Tags, filters) {
+				resources = append(resources, resource)
+			}
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].ARN < resources[j].ARN })
+	return resources, nil
+}
+
+// KeyTags indexes KMS key resources by key ID.
+func KeyTags(resources []Resource) map[string]map[string]string {
+	tags := make(map[string]map[string]string, len(resources))
+	for _, resource := range resources {
+		parsed, err := arn.Parse(resource.ARN)
+		if err != nil {
+			continue
+		}
+		if keyID, ok := strings.CutPrefix(parsed.Resource, "key/"); ok {
+			tags[keyID] = resource.Tags
+		}
+	}
+	return tags
+}
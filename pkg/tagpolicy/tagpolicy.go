@@ -0,0 +1,68 @@
+// Package tagpolicy implements tag filtering and required-tag validation shared by
+// the KMS and Secrets Manager listers.
+package tagpolicy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Filter matches resources that have Key, and Value too when HasValue is set.
+type Filter struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// ParseFilters parses Key=Value (or bare Key) expressions from --filter-tag.
+func ParseFilters(exprs []string) ([]Filter, error) {
+	var filters []Filter
+	for _, expr := range exprs {
+		key, value, hasValue := strings.Cut(expr, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag filter %q (use Key=Value or Key)", expr)
+		}
+		filters = append(filters, Filter{
+			Key:      key,
+			Value:    strings.TrimSpace(value),
+			HasValue: hasValue,
+		})
+	}
+	return filters, nil
+}
+
+// Match reports whether tags satisfy every filter.
+func Match(tags map[string]string, filters []Filter) bool {
+	for _, f := range filters {
+		value, ok := tags[f.Key]
+		if !ok || (f.HasValue && value != f.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRequired splits a comma-separated --required-tags list.
+func ParseRequired(list string) []string {
+	var required []string
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			required = append(required, key)
+		}
+	}
+	return required
+}
+
+// Missing returns the required keys absent (or empty) in tags, sorted.
+func Missing(tags map[string]string, required []string) []string {
+	var missing []string
+	for _, key := range required {
+		if tags[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,163 @@
+// Package telemetry reports anonymous usage for users who opt in: which
+// command ran, how long it took, how it exited, and how many AWS errors of each
+// class it hit. Nothing identifying an account, caller, region, key, or secret
+// is sent, and nothing is sent at all unless telemetry is turned on.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"secrets-lister/pkg/awserr"
+	"secrets-lister/pkg/version"
+)
+
+const (
+	// EnvVar set to "on" or "off" overrides --telemetry, so a fleet can be
+	// opted in (or out) without changing every invocation
+	EnvVar         = "AWSKMS_TELEMETRY"
+	EndpointEnvVar = "AWSKMS_TELEMETRY_ENDPOINT"
+
+	sendTimeout = 2 * time.Second
+)
+
+type Options struct {
+	Mode     string
+	Endpoint string
+}
+
+func Defaults() Options {
+	return Options{Mode: "off"}
+}
+
+// RegisterFlags adds the telemetry flags to fs, with o's values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Mode, "telemetry", o.Mode, "Send anonymous usage (command, duration, exit code, error classes): on or off (env "+EnvVar+" overrides)")
+	fs.StringVar(&o.Endpoint, "telemetry-endpoint", o.Endpoint, "URL usage events are POSTed to (env "+EndpointEnvVar+" overrides)")
+}
+
+// Enabled reports whether the user opted in. DO_NOT_TRACK turns telemetry off
+// whatever else is set.
+func (o Options) Enabled() bool {
+	if os.Getenv("DO_NOT_TRACK") != "" && os.Getenv("DO_NOT_TRACK") != "0" {
+		return false
+	}
+	mode := o.Mode
+	if env := os.Getenv(EnvVar); env != "" {
+		mode = env
+	}
+	switch strings.ToLower(mode) {
+	case "on", "true", "1":
+		return true
+	}
+	return false
+}
+
+func (o Options) endpoint() string {
+	if env := os.Getenv(EndpointEnvVar); env != "" {
+		return env
+	}
+	return o.Endpoint
+}
+
+// Event is everything one run reports.
+type Event struct {
+	Tool         string         `json:"tool"`
+	Command      string         `json:"command"`
+	Version      string         `json:"version"`
+	Platform     string         `json:"platform"`
+	DurationMS   int64          `json:"duration_ms"`
+	ExitCode     int            `json:"exit_code"`
+	ErrorClasses map[string]int `json:"error_classes,omitempty"`
+}
+
+// Recorder collects one run's event. Options are read when the run finishes,
+// so a recorder can be started before the command's flags are parsed.
+type Recorder struct {
+	opts    *Options
+	started time.Time
+
+	mu     sync.Mutex
+	event  Event
+	closed bool
+}
+
+func Start(opts *Options, tool, command string) *Recorder {
+	info := version.Get()
+	return &Recorder{
+		opts:    opts,
+		started: time.Now(),
+		event: Event{
+			Tool:         tool,
+			Command:      command,
+			Version:      info.Version,
+			Platform:     info.Platform,
+			ErrorClasses: make(map[string]int),
+		},
+	}
+}
+
+// Error counts err by its class. Only the class is kept, never the message.
+func (r *Recorder) Error(err error) {
+	if err != nil {
+		r.Class(awserr.Classify(err))
+	}
+}
+
+func (r *Recorder) Class(class awserr.Class) {
+	if r == nil || class == "" {
+		return
+	}
+	r.mu.Lock()
+	r.event.ErrorClasses[string(class)]++
+	r.mu.Unlock()
+}
+
+// Finish sends the event if the user opted in. It is best effort: failures are
+// ignored and the send gives up after a couple of seconds, so telemetry can't
+// slow down or fail a run. Only the first call sends.
+func (r *Recorder) Finish(exitCode int) {
+	if r == nil || r.opts == nil || !r.opts.Enabled() {
+		return
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	r.event.ExitCode = exitCode
+	r.event.DurationMS = time.Since(r.started).Milliseconds()
+	body, err := json.Marshal(r.event)
+	r.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	endpoint := r.opts.endpoint()
+	if endpoint == "" {
+		fmt.Fprintf(os.Stderr, "Warning: telemetry is on but no endpoint is set (--telemetry-endpoint or %s)\n", EndpointEnvVar)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
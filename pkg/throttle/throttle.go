@@ -0,0 +1,183 @@
+// Package throttle keeps large scans inside AWS API rate limits: a retryer
+// with tunable exponential backoff for throttled and transient failures, a
+// client-side token bucket that paces every request the process sends, and
+// Retry for the few APIs whose quotas outlast the retryer.
+package throttle
+
+import (
+	"context"
+	"flag"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"secrets-lister/pkg/awserr"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+type Options struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxBackoff  time.Duration
+	// Jitter is the fraction of each delay that is randomized: 0 waits the
+	// exact exponential delay, 1 waits anywhere between zero and it
+	Jitter float64
+	// RPS caps requests per second across all clients (0 means no limit)
+	RPS float64
+}
+
+func Defaults() Options {
+	return Options{
+		MaxAttempts: 10,
+		BaseDelay:   200 * time.Millisecond,
+		MaxBackoff:  20 * time.Second,
+		Jitter:      1,
+	}
+}
+
+// RegisterFlags adds the retry and rate limit flags to fs, with o's values as
+// defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.MaxAttempts, "retry-max-attempts", o.MaxAttempts, "Attempts per API call before giving up on throttling or transient errors")
+	fs.DurationVar(&o.BaseDelay, "retry-base-delay", o.BaseDelay, "Delay before the first retry; doubles on each attempt")
+	fs.DurationVar(&o.MaxBackoff, "retry-max-backoff", o.MaxBackoff, "Longest delay between retries")
+	fs.Float64Var(&o.Jitter, "retry-jitter", o.Jitter, "Fraction of each retry delay that is randomized (0-1)")
+	fs.Float64Var(&o.RPS, "rps", o.RPS, "Maximum AWS API requests per second across all services and regions (0 for no limit)")
+}
+
+// Retryer returns a standard SDK retryer using o's backoff. The SDK's retry
+// quota is disabled: it exists to fail fast during outages, which would abort
+// a long scan after a burst of throttling instead of waiting it out.
+func (o Options) Retryer() func() aws.Retryer {
+	return func() aws.Retryer {
+		return retry.NewStandard(func(so *retry.StandardOptions) {
+			so.MaxAttempts = o.MaxAttempts
+			so.MaxBackoff = o.MaxBackoff
+			so.Backoff = backoff{base: o.BaseDelay, max: o.MaxBackoff, jitter: o.Jitter}
+			so.RateLimiter = ratelimit.None
+		})
+	}
+}
+
+type backoff struct {
+	base, max time.Duration
+	jitter    float64
+}
+
+func (b backoff) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	delay := float64(b.base) * math.Pow(2, float64(attempt-1))
+	if delay > float64(b.max) {
+		delay = float64(b.max)
+	}
+	jitter := math.Min(math.Max(b.jitter, 0), 1)
+	return time.Duration(delay * (1 - jitter*rand.Float64())), nil
+}
+
+// Retry calls fn until it succeeds, fails with an error that isn't throttling
+// or transient, or has been tried attempts times, backing off from base
+// between tries. It is for APIs whose quota is far below what the SDK's own
+// retries wait out, such as CloudTrail LookupEvents at two calls a second.
+func Retry(ctx context.Context, attempts int, base time.Duration, fn func() error) error {
+	delays := backoff{base: base, max: 30 * time.Second, jitter: 0.5}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		if class := awserr.Classify(err); class != awserr.Throttled && class != awserr.Transient {
+			return err
+		}
+		delay, _ := delays.BackoffDelay(attempt, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+var (
+	shared     *Limiter
+	sharedOnce sync.Once
+)
+
+// Shared returns the process-wide limiter for o.RPS, built on first use, or
+// nil if there is no limit. Every config shares it, so --rps caps the whole
+// process however many accounts or commands load a config; later calls
+// return the same limiter whatever options they pass.
+func (o Options) Shared() *Limiter {
+	sharedOnce.Do(func() {
+		if o.RPS > 0 {
+			shared = NewLimiter(o.RPS)
+		}
+	})
+	return shared
+}
+
+// Limit paces client's requests with limiter, or returns client unchanged if
+// limiter is nil. Retries count against the limit too.
+func Limit(client aws.HTTPClient, limiter *Limiter) aws.HTTPClient {
+	if limiter == nil {
+		return client
+	}
+	return &limitedClient{client: client, limiter: limiter}
+}
+
+type limitedClient struct {
+	client  aws.HTTPClient
+	limiter *Limiter
+}
+
+func (c *limitedClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// Limiter is a token bucket refilled at rps tokens a second, holding at most
+// one second's worth so an idle period can't turn into a burst.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rps float64) *Limiter {
+	burst := math.Max(1, rps)
+	return &Limiter{rate: rps, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestSharedLimiterIsBuiltOnce(t *testing.T) {
+	first := Options{RPS: 5}.Shared()
+	if first == nil {
+		t.Fatal("Shared returned nil for --rps 5")
+	}
+	if second := (Options{RPS: 50}).Shared(); second != first {
+		t.Error("a second Shared call built another limiter")
+	}
+
+	a := Limit(http.DefaultClient, first).(*limitedClient)
+	b := Limit(http.DefaultClient, first).(*limitedClient)
+	if a.limiter != b.limiter {
+		t.Error("clients limited by the shared limiter don't share it")
+	}
+}
+
+func TestLimitWithoutLimiter(t *testing.T) {
+	if client := Limit(http.DefaultClient, nil); client != http.DefaultClient {
+		t.Error("Limit wrapped the client without a limiter")
+	}
+}
+
+func TestLimiterPaces(t *testing.T) {
+	limiter := NewLimiter(20)
+	ctx := context.Background()
+	start := time.Now()
+	// The first 20 come from the full bucket; the next 10 take half a second
+	for i := 0; i < 30; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("30 requests at 20 rps took %v, want about 500ms", elapsed)
+	}
+}
+
+func TestLimiterWaitHonoursContext(t *testing.T) {
+	limiter := NewLimiter(1)
+	limiter.Wait(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("Wait returned without a token after the context was canceled")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException"}
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException"}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "first try", errs: []error{nil}, wantCalls: 1},
+		{name: "throttled then through", errs: []error{throttled, throttled, nil}, wantCalls: 3},
+		{name: "throttled every time", errs: []error{throttled, throttled, throttled, throttled}, wantCalls: 3, wantErr: throttled},
+		{name: "denied isn't retried", errs: []error{denied, nil}, wantCalls: 1, wantErr: denied},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			err := Retry(context.Background(), 3, time.Millisecond, func() error {
+				calls++
+				return tc.errs[calls-1]
+			})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("err = %v, want %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	Retry(ctx, 5, time.Hour, func() error {
+		calls++
+		return &smithy.GenericAPIError{Code: "ThrottlingException"}
+	})
+	if calls != 1 {
+		t.Errorf("calls = %d after the context was canceled, want 1", calls)
+	}
+}
@@ -0,0 +1,82 @@
+// Package version reports what build is running. Release builds set Version,
+// Commit, and Date with -ldflags, e.g.
+//
+//	go build -ldflags "-X secrets-lister/pkg/version.Version=v1.4.0 -X secrets-lister/pkg/version.Commit=$(git rev-parse HEAD) -X secrets-lister/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+const sdkModule = "github.com/aws/aws-sdk-go-v2"
+
+type Info struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	Date       string `json:"date,omitempty"`
+	GoVersion  string `json:"go_version"`
+	SDKVersion string `json:"sdk_version,omitempty"`
+	Platform   string `json:"platform"`
+}
+
+// Get fills in anything the build didn't set from the binary's embedded build
+// info, so plain `go build` binaries still report their commit.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, dep := range build.Deps {
+		if dep.Path == sdkModule {
+			info.SDKVersion = dep.Version
+		}
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.Date == "":
+			info.Date = setting.Value
+		}
+	}
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s (%s)", i.Version, valueOrUnknown(i.Commit))
+}
+
+// Print writes the full build report, one field per line.
+func Print(w io.Writer, tool string) {
+	info := Get()
+	fmt.Fprintf(w, "%s %s\n", tool, info.Version)
+	fmt.Fprintf(w, "  Commit:     %s\n", valueOrUnknown(info.Commit))
+	fmt.Fprintf(w, "  Built:      %s\n", valueOrUnknown(info.Date))
+	fmt.Fprintf(w, "  Go:         %s\n", info.GoVersion)
+	fmt.Fprintf(w, "  AWS SDK:    %s\n", valueOrUnknown(info.SDKVersion))
+	fmt.Fprintf(w, "  Platform:   %s\n", info.Platform)
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}